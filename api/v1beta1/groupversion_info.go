@@ -28,9 +28,12 @@ const (
 	Group   = "vertica.com"
 	Version = "v1beta1"
 
-	VerticaDBKind         = "VerticaDB"
-	VerticaAutoscalerKind = "VerticaAutoscaler"
-	EventTriggerKind      = "EventTrigger"
+	VerticaDBKind          = "VerticaDB"
+	VerticaAutoscalerKind  = "VerticaAutoscaler"
+	EventTriggerKind       = "EventTrigger"
+	VerticaBackupKind      = "VerticaBackup"
+	VerticaRestoreKind     = "VerticaRestore"
+	VerticaDBOperationKind = "VerticaDBOperation"
 )
 
 var (
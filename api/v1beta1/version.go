@@ -41,6 +41,9 @@ const (
 	// The minimum version that we can use the option with create DB to skip the
 	// package install.
 	CreateDBSkipPackageInstallVersion = "v12.0.1"
+	// The minimum version that can change the shard count of an existing
+	// database with reshard_database.
+	ReshardMinVersion = "v11.1.0"
 )
 
 // GetVerticaVersionStr returns the vertica version, in string form, that is stored
@@ -0,0 +1,196 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"regexp"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// archiveNameRegexp is the pattern that an archive name must match. The name
+// is used directly in SQL, so we only allow plain identifiers.
+var archiveNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// VerticaBackupSpec defines the desired state of VerticaBackup
+type VerticaBackupSpec struct {
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// The name of the VerticaDB CR that restore points are saved for. The
+	// VerticaDB must be in the same namespace as this CR and must be an Eon
+	// Mode database. The VerticaDB does not own this CR, so deleting the
+	// VerticaDB will leave the backup CR, and the restore points saved in
+	// communal storage, in place.
+	VerticaDBName string `json:"verticaDBName"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Optional
+	// The name of the archive in communal storage that the restore points are
+	// saved to. If omitted, the name of this CR is used with any '-' or '.'
+	// replaced with '_'. The archive is created if it doesn't already exist.
+	ArchiveName string `json:"archiveName,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Optional
+	// A cron expression (e.g. "0 2 * * *") that controls when restore points
+	// are saved. The standard five field format is used, and the schedule is
+	// evaluated in UTC. If omitted, a single restore point is saved when the
+	// CR is created.
+	Schedule string `json:"schedule,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=7
+	// +kubebuilder:validation:Minimum:=1
+	// The number of restore points to keep in the archive. Once the limit is
+	// reached, saving a new restore point removes the oldest one. This is
+	// applied as the limit of the archive, and the archive is altered if it
+	// is changed.
+	Retention int `json:"retention,omitempty"`
+}
+
+// VerticaBackupStatus defines the observed state of VerticaBackup
+type VerticaBackupStatus struct {
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The last time we attempted to save a restore point.
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The last time a restore point was saved successfully.
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The number of restore points that this CR has saved.
+	BackupCount int `json:"backupCount"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The number of attempts to save a restore point that have failed.
+	FailureCount int `json:"failureCount"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// A message describing the outcome of the last attempt. This is empty if
+	// the last attempt was successful.
+	Message string `json:"message,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	// The restore point limit that was last applied to the archive. When this
+	// differs from spec.retention, the archive is altered.
+	ArchiveLimit int `json:"archiveLimit,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The restore points that currently exist in the archive, as of the last
+	// successful save. They are ordered by index, so the most recent one is
+	// first.
+	RestorePoints []RestorePointInfo `json:"restorePoints,omitempty"`
+}
+
+// RestorePointInfo describes a single restore point saved in an archive.
+type RestorePointInfo struct {
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The index of the restore point in the archive. The most recent restore
+	// point has an index of 1.
+	Index int `json:"index"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The unique identifier of the restore point.
+	ID string `json:"id"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The time the restore point was saved, as reported by Vertica.
+	SaveTime string `json:"saveTime"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:categories=all;vertica,shortName=vbk
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="VerticaDB",type="string",JSONPath=".spec.verticaDBName"
+//+kubebuilder:printcolumn:name="Schedule",type="string",JSONPath=".spec.schedule"
+//+kubebuilder:printcolumn:name="Backups",type="integer",JSONPath=".status.backupCount"
+//+kubebuilder:printcolumn:name="Last Success",type="date",JSONPath=".status.lastSuccessfulTime"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// VerticaBackup is the Schema for the verticabackups API
+type VerticaBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VerticaBackupSpec   `json:"spec,omitempty"`
+	Status VerticaBackupStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// VerticaBackupList contains a list of VerticaBackup
+type VerticaBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VerticaBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VerticaBackup{}, &VerticaBackupList{})
+}
+
+func (v *VerticaBackup) ExtractNamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Name:      v.ObjectMeta.Name,
+		Namespace: v.ObjectMeta.Namespace,
+	}
+}
+
+// GetArchiveName returns the name of the archive that restore points are saved to
+func (v *VerticaBackup) GetArchiveName() string {
+	if v.Spec.ArchiveName != "" {
+		return v.Spec.ArchiveName
+	}
+	return strings.NewReplacer("-", "_", ".", "_").Replace(v.Name)
+}
+
+// IsValidArchiveName returns true if the given name can be used as the name of
+// a restore point archive
+func IsValidArchiveName(name string) bool {
+	return archiveNameRegexp.MatchString(name)
+}
+
+// MakeVBKName is a helper that creates a sample name for test purposes
+func MakeVBKName() types.NamespacedName {
+	return types.NamespacedName{Name: "vertica-backup-sample", Namespace: "default"}
+}
+
+// MakeVBK is a helper that constructs a VerticaBackup struct using the sample
+// name. This is intended for test purposes.
+func MakeVBK() *VerticaBackup {
+	nm := MakeVBKName()
+	vdbNm := MakeVDBName()
+	return &VerticaBackup{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: GroupVersion.String(),
+			Kind:       VerticaBackupKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nm.Name,
+			Namespace: nm.Namespace,
+			UID:       "zyxwvu-tsr",
+		},
+		Spec: VerticaBackupSpec{
+			VerticaDBName: vdbNm.Name,
+			Retention:     7,
+		},
+	}
+}
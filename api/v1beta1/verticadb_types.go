@@ -28,6 +28,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -90,8 +91,11 @@ type VerticaDBSpec struct {
 	// +kubebuilder:default:=6
 	// +kubebuilder:validation:Optional
 	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:number"
-	// The number of shards to create in the database. This cannot be updated
-	// once the CRD is created.  Refer to this page to determine an optimal size:
+	// The number of shards to create in the database. Once the database is
+	// created, this can only be changed in Eon Mode with a server version
+	// that supports resharding.  A change causes the operator to call
+	// reshard_database and rebalance the subclusters.  Refer to this page to
+	// determine an optimal size:
 	// https://www.vertica.com/docs/latest/HTML/Content/Authoring/Eon/SizingEonCluster.htm
 	// The default was chosen using this link and the default subcluster size of 3.
 	ShardCount int `json:"shardCount"`
@@ -155,6 +159,51 @@ type VerticaDBSpec struct {
 	// released Vertica versions when upgrading.
 	IgnoreUpgradePath bool `json:"ignoreUpgradePath,omitempty"`
 
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	// An opt-in policy to automatically roll back an image upgrade when the
+	// vertica nodes cannot be restarted with the new image.  A rollback is
+	// only done if the catalog hasn't been upgraded yet.  That is, no vertica
+	// node has come up with the new image.  When a rollback happens, spec.image
+	// is left alone; the pods are run with the image used prior to the upgrade
+	// and status.upgradeState reports the rollback.  Change spec.image to
+	// start a new upgrade.
+	UpgradeRollbackPolicy UpgradeRollbackPolicy `json:"upgradeRollbackPolicy,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	// Settings to upgrade a single secondary subcluster ahead of the other
+	// secondaries during an online upgrade.  The primaries are always
+	// upgraded first.  The upgrade pauses once that canary subcluster is up
+	// with the new image and waits for approval before upgrading the
+	// remaining secondary subclusters.
+	UpgradeCanary UpgradeCanary `json:"upgradeCanary,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	// A list of windows in which the operator is allowed to do disruptive
+	// operations: image upgrades, PVC expansion, resharding, shard
+	// rebalancing requested through a VerticaDBOperation and restarts of
+	// read-only nodes.  If this is empty, those operations are started as
+	// soon as they are needed.  Otherwise, they are deferred until one of the
+	// windows is open; the rest of the reconcile carries on in the meantime.
+	// Nodes without a shard subscription are always rebalanced and down nodes
+	// are always restarted.  An upgrade that has shut down the database is
+	// allowed to finish after its window closes.
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	// Controls how the pods are placed across the topology domains, such as
+	// zones, of the Kubernetes cluster.  When the mode is Zone, the pods of
+	// each subcluster are spread evenly across the topology key.  For an
+	// Enterprise Mode database, the operator also maintains a Vertica fault
+	// group for each domain so that the database knows which nodes can fail
+	// together.  The Zone mode requires the operator to be able to read
+	// nodes, which is granted by the node-reader ClusterRole that is
+	// deployed with the operator.
+	Topology Topology `json:"topology,omitempty"`
+
 	// +kubebuilder:validation:Optional
 	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors={"urn:alm:descriptor:com.tectonic.ui:fieldDependency:initPolicy:Revive","urn:alm:descriptor:com.tectonic.ui:advanced"}
 	// This specifies the order of nodes when doing a revive.  Each entry
@@ -359,6 +408,17 @@ type VerticaDBSpec struct {
 	// here are applied to the default startup probe we create. If this is
 	// omitted, we use the default probe.
 	StartupProbeOverride *corev1.Probe `json:"startupProbeOverride,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	// A map of database configuration parameters that the operator keeps set
+	// in the database. Unlike communal.additionalConfig, these are applied
+	// once the database is up and any change to them is applied to the running
+	// database. The operator reads the parameters back from the database so
+	// that any drift from these values is reported and corrected. Some
+	// parameters don't take effect until the database is restarted. These are
+	// listed in status.configParametersPendingRestart.
+	ConfigParameters map[string]string `json:"configParameters,omitempty"`
 }
 
 // LocalObjectReference is used instead of corev1.LocalObjectReference and behaves the same.
@@ -473,6 +533,13 @@ const (
 	PersistentVolume DepotVolumeType = "PersistentVolume"
 )
 
+type PVCRetentionPolicyType string
+
+const (
+	PVCRetain PVCRetentionPolicyType = "Retain"
+	PVCDelete PVCRetentionPolicyType = "Delete"
+)
+
 // Defines a number of pods for a specific subcluster
 type SubclusterPodCount struct {
 	// +kubebuilder:validation:required
@@ -614,7 +681,10 @@ type LocalStorage struct {
 	// 'PersistentVolume'. This field is used to define the name of the storage
 	// class to use for the PV. This will be set when creating the PVC. By
 	// default, it is not set. This means that that the PVC we create will have
-	// the default storage class set in Kubernetes.
+	// the default storage class set in Kubernetes. This can be changed for a
+	// k-safe Eon Mode database that has more than 3 primary nodes. The
+	// operator will then rebuild the pods, one at a time, so that their PVCs
+	// use the new storage class.
 	StorageClass string `json:"storageClass,omitempty"`
 
 	// +kubebuilder:validation:Optional
@@ -658,6 +728,130 @@ type LocalStorage struct {
 	// first created. For backwards compatibility, if this is omitted, then it
 	// shares the same path as the dataPath.
 	CatalogPath string `json:"catalogPath"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	// If set, the catalog is stored in its own PV rather than in the local
+	// data PV.  The catalogPath must differ from the dataPath and depotPath.
+	// This can only be set when the VerticaDB is created.
+	CatalogPVC *LocalVolumeClaim `json:"catalogPVC,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	// If set, the 'DATA,TEMP' storage location is stored in its own PV rather
+	// than in the local data PV.  The dataPath must differ from the
+	// catalogPath and depotPath.  This can only be set when the VerticaDB is
+	// created.
+	DataPVC *LocalVolumeClaim `json:"dataPVC,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	// If set, the depot is stored in its own PV rather than in the local data
+	// PV.  This allows the depot to use a faster storage class than the
+	// catalog.  The depotPath must differ from the catalogPath and dataPath,
+	// and depotVolume must be PersistentVolume.  This can only be set when the
+	// VerticaDB is created.
+	DepotPVC *LocalVolumeClaim `json:"depotPVC,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	// If set, the operator will expand a pod's PVC when the disk usage of its
+	// volume crosses a threshold.  Only the PVCs of the pods that are low on
+	// disk space are expanded; requestSize is left unchanged.  When omitted,
+	// PVCs are only expanded when the requestSize is increased.
+	AutoGrow *LocalStorageAutoGrow `json:"autoGrow,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	// Controls what happens to the local PVCs when a subcluster is scaled
+	// down or the VerticaDB is deleted.  When omitted, the PVCs of pods that
+	// are scaled down are kept, and all of the PVCs are deleted along with
+	// the VerticaDB.
+	PVCRetentionPolicy *PVCRetentionPolicy `json:"pvcRetentionPolicy,omitempty"`
+}
+
+// PVCRetentionPolicy describes when the local PVCs of a pod are deleted
+type PVCRetentionPolicy struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=Retain
+	// +kubebuilder:validation:Enum:=Retain;Delete
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors={"urn:alm:descriptor:com.tectonic.ui:select:Retain","urn:alm:descriptor:com.tectonic.ui:select:Delete"}
+	// What to do with the PVCs of a pod that is removed because its
+	// subcluster was scaled down or removed.  If set to Delete, the PVCs are
+	// deleted once the node has been removed from the database and the pod
+	// is gone.  This stops a later scale out from picking up a stale catalog.
+	WhenScaled PVCRetentionPolicyType `json:"whenScaled,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=Delete
+	// +kubebuilder:validation:Enum:=Retain;Delete
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors={"urn:alm:descriptor:com.tectonic.ui:select:Retain","urn:alm:descriptor:com.tectonic.ui:select:Delete"}
+	// What to do with the PVCs when the VerticaDB is deleted.  If set to
+	// Retain, the PVCs are kept so that a new VerticaDB can reuse them.
+	WhenDeleted PVCRetentionPolicyType `json:"whenDeleted,omitempty"`
+}
+
+// LocalStorageAutoGrow is the policy the operator follows to expand a PVC
+// that is running low on disk space.
+type LocalStorageAutoGrow struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=80
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:number"
+	// The percentage of the volume that must be in use before the PVC is
+	// expanded.  This must be between 1 and 99.
+	ThresholdPercent int `json:"thresholdPercent,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// The amount of storage to add to the PVC each time it is expanded.
+	GrowthStep resource.Quantity `json:"growthStep"`
+
+	// +kubebuilder:validation:Required
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// The largest size a PVC will be expanded to.  This must be at least as
+	// large as the requestSize of each of the local PVCs.
+	MaxSize resource.Quantity `json:"maxSize"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=600
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:number"
+	// The minimum number of seconds between two expansions of the same PVC.
+	// This gives the storage provider time to expand the volume, and Vertica
+	// time to see the new space, before we look at the disk usage again.
+	// It is also how often the operator checks the disk usage of the pods.
+	// If set to 0, the disk usage is checked every 60 seconds.
+	MinIntervalSeconds int `json:"minIntervalSeconds,omitempty"`
+}
+
+// LocalVolumeClaim describes a PVC that is created for each pod to store one
+// part of the local data.
+type LocalVolumeClaim struct {
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:io.kubernetes:StorageClass"
+	// The name of the storage class to use for the PVC.  If omitted, the
+	// default storage class in Kubernetes is used.  This can be changed in the
+	// same way as local.storageClass.
+	StorageClass string `json:"storageClass,omitempty"`
+
+	// +kubebuilder:validation:Required
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// The minimum size of the PV.  Increasing this after the PVC has been
+	// created will cause the PV to be expanded.
+	RequestSize resource.Quantity `json:"requestSize"`
+}
+
+// LocalPVC is one of the PVCs that are created for each pod. Each one has a
+// volumeClaimTemplate in the statefulset.
+type LocalPVC struct {
+	// The name of the volumeClaimTemplate
+	Name string
+	// The path in the container where the PVC is mounted. This is empty for
+	// the local data PVC, which is mounted in multiple places.
+	MountPath    string
+	StorageClass string
+	RequestSize  resource.Quantity
+	// True if this PVC stores the depot
+	HasDepot bool
 }
 
 // GetCatalogPath returns the path to the catalog. This wrapper exists because
@@ -677,6 +871,20 @@ func (l *LocalStorage) IsDepotPathUnique() bool {
 		l.DepotPath != l.GetCatalogPath()
 }
 
+// IsCatalogPathUnique returns true if the catalog path is different from the
+// data and depot paths.
+func (l *LocalStorage) IsCatalogPathUnique() bool {
+	return l.GetCatalogPath() != l.DataPath &&
+		l.GetCatalogPath() != l.DepotPath
+}
+
+// IsDataPathUnique returns true if the data path is different from the
+// catalog and depot paths.
+func (l *LocalStorage) IsDataPathUnique() bool {
+	return l.DataPath != l.GetCatalogPath() &&
+		l.DataPath != l.DepotPath
+}
+
 type Subcluster struct {
 	// +kubebuilder:validation:required
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
@@ -706,7 +914,9 @@ type Subcluster struct {
 	// +kubebuilder:validation:Optional
 	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:booleanSwitch"
 	// Indicates whether the subcluster is a primary or secondary. You must have
-	// at least one primary subcluster in the database.
+	// at least one primary subcluster in the database. In Eon Mode, this can
+	// be changed after the subcluster is created. The operator will promote or
+	// demote the subcluster, provided the primary nodes left satisfy kSafety.
 	IsPrimary bool `json:"isPrimary"`
 
 	// +kubebuilder:validation:Optional
@@ -717,6 +927,15 @@ type Subcluster struct {
 	// new image.
 	IsTransient bool `json:"isTransient,omitempty"`
 
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:booleanSwitch"
+	// When set to true, the subcluster is shutdown. Client connections are
+	// drained, the Vertica nodes are stopped and the statefulset is scaled to
+	// zero. The PVCs and the nodes in the catalog are kept, so setting this
+	// back to false will start the subcluster again. Only secondary
+	// subclusters can be shutdown.
+	Shutdown bool `json:"shutdown,omitempty"`
+
 	// +kubebuilder:validation:Optional
 	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:hidden"
 	// This allows a different image to be used for the subcluster than the one
@@ -812,6 +1031,25 @@ type Subcluster struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	// A map of key/value pairs appended to service metadata.annotations.
 	ServiceAnnotations map[string]string `json:"serviceAnnotations,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	// A map of configuration parameters to set for each node in this
+	// subcluster. These override any value set in spec.configParameters for
+	// the nodes in this subcluster.
+	ConfigParameters map[string]string `json:"configParameters,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:advanced"
+	// Overrides the maxUnavailable of the PodDisruptionBudget that the
+	// operator generates for this subcluster.  It can be an absolute number or
+	// a percentage of the subcluster size.  If omitted, one pod is allowed to
+	// be unavailable.  This can only be set for secondary subclusters.  The
+	// pods of all primary subclusters share a single budget that is derived
+	// from spec.kSafety: it allows one pod to be unavailable when kSafety is 1
+	// and none when it is 0.  Each budget is raised by the number of its pods
+	// that the operator is restarting.
+	PdbMaxUnavailable *intstr.IntOrString `json:"pdbMaxUnavailable,omitempty"`
 }
 
 // Affinity is used instead of corev1.Affinity and behaves the same.
@@ -866,6 +1104,90 @@ type VerticaDBStatus struct {
 	// Status message for the current running upgrade.   If no upgrade
 	// is occurring, this message remains blank.
 	UpgradeStatus string `json:"upgradeStatus"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	// Structured state of the current, or most recently completed, upgrade.
+	// This is kept after the upgrade finishes so that the outcome can be
+	// inspected.  It is reset when a new upgrade starts.
+	UpgradeState *UpgradeState `json:"upgradeState,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	// The names of the configuration parameters, from spec.configParameters
+	// or spec.subclusters[].configParameters, that have been set in the
+	// database but won't take effect until the database is restarted.
+	ConfigParametersPendingRestart []string `json:"configParametersPendingRestart,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	// The names of the configuration parameters, from spec.configParameters
+	// or spec.subclusters[].configParameters, that the database doesn't know
+	// about.  These are skipped until they are fixed in the spec.
+	ConfigParametersUnknown []string `json:"configParametersUnknown,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	// The disruptive operations that are waiting for a maintenance window to
+	// open.  An operation is removed if the change that needed it is
+	// reverted before the window opens.  See spec.maintenanceWindows.
+	DeferredOperations []string `json:"deferredOperations,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	// The time the next maintenance window opens.  This is only set while
+	// there are deferred operations.
+	NextMaintenanceWindow *metav1.Time `json:"nextMaintenanceWindow,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	// The number of shards in the database.  This can differ from
+	// spec.shardCount while a reshard is pending or in progress.
+	ShardCount int `json:"shardCount,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	// Status message for the current reshard.  If no reshard is occurring,
+	// this message remains blank.
+	ReshardStatus string `json:"reshardStatus,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	// Status message for the current storage class migration.  This reports
+	// the progress of rebuilding the pods so that their PVCs use the new
+	// storage class.  If no migration is occurring, this message remains
+	// blank.
+	StorageClassMigrationStatus string `json:"storageClassMigrationStatus,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	// The PVCs that the operator has expanded because of spec.local.autoGrow.
+	PVCAutoGrow []PVCAutoGrowStatus `json:"pvcAutoGrow,omitempty"`
+}
+
+// PVCAutoGrowStatus is the state of the automatic expansion of a single PVC
+type PVCAutoGrowStatus struct {
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The name of the PVC
+	Name string `json:"name"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The size the PVC was last expanded to
+	RequestSize resource.Quantity `json:"requestSize"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The number of times the operator has expanded the PVC
+	ExpansionCount int `json:"expansionCount"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The time the PVC was last expanded
+	LastExpansionTime metav1.Time `json:"lastExpansionTime"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	// True if the PVC is low on disk space but cannot be expanded any further
+	// because it is already at spec.local.autoGrow.maxSize.
+	MaxSizeReached bool `json:"maxSizeReached,omitempty"`
 }
 
 // VerticaDBConditionType defines type for VerticaDBCondition
@@ -885,8 +1207,152 @@ const (
 	// VerticaRestartNeeded is a condition that when set to true will force the
 	// operator to stop/start the vertica pods.
 	VerticaRestartNeeded VerticaDBConditionType = "VerticaRestartNeeded"
+	// ConfigParametersInSync indicates whether the configuration parameters
+	// in the database match what is in spec.configParameters.
+	ConfigParametersInSync VerticaDBConditionType = "ConfigParametersInSync"
+	// UpgradeRolledBack indicates that the last upgrade failed and the
+	// database was rolled back to its previous image.
+	UpgradeRolledBack VerticaDBConditionType = "UpgradeRolledBack"
+	// UpgradePreflight reports the result of the checks that are run before
+	// an upgrade is started.  It is false if any check failed, which blocks
+	// the upgrade.
+	UpgradePreflight VerticaDBConditionType = "UpgradePreflight"
+	// ReshardInProgress indicates the shard count of the database is being
+	// changed to match spec.shardCount.
+	ReshardInProgress VerticaDBConditionType = "ReshardInProgress"
+	// StorageClassMigrationInProgress indicates the pods are being rebuilt,
+	// one at a time, so that their PVCs use a new storage class.
+	StorageClassMigrationInProgress VerticaDBConditionType = "StorageClassMigrationInProgress"
 )
 
+// UpgradeRollbackPolicy controls when a failed upgrade is rolled back
+type UpgradeRollbackPolicy struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=false
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:booleanSwitch"
+	// Set to true to have the operator roll back a failed upgrade.  One of
+	// maxRestartAttempts or deadlineSeconds must be set when this is true.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:number"
+	// The number of failed attempts to restart vertica with the new image
+	// before the upgrade is rolled back.  A value of 0 means there is no
+	// limit on the attempts.
+	MaxRestartAttempts int32 `json:"maxRestartAttempts,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:number"
+	// The number of seconds, measured from the start of the upgrade, after
+	// which a failed restart with the new image causes the upgrade to be
+	// rolled back.  A value of 0 means there is no deadline.
+	DeadlineSeconds int32 `json:"deadlineSeconds,omitempty"`
+}
+
+// MaintenanceWindow is a recurring window of time in which disruptive
+// operations are allowed.
+type MaintenanceWindow struct {
+	// +kubebuilder:validation:Required
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:text"
+	// A cron expression, in the standard five field format, for when the
+	// window opens.  For example, "0 2 * * SUN" opens a window at 2am every
+	// Sunday.
+	Schedule string `json:"schedule"`
+
+	// +kubebuilder:validation:Required
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:text"
+	// How long the window stays open, such as "2h" or "90m".
+	Duration metav1.Duration `json:"duration"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:text"
+	// The time zone, as an IANA name like "America/Toronto", that the
+	// schedule is in.  If this is omitted, UTC is used.
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// TopologyMode is the way that pods are placed across topology domains
+type TopologyMode string
+
+const (
+	// TopologyModeNone leaves the placement of the pods to the scheduler
+	TopologyModeNone TopologyMode = "None"
+	// TopologyModeZone spreads the pods across the topology key and maps each
+	// domain to a Vertica fault group
+	TopologyModeZone TopologyMode = "Zone"
+
+	// DefaultTopologyKey is the node label used when spreading the pods if
+	// one isn't given in the spec.
+	DefaultTopologyKey = "topology.kubernetes.io/zone"
+)
+
+// Topology defines how pods are spread across the topology of the cluster
+type Topology struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=None
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors={"urn:alm:descriptor:com.tectonic.ui:select:None","urn:alm:descriptor:com.tectonic.ui:select:Zone"}
+	// The placement mode.  It can be one of the following:
+	// - None: the pods are placed using only the nodeSelector, affinity and
+	// tolerations in the subcluster.
+	// - Zone: a topologySpreadConstraint is added to the pods of each
+	// subcluster.  In Enterprise Mode, each node is also added to a fault
+	// group named after the value of the topology key on the Kubernetes node
+	// that runs it.
+	Mode TopologyMode `json:"mode,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:text"
+	// The node label whose values are the topology domains.  If omitted,
+	// topology.kubernetes.io/zone is used.
+	TopologyKey string `json:"topologyKey,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:number"
+	// The maximum difference in the number of pods of a subcluster between
+	// any two topology domains.  If omitted, 1 is used.
+	MaxSkew int32 `json:"maxSkew,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors={"urn:alm:descriptor:com.tectonic.ui:select:DoNotSchedule","urn:alm:descriptor:com.tectonic.ui:select:ScheduleAnyway"}
+	// What to do with a pod that cannot be scheduled without exceeding
+	// maxSkew.  If omitted, DoNotSchedule is used, which leaves the pod
+	// pending.  ScheduleAnyway will place the pod while still favoring the
+	// domains that reduce the skew.
+	WhenUnsatisfiable corev1.UnsatisfiableConstraintAction `json:"whenUnsatisfiable,omitempty"`
+}
+
+// UpgradeCanaryApproval is the decision made about a canary subcluster
+type UpgradeCanaryApproval string
+
+const (
+	UpgradeCanaryApproved UpgradeCanaryApproval = "Approved"
+	UpgradeCanaryDenied   UpgradeCanaryApproval = "Denied"
+)
+
+// UpgradeCanary defines a secondary subcluster that is upgraded ahead of the
+// other secondaries
+type UpgradeCanary struct {
+	// +kubebuilder:validation:Optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors="urn:alm:descriptor:com.tectonic.ui:text"
+	// The name of the secondary subcluster to use as the canary.  When this
+	// is empty, all of the secondary subclusters are upgraded without a pause.
+	// This only applies to online upgrade.
+	Subcluster string `json:"subcluster,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum:="";Approved;Denied
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors={"urn:alm:descriptor:com.tectonic.ui:select:Approved","urn:alm:descriptor:com.tectonic.ui:select:Denied"}
+	// Set to Approved to continue the upgrade after the canary subcluster is
+	// up with the new image.  Set to Denied to halt the upgrade, with the
+	// canary left on the new image, until this is changed to Approved.  A
+	// denial doesn't roll the upgrade back: the primaries are upgraded before
+	// the canary, so the catalog is already upgraded by then.  A value that
+	// is already set when an upgrade starts was given for a prior upgrade, so
+	// it is ignored.  Change it, or clear it and set it again, to decide on
+	// the canary of the current upgrade.
+	Approval UpgradeCanaryApproval `json:"approval,omitempty"`
+}
+
 // Fixed index entries for each condition.
 const (
 	AutoRestartVerticaIndex = iota
@@ -895,28 +1361,43 @@ const (
 	OfflineUpgradeInProgressIndex
 	OnlineUpgradeInProgressIndex
 	VerticaRestartNeededIndex
+	ConfigParametersInSyncIndex
+	UpgradeRolledBackIndex
+	UpgradePreflightIndex
+	ReshardInProgressIndex
+	StorageClassMigrationInProgressIndex
 )
 
 // VerticaDBConditionIndexMap is a map of the VerticaDBConditionType to its
 // index in the condition array
 var VerticaDBConditionIndexMap = map[VerticaDBConditionType]int{
-	AutoRestartVertica:       AutoRestartVerticaIndex,
-	DBInitialized:            DBInitializedIndex,
-	ImageChangeInProgress:    ImageChangeInProgressIndex,
-	OfflineUpgradeInProgress: OfflineUpgradeInProgressIndex,
-	OnlineUpgradeInProgress:  OnlineUpgradeInProgressIndex,
-	VerticaRestartNeeded:     VerticaRestartNeededIndex,
+	AutoRestartVertica:              AutoRestartVerticaIndex,
+	DBInitialized:                   DBInitializedIndex,
+	ImageChangeInProgress:           ImageChangeInProgressIndex,
+	OfflineUpgradeInProgress:        OfflineUpgradeInProgressIndex,
+	OnlineUpgradeInProgress:         OnlineUpgradeInProgressIndex,
+	VerticaRestartNeeded:            VerticaRestartNeededIndex,
+	ConfigParametersInSync:          ConfigParametersInSyncIndex,
+	UpgradeRolledBack:               UpgradeRolledBackIndex,
+	UpgradePreflight:                UpgradePreflightIndex,
+	ReshardInProgress:               ReshardInProgressIndex,
+	StorageClassMigrationInProgress: StorageClassMigrationInProgressIndex,
 }
 
 // VerticaDBConditionNameMap is the reverse of VerticaDBConditionIndexMap.  It
 // maps an index to the condition name.
 var VerticaDBConditionNameMap = map[int]VerticaDBConditionType{
-	AutoRestartVerticaIndex:       AutoRestartVertica,
-	DBInitializedIndex:            DBInitialized,
-	ImageChangeInProgressIndex:    ImageChangeInProgress,
-	OfflineUpgradeInProgressIndex: OfflineUpgradeInProgress,
-	OnlineUpgradeInProgressIndex:  OnlineUpgradeInProgress,
-	VerticaRestartNeededIndex:     VerticaRestartNeeded,
+	AutoRestartVerticaIndex:              AutoRestartVertica,
+	DBInitializedIndex:                   DBInitialized,
+	ImageChangeInProgressIndex:           ImageChangeInProgress,
+	OfflineUpgradeInProgressIndex:        OfflineUpgradeInProgress,
+	OnlineUpgradeInProgressIndex:         OnlineUpgradeInProgress,
+	VerticaRestartNeededIndex:            VerticaRestartNeeded,
+	ConfigParametersInSyncIndex:          ConfigParametersInSync,
+	UpgradeRolledBackIndex:               UpgradeRolledBack,
+	UpgradePreflightIndex:                UpgradePreflight,
+	ReshardInProgressIndex:               ReshardInProgress,
+	StorageClassMigrationInProgressIndex: StorageClassMigrationInProgress,
 }
 
 // VerticaDBCondition defines condition for VerticaDB
@@ -936,6 +1417,156 @@ type VerticaDBCondition struct {
 	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
 }
 
+// UpgradePhase is the step of the upgrade that is currently running
+type UpgradePhase string
+
+const (
+	// UpgradePhaseStarting is set when an upgrade is first detected
+	UpgradePhaseStarting UpgradePhase = "Starting"
+	// UpgradePhaseStoppingCluster is set while an offline upgrade stops the
+	// entire cluster
+	UpgradePhaseStoppingCluster UpgradePhase = "StoppingCluster"
+	// UpgradePhaseReschedulingPods is set while an offline upgrade recreates
+	// the pods with the new image
+	UpgradePhaseReschedulingPods UpgradePhase = "ReschedulingPods"
+	// UpgradePhaseRestartingCluster is set while an offline upgrade restarts
+	// the cluster with the new image
+	UpgradePhaseRestartingCluster UpgradePhase = "RestartingCluster"
+	// UpgradePhaseCreatingTransient is set while an online upgrade sets up the
+	// transient subcluster
+	UpgradePhaseCreatingTransient UpgradePhase = "CreatingTransient"
+	// UpgradePhaseUpgradingPrimaries is set while an online upgrade is
+	// restarting the primary subclusters
+	UpgradePhaseUpgradingPrimaries UpgradePhase = "UpgradingPrimaries"
+	// UpgradePhaseUpgradingSecondaries is set while an online upgrade is
+	// restarting the secondary subclusters
+	UpgradePhaseUpgradingSecondaries UpgradePhase = "UpgradingSecondaries"
+	// UpgradePhaseRemovingTransient is set while an online upgrade removes
+	// the transient subcluster
+	UpgradePhaseRemovingTransient UpgradePhase = "RemovingTransient"
+	// UpgradePhaseCompleted is set once the upgrade has finished
+	UpgradePhaseCompleted UpgradePhase = "Completed"
+	// UpgradePhaseRollingBack is set while a failed upgrade is being rolled
+	// back to the source image
+	UpgradePhaseRollingBack UpgradePhase = "RollingBack"
+	// UpgradePhaseRolledBack is set once a failed upgrade has been rolled back
+	UpgradePhaseRolledBack UpgradePhase = "RolledBack"
+)
+
+// SubclusterUpgradePhase is the progress of the upgrade for a single subcluster
+type SubclusterUpgradePhase string
+
+const (
+	SubclusterUpgradePending    SubclusterUpgradePhase = "Pending"
+	SubclusterUpgradeDraining   SubclusterUpgradePhase = "Draining"
+	SubclusterUpgradeRecreating SubclusterUpgradePhase = "Recreating"
+	SubclusterUpgradeRestarting SubclusterUpgradePhase = "Restarting"
+	SubclusterUpgradeUpgraded   SubclusterUpgradePhase = "Upgraded"
+)
+
+// UpgradeState is the structured state of an upgrade
+type UpgradeState struct {
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The image the database was running before the upgrade started.
+	// +optional
+	SourceImage string `json:"sourceImage,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The image the database is being upgraded to.
+	TargetImage string `json:"targetImage"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The upgrade policy that the operator chose to use.  This is either
+	// Offline or Online, and may differ from spec.upgradePolicy when Auto is
+	// used or when the server doesn't support online upgrade.
+	Policy UpgradePolicyType `json:"policy"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The step of the upgrade that is currently running.
+	Phase UpgradePhase `json:"phase"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// Upgrade progress for each subcluster.
+	// +optional
+	Subclusters []SubclusterUpgradeState `json:"subclusters,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The time the upgrade started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The time the upgrade finished.  This is empty while the upgrade is
+	// running.
+	// +optional
+	FinishTime *metav1.Time `json:"finishTime,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The number of failed attempts to restart vertica with the new image.
+	// +optional
+	RestartAttempts int32 `json:"restartAttempts,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// This is set once a vertica node has come up with the new image.  The
+	// catalog is upgraded at that point, so the upgrade can no longer be
+	// rolled back.
+	// +optional
+	CatalogUpgraded bool `json:"catalogUpgraded,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The state of the canary subcluster.  This is only set for an online
+	// upgrade when spec.upgradeCanary.subcluster is set.
+	// +optional
+	Canary *UpgradeCanaryState `json:"canary,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The spec.upgradeCanary.approval that was set when the upgrade started.
+	// It was given for a prior upgrade, so it doesn't count as a decision on
+	// the canary of this one.  This is cleared once the approval is cleared
+	// in the spec.
+	// +optional
+	ConsumedCanaryApproval UpgradeCanaryApproval `json:"consumedCanaryApproval,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The last error the upgrade ran into.  The upgrade is retried after an
+	// error, so this may refer to an error that has since been resolved.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// UpgradeCanaryPhase is the progress of the canary subcluster
+type UpgradeCanaryPhase string
+
+const (
+	UpgradeCanaryPhaseUpgrading        UpgradeCanaryPhase = "Upgrading"
+	UpgradeCanaryPhaseAwaitingApproval UpgradeCanaryPhase = "AwaitingApproval"
+	UpgradeCanaryPhaseApproved         UpgradeCanaryPhase = "Approved"
+	UpgradeCanaryPhaseDenied           UpgradeCanaryPhase = "Denied"
+)
+
+// UpgradeCanaryState is the upgrade progress of the canary subcluster
+type UpgradeCanaryState struct {
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// Name of the canary subcluster
+	Subcluster string `json:"subcluster"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The progress of the canary.  The upgrade of the remaining secondary
+	// subclusters is paused while this is AwaitingApproval.
+	Phase UpgradeCanaryPhase `json:"phase"`
+}
+
+// SubclusterUpgradeState is the upgrade progress of a single subcluster
+type SubclusterUpgradeState struct {
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// Name of the subcluster
+	Name string `json:"name"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The upgrade step the subcluster is in.
+	Phase SubclusterUpgradePhase `json:"phase"`
+}
+
 // SubclusterStatus defines the per-subcluster status that we track
 type SubclusterStatus struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=status
@@ -946,6 +1577,13 @@ type SubclusterStatus struct {
 	// Object ID of the subcluster.
 	Oid string `json:"oid"`
 
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +kubebuilder:validation:Optional
+	// The type of the subcluster as it is in the database: primary or
+	// secondary. This can differ from isPrimary in the spec while the
+	// subcluster is being promoted or demoted.
+	Type string `json:"type,omitempty"`
+
 	// +operator-sdk:csv:customresourcedefinitions:type=status
 	// A count of the number of pods that have been installed into the subcluster.
 	InstallCount int32 `json:"installCount"`
@@ -1211,6 +1849,15 @@ func (s *Subcluster) GetType() string {
 	return SecondarySubclusterType
 }
 
+// GetStsSize returns the number of replicas the statefulset for the subcluster
+// should have. This is zero if the subcluster is shutdown.
+func (s *Subcluster) GetStsSize() int32 {
+	if s.Shutdown {
+		return 0
+	}
+	return s.Size
+}
+
 // GenCompatibleFQDN returns a name of the subcluster that is
 // compatible inside a fully-qualified domain name.
 func (s *Subcluster) GenCompatibleFQDN() string {
@@ -1248,11 +1895,48 @@ func (v *VerticaDB) RequiresTransientSubcluster() bool {
 		v.Spec.TemporarySubclusterRouting.Template.Size > 0
 }
 
+// GetDesiredImage returns the image the pods should be running.  This is
+// spec.image unless the upgrade to it is being, or has been, rolled back.  In
+// that case it is the image the upgrade started from.
+func (v *VerticaDB) GetDesiredImage() string {
+	state := v.Status.UpgradeState
+	if state != nil && state.SourceImage != "" && state.TargetImage == v.Spec.Image &&
+		(state.Phase == UpgradePhaseRollingBack || state.Phase == UpgradePhaseRolledBack) {
+		return state.SourceImage
+	}
+	return v.Spec.Image
+}
+
 // IsOnlineUpgradeInProgress returns true if an online upgrade is in progress
 func (v *VerticaDB) IsOnlineUpgradeInProgress() bool {
 	return v.isConditionIndexSet(OnlineUpgradeInProgressIndex)
 }
 
+// IsZoneTopologyEnabled returns true if the pods are spread across zones that
+// are mapped to fault groups
+func (v *VerticaDB) IsZoneTopologyEnabled() bool {
+	return v.Spec.Topology.Mode == TopologyModeZone
+}
+
+// GetTopologyKey returns the node label used to spread the pods
+func (v *VerticaDB) GetTopologyKey() string {
+	if v.Spec.Topology.TopologyKey == "" {
+		return DefaultTopologyKey
+	}
+	return v.Spec.Topology.TopologyKey
+}
+
+// IsReshardInProgress returns true if the shard count is being changed
+func (v *VerticaDB) IsReshardInProgress() bool {
+	return v.isConditionIndexSet(ReshardInProgressIndex)
+}
+
+// IsStorageClassMigrationInProgress returns true if pods are being rebuilt to
+// move their PVCs to a new storage class
+func (v *VerticaDB) IsStorageClassMigrationInProgress() bool {
+	return v.isConditionIndexSet(StorageClassMigrationInProgressIndex)
+}
+
 // IsConditionSet will return true if the status condition is set to true.
 // If the condition is not in the array then this implies the condition is
 // false.
@@ -1310,6 +1994,17 @@ func (v *VerticaDB) FindSubclusterStatus(scName string) (SubclusterStatus, bool)
 	return SubclusterStatus{}, false
 }
 
+// FindPVCAutoGrowStatus will return the autogrow status for the given PVC. The
+// bool return value is false if the PVC has never been expanded.
+func (v *VerticaDB) FindPVCAutoGrowStatus(pvcName string) (PVCAutoGrowStatus, bool) {
+	for i := range v.Status.PVCAutoGrow {
+		if v.Status.PVCAutoGrow[i].Name == pvcName {
+			return v.Status.PVCAutoGrow[i], true
+		}
+	}
+	return PVCAutoGrowStatus{}, false
+}
+
 // IsHTTPServerDisabled explicitly checks if the http server is disabled. If set
 // to auto or enabled, this returns false.
 func (v *VerticaDB) IsHTTPServerDisabled() bool {
@@ -1369,6 +2064,43 @@ func (v *VerticaDB) IsDepotVolumeEmptyDir() bool {
 	return v.Spec.Local.DepotVolume == EmptyDir
 }
 
+// GetLocalPVCs returns the PVCs that are created for each pod. The local data
+// PVC always exists and is first. It is followed by a PVC for each of the
+// catalog, data and depot that were given their own volume.
+func (v *VerticaDB) GetLocalPVCs() []LocalPVC {
+	loc := &v.Spec.Local
+	pvcs := []LocalPVC{
+		{
+			Name:         LocalDataPVC,
+			StorageClass: loc.StorageClass,
+			RequestSize:  loc.RequestSize,
+			HasDepot:     v.IsDepotVolumePersistentVolume() && loc.DepotPVC == nil,
+		},
+	}
+	claims := []struct {
+		name      string
+		mountPath string
+		claim     *LocalVolumeClaim
+	}{
+		{LocalCatalogPVC, loc.GetCatalogPath(), loc.CatalogPVC},
+		{LocalDataFilesPVC, loc.DataPath, loc.DataPVC},
+		{LocalDepotPVC, loc.DepotPath, loc.DepotPVC},
+	}
+	for i := range claims {
+		if claims[i].claim == nil {
+			continue
+		}
+		pvcs = append(pvcs, LocalPVC{
+			Name:         claims[i].name,
+			MountPath:    claims[i].mountPath,
+			StorageClass: claims[i].claim.StorageClass,
+			RequestSize:  claims[i].claim.RequestSize,
+			HasDepot:     claims[i].name == LocalDepotPVC,
+		})
+	}
+	return pvcs
+}
+
 // IsDepotVolumePersistentVolume returns true if the depot volume's type
 // is persistentVolume.
 func (v *VerticaDB) IsDepotVolumePersistentVolume() bool {
@@ -1376,6 +2108,20 @@ func (v *VerticaDB) IsDepotVolumePersistentVolume() bool {
 		v.Spec.Local.DepotVolume == ""
 }
 
+// IsPVCDeletedWhenScaled returns true if the PVCs of a pod that is scaled
+// down should be deleted
+func (v *VerticaDB) IsPVCDeletedWhenScaled() bool {
+	return v.Spec.Local.PVCRetentionPolicy != nil &&
+		v.Spec.Local.PVCRetentionPolicy.WhenScaled == PVCDelete
+}
+
+// IsPVCRetainedWhenDeleted returns true if the PVCs should be kept after the
+// VerticaDB is deleted
+func (v *VerticaDB) IsPVCRetainedWhenDeleted() bool {
+	return v.Spec.Local.PVCRetentionPolicy != nil &&
+		v.Spec.Local.PVCRetentionPolicy.WhenDeleted == PVCRetain
+}
+
 // IsknownDepotVolumeType returns true if the depot volume's type is
 // a valid one.
 func (v *VerticaDB) IsKnownDepotVolumeType() bool {
@@ -20,20 +20,29 @@ package v1beta1
 import (
 	"fmt"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/robfig/cron/v3"
 	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
 	"github.com/vertica/vertica-kubernetes/pkg/paths"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
+// configParameterNameRegexp matches the valid names of a config parameter
+var configParameterNameRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
 const (
 	invalidDBNameChars       = "$=<>`" + `'^\".@*?#&/-:;{}()[] \~!%+|,`
 	dbNameLengthLimit        = 30
@@ -43,6 +52,9 @@ const (
 	portLowerBound           = 30000
 	portUpperBound           = 32767
 	LocalDataPVC             = "local-data"
+	LocalCatalogPVC          = "local-catalog"
+	LocalDataFilesPVC        = "local-datafiles"
+	LocalDepotPVC            = "local-depot"
 	PodInfoMountName         = "podinfo"
 	LicensingMountName       = "licensing"
 	HadoopConfigMountName    = "hadoop-conf"
@@ -231,13 +243,6 @@ func (v *VerticaDB) validateImmutableFields(old runtime.Object) field.ErrorList
 			"communal.endpoint cannot change after creation")
 		allErrs = append(allErrs, err)
 	}
-	// local.storageClass cannot change after creation
-	if v.Spec.Local.StorageClass != oldObj.Spec.Local.StorageClass {
-		err := field.Invalid(field.NewPath("spec").Child("local").Child("storageClass"),
-			v.Spec.Local.StorageClass,
-			"local.storageClass cannot change after creation")
-		allErrs = append(allErrs, err)
-	}
 	// when update subcluster names, there should be at least one sc's name match its old name
 	if !v.canUpdateScName(oldObj) {
 		err := field.Invalid(field.NewPath("spec").Child("subclusters"),
@@ -245,22 +250,18 @@ func (v *VerticaDB) validateImmutableFields(old runtime.Object) field.ErrorList
 			"at least one subcluster name should match its old name")
 		allErrs = append(allErrs, err)
 	}
-	// validate that for existing subclusters that we don't change the
-	// primary/secondary type
-	if ok, inx := v.isSubclusterTypeIsChanging(oldObj); ok {
-		err := field.Invalid(field.NewPath("spec").Child("subclusters").Child("isPrimary"),
-			v.Spec.Subclusters[inx],
-			fmt.Sprintf("subcluster %s cannot have its isPrimary type change", v.Spec.Subclusters[inx].Name))
-		allErrs = append(allErrs, err)
-	}
+	allErrs = v.checkSubclusterTypeChange(oldObj, allErrs)
+	allErrs = v.checkStorageClassChange(oldObj, allErrs)
+	allErrs = v.checkSubclusterRenames(oldObj, allErrs)
 	allErrs = v.checkImmutableUpgradePolicy(oldObj, allErrs)
 	allErrs = v.checkImmutableTemporarySubclusterRouting(oldObj, allErrs)
 	allErrs = v.checkImmutableEncryptSpreadComm(oldObj, allErrs)
 	allErrs = v.checkImmutableLocalPathChange(oldObj, allErrs)
-	allErrs = v.checkImmutableShardCount(oldObj, allErrs)
+	allErrs = v.checkShardCountChange(oldObj, allErrs)
 	allErrs = v.checkImmutableS3ServerSideEncryption(oldObj, allErrs)
 	allErrs = v.checkImmutableHTTPServerMode(oldObj, allErrs)
 	allErrs = v.checkImmutableDepotVolume(oldObj, allErrs)
+	allErrs = v.checkImmutableLocalPVCs(oldObj, allErrs)
 	return allErrs
 }
 
@@ -273,6 +274,7 @@ func (v *VerticaDB) validateVerticaDBSpec() field.ErrorList {
 	allErrs = v.validateCommunalPath(allErrs)
 	allErrs = v.validateS3ServerSideEncryption(allErrs)
 	allErrs = v.validateAdditionalConfigParms(allErrs)
+	allErrs = v.validateConfigParameters(allErrs)
 	allErrs = v.validateCustomLabels(allErrs)
 	allErrs = v.validateEndpoint(allErrs)
 	allErrs = v.hasValidDomainName(allErrs)
@@ -292,6 +294,12 @@ func (v *VerticaDB) validateVerticaDBSpec() field.ErrorList {
 	allErrs = v.validateHTTPServerMode(allErrs)
 	allErrs = v.hasValidShardCount(allErrs)
 	allErrs = v.hasValidProbeOverrides(allErrs)
+	allErrs = v.hasValidSubclusterShutdown(allErrs)
+	allErrs = v.hasValidUpgradeRollbackPolicy(allErrs)
+	allErrs = v.hasValidUpgradeCanary(allErrs)
+	allErrs = v.hasValidMaintenanceWindows(allErrs)
+	allErrs = v.hasValidPdbMaxUnavailable(allErrs)
+	allErrs = v.hasValidTopology(allErrs)
 	if len(allErrs) == 0 {
 		return nil
 	}
@@ -391,6 +399,38 @@ func (v *VerticaDB) validateAdditionalConfigParms(allErrs field.ErrorList) field
 	return allErrs
 }
 
+// validateConfigParameters checks the config parameters that are applied to
+// the running database. The names are used directly in SQL, so they are
+// restricted to the characters allowed in a parameter name.
+func (v *VerticaDB) validateConfigParameters(allErrs field.ErrorList) field.ErrorList {
+	allErrs = validateConfigParameterMap(allErrs, field.NewPath("spec").Child("configParameters"), v.Spec.ConfigParameters)
+	for i := range v.Spec.Subclusters {
+		allErrs = validateConfigParameterMap(allErrs,
+			field.NewPath("spec").Child("subclusters").Index(i).Child("configParameters"),
+			v.Spec.Subclusters[i].ConfigParameters)
+	}
+	return allErrs
+}
+
+// validateConfigParameterMap will validate a single map of config parameters
+func validateConfigParameterMap(allErrs field.ErrorList, fieldPath *field.Path, parms map[string]string) field.ErrorList {
+	// Like additionalConfig, the parameter names are case insensitive.
+	seen := map[string]bool{}
+	for k := range parms {
+		if !configParameterNameRegexp.MatchString(k) {
+			err := field.Invalid(fieldPath, parms,
+				fmt.Sprintf("key %s is not a valid configuration parameter name", k))
+			allErrs = append(allErrs, err)
+		}
+		if seen[strings.ToLower(k)] {
+			err := field.Invalid(fieldPath, parms, fmt.Sprintf("duplicates key %s", k))
+			allErrs = append(allErrs, err)
+		}
+		seen[strings.ToLower(k)] = true
+	}
+	return allErrs
+}
+
 func (v *VerticaDB) validateCustomLabels(allErrs field.ErrorList) field.ErrorList {
 	for _, invalidLabel := range vmeta.ProtectedLabels {
 		_, ok := v.Spec.Labels[invalidLabel]
@@ -495,6 +535,18 @@ func (v *VerticaDB) getClusterSize() int {
 	return sizeSum
 }
 
+// getPrimaryCount returns the number of nodes in primary subclusters
+func (v *VerticaDB) getPrimaryCount() int {
+	sizeSum := 0
+	for i := range v.Spec.Subclusters {
+		sc := &v.Spec.Subclusters[i]
+		if sc.IsPrimary {
+			sizeSum += int(sc.Size)
+		}
+	}
+	return sizeSum
+}
+
 func (v *VerticaDB) hasValidDomainName(allErrs field.ErrorList) field.ErrorList {
 	for i := range v.Spec.Subclusters {
 		sc := &v.Spec.Subclusters[i]
@@ -592,7 +644,8 @@ func (v *VerticaDB) hasDuplicateScName(allErrs field.ErrorList) field.ErrorList
 func (v *VerticaDB) hasValidVolumeName(allErrs field.ErrorList) field.ErrorList {
 	for i := range v.Spec.Volumes {
 		vol := v.Spec.Volumes[i]
-		if (vol.Name == LocalDataPVC) || (vol.Name == PodInfoMountName) || (vol.Name == LicensingMountName) || (vol.Name == HadoopConfigMountName) {
+		if (vol.Name == LocalDataPVC) || (vol.Name == LocalCatalogPVC) || (vol.Name == LocalDataFilesPVC) || (vol.Name == LocalDepotPVC) ||
+			(vol.Name == PodInfoMountName) || (vol.Name == LicensingMountName) || (vol.Name == HadoopConfigMountName) {
 			err := field.Invalid(field.NewPath("spec").Child("volumes").Index(i).Child("name"),
 				v.Spec.Volumes[i].Name,
 				"conflicts with the name of one of the internally generated volumes")
@@ -639,6 +692,13 @@ func (v *VerticaDB) canUpdateScName(oldObj *VerticaDB) bool {
 			}
 		}
 	}
+	// A subcluster that is renamed counts as a match of its old name
+	renamedFrom := map[string]string{}
+	if renames, err := vmeta.GetSubclusterRenames(v.Annotations); err == nil {
+		for oldName, newName := range renames {
+			renamedFrom[newName] = oldName
+		}
+	}
 	canUpdate := false
 	if len(scMap) > 0 {
 		for i := range v.Spec.Subclusters {
@@ -646,6 +706,9 @@ func (v *VerticaDB) canUpdateScName(oldObj *VerticaDB) bool {
 			if _, ok := scMap[scNew.Name]; ok {
 				canUpdate = true
 			}
+			if _, ok := scMap[renamedFrom[scNew.Name]]; ok {
+				canUpdate = true
+			}
 		}
 	} else {
 		canUpdate = true
@@ -653,6 +716,79 @@ func (v *VerticaDB) canUpdateScName(oldObj *VerticaDB) bool {
 	return canUpdate
 }
 
+// checkSubclusterRenames will validate the subcluster renames annotation. A
+// rename is requested when the old name is removed from spec.subclusters in
+// the same update that the new name is added.
+func (v *VerticaDB) checkSubclusterRenames(oldObj *VerticaDB, allErrs field.ErrorList) field.ErrorList {
+	pathPrefix := field.NewPath("metadata").Child("annotations").Key(vmeta.SubclusterRenamesAnnotation)
+	renames, err := vmeta.GetSubclusterRenames(v.Annotations)
+	if err != nil {
+		return append(allErrs, field.Invalid(pathPrefix, v.Annotations[vmeta.SubclusterRenamesAnnotation], err.Error()))
+	}
+	oldScMap := oldObj.GenSubclusterMap()
+	newScMap := v.GenSubclusterMap()
+	renamedTo := map[string]bool{}
+	oldNames := make([]string, 0, len(renames))
+	for oldName := range renames {
+		oldNames = append(oldNames, oldName)
+	}
+	sort.Strings(oldNames)
+	for _, oldName := range oldNames {
+		newName := renames[oldName]
+		oldSc, inOld := oldScMap[oldName]
+		_, stillInNew := newScMap[oldName]
+		// Only validate renames that are happening in this update
+		if !inOld || stillInNew {
+			continue
+		}
+		newSc, ok := newScMap[newName]
+		var reason string
+		switch {
+		case !ok:
+			reason = fmt.Sprintf("subcluster %s is renamed to %s, but there is no subcluster with that name", oldName, newName)
+		case oldScMap[newName] != nil:
+			reason = fmt.Sprintf("cannot rename subcluster %s to %s because a subcluster with that name already exists",
+				oldName, newName)
+		case oldSc.IsTransient || newSc.IsTransient:
+			reason = fmt.Sprintf("transient subcluster %s cannot be renamed", oldName)
+		case oldObj.isImageChangeInProgress():
+			reason = fmt.Sprintf("subcluster %s cannot be renamed while an image change is in progress", oldName)
+		}
+		if reason != "" {
+			allErrs = append(allErrs, field.Invalid(pathPrefix, v.Annotations[vmeta.SubclusterRenamesAnnotation], reason))
+		}
+		renamedTo[newName] = true
+	}
+
+	// A renamed subcluster keeps its statefulset, so a new subcluster cannot
+	// use a name whose statefulset name is already taken.
+	stsPathPrefix := field.NewPath("metadata").Child("annotations").Key(vmeta.SubclusterStsNamesAnnotation)
+	if _, err := vmeta.GetSubclusterStsNames(v.Annotations); err != nil {
+		allErrs = append(allErrs, field.Invalid(stsPathPrefix, v.Annotations[vmeta.SubclusterStsNamesAnnotation], err.Error()))
+	}
+	oldStsNames, err := vmeta.GetSubclusterStsNames(oldObj.Annotations)
+	if err != nil {
+		return allErrs
+	}
+	stsNames := map[string]string{}
+	for scName, stsName := range oldStsNames {
+		stsNames[stsName] = scName
+	}
+	for i := range v.Spec.Subclusters {
+		sc := &v.Spec.Subclusters[i]
+		if _, ok := oldScMap[sc.Name]; ok || renamedTo[sc.Name] {
+			continue
+		}
+		if owner, ok := stsNames[v.Name+"-"+sc.GenCompatibleFQDN()]; ok {
+			err := field.Invalid(field.NewPath("spec").Child("subclusters").Index(i).Child("name"),
+				sc.Name,
+				fmt.Sprintf("subcluster name conflicts with the statefulset of subcluster %s, which was renamed", owner))
+			allErrs = append(allErrs, err)
+		}
+	}
+	return allErrs
+}
+
 // hasValidKerberosSetup checks whether Kerberos settings are correct
 func (v *VerticaDB) hasValidKerberosSetup(allErrs field.ErrorList) field.ErrorList {
 	// Handle two valid cases.  None of the Kerberos settings are used or they
@@ -727,6 +863,43 @@ func (v *VerticaDB) hasValidTemporarySubclusterRouting(allErrs field.ErrorList)
 	return allErrs
 }
 
+// checkSubclusterTypeChange will validate a change of isPrimary for existing
+// subclusters. The operator promotes or demotes the subcluster, so this is only
+// allowed in Eon Mode and when the resulting primary nodes satisfy k-safety.
+func (v *VerticaDB) checkSubclusterTypeChange(oldObj *VerticaDB, allErrs field.ErrorList) field.ErrorList {
+	ok, inx := v.isSubclusterTypeIsChanging(oldObj)
+	if !ok {
+		return allErrs
+	}
+	fieldPrefix := field.NewPath("spec").Child("subclusters").Index(inx).Child("isPrimary")
+	if !v.IsEON() {
+		err := field.Invalid(fieldPrefix,
+			v.Spec.Subclusters[inx].IsPrimary,
+			fmt.Sprintf("subcluster %s cannot have its isPrimary type change in an Enterprise database",
+				v.Spec.Subclusters[inx].Name))
+		return append(allErrs, err)
+	}
+	if oldObj.isImageChangeInProgress() {
+		err := field.Invalid(fieldPrefix,
+			v.Spec.Subclusters[inx].IsPrimary,
+			fmt.Sprintf("subcluster %s cannot have its isPrimary type change while an image change is in progress",
+				v.Spec.Subclusters[inx].Name))
+		return append(allErrs, err)
+	}
+	minPrimaryNodes := KSafety0MinHosts
+	if v.Spec.KSafety == KSafety1 {
+		minPrimaryNodes = KSafety1MinHosts
+	}
+	if primaryNodes := v.getPrimaryCount(); primaryNodes < minPrimaryNodes {
+		err := field.Invalid(fieldPrefix,
+			v.Spec.Subclusters[inx].IsPrimary,
+			fmt.Sprintf("changing the type of subcluster %s leaves %d primary nodes, but kSafety %s needs at least %d",
+				v.Spec.Subclusters[inx].Name, primaryNodes, v.Spec.KSafety, minPrimaryNodes))
+		allErrs = append(allErrs, err)
+	}
+	return allErrs
+}
+
 func (v *VerticaDB) isSubclusterTypeIsChanging(oldObj *VerticaDB) (ok bool, scInx int) {
 	// Create a map of subclusterName -> isPrimary using the old object.
 	nameToPrimaryMap := map[string]bool{}
@@ -849,7 +1022,116 @@ func (v *VerticaDB) validateEncryptSpreadComm(allErrs field.ErrorList) field.Err
 
 func (v *VerticaDB) validateLocalStorage(allErrs field.ErrorList) field.ErrorList {
 	allErrs = v.validateLocalPaths(allErrs)
-	return v.validateDepotVolume(allErrs)
+	allErrs = v.validateDepotVolume(allErrs)
+	allErrs = v.validateLocalPVCs(allErrs)
+	allErrs = v.validateAutoGrow(allErrs)
+	return v.validatePVCRetentionPolicy(allErrs)
+}
+
+func (v *VerticaDB) validatePVCRetentionPolicy(allErrs field.ErrorList) field.ErrorList {
+	rp := v.Spec.Local.PVCRetentionPolicy
+	if rp == nil {
+		return allErrs
+	}
+	pathPrefix := field.NewPath("spec").Child("local").Child("pvcRetentionPolicy")
+	policies := []struct {
+		fieldName string
+		val       PVCRetentionPolicyType
+	}{
+		{"whenScaled", rp.WhenScaled},
+		{"whenDeleted", rp.WhenDeleted},
+	}
+	for _, p := range policies {
+		if p.val != "" && p.val != PVCRetain && p.val != PVCDelete {
+			err := field.Invalid(pathPrefix.Child(p.fieldName),
+				p.val,
+				fmt.Sprintf("valid values are %s, %s or an empty string", PVCRetain, PVCDelete))
+			allErrs = append(allErrs, err)
+		}
+	}
+	return allErrs
+}
+
+// validateAutoGrow checks the policy used to expand PVCs that are low on disk
+// space
+func (v *VerticaDB) validateAutoGrow(allErrs field.ErrorList) field.ErrorList {
+	ag := v.Spec.Local.AutoGrow
+	if ag == nil {
+		return allErrs
+	}
+	pathPrefix := field.NewPath("spec").Child("local").Child("autoGrow")
+	const MaxThresholdPercent = 99
+	if ag.ThresholdPercent < 1 || ag.ThresholdPercent > MaxThresholdPercent {
+		err := field.Invalid(pathPrefix.Child("thresholdPercent"),
+			ag.ThresholdPercent,
+			fmt.Sprintf("thresholdPercent must be between 1 and %d", MaxThresholdPercent))
+		allErrs = append(allErrs, err)
+	}
+	if ag.GrowthStep.Sign() <= 0 {
+		err := field.Invalid(pathPrefix.Child("growthStep"),
+			ag.GrowthStep.String(),
+			"growthStep must be greater than zero")
+		allErrs = append(allErrs, err)
+	}
+	if ag.MinIntervalSeconds < 0 {
+		err := field.Invalid(pathPrefix.Child("minIntervalSeconds"),
+			ag.MinIntervalSeconds,
+			"minIntervalSeconds cannot be negative")
+		allErrs = append(allErrs, err)
+	}
+	localPVCs := v.GetLocalPVCs()
+	for i := range localPVCs {
+		if ag.MaxSize.Cmp(localPVCs[i].RequestSize) < 0 {
+			err := field.Invalid(pathPrefix.Child("maxSize"),
+				ag.MaxSize.String(),
+				fmt.Sprintf("maxSize must be at least the requestSize of the %s PVC (%s)",
+					localPVCs[i].Name, localPVCs[i].RequestSize.String()))
+			allErrs = append(allErrs, err)
+		}
+	}
+	return allErrs
+}
+
+// validateLocalPVCs checks the PVCs that give the catalog, data or depot their
+// own volume. Each one needs a path that isn't shared with the others.
+func (v *VerticaDB) validateLocalPVCs(allErrs field.ErrorList) field.ErrorList {
+	loc := &v.Spec.Local
+	pathPrefix := field.NewPath("spec").Child("local")
+	claims := []struct {
+		fieldName  string
+		claim      *LocalVolumeClaim
+		pathName   string
+		pathUnique bool
+	}{
+		{"catalogPVC", loc.CatalogPVC, "catalogPath", loc.IsCatalogPathUnique()},
+		{"dataPVC", loc.DataPVC, "dataPath", loc.IsDataPathUnique()},
+		{"depotPVC", loc.DepotPVC, "depotPath", loc.IsDepotPathUnique()},
+	}
+	for i := range claims {
+		c := &claims[i]
+		if c.claim == nil {
+			continue
+		}
+		if c.claim.RequestSize.Sign() <= 0 {
+			err := field.Invalid(pathPrefix.Child(c.fieldName).Child("requestSize"),
+				c.claim.RequestSize.String(),
+				"requestSize must be greater than zero")
+			allErrs = append(allErrs, err)
+		}
+		if !c.pathUnique {
+			err := field.Invalid(pathPrefix.Child(c.fieldName),
+				c.fieldName,
+				fmt.Sprintf("%s can only be set if %s differs from the other local paths", c.fieldName, c.pathName))
+			allErrs = append(allErrs, err)
+		}
+	}
+	if loc.DepotPVC != nil && v.IsDepotVolumeEmptyDir() {
+		err := field.Invalid(pathPrefix.Child("depotPVC"),
+			"depotPVC",
+			"depotPVC cannot be set when depotVolume is EmptyDir")
+		allErrs = append(allErrs, err)
+	}
+	return allErrs
 }
 
 func (v *VerticaDB) validateLocalPaths(allErrs field.ErrorList) field.ErrorList {
@@ -940,6 +1222,163 @@ func (v *VerticaDB) hasValidShardCount(allErrs field.ErrorList) field.ErrorList
 	return append(allErrs, err)
 }
 
+// hasValidSubclusterShutdown will make sure that only secondary subclusters are
+// shutdown. Stopping a primary subcluster could cause the database to lose
+// quorum.
+func (v *VerticaDB) hasValidSubclusterShutdown(allErrs field.ErrorList) field.ErrorList {
+	for i := range v.Spec.Subclusters {
+		sc := &v.Spec.Subclusters[i]
+		if !sc.Shutdown {
+			continue
+		}
+		if sc.IsPrimary || sc.IsTransient {
+			err := field.Invalid(field.NewPath("spec").Child("subclusters").Index(i).Child("shutdown"),
+				sc.Shutdown,
+				"only secondary subclusters can be shutdown")
+			allErrs = append(allErrs, err)
+		}
+	}
+	return allErrs
+}
+
+// hasValidPdbMaxUnavailable ensures the PodDisruptionBudget override for each
+// subcluster is a non-negative number or a percentage between 0% and 100%.
+// Primary subclusters share a budget derived from the k-safety, so they cannot
+// override it.
+func (v *VerticaDB) hasValidPdbMaxUnavailable(allErrs field.ErrorList) field.ErrorList {
+	const maxPercent = 100
+	for i := range v.Spec.Subclusters {
+		mu := v.Spec.Subclusters[i].PdbMaxUnavailable
+		if mu == nil {
+			continue
+		}
+		pathPrefix := field.NewPath("spec").Child("subclusters").Index(i).Child("pdbMaxUnavailable")
+		if v.Spec.Subclusters[i].IsPrimary {
+			err := field.Invalid(pathPrefix, mu.String(),
+				"pdbMaxUnavailable cannot be set for a primary subcluster; its budget is derived from kSafety")
+			allErrs = append(allErrs, err)
+			continue
+		}
+		if mu.Type == intstr.Int {
+			if mu.IntVal < 0 {
+				err := field.Invalid(pathPrefix, mu.String(), "pdbMaxUnavailable cannot be negative")
+				allErrs = append(allErrs, err)
+			}
+			continue
+		}
+		pct, err := strconv.Atoi(strings.TrimSuffix(mu.StrVal, "%"))
+		if !strings.HasSuffix(mu.StrVal, "%") || err != nil || pct < 0 || pct > maxPercent {
+			err := field.Invalid(pathPrefix, mu.String(),
+				"pdbMaxUnavailable must be a non-negative number or a percentage between 0% and 100%")
+			allErrs = append(allErrs, err)
+		}
+	}
+	return allErrs
+}
+
+// hasValidTopology checks the settings that control how pods are spread
+// across topology domains
+func (v *VerticaDB) hasValidTopology(allErrs field.ErrorList) field.ErrorList {
+	topo := &v.Spec.Topology
+	pathPrefix := field.NewPath("spec").Child("topology")
+	switch topo.Mode {
+	case "", TopologyModeNone, TopologyModeZone:
+	default:
+		err := field.Invalid(pathPrefix.Child("mode"), topo.Mode,
+			fmt.Sprintf("mode must be one of: %s, %s", TopologyModeNone, TopologyModeZone))
+		allErrs = append(allErrs, err)
+	}
+	if topo.MaxSkew < 0 {
+		err := field.Invalid(pathPrefix.Child("maxSkew"), topo.MaxSkew, "maxSkew cannot be negative")
+		allErrs = append(allErrs, err)
+	}
+	switch topo.WhenUnsatisfiable {
+	case "", v1.DoNotSchedule, v1.ScheduleAnyway:
+	default:
+		err := field.Invalid(pathPrefix.Child("whenUnsatisfiable"), topo.WhenUnsatisfiable,
+			fmt.Sprintf("whenUnsatisfiable must be one of: %s, %s", v1.DoNotSchedule, v1.ScheduleAnyway))
+		allErrs = append(allErrs, err)
+	}
+	return allErrs
+}
+
+func (v *VerticaDB) hasValidUpgradeRollbackPolicy(allErrs field.ErrorList) field.ErrorList {
+	policy := &v.Spec.UpgradeRollbackPolicy
+	pathPrefix := field.NewPath("spec").Child("upgradeRollbackPolicy")
+	if policy.MaxRestartAttempts < 0 {
+		err := field.Invalid(pathPrefix.Child("maxRestartAttempts"),
+			policy.MaxRestartAttempts,
+			"maxRestartAttempts cannot be negative")
+		allErrs = append(allErrs, err)
+	}
+	if policy.DeadlineSeconds < 0 {
+		err := field.Invalid(pathPrefix.Child("deadlineSeconds"),
+			policy.DeadlineSeconds,
+			"deadlineSeconds cannot be negative")
+		allErrs = append(allErrs, err)
+	}
+	if policy.Enabled && policy.MaxRestartAttempts == 0 && policy.DeadlineSeconds == 0 {
+		err := field.Invalid(pathPrefix.Child("enabled"),
+			policy.Enabled,
+			"one of maxRestartAttempts or deadlineSeconds must be set when rollback is enabled")
+		allErrs = append(allErrs, err)
+	}
+	return allErrs
+}
+
+// hasValidUpgradeCanary will make sure the canary subcluster, if set, is a
+// secondary subcluster that is in the spec.
+func (v *VerticaDB) hasValidUpgradeCanary(allErrs field.ErrorList) field.ErrorList {
+	scName := v.Spec.UpgradeCanary.Subcluster
+	if scName == "" {
+		return allErrs
+	}
+	pathPrefix := field.NewPath("spec").Child("upgradeCanary").Child("subcluster")
+	sc, ok := v.GenSubclusterMap()[scName]
+	if !ok {
+		err := field.Invalid(pathPrefix,
+			scName,
+			"the canary subcluster must be one of the subclusters in spec.subclusters")
+		allErrs = append(allErrs, err)
+	} else if sc.IsPrimary {
+		err := field.Invalid(pathPrefix,
+			scName,
+			"the canary subcluster must be a secondary subcluster")
+		allErrs = append(allErrs, err)
+	}
+	return allErrs
+}
+
+// hasValidMaintenanceWindows will make sure each maintenance window has a
+// valid schedule, duration and time zone.
+func (v *VerticaDB) hasValidMaintenanceWindows(allErrs field.ErrorList) field.ErrorList {
+	for i := range v.Spec.MaintenanceWindows {
+		mw := &v.Spec.MaintenanceWindows[i]
+		pathPrefix := field.NewPath("spec").Child("maintenanceWindows").Index(i)
+		if _, err := cron.ParseStandard(mw.Schedule); err != nil {
+			err := field.Invalid(pathPrefix.Child("schedule"),
+				mw.Schedule,
+				fmt.Sprintf("schedule is not a valid cron expression: %s", err))
+			allErrs = append(allErrs, err)
+		}
+		if mw.Duration.Duration <= 0 {
+			err := field.Invalid(pathPrefix.Child("duration"),
+				mw.Duration,
+				"duration must be greater than zero")
+			allErrs = append(allErrs, err)
+		}
+		if mw.TimeZone != "" {
+			if _, err := time.LoadLocation(mw.TimeZone); err != nil {
+				err := field.Invalid(pathPrefix.Child("timeZone"),
+					mw.TimeZone,
+					fmt.Sprintf("timeZone is not a valid time zone: %s", err))
+				allErrs = append(allErrs, err)
+			}
+		}
+	}
+	return allErrs
+}
+
 func (v *VerticaDB) hasValidProbeOverrides(allErrs field.ErrorList) field.ErrorList {
 	parentField := field.NewPath("spec")
 	allErrs = v.hasValidProbeOverride(allErrs, parentField.Child("readinessProbeOverride"), v.Spec.ReadinessProbeOverride)
@@ -1059,16 +1498,31 @@ func (v *VerticaDB) checkImmutableLocalPathChange(oldObj *VerticaDB, allErrs fie
 	return allErrs
 }
 
-// checkImmutableShardCount will make sure the shard count doesn't change after
-// the db has been initialized.
-func (v *VerticaDB) checkImmutableShardCount(oldObj *VerticaDB, allErrs field.ErrorList) field.ErrorList {
-	if !v.isDBInitialized() {
+// checkShardCountChange will make sure the shard count only changes after the
+// db has been initialized if it can be done with a reshard. This is only
+// possible in Eon Mode with a new enough server version.
+func (v *VerticaDB) checkShardCountChange(oldObj *VerticaDB, allErrs field.ErrorList) field.ErrorList {
+	if !v.isDBInitialized() || v.Spec.ShardCount == oldObj.Spec.ShardCount {
 		return allErrs
 	}
-	if v.Spec.ShardCount != oldObj.Spec.ShardCount {
-		err := field.Invalid(field.NewPath("spec").Child("shardCount"),
+	fieldPath := field.NewPath("spec").Child("shardCount")
+	if !v.IsEON() || !oldObj.IsEON() {
+		err := field.Invalid(fieldPath,
 			v.Spec.ShardCount,
-			"shardCount cannot change after creation.")
+			"shardCount cannot change after creation in an Enterprise database.")
+		return append(allErrs, err)
+	}
+	if oldObj.isImageChangeInProgress() {
+		err := field.Invalid(fieldPath,
+			v.Spec.ShardCount,
+			"shardCount cannot change while an image change is in progress.")
+		return append(allErrs, err)
+	}
+	if vinf, ok := v.MakeVersionInfo(); ok && !vinf.IsEqualOrNewer(ReshardMinVersion) {
+		err := field.Invalid(fieldPath,
+			v.Spec.ShardCount,
+			fmt.Sprintf("shardCount can only change after creation if the server version is %s or newer.",
+				ReshardMinVersion))
 		allErrs = append(allErrs, err)
 	}
 	return allErrs
@@ -1118,6 +1572,93 @@ func (v *VerticaDB) checkImmutableDepotVolume(oldObj *VerticaDB, allErrs field.E
 	return allErrs
 }
 
+// checkImmutableLocalPVCs will make sure the catalog, data and depot PVCs are
+// not added or removed. The volumeClaimTemplates of a statefulset cannot be
+// changed once it is created.
+func (v *VerticaDB) checkImmutableLocalPVCs(oldObj *VerticaDB, allErrs field.ErrorList) field.ErrorList {
+	pathPrefix := field.NewPath("spec").Child("local")
+	claims := []struct {
+		fieldName string
+		newClaim  *LocalVolumeClaim
+		oldClaim  *LocalVolumeClaim
+	}{
+		{"catalogPVC", v.Spec.Local.CatalogPVC, oldObj.Spec.Local.CatalogPVC},
+		{"dataPVC", v.Spec.Local.DataPVC, oldObj.Spec.Local.DataPVC},
+		{"depotPVC", v.Spec.Local.DepotPVC, oldObj.Spec.Local.DepotPVC},
+	}
+	for i := range claims {
+		c := &claims[i]
+		if (c.newClaim == nil) != (c.oldClaim == nil) {
+			err := field.Invalid(pathPrefix.Child(c.fieldName),
+				c.fieldName,
+				fmt.Sprintf("%s cannot be added or removed after the VerticaDB is created", c.fieldName))
+			allErrs = append(allErrs, err)
+		}
+	}
+	return allErrs
+}
+
+// checkStorageClassChange will make sure a change to the storage class of any
+// of the local PVCs can be migrated. The operator migrates by removing each
+// node and rebuilding its pod with new PVCs, which is only safe for a k-safe
+// Eon Mode database.
+func (v *VerticaDB) checkStorageClassChange(oldObj *VerticaDB, allErrs field.ErrorList) field.ErrorList {
+	pathPrefix := field.NewPath("spec").Child("local")
+	type classChange struct {
+		path               *field.Path
+		newClass, oldClass string
+	}
+	changes := []classChange{
+		{pathPrefix.Child("storageClass"), v.Spec.Local.StorageClass, oldObj.Spec.Local.StorageClass},
+	}
+	claims := []struct {
+		fieldName string
+		newClaim  *LocalVolumeClaim
+		oldClaim  *LocalVolumeClaim
+	}{
+		{"catalogPVC", v.Spec.Local.CatalogPVC, oldObj.Spec.Local.CatalogPVC},
+		{"dataPVC", v.Spec.Local.DataPVC, oldObj.Spec.Local.DataPVC},
+		{"depotPVC", v.Spec.Local.DepotPVC, oldObj.Spec.Local.DepotPVC},
+	}
+	for i := range claims {
+		// Adding or removing a claim is checked in checkImmutableLocalPVCs
+		if claims[i].newClaim != nil && claims[i].oldClaim != nil {
+			changes = append(changes, classChange{pathPrefix.Child(claims[i].fieldName).Child("storageClass"),
+				claims[i].newClaim.StorageClass, claims[i].oldClaim.StorageClass})
+		}
+	}
+
+	for i := range changes {
+		c := &changes[i]
+		if c.newClass == c.oldClass {
+			continue
+		}
+		var msg string
+		switch {
+		case c.newClass == "":
+			msg = "storageClass cannot be changed to the default storage class. Set it to the name of the storage class"
+		case !v.IsEON():
+			msg = "storageClass can only change for an Eon Mode database"
+		case v.Spec.KSafety == KSafety0:
+			msg = "storageClass can only change for a database with kSafety 1 since each node is rebuilt"
+		case v.getPrimaryCount() <= KSafety1MinHosts:
+			// Each node is removed from the database while it is rebuilt.
+			// For a primary, that must not leave fewer primary nodes than
+			// kSafety 1 needs.
+			msg = fmt.Sprintf("storageClass can only change when there are more than %d primary nodes "+
+				"since each node is removed from the database while it is rebuilt", KSafety1MinHosts)
+		case v.Spec.InitPolicy == CommunalInitPolicyScheduleOnly:
+			msg = fmt.Sprintf("storageClass cannot change when initPolicy is %s", CommunalInitPolicyScheduleOnly)
+		case oldObj.isImageChangeInProgress():
+			msg = "storageClass cannot change while an image change is in progress"
+		default:
+			continue
+		}
+		allErrs = append(allErrs, field.Invalid(c.path, c.newClass, msg))
+	}
+	return allErrs
+}
+
 // setDefaultServiceName will explicitly set the serviceName in any subcluster
 // that omitted it
 func (v *VerticaDB) setDefaultServiceName() {
@@ -17,6 +17,7 @@ package v1beta1
 
 import (
 	"fmt"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -24,6 +25,7 @@ import (
 	"github.com/vertica/vertica-kubernetes/pkg/paths"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -138,6 +140,23 @@ var _ = Describe("verticadb_webhook", func() {
 		validateSpecValuesHaveErr(vdb, false)
 	})
 
+	It("should only allow valid names in configParameters", func() {
+		vdb := createVDBHelper()
+		vdb.Spec.ConfigParameters = map[string]string{
+			"MaxClientSessions": "100",
+			"maxclientsessions": "50",
+		}
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.ConfigParameters = map[string]string{
+			"MaxClientSessions": "100",
+		}
+		validateSpecValuesHaveErr(vdb, false)
+		vdb.Spec.Subclusters[0].ConfigParameters = map[string]string{
+			"Bad'Name": "1",
+		}
+		validateSpecValuesHaveErr(vdb, true)
+	})
+
 	It("should have invalid subcluster name", func() {
 		vdb := createVDBHelper()
 		sc := &vdb.Spec.Subclusters[0]
@@ -290,7 +309,7 @@ var _ = Describe("verticadb_webhook", func() {
 		}
 		validateImmutableFields(vdbUpdate, true)
 	})
-	It("should not change shardCount after DB init", func() {
+	It("should only allow shardCount to change after DB init if a reshard is possible", func() {
 		vdbUpdate := createVDBHelper()
 		vdbUpdate.Spec.ShardCount = 10
 		validateImmutableFields(vdbUpdate, false)
@@ -298,12 +317,69 @@ var _ = Describe("verticadb_webhook", func() {
 		vdbUpdate.Status.Conditions[DBInitializedIndex] = VerticaDBCondition{
 			Status: v1.ConditionTrue,
 		}
+		vdbUpdate.Annotations[VersionAnnotation] = ReshardMinVersion
+		validateImmutableFields(vdbUpdate, false)
+		// Server is too old
+		vdbUpdate.Annotations[VersionAnnotation] = "v11.0.2"
 		validateImmutableFields(vdbUpdate, true)
+		// Not allowed during an image change
+		vdbUpdate.Annotations[VersionAnnotation] = ReshardMinVersion
+		vdbOrig := createVDBHelper()
+		vdbOrig.Status.Conditions = make([]VerticaDBCondition, ImageChangeInProgressIndex+1)
+		vdbOrig.Status.Conditions[ImageChangeInProgressIndex] = VerticaDBCondition{
+			Status: v1.ConditionTrue,
+		}
+		checkErrorsForImmutableFields(vdbOrig, vdbUpdate, true)
+		// Not allowed in Enterprise
+		vdbOrig = createVDBHelper()
+		vdbOrig.Spec.ShardCount = 0
+		checkErrorsForImmutableFields(vdbOrig, vdbUpdate, true)
 	})
-	It("should not change isPrimary after creation", func() {
+	It("should only allow isPrimary to change if k-safety is kept", func() {
 		vdbUpdate := createVDBHelper()
-		vdbUpdate.Spec.Subclusters[0].IsPrimary = !vdbUpdate.Spec.Subclusters[0].IsPrimary
-		validateImmutableFields(vdbUpdate, true)
+		vdbUpdate.Spec.Subclusters = append(vdbUpdate.Spec.Subclusters,
+			Subcluster{Name: "sc2", Size: 3, IsPrimary: false})
+		vdbOrig := vdbUpdate.DeepCopy()
+		// Demoting the only primary subcluster isn't allowed
+		vdbUpdate.Spec.Subclusters[0].IsPrimary = false
+		Expect(vdbUpdate.validateImmutableFields(vdbOrig)).ShouldNot(BeEmpty())
+		// Swapping the primary is fine
+		vdbUpdate.Spec.Subclusters[1].IsPrimary = true
+		Expect(vdbUpdate.validateImmutableFields(vdbOrig)).Should(BeEmpty())
+		// Not enough primary nodes for k-safety 1
+		vdbUpdate.Spec.Subclusters[1].Size = 2
+		Expect(vdbUpdate.validateImmutableFields(vdbOrig)).ShouldNot(BeEmpty())
+		// Type changes are only for Eon Mode
+		vdbUpdate.Spec.Subclusters[1].Size = 3
+		vdbUpdate.Spec.ShardCount = 0
+		vdbUpdate.Spec.Communal.Path = ""
+		vdbOrig.Spec.ShardCount = 0
+		vdbOrig.Spec.Communal.Path = ""
+		Expect(vdbUpdate.validateImmutableFields(vdbOrig)).ShouldNot(BeEmpty())
+	})
+	It("should only allow a subcluster rename through the annotation", func() {
+		vdbOrig := createVDBHelper()
+		vdbUpdate := createVDBHelper()
+		vdbUpdate.Spec.Subclusters[0].Name = "analytics"
+		Expect(vdbUpdate.validateImmutableFields(vdbOrig)).ShouldNot(BeEmpty())
+		vdbUpdate.Annotations[vmeta.SubclusterRenamesAnnotation] = "defaultsubcluster=analytics"
+		Expect(vdbUpdate.validateImmutableFields(vdbOrig)).Should(BeEmpty())
+		vdbUpdate.Annotations[vmeta.SubclusterRenamesAnnotation] = "defaultsubcluster"
+		Expect(vdbUpdate.validateImmutableFields(vdbOrig)).ShouldNot(BeEmpty())
+		vdbUpdate.Annotations[vmeta.SubclusterRenamesAnnotation] = "defaultsubcluster=other"
+		Expect(vdbUpdate.validateImmutableFields(vdbOrig)).ShouldNot(BeEmpty())
+
+		// A new subcluster cannot reuse the statefulset of a renamed one
+		vdbOrig.Spec.Subclusters[0].Name = "analytics"
+		vdbOrig.Annotations[vmeta.SubclusterStsNamesAnnotation] = "analytics=" + vdbOrig.Name + "-defaultsubcluster"
+		vdbUpdate = vdbOrig.DeepCopy()
+		vdbUpdate.Spec.Subclusters = append(vdbUpdate.Spec.Subclusters,
+			Subcluster{Name: "defaultsubcluster", Size: 3})
+		Expect(vdbUpdate.validateImmutableFields(vdbOrig)).ShouldNot(BeEmpty())
+		vdbUpdate.Spec.Subclusters[1].Name = "sc2"
+		Expect(vdbUpdate.validateImmutableFields(vdbOrig)).Should(BeEmpty())
+		vdbUpdate.Annotations[vmeta.SubclusterStsNamesAnnotation] = "analytics"
+		Expect(vdbUpdate.validateImmutableFields(vdbOrig)).ShouldNot(BeEmpty())
 	})
 	It("should allow image change if autoRestartVertica is disabled", func() {
 		vdb := createVDBHelper()
@@ -332,10 +408,31 @@ var _ = Describe("verticadb_webhook", func() {
 		allErrs := vdb.validateImmutableFields(vdbUpdate)
 		Expect(allErrs).ShouldNot(BeNil())
 	})
-	It("should not change local.storageClass after creation", func() {
+	It("should only allow local.storageClass to change for a k-safe Eon database", func() {
 		vdbUpdate := createVDBHelper()
+		vdbUpdate.Spec.Subclusters[0].Size = 4
 		vdbUpdate.Spec.Local.StorageClass = "MyStorageClass"
+		validateImmutableFields(vdbUpdate, false)
+
+		// Removing one of 3 primaries would leave too few for kSafety 1
+		vdbUpdate.Spec.Subclusters[0].Size = 3
+		vdbUpdate.Spec.Subclusters = append(vdbUpdate.Spec.Subclusters, Subcluster{
+			Name:        "sec",
+			Size:        3,
+			ServiceType: v1.ServiceTypeClusterIP,
+		})
 		validateImmutableFields(vdbUpdate, true)
+
+		vdb := createVDBHelper()
+		vdb.Spec.KSafety = KSafety0
+		vdbUpdate.Spec.KSafety = KSafety0
+		checkErrorsForImmutableFields(vdb, vdbUpdate, true)
+
+		vdb = createVDBHelper()
+		vdb.Spec.Local.StorageClass = "MyStorageClass"
+		vdbUpdate = createVDBHelper()
+		vdbUpdate.Spec.Local.StorageClass = ""
+		checkErrorsForImmutableFields(vdb, vdbUpdate, true)
 	})
 	It("should not change local.depotVolume after DB init", func() {
 		vdbUpdate := createVDBHelper()
@@ -348,6 +445,25 @@ var _ = Describe("verticadb_webhook", func() {
 		validateImmutableFields(vdbUpdate, true)
 	})
 
+	It("should not add or remove the local PVCs after creation", func() {
+		vdbUpdate := createVDBHelper()
+		vdbUpdate.Spec.Local.CatalogPath = "/catalog"
+		vdbUpdate.Spec.Local.CatalogPVC = &LocalVolumeClaim{RequestSize: resource.MustParse("10Gi")}
+		validateImmutableFields(vdbUpdate, true)
+
+		vdb := createVDBHelper()
+		vdb.Spec.Local.CatalogPath = "/catalog"
+		vdb.Spec.Local.CatalogPVC = &LocalVolumeClaim{StorageClass: "replicated", RequestSize: resource.MustParse("10Gi")}
+		vdbUpdate.Spec.Local.CatalogPVC = &LocalVolumeClaim{StorageClass: "replicated", RequestSize: resource.MustParse("20Gi")}
+		Expect(vdb.validateImmutableFields(vdbUpdate)).Should(BeNil())
+		vdb.Spec.Subclusters[0].Size = 4
+		vdbUpdate.Spec.Subclusters[0].Size = 4
+		vdbUpdate.Spec.Local.CatalogPVC.StorageClass = "nvme"
+		Expect(vdb.validateImmutableFields(vdbUpdate)).Should(BeNil())
+		vdbUpdate.Spec.Local.CatalogPVC = nil
+		Expect(vdb.validateImmutableFields(vdbUpdate)).ShouldNot(BeNil())
+	})
+
 	It("should not have zero matched subcluster names to the old subcluster names", func() {
 		vdb := createVDBHelper()
 		vdb.Spec.Subclusters = append(vdb.Spec.Subclusters, Subcluster{
@@ -659,6 +775,65 @@ var _ = Describe("verticadb_webhook", func() {
 		validateSpecValuesHaveErr(vdb, true)
 	})
 
+	It("should only allow a local PVC for a path that isn't shared", func() {
+		vdb := MakeVDB()
+		vdb.Spec.Local.DataPath = "/data"
+		vdb.Spec.Local.CatalogPath = "/data"
+		vdb.Spec.Local.DepotPath = "/depot"
+		vdb.Spec.Local.CatalogPVC = &LocalVolumeClaim{RequestSize: resource.MustParse("10Gi")}
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.Local.CatalogPath = "/catalog"
+		validateSpecValuesHaveErr(vdb, false)
+		vdb.Spec.Local.CatalogPVC.RequestSize = resource.MustParse("0")
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.Local.CatalogPVC.RequestSize = resource.MustParse("10Gi")
+
+		vdb.Spec.Local.DepotPVC = &LocalVolumeClaim{StorageClass: "nvme", RequestSize: resource.MustParse("100Gi")}
+		validateSpecValuesHaveErr(vdb, false)
+		vdb.Spec.Local.DepotVolume = EmptyDir
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.Local.DepotVolume = PersistentVolume
+		vdb.Spec.Local.DataPVC = &LocalVolumeClaim{RequestSize: resource.MustParse("10Gi")}
+		validateSpecValuesHaveErr(vdb, false)
+		vdb.Spec.Local.DataPath = "/depot"
+		validateSpecValuesHaveErr(vdb, true)
+	})
+
+	It("should validate the autoGrow policy", func() {
+		vdb := MakeVDB()
+		vdb.Spec.Local.AutoGrow = &LocalStorageAutoGrow{
+			ThresholdPercent:   80,
+			GrowthStep:         resource.MustParse("50Gi"),
+			MaxSize:            resource.MustParse("1Ti"),
+			MinIntervalSeconds: 600,
+		}
+		validateSpecValuesHaveErr(vdb, false)
+		vdb.Spec.Local.AutoGrow.ThresholdPercent = 100
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.Local.AutoGrow.ThresholdPercent = 0
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.Local.AutoGrow.ThresholdPercent = 90
+		vdb.Spec.Local.AutoGrow.GrowthStep = resource.MustParse("0")
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.Local.AutoGrow.GrowthStep = resource.MustParse("50Gi")
+		vdb.Spec.Local.AutoGrow.MinIntervalSeconds = -1
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.Local.AutoGrow.MinIntervalSeconds = 0
+		validateSpecValuesHaveErr(vdb, false)
+		vdb.Spec.Local.AutoGrow.MaxSize = resource.MustParse("5Gi")
+		validateSpecValuesHaveErr(vdb, true)
+	})
+
+	It("should only allow Retain or Delete in the pvcRetentionPolicy", func() {
+		vdb := MakeVDB()
+		vdb.Spec.Local.PVCRetentionPolicy = &PVCRetentionPolicy{WhenScaled: PVCDelete, WhenDeleted: PVCRetain}
+		validateSpecValuesHaveErr(vdb, false)
+		vdb.Spec.Local.PVCRetentionPolicy.WhenScaled = ""
+		validateSpecValuesHaveErr(vdb, false)
+		vdb.Spec.Local.PVCRetentionPolicy.WhenDeleted = "Keep"
+		validateSpecValuesHaveErr(vdb, true)
+	})
+
 	It("should prevent internally generated labels to be overridden", func() {
 		vdb := MakeVDB()
 		vdb.Spec.Labels = map[string]string{
@@ -691,6 +866,65 @@ var _ = Describe("verticadb_webhook", func() {
 		validateSpecValuesHaveErr(vdb, false)
 	})
 
+	It("should only allow secondary subclusters to be shutdown", func() {
+		vdb := createVDBHelper()
+		vdb.Spec.Subclusters = append(vdb.Spec.Subclusters, Subcluster{
+			Name:        "sc2",
+			Size:        3,
+			IsPrimary:   false,
+			ServiceType: "ClusterIP",
+			Shutdown:    true,
+		})
+		validateSpecValuesHaveErr(vdb, false)
+		vdb.Spec.Subclusters[0].Shutdown = true
+		validateSpecValuesHaveErr(vdb, true)
+	})
+
+	It("should validate the upgrade rollback policy", func() {
+		vdb := createVDBHelper()
+		vdb.Spec.UpgradeRollbackPolicy.Enabled = true
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.UpgradeRollbackPolicy.MaxRestartAttempts = 3
+		validateSpecValuesHaveErr(vdb, false)
+		vdb.Spec.UpgradeRollbackPolicy.DeadlineSeconds = -1
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.UpgradeRollbackPolicy.DeadlineSeconds = 600
+		vdb.Spec.UpgradeRollbackPolicy.MaxRestartAttempts = 0
+		validateSpecValuesHaveErr(vdb, false)
+	})
+
+	It("should validate the upgrade canary subcluster", func() {
+		vdb := createVDBHelper()
+		vdb.Spec.UpgradeCanary.Subcluster = "not-there"
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.UpgradeCanary.Subcluster = vdb.Spec.Subclusters[0].Name
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.Subclusters = append(vdb.Spec.Subclusters, Subcluster{
+			Name:        "canary",
+			Size:        3,
+			IsPrimary:   false,
+			ServiceType: "ClusterIP",
+		})
+		vdb.Spec.UpgradeCanary.Subcluster = "canary"
+		validateSpecValuesHaveErr(vdb, false)
+	})
+
+	It("should validate the maintenance windows", func() {
+		vdb := createVDBHelper()
+		vdb.Spec.MaintenanceWindows = []MaintenanceWindow{
+			{Schedule: "0 2 * * SUN", Duration: metav1.Duration{Duration: 2 * time.Hour}, TimeZone: "America/Toronto"},
+		}
+		validateSpecValuesHaveErr(vdb, false)
+		vdb.Spec.MaintenanceWindows[0].Schedule = "not a schedule"
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.MaintenanceWindows[0].Schedule = "0 2 * * *"
+		vdb.Spec.MaintenanceWindows[0].Duration.Duration = 0
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.MaintenanceWindows[0].Duration.Duration = time.Hour
+		vdb.Spec.MaintenanceWindows[0].TimeZone = "Not/AZone"
+		validateSpecValuesHaveErr(vdb, true)
+	})
+
 	It("should not allow invalid http server transitions", func() {
 		// Enabled -> Disabled
 		validateHTTPServerModeTransition(HTTPServerModeEnabled, HTTPServerModeDisabled, true)
@@ -759,6 +993,45 @@ var _ = Describe("verticadb_webhook", func() {
 		vdb.Spec.ShardCount = 1
 		validateSpecValuesHaveErr(vdb, false)
 	})
+
+	It("should verify the pdb maxUnavailable override", func() {
+		vdb := MakeVDB()
+		mu := intstr.FromInt(2)
+		vdb.Spec.Subclusters = append(vdb.Spec.Subclusters, Subcluster{
+			Name:        "sc2",
+			Size:        3,
+			ServiceType: v1.ServiceTypeClusterIP,
+		})
+		vdb.Spec.Subclusters[0].PdbMaxUnavailable = &mu
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.Subclusters[0].PdbMaxUnavailable = nil
+		vdb.Spec.Subclusters[1].PdbMaxUnavailable = &mu
+		validateSpecValuesHaveErr(vdb, false)
+		mu = intstr.FromInt(-1)
+		validateSpecValuesHaveErr(vdb, true)
+		mu = intstr.FromString("50%")
+		validateSpecValuesHaveErr(vdb, false)
+		mu = intstr.FromString("101%")
+		validateSpecValuesHaveErr(vdb, true)
+		mu = intstr.FromString("half")
+		validateSpecValuesHaveErr(vdb, true)
+	})
+
+	It("should verify the topology settings", func() {
+		vdb := MakeVDB()
+		vdb.Spec.Topology.Mode = TopologyModeZone
+		validateSpecValuesHaveErr(vdb, false)
+		vdb.Spec.Topology.Mode = "Rack"
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.Topology.Mode = TopologyModeZone
+		vdb.Spec.Topology.MaxSkew = -1
+		validateSpecValuesHaveErr(vdb, true)
+		vdb.Spec.Topology.MaxSkew = 2
+		vdb.Spec.Topology.WhenUnsatisfiable = v1.ScheduleAnyway
+		validateSpecValuesHaveErr(vdb, false)
+		vdb.Spec.Topology.WhenUnsatisfiable = "Sometimes"
+		validateSpecValuesHaveErr(vdb, true)
+	})
 })
 
 func createVDBHelper() *VerticaDB {
@@ -0,0 +1,191 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// OperationType is the kind of action a VerticaDBOperation will do
+type OperationType string
+
+const (
+	// OperationRestartSubcluster will drain, stop and restart the vertica
+	// nodes of the target subclusters.
+	OperationRestartSubcluster OperationType = "RestartSubcluster"
+	// OperationRebalanceShards will call rebalance_shards for the target
+	// subclusters, or all subclusters if none are given.
+	OperationRebalanceShards OperationType = "RebalanceShards"
+	// OperationAnalyzeStatistics will call analyze_statistics for all tables
+	// in the database.
+	OperationAnalyzeStatistics OperationType = "AnalyzeStatistics"
+	// OperationKillSessions will close the client sessions connected to the
+	// target subclusters or pods, or all sessions if no target is given.
+	OperationKillSessions OperationType = "KillSessions"
+	// OperationReinstall will redo the install steps (EULA acceptance,
+	// config directories, admintools.conf and http certs) for the pods in the
+	// target subclusters, or all pods if none are given.  This is done even
+	// for pods that were already installed.
+	OperationReinstall OperationType = "Reinstall"
+)
+
+// VerticaDBOperationSpec defines the desired state of VerticaDBOperation
+type VerticaDBOperationSpec struct {
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// The name of the VerticaDB CR that the operation is done against. It must
+	// be in the same namespace as this CR.
+	VerticaDBName string `json:"verticaDBName"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum:=RestartSubcluster;RebalanceShards;AnalyzeStatistics;KillSessions;Reinstall
+	// The operation to perform. The operation is done once. To do it again,
+	// create a new VerticaDBOperation.
+	Type OperationType `json:"type"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Optional
+	// The names of the subclusters to target. This is required for
+	// RestartSubcluster. It is optional for RebalanceShards, KillSessions and
+	// Reinstall, where an empty list means all subclusters. It isn't used by
+	// the other operations.
+	Subclusters []string `json:"subclusters,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Optional
+	// The names of the pods to target. This is only used by KillSessions, in
+	// addition to any pods in subclusters.
+	Pods []string `json:"pods,omitempty"`
+}
+
+const (
+	// OperationPending means the operation hasn't started yet. It may be
+	// waiting for another operation against the same VerticaDB to finish.
+	OperationPending = "Pending"
+	// OperationRunning means the operation has started.
+	OperationRunning = "Running"
+	// OperationSucceeded means the operation finished successfully.
+	OperationSucceeded = "Succeeded"
+	// OperationFailed means the operation could not be done. The message in
+	// the status will have the reason.
+	OperationFailed = "Failed"
+)
+
+// VerticaDBOperationStatus defines the observed state of VerticaDBOperation
+type VerticaDBOperationStatus struct {
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The phase of the operation. One of Pending, Running, Succeeded or Failed.
+	Phase string `json:"phase,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// A message describing the current phase.
+	Message string `json:"message,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The time the operation moved to the Running phase.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The time the operation moved to the Succeeded or Failed phase.
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The names of the steps of the operation that have finished. An operation
+	// is made up of one or more steps that are done in order.
+	CompletedSteps []string `json:"completedSteps,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// Output produced by the operation, such as the result of the SQL it ran.
+	Output string `json:"output,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:categories=all;vertica,shortName=vop
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="VerticaDB",type="string",JSONPath=".spec.verticaDBName"
+//+kubebuilder:printcolumn:name="Type",type="string",JSONPath=".spec.type"
+//+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// VerticaDBOperation is the Schema for the verticadboperations API
+type VerticaDBOperation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VerticaDBOperationSpec   `json:"spec,omitempty"`
+	Status VerticaDBOperationStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// VerticaDBOperationList contains a list of VerticaDBOperation
+type VerticaDBOperationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VerticaDBOperation `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VerticaDBOperation{}, &VerticaDBOperationList{})
+}
+
+func (v *VerticaDBOperation) ExtractNamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Name:      v.ObjectMeta.Name,
+		Namespace: v.ObjectMeta.Namespace,
+	}
+}
+
+// IsFinished returns true if the operation has reached a terminal phase
+func (v *VerticaDBOperation) IsFinished() bool {
+	return v.Status.Phase == OperationSucceeded || v.Status.Phase == OperationFailed
+}
+
+// IsMutating returns true if the operation changes the state of the database
+// or its pods. At most one mutating operation can run against a VerticaDB at
+// a time.
+func (v *VerticaDBOperation) IsMutating() bool {
+	return v.Spec.Type != OperationAnalyzeStatistics
+}
+
+// MakeVOPName is a helper that creates a sample name for test purposes
+func MakeVOPName() types.NamespacedName {
+	return types.NamespacedName{Name: "vertica-operation-sample", Namespace: "default"}
+}
+
+// MakeVOP is a helper that constructs a VerticaDBOperation struct using the
+// sample name. This is intended for test purposes.
+func MakeVOP() *VerticaDBOperation {
+	nm := MakeVOPName()
+	vdbNm := MakeVDBName()
+	return &VerticaDBOperation{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: GroupVersion.String(),
+			Kind:       VerticaDBOperationKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nm.Name,
+			Namespace: nm.Namespace,
+			UID:       "zyxwvu-tsr",
+		},
+		Spec: VerticaDBOperationSpec{
+			VerticaDBName: vdbNm.Name,
+			Type:          OperationAnalyzeStatistics,
+		},
+	}
+}
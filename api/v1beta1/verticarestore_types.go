@@ -0,0 +1,148 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// VerticaRestoreSpec defines the desired state of VerticaRestore
+type VerticaRestoreSpec struct {
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// The name of the VerticaDB CR to revive from the restore point. The
+	// VerticaDB must have an initPolicy of Revive and must not have been
+	// initialized yet. It can be created before or after this CR.
+	VerticaDBName string `json:"verticaDBName"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Required
+	// The name of the archive in communal storage that holds the restore point.
+	ArchiveName string `json:"archiveName"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum:=0
+	// The index of the restore point in the archive to revive from. The most
+	// recent restore point has an index of 1. Exactly one of
+	// restorePointIndex or restorePointID must be set.
+	RestorePointIndex int `json:"restorePointIndex,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +kubebuilder:validation:Optional
+	// The unique identifier of the restore point to revive from. Exactly one
+	// of restorePointIndex or restorePointID must be set.
+	RestorePointID string `json:"restorePointID,omitempty"`
+}
+
+const (
+	// RestorePending means the restore has been validated and is waiting for
+	// the VerticaDB to be revived.
+	RestorePending = "Pending"
+	// RestoreInProgress means revive has been started with the restore point.
+	RestoreInProgress = "InProgress"
+	// RestoreSucceeded means the database was revived from the restore point.
+	RestoreSucceeded = "Succeeded"
+	// RestoreFailed means the restore cannot be done. The message in the status
+	// will have the reason.
+	RestoreFailed = "Failed"
+)
+
+// VerticaRestoreStatus defines the observed state of VerticaRestore
+type VerticaRestoreStatus struct {
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The state of the restore. One of Pending, InProgress, Succeeded or Failed.
+	State string `json:"state,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// A message describing the current state.
+	Message string `json:"message,omitempty"`
+
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// The time the database was revived from the restore point.
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:categories=all;vertica,shortName=vrs
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="VerticaDB",type="string",JSONPath=".spec.verticaDBName"
+//+kubebuilder:printcolumn:name="Archive",type="string",JSONPath=".spec.archiveName"
+//+kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// VerticaRestore is the Schema for the verticarestores API
+type VerticaRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VerticaRestoreSpec   `json:"spec,omitempty"`
+	Status VerticaRestoreStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// VerticaRestoreList contains a list of VerticaRestore
+type VerticaRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VerticaRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VerticaRestore{}, &VerticaRestoreList{})
+}
+
+func (v *VerticaRestore) ExtractNamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Name:      v.ObjectMeta.Name,
+		Namespace: v.ObjectMeta.Namespace,
+	}
+}
+
+// IsFinished returns true if the restore has reached a terminal state
+func (v *VerticaRestore) IsFinished() bool {
+	return v.Status.State == RestoreSucceeded || v.Status.State == RestoreFailed
+}
+
+// MakeVRSName is a helper that creates a sample name for test purposes
+func MakeVRSName() types.NamespacedName {
+	return types.NamespacedName{Name: "vertica-restore-sample", Namespace: "default"}
+}
+
+// MakeVRS is a helper that constructs a VerticaRestore struct using the sample
+// name. This is intended for test purposes.
+func MakeVRS() *VerticaRestore {
+	nm := MakeVRSName()
+	vdbNm := MakeVDBName()
+	return &VerticaRestore{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: GroupVersion.String(),
+			Kind:       VerticaRestoreKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nm.Name,
+			Namespace: nm.Namespace,
+			UID:       "qponml-kji",
+		},
+		Spec: VerticaRestoreSpec{
+			VerticaDBName:     vdbNm.Name,
+			ArchiveName:       "vertica_backup_sample",
+			RestorePointIndex: 1,
+		},
+	}
+}
@@ -44,7 +44,9 @@ import (
 	"github.com/vertica/vertica-kubernetes/pkg/builder"
 	"github.com/vertica/vertica-kubernetes/pkg/controllers/et"
 	"github.com/vertica/vertica-kubernetes/pkg/controllers/vas"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers/vbk"
 	"github.com/vertica/vertica-kubernetes/pkg/controllers/vdb"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers/vrs"
 	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
 	"github.com/vertica/vertica-kubernetes/pkg/opcfg"
 	"github.com/vertica/vertica-kubernetes/pkg/security"
@@ -101,7 +103,7 @@ func getIsWebhookEnabled() bool {
 // addReconcilersToManager will add a controller for each CR that this operator
 // handles.  If any failure occurs, if will exit the program.
 func addReconcilersToManager(mgr manager.Manager, restCfg *rest.Config, oc *opcfg.OperatorConfig) {
-	if err := (&vdb.VerticaDBReconciler{
+	vdbRec := &vdb.VerticaDBReconciler{
 		Client: mgr.GetClient(),
 		Log:    ctrl.Log.WithName("controllers").WithName("VerticaDB"),
 		Scheme: mgr.GetScheme(),
@@ -112,10 +114,20 @@ func addReconcilersToManager(mgr manager.Manager, restCfg *rest.Config, oc *opcf
 			ServiceAccountName: oc.ServiceAccountName,
 			PrefixName:         oc.PrefixName,
 		},
-	}).SetupWithManager(mgr); err != nil {
+	}
+	if err := vdbRec.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "VerticaDB")
 		os.Exit(1)
 	}
+	// The VerticaDBOperation controller reuses the VerticaDB reconciler to
+	// carry out each operation.
+	if err := (&vdb.VerticaDBOperationReconciler{
+		VRec: vdbRec,
+		Log:  ctrl.Log.WithName("controllers").WithName("VerticaDBOperation"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VerticaDBOperation")
+		os.Exit(1)
+	}
 
 	if err := (&vas.VerticaAutoscalerReconciler{
 		Client: mgr.GetClient(),
@@ -134,6 +146,25 @@ func addReconcilersToManager(mgr manager.Manager, restCfg *rest.Config, oc *opcf
 		setupLog.Error(err, "unable to create controller", "controller", "EventTrigger")
 		os.Exit(1)
 	}
+	if err := (&vbk.VerticaBackupReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Cfg:    restCfg,
+		EVRec:  mgr.GetEventRecorderFor(vmeta.OperatorName),
+		Log:    ctrl.Log.WithName("controllers").WithName("VerticaBackup"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VerticaBackup")
+		os.Exit(1)
+	}
+	if err := (&vrs.VerticaRestoreReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		EVRec:  mgr.GetEventRecorderFor(vmeta.OperatorName),
+		Log:    ctrl.Log.WithName("controllers").WithName("VerticaRestore"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VerticaRestore")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 }
 
@@ -49,77 +49,96 @@ const (
 	RestartNodesNotDownRequeueWaitTimeInSeconds = 10
 )
 
+// The categories of failures that we can detect from the output of a failed
+// admin command.
+const (
+	FailureDiskFull                = "DiskFull"
+	FailureNodesNotDown            = "NodesNotDown"
+	FailureS3EndpointIssue         = "S3EndpointIssue"
+	FailureS3BucketDoesNotExist    = "S3BucketDoesNotExist"
+	FailureCommunalPathNotEmpty    = "CommunalPathNotEmpty"
+	FailureS3WrongRegion           = "S3WrongRegion"
+	FailureInvalidConfigParm       = "InvalidConfigParm"
+	FailureInvalidS3SseCustomerKey = "InvalidS3SseCustomerKey"
+	FailureKerberosAuth            = "KerberosAuth"
+	FailureClusterLeaseNotExpired  = "ClusterLeaseNotExpired"
+	FailureDatabaseNotFound        = "DatabaseNotFound"
+	FailurePermissionDenied        = "PermissionDenied"
+	FailureNodeCountMismatch       = "NodeCountMismatch"
+	FailureGeneric                 = "Generic"
+)
+
 // LogFailure is called when admintools had attempted an option but
 // failed. The command used, along with the output of the command are
 // given. This function will parse the output and determine the appropriate
 // Event and log message to write.
 func (a *ATErrors) LogFailure(cmd, op string, err error) (ctrl.Result, error) {
-	switch {
-	case isDiskFull(op):
+	switch GetFailureCategory(op) {
+	case FailureDiskFull:
 		a.Writer.Eventf(a.VDB, corev1.EventTypeWarning, events.MgmtFailedDiskFull,
 			"'admintools -t %s' failed because of disk full", cmd)
 		return ctrl.Result{Requeue: true}, nil
 
-	case areSomeNodesUpForRestart(op):
+	case FailureNodesNotDown:
 		a.Writer.Eventf(a.VDB, corev1.EventTypeWarning, a.GenericFailureReason,
 			"Failed while calling 'admintools -t %s'", cmd)
 		return ctrl.Result{Requeue: false, RequeueAfter: time.Second * RestartNodesNotDownRequeueWaitTimeInSeconds}, nil
 
-	case cloud.IsEndpointBadError(op):
+	case FailureS3EndpointIssue:
 		a.Writer.Eventf(a.VDB, corev1.EventTypeWarning, events.S3EndpointIssue,
 			"Unable to write to the bucket in the S3 endpoint '%s'", a.VDB.Spec.Communal.Endpoint)
 		return ctrl.Result{Requeue: true}, nil
 
-	case cloud.IsBucketNotExistError(op):
+	case FailureS3BucketDoesNotExist:
 		a.Writer.Eventf(a.VDB, corev1.EventTypeWarning, events.S3BucketDoesNotExist,
 			"The bucket in the S3 path '%s' does not exist", a.VDB.GetCommunalPath())
 		return ctrl.Result{Requeue: true}, nil
 
-	case isCommunalPathNotEmpty(op):
+	case FailureCommunalPathNotEmpty:
 		a.Writer.Eventf(a.VDB, corev1.EventTypeWarning, events.CommunalPathIsNotEmpty,
 			"The communal path '%s' is not empty", a.VDB.GetCommunalPath())
 		return ctrl.Result{Requeue: true}, nil
 
-	case isWrongRegion(op):
+	case FailureS3WrongRegion:
 		a.Writer.Event(a.VDB, corev1.EventTypeWarning, events.S3WrongRegion,
 			"You are trying to access your S3 bucket using the wrong region")
 		return ctrl.Result{Requeue: true}, nil
 
-	case isConfigParmWrong(op):
+	case FailureInvalidConfigParm:
 		a.Writer.Event(a.VDB, corev1.EventTypeWarning, events.InvalidConfigParm,
 			"Invalid communal storage parameter")
 		return ctrl.Result{Requeue: true}, nil
 
-	case isS3SseCustomerKeyInvalid(op):
+	case FailureInvalidS3SseCustomerKey:
 		a.Writer.Event(a.VDB, corev1.EventTypeWarning, events.InvalidS3SseCustomerKey,
 			"Invalid key: should be either 32-character plaintext or 44-character base64-encoded")
 		return ctrl.Result{Requeue: true}, nil
 
-	case isKerberosAuthError(op):
+	case FailureKerberosAuth:
 		a.Writer.Event(a.VDB, corev1.EventTypeWarning, events.KerberosAuthError,
 			"Error during keberos authentication")
 		return ctrl.Result{Requeue: true}, nil
 
-	case isClusterLeaseNotExpired(op):
+	case FailureClusterLeaseNotExpired:
 		a.Writer.Eventf(a.VDB, corev1.EventTypeWarning, events.ReviveDBClusterInUse,
 			"revive_db failed because the cluster lease has not expired for '%s'",
 			a.VDB.GetCommunalPath())
 		return ctrl.Result{Requeue: true}, nil
 
-	case isDatabaseNotFound(op):
+	case FailureDatabaseNotFound:
 		a.Writer.Eventf(a.VDB, corev1.EventTypeWarning, events.ReviveDBNotFound,
 			"revive_db failed because the database '%s' could not be found in the communal path '%s'",
 			a.VDB.Spec.DBName, a.VDB.GetCommunalPath())
 		return ctrl.Result{Requeue: true}, nil
 
-	case isPermissionDeniedError(op):
+	case FailurePermissionDenied:
 		a.Writer.Eventf(a.VDB, corev1.EventTypeWarning, events.ReviveDBPermissionDenied,
 			"revive_db failed because of a permission denied error. Verify these paths match the "+
 				"ones used by the database: 'DATA,TEMP' => %s, 'DEPOT' => %s, 'CATALOG' => %s",
 			a.VDB.Spec.Local.DataPath, a.VDB.Spec.Local.DepotPath, a.VDB.Spec.Local.GetCatalogPath())
 		return ctrl.Result{Requeue: true}, nil
 
-	case isNodeCountMismatch(op):
+	case FailureNodeCountMismatch:
 		a.Writer.Event(a.VDB, corev1.EventTypeWarning, events.ReviveDBNodeCountMismatch,
 			"revive_db failed because of a node count mismatch")
 		return ctrl.Result{Requeue: true}, nil
@@ -131,6 +150,43 @@ func (a *ATErrors) LogFailure(cmd, op string, err error) (ctrl.Result, error) {
 	}
 }
 
+// GetFailureCategory will look at the output of a failed admin command and
+// return the category of failure that it falls into. FailureGeneric is
+// returned if no specific error is found.
+//
+//nolint:gocyclo
+func GetFailureCategory(op string) string {
+	switch {
+	case isDiskFull(op):
+		return FailureDiskFull
+	case areSomeNodesUpForRestart(op):
+		return FailureNodesNotDown
+	case cloud.IsEndpointBadError(op):
+		return FailureS3EndpointIssue
+	case cloud.IsBucketNotExistError(op):
+		return FailureS3BucketDoesNotExist
+	case isCommunalPathNotEmpty(op):
+		return FailureCommunalPathNotEmpty
+	case isWrongRegion(op):
+		return FailureS3WrongRegion
+	case isConfigParmWrong(op):
+		return FailureInvalidConfigParm
+	case isS3SseCustomerKeyInvalid(op):
+		return FailureInvalidS3SseCustomerKey
+	case isKerberosAuthError(op):
+		return FailureKerberosAuth
+	case isClusterLeaseNotExpired(op):
+		return FailureClusterLeaseNotExpired
+	case isDatabaseNotFound(op):
+		return FailureDatabaseNotFound
+	case isPermissionDeniedError(op):
+		return FailurePermissionDenied
+	case isNodeCountMismatch(op):
+		return FailureNodeCountMismatch
+	}
+	return FailureGeneric
+}
+
 // isDiskFull looks at the admintools output to see if the a diskfull error occurred
 func isDiskFull(op string) bool {
 	re := regexp.MustCompile(`OSError: \[Errno 28\] No space left on device`)
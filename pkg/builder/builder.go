@@ -29,6 +29,7 @@ import (
 	"github.com/vertica/vertica-kubernetes/pkg/paths"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -129,7 +130,7 @@ func buildVolumeMounts(vdb *vapi.VerticaDB) []corev1.VolumeMount {
 		{Name: vapi.LocalDataPVC, MountPath: paths.LocalDataPath},
 		buildConfigVolumeMount(vdb),
 		{Name: vapi.LocalDataPVC, SubPath: vdb.GetPVSubPath("log"), MountPath: paths.LogPath},
-		{Name: vapi.LocalDataPVC, SubPath: vdb.GetPVSubPath("data"), MountPath: vdb.Spec.Local.DataPath},
+		buildLocalPathVolumeMount(vdb, vdb.Spec.Local.DataPVC, vapi.LocalDataFilesPVC, "data", vdb.Spec.Local.DataPath),
 		{Name: vapi.PodInfoMountName, MountPath: paths.PodInfoPath},
 	}
 	// Only mount separate depot/catalog paths if the paths are different in the
@@ -142,15 +143,13 @@ func buildVolumeMounts(vdb *vapi.VerticaDB) []corev1.VolumeMount {
 				Name: vapi.DepotMountName, MountPath: vdb.Spec.Local.DepotPath,
 			})
 		} else {
-			volMnts = append(volMnts, corev1.VolumeMount{
-				Name: vapi.LocalDataPVC, SubPath: vdb.GetPVSubPath("depot"), MountPath: vdb.Spec.Local.DepotPath,
-			})
+			volMnts = append(volMnts,
+				buildLocalPathVolumeMount(vdb, vdb.Spec.Local.DepotPVC, vapi.LocalDepotPVC, "depot", vdb.Spec.Local.DepotPath))
 		}
 	}
 	if vdb.Spec.Local.GetCatalogPath() != vdb.Spec.Local.DataPath && vdb.Spec.Local.GetCatalogPath() != vdb.Spec.Local.DepotPath {
-		volMnts = append(volMnts, corev1.VolumeMount{
-			Name: vapi.LocalDataPVC, SubPath: vdb.GetPVSubPath("catalog"), MountPath: vdb.Spec.Local.GetCatalogPath(),
-		})
+		volMnts = append(volMnts,
+			buildLocalPathVolumeMount(vdb, vdb.Spec.Local.CatalogPVC, vapi.LocalCatalogPVC, "catalog", vdb.Spec.Local.GetCatalogPath()))
 	}
 
 	if vdb.Spec.LicenseSecret != "" {
@@ -185,6 +184,16 @@ func buildVolumeMounts(vdb *vapi.VerticaDB) []corev1.VolumeMount {
 	return volMnts
 }
 
+// buildLocalPathVolumeMount returns the volume mount for one of the catalog,
+// data or depot paths. If the path has its own PVC, the entire volume is
+// mounted. Otherwise, a subPath in the local data PVC is used.
+func buildLocalPathVolumeMount(vdb *vapi.VerticaDB, claim *vapi.LocalVolumeClaim, pvcName, subPath, mountPath string) corev1.VolumeMount {
+	if claim != nil {
+		return corev1.VolumeMount{Name: pvcName, MountPath: mountPath}
+	}
+	return corev1.VolumeMount{Name: vapi.LocalDataPVC, SubPath: vdb.GetPVSubPath(subPath), MountPath: mountPath}
+}
+
 func buildKerberosVolumeMounts() []corev1.VolumeMount {
 	// We create two mounts.  One is to set /etc/krb5.conf.  It needs to be set
 	// at the specific location.  The second one is to mount a directory that
@@ -525,6 +534,7 @@ func buildPodSpec(vdb *vapi.VerticaDB, sc *vapi.Subcluster, deployNames *Deploym
 		NodeSelector:                  sc.NodeSelector,
 		Affinity:                      GetK8sAffinity(sc.Affinity),
 		Tolerations:                   sc.Tolerations,
+		TopologySpreadConstraints:     buildTopologySpreadConstraints(vdb, sc),
 		ImagePullSecrets:              GetK8sLocalObjectReferenceArray(vdb.Spec.ImagePullSecrets),
 		Containers:                    makeContainers(vdb, sc),
 		Volumes:                       buildVolumes(vdb, deployNames),
@@ -534,6 +544,33 @@ func buildPodSpec(vdb *vapi.VerticaDB, sc *vapi.Subcluster, deployNames *Deploym
 	}
 }
 
+// buildTopologySpreadConstraints returns the constraints that spread the pods
+// of a subcluster across the topology domains. Nothing is returned unless the
+// zone topology mode is enabled.
+func buildTopologySpreadConstraints(vdb *vapi.VerticaDB, sc *vapi.Subcluster) []corev1.TopologySpreadConstraint {
+	if !vdb.IsZoneTopologyEnabled() {
+		return nil
+	}
+	maxSkew := vdb.Spec.Topology.MaxSkew
+	if maxSkew == 0 {
+		maxSkew = 1
+	}
+	whenUnsatisfiable := vdb.Spec.Topology.WhenUnsatisfiable
+	if whenUnsatisfiable == "" {
+		whenUnsatisfiable = corev1.DoNotSchedule
+	}
+	return []corev1.TopologySpreadConstraint{
+		{
+			MaxSkew:           maxSkew,
+			TopologyKey:       vdb.GetTopologyKey(),
+			WhenUnsatisfiable: whenUnsatisfiable,
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: MakeStsSelectorLabels(vdb, sc),
+			},
+		},
+	}
+}
+
 // buildPodSecurityPolicy will create the security policy for the pod spec
 func buildPodSecurityPolicy(vdb *vapi.VerticaDB) *corev1.PodSecurityContext {
 	// If anything was specified in the vdb, we use that as the base. Otherwise,
@@ -805,20 +842,20 @@ func pickImage(vdb *vapi.VerticaDB, sc *vapi.Subcluster) string {
 	if sc.ImageOverride != "" {
 		return sc.ImageOverride
 	}
-	return vdb.Spec.Image
+	return vdb.GetDesiredImage()
 }
 
 // getStorageClassName returns a  pointer to the StorageClass
-func getStorageClassName(vdb *vapi.VerticaDB) *string {
-	if vdb.Spec.Local.StorageClass == "" {
+func getStorageClassName(storageClass string) *string {
+	if storageClass == "" {
 		return nil
 	}
-	return &vdb.Spec.Local.StorageClass
+	return &storageClass
 }
 
 // BuildStsSpec builds manifest for a subclusters statefulset
 func BuildStsSpec(nm types.NamespacedName, vdb *vapi.VerticaDB, sc *vapi.Subcluster, deployNames *DeploymentNames) *appsv1.StatefulSet {
-	isControllerRef := true
+	stsSize := sc.GetStsSize()
 	return &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        nm.Name,
@@ -831,7 +868,7 @@ func BuildStsSpec(nm types.NamespacedName, vdb *vapi.VerticaDB, sc *vapi.Subclus
 				MatchLabels: MakeStsSelectorLabels(vdb, sc),
 			},
 			ServiceName: names.GenHlSvcName(vdb).Name,
-			Replicas:    &sc.Size,
+			Replicas:    &stsSize,
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels:      MakeLabelsForPodObject(vdb, sc),
@@ -839,38 +876,121 @@ func BuildStsSpec(nm types.NamespacedName, vdb *vapi.VerticaDB, sc *vapi.Subclus
 				},
 				Spec: buildPodSpec(vdb, sc, deployNames),
 			},
-			UpdateStrategy:      makeUpdateStrategy(vdb),
-			PodManagementPolicy: appsv1.ParallelPodManagement,
-			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: vapi.LocalDataPVC,
-						// Set the ownerReference so that we get auto-deletion
-						OwnerReferences: []metav1.OwnerReference{
-							{
-								APIVersion: vapi.GroupVersion.String(),
-								Kind:       vapi.VerticaDBKind,
-								Name:       vdb.Name,
-								UID:        vdb.UID,
-								Controller: &isControllerRef,
-							},
-						},
+			UpdateStrategy:       makeUpdateStrategy(vdb),
+			PodManagementPolicy:  appsv1.ParallelPodManagement,
+			VolumeClaimTemplates: buildVolumeClaimTemplates(vdb),
+		},
+	}
+}
+
+// buildVolumeClaimTemplates returns a volumeClaimTemplate for each of the
+// local PVCs
+func buildVolumeClaimTemplates(vdb *vapi.VerticaDB) []corev1.PersistentVolumeClaim {
+	isControllerRef := true
+	localPVCs := vdb.GetLocalPVCs()
+	templates := make([]corev1.PersistentVolumeClaim, 0, len(localPVCs))
+	for i := range localPVCs {
+		templates = append(templates, corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: localPVCs[i].Name,
+				// Set the ownerReference so that we get auto-deletion
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion: vapi.GroupVersion.String(),
+						Kind:       vapi.VerticaDBKind,
+						Name:       vdb.Name,
+						UID:        vdb.UID,
+						Controller: &isControllerRef,
 					},
-					Spec: corev1.PersistentVolumeClaimSpec{
-						AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
-						StorageClassName: getStorageClassName(vdb),
-						Resources: corev1.ResourceRequirements{
-							Requests: corev1.ResourceList{
-								corev1.ResourceStorage: vdb.Spec.Local.RequestSize,
-							},
-						},
+				},
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				StorageClassName: getStorageClassName(localPVCs[i].StorageClass),
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: localPVCs[i].RequestSize,
 					},
 				},
 			},
+		})
+	}
+	return templates
+}
+
+// BuildPdb builds the PodDisruptionBudget for a secondary subcluster. The
+// extra count is added to the maxUnavailable for pods in the subcluster that
+// the operator is restarting.
+func BuildPdb(nm types.NamespacedName, vdb *vapi.VerticaDB, sc *vapi.Subcluster, extra int) *policyv1.PodDisruptionBudget {
+	maxUnavailable := makePdbMaxUnavailable(sc, extra)
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        nm.Name,
+			Namespace:   nm.Namespace,
+			Labels:      makeLabelsForObject(vdb, sc, false),
+			Annotations: MakeAnnotationsForObject(vdb),
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: MakeStsSelectorLabels(vdb, sc),
+			},
+			MaxUnavailable: &maxUnavailable,
+		},
+	}
+}
+
+// BuildPrimaryPdb builds the PodDisruptionBudget that covers the pods of all
+// primary subclusters. The extra count is added to the maxUnavailable for
+// primary pods that the operator is restarting.
+func BuildPrimaryPdb(nm types.NamespacedName, vdb *vapi.VerticaDB, extra int) *policyv1.PodDisruptionBudget {
+	maxUnavailable := makePrimaryPdbMaxUnavailable(vdb, extra)
+	selector := MakeBaseSvcSelectorLabels(vdb)
+	selector[vmeta.SubclusterTypeLabel] = vapi.PrimarySubclusterType
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        nm.Name,
+			Namespace:   nm.Namespace,
+			Labels:      makeLabelsForObject(vdb, nil, false),
+			Annotations: MakeAnnotationsForObject(vdb),
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: selector,
+			},
+			MaxUnavailable: &maxUnavailable,
 		},
 	}
 }
 
+// makePrimaryPdbMaxUnavailable returns the maxUnavailable to use in the
+// PodDisruptionBudget of the primary pods. Losing more primary nodes than the
+// k-safety allows will cause the database to lose quorum and shut down.
+func makePrimaryPdbMaxUnavailable(vdb *vapi.VerticaDB, extra int) intstr.IntOrString {
+	if vdb.Spec.KSafety == vapi.KSafety0 {
+		return intstr.FromInt(extra)
+	}
+	return intstr.FromInt(1 + extra)
+}
+
+// makePdbMaxUnavailable returns the maxUnavailable to use in the
+// PodDisruptionBudget of a secondary subcluster. Secondary nodes don't count
+// towards quorum, so we let one of them go unless the spec overrides it.
+func makePdbMaxUnavailable(sc *vapi.Subcluster, extra int) intstr.IntOrString {
+	if sc.PdbMaxUnavailable == nil {
+		return intstr.FromInt(1 + extra)
+	}
+	if extra == 0 {
+		return *sc.PdbMaxUnavailable
+	}
+	// A percentage is rounded up the same way the disruption controller does
+	// it, so that the extra pods are added on top of what the spec allows.
+	base, err := intstr.GetScaledValueFromIntOrPercent(sc.PdbMaxUnavailable, int(sc.Size), true)
+	if err != nil {
+		return *sc.PdbMaxUnavailable
+	}
+	return intstr.FromInt(base + extra)
+}
+
 // buildPod will construct a spec for a pod.
 // This is only here for testing purposes when we need to construct the pods ourselves.  This
 // bit is typically handled by the statefulset controller.
@@ -895,19 +1015,63 @@ func BuildPod(vdb *vapi.VerticaDB, sc *vapi.Subcluster, podIndex int32) *corev1.
 	// Set a few things in the spec that are normally done by the statefulset
 	// controller. Again, this is for testing purposes only as the statefulset
 	// controller handles adding of the PVC to the volume list.
-	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
-		Name: vapi.LocalDataPVC,
-		VolumeSource: corev1.VolumeSource{
-			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-				ClaimName: names.GenPVCName(vdb, sc, podIndex).Name,
+	for _, localPVC := range vdb.GetLocalPVCs() {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: localPVC.Name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: fmt.Sprintf("%s-%s", localPVC.Name, nm.Name),
+				},
 			},
-		},
-	})
+		})
+	}
 	pod.Spec.Hostname = nm.Name
 	pod.Spec.Subdomain = names.GenHlSvcName(vdb).Name
 	return pod
 }
 
+// BuildUpgradePreflightPod will construct a throwaway pod that runs the image
+// in the vdb.  It is used prior to an upgrade to verify that the new image can
+// be pulled.  It is scheduled the same way as the first subcluster so that the
+// pull is done from a node that will run vertica.
+func BuildUpgradePreflightPod(nm types.NamespacedName, vdb *vapi.VerticaDB) *corev1.Pod {
+	termGracePeriod := int64(0)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nm.Name,
+			Namespace: nm.Namespace,
+			// We intentionally use a subset of the operator labels so that
+			// this pod isn't picked up by the service objects or mistaken for
+			// a pod that belongs to a subcluster.
+			Labels: map[string]string{
+				vmeta.ManagedByLabel: vmeta.OperatorName,
+				vmeta.ComponentLabel: "upgrade-preflight",
+			},
+			Annotations: MakeAnnotationsForObject(vdb),
+		},
+		Spec: corev1.PodSpec{
+			ImagePullSecrets: GetK8sLocalObjectReferenceArray(vdb.Spec.ImagePullSecrets),
+			RestartPolicy:    corev1.RestartPolicyNever,
+			Containers: []corev1.Container{
+				{
+					Name:            names.ServerContainer,
+					Image:           vdb.Spec.Image,
+					ImagePullPolicy: vdb.Spec.ImagePullPolicy,
+					Command:         []string{"/bin/sh", "-c", "exit 0"},
+				},
+			},
+			TerminationGracePeriodSeconds: &termGracePeriod,
+		},
+	}
+	if len(vdb.Spec.Subclusters) > 0 {
+		sc := &vdb.Spec.Subclusters[0]
+		pod.Spec.NodeSelector = sc.NodeSelector
+		pod.Spec.Affinity = GetK8sAffinity(sc.Affinity)
+		pod.Spec.Tolerations = sc.Tolerations
+	}
+	return pod
+}
+
 // BuildPVC will build a PVC for test purposes
 func BuildPVC(vdb *vapi.VerticaDB, sc *vapi.Subcluster, podIndex int32) *corev1.PersistentVolumeClaim {
 	scn := TestStorageClassName
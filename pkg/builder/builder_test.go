@@ -22,8 +22,10 @@ import (
 	. "github.com/onsi/gomega"
 	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
 	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
 	"github.com/vertica/vertica-kubernetes/pkg/paths"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -256,6 +258,80 @@ var _ = Describe("builder", func() {
 			Expect(cnt.VolumeMounts[i+ExpectedPathsPerMount+j].MountPath).Should(ContainSubstring(paths.RootSSHPath))
 		}
 	})
+
+	It("should derive the pdb maxUnavailable from the kSafety and subcluster type", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.KSafety = vapi.KSafety0
+		Expect(makePrimaryPdbMaxUnavailable(vdb, 0)).Should(Equal(intstr.FromInt(0)))
+		Expect(makePrimaryPdbMaxUnavailable(vdb, 1)).Should(Equal(intstr.FromInt(1)))
+		vdb.Spec.KSafety = vapi.KSafety1
+		Expect(makePrimaryPdbMaxUnavailable(vdb, 0)).Should(Equal(intstr.FromInt(1)))
+		Expect(makePrimaryPdbMaxUnavailable(vdb, 2)).Should(Equal(intstr.FromInt(3)))
+
+		sc := &vapi.Subcluster{Name: "sc2", IsPrimary: false, Size: 4}
+		Expect(makePdbMaxUnavailable(sc, 0)).Should(Equal(intstr.FromInt(1)))
+		Expect(makePdbMaxUnavailable(sc, 1)).Should(Equal(intstr.FromInt(2)))
+		override := intstr.FromString("25%")
+		sc.PdbMaxUnavailable = &override
+		Expect(makePdbMaxUnavailable(sc, 0)).Should(Equal(override))
+		Expect(makePdbMaxUnavailable(sc, 2)).Should(Equal(intstr.FromInt(3)))
+	})
+
+	It("should select all of the primary pods in the primary pdb", func() {
+		vdb := vapi.MakeVDB()
+		pdb := BuildPrimaryPdb(names.GenPrimaryPdbName(vdb), vdb, 0)
+		Expect(pdb.Spec.Selector.MatchLabels).Should(HaveKeyWithValue(vmeta.SubclusterTypeLabel, vapi.PrimarySubclusterType))
+		Expect(pdb.Spec.Selector.MatchLabels).ShouldNot(HaveKey(vmeta.SubclusterNameLabel))
+		Expect(pdb.Labels).ShouldNot(HaveKey(vmeta.SubclusterNameLabel))
+	})
+
+	It("should create a separate volume for the catalog, data and depot if requested", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Local.DataPath = "/data"
+		vdb.Spec.Local.DepotPath = "/depot"
+		vdb.Spec.Local.CatalogPath = "/catalog"
+		sc := &vdb.Spec.Subclusters[0]
+		sts := BuildStsSpec(names.GenStsName(vdb, sc), vdb, sc, &DeploymentNames{})
+		Expect(sts.Spec.VolumeClaimTemplates).Should(HaveLen(1))
+
+		vdb.Spec.Local.CatalogPVC = &vapi.LocalVolumeClaim{StorageClass: "replicated", RequestSize: resource.MustParse("10Gi")}
+		vdb.Spec.Local.DepotPVC = &vapi.LocalVolumeClaim{StorageClass: "nvme", RequestSize: resource.MustParse("100Gi")}
+		sts = BuildStsSpec(names.GenStsName(vdb, sc), vdb, sc, &DeploymentNames{})
+		vcts := sts.Spec.VolumeClaimTemplates
+		Expect(vcts).Should(HaveLen(3))
+		Expect(vcts[0].Name).Should(Equal(vapi.LocalDataPVC))
+		Expect(vcts[1].Name).Should(Equal(vapi.LocalCatalogPVC))
+		Expect(*vcts[1].Spec.StorageClassName).Should(Equal("replicated"))
+		Expect(vcts[2].Name).Should(Equal(vapi.LocalDepotPVC))
+		Expect(vcts[2].Spec.Resources.Requests[v1.ResourceStorage]).Should(Equal(resource.MustParse("100Gi")))
+
+		mnts := sts.Spec.Template.Spec.Containers[0].VolumeMounts
+		Expect(mnts).Should(ContainElement(v1.VolumeMount{Name: vapi.LocalCatalogPVC, MountPath: "/catalog"}))
+		Expect(mnts).Should(ContainElement(v1.VolumeMount{Name: vapi.LocalDepotPVC, MountPath: "/depot"}))
+		Expect(mnts).Should(ContainElement(v1.VolumeMount{Name: vapi.LocalDataPVC, SubPath: vdb.GetPVSubPath("data"), MountPath: "/data"}))
+	})
+
+	It("should only spread the pods across zones when the zone topology is enabled", func() {
+		vdb := vapi.MakeVDB()
+		sc := &vdb.Spec.Subclusters[0]
+		Expect(buildPodSpec(vdb, sc, &DeploymentNames{}).TopologySpreadConstraints).Should(BeEmpty())
+
+		vdb.Spec.Topology.Mode = vapi.TopologyModeZone
+		tsc := buildPodSpec(vdb, sc, &DeploymentNames{}).TopologySpreadConstraints
+		Expect(tsc).Should(HaveLen(1))
+		Expect(tsc[0].TopologyKey).Should(Equal(vapi.DefaultTopologyKey))
+		Expect(tsc[0].MaxSkew).Should(Equal(int32(1)))
+		Expect(tsc[0].WhenUnsatisfiable).Should(Equal(v1.DoNotSchedule))
+		Expect(tsc[0].LabelSelector.MatchLabels).Should(Equal(MakeStsSelectorLabels(vdb, sc)))
+
+		vdb.Spec.Topology.TopologyKey = "rack"
+		vdb.Spec.Topology.MaxSkew = 2
+		vdb.Spec.Topology.WhenUnsatisfiable = v1.ScheduleAnyway
+		tsc = buildPodSpec(vdb, sc, &DeploymentNames{}).TopologySpreadConstraints
+		Expect(tsc[0].TopologyKey).Should(Equal("rack"))
+		Expect(tsc[0].MaxSkew).Should(Equal(int32(2)))
+		Expect(tsc[0].WhenUnsatisfiable).Should(Equal(v1.ScheduleAnyway))
+	})
 })
 
 func getFirstSSHSecretVolumeMountIndex(c *v1.Container) (int, bool) {
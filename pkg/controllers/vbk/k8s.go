@@ -0,0 +1,82 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vbk
+
+import (
+	"context"
+	"reflect"
+
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/builder"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// fetchVDB will fetch the VerticaDB that is referenced in a VerticaBackup.
+// This will log an event if the VerticaDB is not found.
+func fetchVDB(ctx context.Context, vrec *VerticaBackupReconciler,
+	vbk *vapi.VerticaBackup, vdb *vapi.VerticaDB) (ctrl.Result, error) {
+	nm := types.NamespacedName{
+		Namespace: vbk.Namespace,
+		Name:      vbk.Spec.VerticaDBName,
+	}
+	err := vrec.Client.Get(ctx, nm, vdb)
+	if err != nil && errors.IsNotFound(err) {
+		vrec.EVRec.Eventf(vbk, corev1.EventTypeWarning, events.VerticaDBNotFound,
+			"The VerticaDB named '%s' was not found", vbk.Spec.VerticaDBName)
+		return ctrl.Result{Requeue: true}, nil
+	}
+	return ctrl.Result{}, err
+}
+
+// fetchSuperuserPassword will return the superuser password of the VerticaDB.
+// An empty string is returned if the VerticaDB doesn't use a password.
+func fetchSuperuserPassword(ctx context.Context, vrec *VerticaBackupReconciler, vdb *vapi.VerticaDB) (string, error) {
+	secretName := names.GenSUPasswdSecretName(vdb)
+	if secretName.Name == "" {
+		return "", nil
+	}
+	secret := &corev1.Secret{}
+	if err := vrec.Client.Get(ctx, secretName, secret); err != nil {
+		return "", err
+	}
+	return string(secret.Data[builder.SuperuserPasswordKey]), nil
+}
+
+// updateStatus will set status fields in the VerticaBackup. It handles retry
+// for transient errors like when update fails because another client updated
+// the VerticaBackup.
+func updateStatus(ctx context.Context, vrec *VerticaBackupReconciler, vbk *vapi.VerticaBackup,
+	updateFunc func(*vapi.VerticaBackupStatus)) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		// Always fetch the latest to minimize the chance of getting a conflict error.
+		if err := vrec.Client.Get(ctx, vbk.ExtractNamespacedName(), vbk); err != nil {
+			return err
+		}
+
+		orig := vbk.Status.DeepCopy()
+		updateFunc(&vbk.Status)
+		if reflect.DeepEqual(orig, &vbk.Status) {
+			return nil
+		}
+		return vrec.Client.Status().Update(ctx, vbk)
+	})
+}
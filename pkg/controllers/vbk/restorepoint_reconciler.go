@@ -0,0 +1,307 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vbk
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/robfig/cron/v3"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	vbuilder "github.com/vertica/vertica-kubernetes/pkg/builder"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RestorePointReconciler will save restore points of a VerticaDB according to
+// the schedule in the VerticaBackup.
+type RestorePointReconciler struct {
+	VRec    *VerticaBackupReconciler
+	Log     logr.Logger
+	Vbk     *vapi.VerticaBackup
+	Vdb     *vapi.VerticaDB
+	PRunner cmds.PodRunner
+	// now returns the current time. It is overridden in tests.
+	now func() time.Time
+}
+
+// MakeRestorePointReconciler will build a RestorePointReconciler object
+func MakeRestorePointReconciler(vrec *VerticaBackupReconciler, log logr.Logger, vbk *vapi.VerticaBackup,
+	vdb *vapi.VerticaDB, prunner cmds.PodRunner) controllers.ReconcileActor {
+	return &RestorePointReconciler{
+		VRec:    vrec,
+		Log:     log,
+		Vbk:     vbk,
+		Vdb:     vdb,
+		PRunner: prunner,
+		now:     time.Now,
+	}
+}
+
+// Reconcile will save a restore point if one is due
+func (r *RestorePointReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ctrl.Result, error) {
+	if msg, ok := r.validateSpec(); !ok {
+		r.VRec.EVRec.Event(r.Vbk, corev1.EventTypeWarning, events.InvalidBackupSpec, msg)
+		return ctrl.Result{}, updateStatus(ctx, r.VRec, r.Vbk, func(stat *vapi.VerticaBackupStatus) {
+			stat.Message = msg
+		})
+	}
+
+	if res, err := r.alterArchiveLimit(ctx); verrors.IsReconcileAborted(res, err) {
+		return res, err
+	}
+
+	now := r.now()
+	nextTime, err := r.getNextScheduleTime()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if nextTime.IsZero() {
+		// Nothing more to do for a one-time backup
+		return ctrl.Result{}, nil
+	}
+	if now.Before(nextTime) {
+		r.Log.Info("Next restore point not due yet", "nextTime", nextTime)
+		return ctrl.Result{RequeueAfter: nextTime.Sub(now)}, nil
+	}
+
+	pod, ok, err := r.findPodToRunVsql(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !ok {
+		r.Log.Info("No pod found to save the restore point from. Requeue reconciliation.")
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	if err := r.saveRestorePoint(ctx, pod, now); err != nil {
+		// The failure has been recorded in the status. Returning the error
+		// will retry with a backoff. For scheduled backups the retry won't
+		// happen until the next time in the schedule.
+		return ctrl.Result{}, err
+	}
+
+	nextTime, err = r.getNextScheduleTime()
+	if err != nil || nextTime.IsZero() {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: nextTime.Sub(r.now())}, nil
+}
+
+// validateSpec will check that a restore point can be saved for the spec. If
+// it can't, a message explaining why is returned.
+func (r *RestorePointReconciler) validateSpec() (string, bool) {
+	if !r.Vdb.IsEON() {
+		return fmt.Sprintf("Restore points can only be saved for Eon Mode databases. VerticaDB '%s' is not in Eon Mode",
+			r.Vdb.Name), false
+	}
+	if !vapi.IsValidArchiveName(r.Vbk.GetArchiveName()) {
+		return fmt.Sprintf("Archive name '%s' is not valid. It must start with a letter or underscore and contain "+
+			"only letters, digits and underscores", r.Vbk.GetArchiveName()), false
+	}
+	if r.Vbk.Spec.Schedule != "" {
+		if _, err := cron.ParseStandard(r.Vbk.Spec.Schedule); err != nil {
+			return fmt.Sprintf("Schedule '%s' is not a valid cron expression: %s", r.Vbk.Spec.Schedule, err), false
+		}
+	}
+	return "", true
+}
+
+// needsArchiveLimitChange returns true if the limit of the archive doesn't
+// match the retention in the spec.
+func (r *RestorePointReconciler) needsArchiveLimitChange() bool {
+	return r.Vbk.Spec.Retention > 0 && r.Vbk.Status.ArchiveLimit != r.Vbk.Spec.Retention
+}
+
+// alterArchiveLimit will change the limit of an existing archive when the
+// retention in the spec changes. We wait for the next restore point if we
+// don't know that the archive exists yet, since saving one applies the limit.
+func (r *RestorePointReconciler) alterArchiveLimit(ctx context.Context) (ctrl.Result, error) {
+	if r.Vbk.Status.ArchiveLimit == 0 || !r.needsArchiveLimitChange() {
+		return ctrl.Result{}, nil
+	}
+	pod, ok, err := r.findPodToRunVsql(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !ok {
+		r.Log.Info("No pod found to alter the archive limit from. Requeue reconciliation.")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	archive := r.Vbk.GetArchiveName()
+	sql := fmt.Sprintf("alter archive %s limit %d;", archive, r.Vbk.Spec.Retention)
+	_, stderr, err := r.PRunner.ExecVSQL(ctx, pod, names.ServerContainer, "-tAc", sql)
+	if err != nil {
+		r.VRec.EVRec.Eventf(r.Vbk, corev1.EventTypeWarning, events.RestorePointFailed,
+			"Failed to change the limit of archive '%s' to %d: %s", archive, r.Vbk.Spec.Retention, stderr)
+		return ctrl.Result{}, err
+	}
+	r.Log.Info("Changed the archive limit", "archive", archive, "limit", r.Vbk.Spec.Retention)
+	restorePoints, err := r.fetchRestorePoints(ctx, pod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, updateStatus(ctx, r.VRec, r.Vbk, func(stat *vapi.VerticaBackupStatus) {
+		stat.ArchiveLimit = r.Vbk.Spec.Retention
+		stat.RestorePoints = restorePoints
+	})
+}
+
+// getNextScheduleTime returns the time the next restore point is due. A zero
+// time is returned if no more restore points are to be saved.
+func (r *RestorePointReconciler) getNextScheduleTime() (time.Time, error) {
+	if r.Vbk.Spec.Schedule == "" {
+		// A one-time backup is due until it has succeeded
+		if r.Vbk.Status.LastSuccessfulTime != nil {
+			return time.Time{}, nil
+		}
+		return r.Vbk.CreationTimestamp.Time, nil
+	}
+	sched, err := cron.ParseStandard(r.Vbk.Spec.Schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	base := r.Vbk.CreationTimestamp.Time
+	if r.Vbk.Status.LastScheduleTime != nil {
+		base = r.Vbk.Status.LastScheduleTime.Time
+	}
+	return sched.Next(base.UTC()), nil
+}
+
+// findPodToRunVsql will return a pod that can be used to run vsql. We pick a
+// pod that is ready, which means vertica is up and accepting connections.
+func (r *RestorePointReconciler) findPodToRunVsql(ctx context.Context) (types.NamespacedName, bool, error) {
+	pods := &corev1.PodList{}
+	if err := r.VRec.Client.List(ctx, pods, client.InNamespace(r.Vdb.Namespace),
+		client.MatchingLabels(vbuilder.MakeBaseSvcSelectorLabels(r.Vdb))); err != nil {
+		return types.NamespacedName{}, false, err
+	}
+	for i := range pods.Items {
+		if isPodReady(&pods.Items[i]) {
+			return types.NamespacedName{Namespace: pods.Items[i].Namespace, Name: pods.Items[i].Name}, true, nil
+		}
+	}
+	return types.NamespacedName{}, false, nil
+}
+
+// isPodReady returns true if the pod is running and all of its containers are
+// ready. The readiness probe of the server container checks that vertica is up.
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil || len(pod.Status.ContainerStatuses) == 0 {
+		return false
+	}
+	for i := range pod.Status.ContainerStatuses {
+		if !pod.Status.ContainerStatuses[i].Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// saveRestorePoint will save a new restore point in the archive and record
+// the outcome in the status.
+func (r *RestorePointReconciler) saveRestorePoint(ctx context.Context, pod types.NamespacedName, now time.Time) error {
+	archive := r.Vbk.GetArchiveName()
+	limit := ""
+	if r.Vbk.Spec.Retention > 0 {
+		limit = fmt.Sprintf(" limit %d", r.Vbk.Spec.Retention)
+	}
+	sql := fmt.Sprintf("create archive if not exists %s%s;", archive, limit)
+	// The archive may have been created with a different limit, either by
+	// someone else or before the retention was changed.
+	if r.needsArchiveLimitChange() {
+		sql += fmt.Sprintf(" alter archive %s%s;", archive, limit)
+	}
+	sql += fmt.Sprintf(" save restore point to archive %s;", archive)
+	_, stderr, err := r.PRunner.ExecVSQL(ctx, pod, names.ServerContainer, "-tAc", sql)
+	if err != nil {
+		r.VRec.EVRec.Eventf(r.Vbk, corev1.EventTypeWarning, events.RestorePointFailed,
+			"Failed to save restore point to archive '%s': %s", archive, stderr)
+		if updErr := updateStatus(ctx, r.VRec, r.Vbk, func(stat *vapi.VerticaBackupStatus) {
+			stat.LastScheduleTime = &metav1.Time{Time: now}
+			stat.FailureCount++
+			stat.Message = fmt.Sprintf("failed to save restore point: %s", strings.TrimSpace(stderr))
+		}); updErr != nil {
+			return updErr
+		}
+		return err
+	}
+
+	restorePoints, err := r.fetchRestorePoints(ctx, pod)
+	if err != nil {
+		return err
+	}
+	r.VRec.EVRec.Eventf(r.Vbk, corev1.EventTypeNormal, events.RestorePointSaved,
+		"Successfully saved restore point to archive '%s'", archive)
+	return updateStatus(ctx, r.VRec, r.Vbk, func(stat *vapi.VerticaBackupStatus) {
+		stat.LastScheduleTime = &metav1.Time{Time: now}
+		stat.LastSuccessfulTime = &metav1.Time{Time: now}
+		stat.BackupCount++
+		stat.Message = ""
+		if r.Vbk.Spec.Retention > 0 {
+			stat.ArchiveLimit = r.Vbk.Spec.Retention
+		}
+		stat.RestorePoints = restorePoints
+	})
+}
+
+// fetchRestorePoints returns all of the restore points that are in the archive
+func (r *RestorePointReconciler) fetchRestorePoints(ctx context.Context, pod types.NamespacedName) ([]vapi.RestorePointInfo, error) {
+	sql := fmt.Sprintf("select index, id, save_time from archive_restore_points where archive = '%s' order by index;",
+		r.Vbk.GetArchiveName())
+	stdout, _, err := r.PRunner.ExecVSQL(ctx, pod, names.ServerContainer, "-tAc", sql)
+	if err != nil {
+		return nil, err
+	}
+	return parseRestorePoints(stdout)
+}
+
+// parseRestorePoints will parse the output of the archive_restore_points query
+func parseRestorePoints(stdout string) ([]vapi.RestorePointInfo, error) {
+	restorePoints := []vapi.RestorePointInfo{}
+	for _, line := range strings.Split(stdout, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		cols := strings.Split(line, "|")
+		const ExpectedCols = 3
+		if len(cols) != ExpectedCols {
+			return nil, fmt.Errorf("unexpected output from archive_restore_points query: %s", line)
+		}
+		inx, err := strconv.Atoi(strings.TrimSpace(cols[0]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse restore point index '%s': %w", cols[0], err)
+		}
+		restorePoints = append(restorePoints, vapi.RestorePointInfo{
+			Index:    inx,
+			ID:       strings.TrimSpace(cols[1]),
+			SaveTime: strings.TrimSpace(cols[2]),
+		})
+	}
+	return restorePoints, nil
+}
@@ -0,0 +1,179 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vbk
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/test"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("restorepoint_reconcile", func() {
+	ctx := context.Background()
+
+	It("should save a single restore point when there is no schedule", func() {
+		vdb := vapi.MakeVDB()
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		vbk := vapi.MakeVBK()
+		Expect(k8sClient.Create(ctx, vbk)).Should(Succeed())
+		defer func() { Expect(k8sClient.Delete(ctx, vbk)).Should(Succeed()) }()
+
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+		fpr := &cmds.FakePodRunner{Results: cmds.CmdResults{
+			pn: []cmds.CmdResult{
+				{}, // create archive and save restore point
+				{Stdout: "1|45006999883346698|2023-06-01 02:00:01.123\n2|45006999883346600|2023-05-31 02:00:01.456\n"},
+			},
+		}}
+		act := MakeRestorePointReconciler(vbkRec, logger, vbk, vdb, fpr)
+		Expect(act.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		hist := fpr.FindCommands("save restore point to archive vertica_backup_sample")
+		Expect(len(hist)).Should(Equal(1))
+		Expect(hist[0].Command[len(hist[0].Command)-1]).Should(ContainSubstring("limit 7"))
+		Expect(hist[0].Command[len(hist[0].Command)-1]).Should(ContainSubstring("alter archive vertica_backup_sample limit 7;"))
+
+		fetchVbk := &vapi.VerticaBackup{}
+		Expect(k8sClient.Get(ctx, vbk.ExtractNamespacedName(), fetchVbk)).Should(Succeed())
+		Expect(fetchVbk.Status.BackupCount).Should(Equal(1))
+		Expect(fetchVbk.Status.LastSuccessfulTime).ShouldNot(BeNil())
+		Expect(fetchVbk.Status.RestorePoints).Should(HaveLen(2))
+		Expect(fetchVbk.Status.RestorePoints[0]).Should(Equal(vapi.RestorePointInfo{
+			Index: 1, ID: "45006999883346698", SaveTime: "2023-06-01 02:00:01.123"}))
+
+		// A second reconcile is a no-op since the one-time backup is done
+		fpr.Histories = nil
+		act = MakeRestorePointReconciler(vbkRec, logger, fetchVbk, vdb, fpr)
+		Expect(act.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(fpr.Histories).Should(BeEmpty())
+	})
+
+	It("should alter the archive limit when the retention changes", func() {
+		vdb := vapi.MakeVDB()
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		vbk := vapi.MakeVBK()
+		vbk.Spec.Retention = 3
+		Expect(k8sClient.Create(ctx, vbk)).Should(Succeed())
+		defer func() { Expect(k8sClient.Delete(ctx, vbk)).Should(Succeed()) }()
+		// The one-time restore point was already saved with the old limit
+		vbk.Status.LastSuccessfulTime = &metav1.Time{Time: time.Now()}
+		vbk.Status.ArchiveLimit = 7
+		Expect(k8sClient.Status().Update(ctx, vbk)).Should(Succeed())
+
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+		fpr := &cmds.FakePodRunner{Results: cmds.CmdResults{
+			pn: []cmds.CmdResult{
+				{}, // alter archive
+				{Stdout: "1|45006999883346698|2023-06-01 02:00:01.123\n"},
+			},
+		}}
+		act := MakeRestorePointReconciler(vbkRec, logger, vbk, vdb, fpr)
+		Expect(act.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(fpr.FindCommands("alter archive vertica_backup_sample limit 3;")).Should(HaveLen(1))
+		Expect(fpr.FindCommands("save restore point")).Should(BeEmpty())
+
+		fetchVbk := &vapi.VerticaBackup{}
+		Expect(k8sClient.Get(ctx, vbk.ExtractNamespacedName(), fetchVbk)).Should(Succeed())
+		Expect(fetchVbk.Status.ArchiveLimit).Should(Equal(3))
+		Expect(fetchVbk.Status.RestorePoints).Should(HaveLen(1))
+
+		// Nothing to do once the limit matches
+		fpr.Histories = nil
+		act = MakeRestorePointReconciler(vbkRec, logger, fetchVbk, vdb, fpr)
+		Expect(act.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(fpr.Histories).Should(BeEmpty())
+	})
+
+	It("should requeue until the next scheduled time", func() {
+		vdb := vapi.MakeVDB()
+		vbk := vapi.MakeVBK()
+		vbk.Spec.Schedule = "0 2 * * *"
+		Expect(k8sClient.Create(ctx, vbk)).Should(Succeed())
+		defer func() { Expect(k8sClient.Delete(ctx, vbk)).Should(Succeed()) }()
+
+		fpr := &cmds.FakePodRunner{}
+		act := MakeRestorePointReconciler(vbkRec, logger, vbk, vdb, fpr)
+		r := act.(*RestorePointReconciler)
+		r.now = func() time.Time { return vbk.CreationTimestamp.Time }
+		res, err := r.Reconcile(ctx, &ctrl.Request{})
+		Expect(err).Should(Succeed())
+		Expect(res.RequeueAfter).Should(BeNumerically(">", 0))
+		Expect(res.RequeueAfter).Should(BeNumerically("<=", 24*time.Hour))
+		Expect(fpr.Histories).Should(BeEmpty())
+	})
+
+	It("should record a failure in the status", func() {
+		vdb := vapi.MakeVDB()
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		vbk := vapi.MakeVBK()
+		Expect(k8sClient.Create(ctx, vbk)).Should(Succeed())
+		defer func() { Expect(k8sClient.Delete(ctx, vbk)).Should(Succeed()) }()
+
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+		fpr := &cmds.FakePodRunner{Results: cmds.CmdResults{
+			pn: []cmds.CmdResult{{Stderr: "ERROR 2005: archive limit exceeded", Err: errors.New("command failed")}},
+		}}
+		act := MakeRestorePointReconciler(vbkRec, logger, vbk, vdb, fpr)
+		_, err := act.Reconcile(ctx, &ctrl.Request{})
+		Expect(err).ShouldNot(Succeed())
+
+		fetchVbk := &vapi.VerticaBackup{}
+		Expect(k8sClient.Get(ctx, vbk.ExtractNamespacedName(), fetchVbk)).Should(Succeed())
+		Expect(fetchVbk.Status.FailureCount).Should(Equal(1))
+		Expect(fetchVbk.Status.BackupCount).Should(Equal(0))
+		Expect(fetchVbk.Status.Message).Should(ContainSubstring("archive limit exceeded"))
+	})
+
+	It("should not save a restore point for an invalid spec", func() {
+		vdb := vapi.MakeVDB()
+		vbk := vapi.MakeVBK()
+		vbk.Spec.Schedule = "every day"
+		Expect(k8sClient.Create(ctx, vbk)).Should(Succeed())
+		defer func() { Expect(k8sClient.Delete(ctx, vbk)).Should(Succeed()) }()
+
+		fpr := &cmds.FakePodRunner{}
+		act := MakeRestorePointReconciler(vbkRec, logger, vbk, vdb, fpr)
+		Expect(act.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(fpr.Histories).Should(BeEmpty())
+		Expect(vbk.Status.Message).Should(ContainSubstring("not a valid cron expression"))
+
+		vdb.Spec.ShardCount = 0
+		vbk.Spec.Schedule = ""
+		Expect(act.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(fpr.Histories).Should(BeEmpty())
+		Expect(vbk.Status.Message).Should(ContainSubstring("Eon Mode"))
+	})
+})
@@ -0,0 +1,157 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vbk
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
+	"github.com/vertica/vertica-kubernetes/pkg/meta"
+)
+
+// VerticaBackupReconciler reconciles a VerticaBackup object
+type VerticaBackupReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Log    logr.Logger
+	Cfg    *rest.Config
+	EVRec  record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticabackups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticabackups/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticabackups/finalizers,verbs=update
+//+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticadbs,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",namespace=WATCH_NAMESPACE,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",namespace=WATCH_NAMESPACE,resources=pods/exec,verbs=create
+// +kubebuilder:rbac:groups="",namespace=WATCH_NAMESPACE,resources=secrets,verbs=get;list;watch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.5/pkg/reconcile
+func (r *VerticaBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("verticabackup", req.NamespacedName)
+	log.Info("starting reconcile of VerticaBackup")
+
+	vbk := &vapi.VerticaBackup{}
+	err := r.Get(ctx, req.NamespacedName, vbk)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("VerticaBackup resource not found.  Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "failed to get VerticaBackup")
+		return ctrl.Result{}, err
+	}
+
+	if meta.IsPauseAnnotationSet(vbk.Annotations) {
+		log.Info(fmt.Sprintf("The pause annotation %s is set. Suspending the iteration", meta.PauseOperatorAnnotation),
+			"result", ctrl.Result{}, "err", nil)
+		return ctrl.Result{}, nil
+	}
+
+	vdb := &vapi.VerticaDB{}
+	if res, err := fetchVDB(ctx, r, vbk, vdb); verrors.IsReconcileAborted(res, err) {
+		return res, err
+	}
+
+	passwd, err := fetchSuperuserPassword(ctx, r, vdb)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	prunner := cmds.MakeClusterPodRunner(log, r.Cfg, passwd)
+
+	// Iterate over each actor
+	actors := r.constructActors(log, vbk, vdb, prunner)
+	var res ctrl.Result
+	for _, act := range actors {
+		log.Info("starting actor", "name", fmt.Sprintf("%T", act))
+		res, err = act.Reconcile(ctx, &req)
+		// Error or a request to requeue will stop the reconciliation.
+		if verrors.IsReconcileAborted(res, err) {
+			log.Info("aborting reconcile of VerticaBackup", "result", res, "err", err)
+			return res, err
+		}
+	}
+
+	log.Info("ending reconcile of VerticaBackup", "result", res, "err", err)
+	return res, err
+}
+
+// constructActors will a list of actors that should be run for the reconcile.
+// Order matters in that some actors depend on the successeful execution of
+// earlier ones.
+func (r *VerticaBackupReconciler) constructActors(log logr.Logger, vbk *vapi.VerticaBackup, vdb *vapi.VerticaDB,
+	prunner cmds.PodRunner) []controllers.ReconcileActor {
+	return []controllers.ReconcileActor{
+		// Save a new restore point when the schedule says one is due
+		MakeRestorePointReconciler(r, log, vbk, vdb, prunner),
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *VerticaBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&vapi.VerticaBackup{}).
+		// The VerticaDB is not an owner of the VerticaBackup. That is
+		// intentional so that deleting the VerticaDB leaves the backups
+		// around. We still watch it so that a backup waiting on the database
+		// to come up will be reconciled as soon as it does.
+		Watches(
+			&source.Kind{Type: &vapi.VerticaDB{}},
+			handler.EnqueueRequestsFromMapFunc(r.findObjectsForVerticaDB),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		).
+		Complete(r)
+}
+
+// findObjectsForVerticaDB will generate requests to reconcile VerticaBackups
+// based on watched VerticaDB.
+func (r *VerticaBackupReconciler) findObjectsForVerticaDB(vdb client.Object) []reconcile.Request {
+	backups := &vapi.VerticaBackupList{}
+	if err := r.List(context.Background(), backups, client.InNamespace(vdb.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list VerticaBackups", "vdb", vdb.GetName())
+		return []reconcile.Request{}
+	}
+
+	requests := []reconcile.Request{}
+	for i := range backups.Items {
+		if backups.Items[i].Spec.VerticaDBName != vdb.GetName() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: backups.Items[i].ExtractNamespacedName()})
+	}
+	return requests
+}
@@ -59,15 +59,62 @@ func (s *AnnotateAndLabelPodReconciler) Reconcile(ctx context.Context, req *ctrl
 
 	// Iterate over pod that exists.
 	for pn, pf := range s.PFacts.Detail {
-		if pf.exists {
-			if err := s.applyAnnotationsAndLabels(ctx, pn, annotations, labels); err != nil {
+		if !pf.exists {
+			continue
+		}
+		podAnnotations := annotations
+		if s.Vdb.IsZoneTopologyEnabled() {
+			podAnnotations, err = s.addZoneAnnotation(ctx, pn, annotations)
+			if err != nil {
 				return ctrl.Result{}, err
 			}
 		}
+		if err := s.applyAnnotationsAndLabels(ctx, pn, podAnnotations, labels); err != nil {
+			return ctrl.Result{}, err
+		}
+		if zone, ok := podAnnotations[vmeta.ZoneAnnotation]; ok {
+			pf.zone = zone
+		}
 	}
 	return ctrl.Result{}, nil
 }
 
+// addZoneAnnotation will return a copy of the annotations with the zone of the
+// node the pod is running on. The zone is taken from the node label named by
+// the topology key. The annotations are returned as-is if the pod hasn't been
+// scheduled or its node doesn't have the label.
+func (s *AnnotateAndLabelPodReconciler) addZoneAnnotation(ctx context.Context, podName types.NamespacedName,
+	anns map[string]string) (map[string]string, error) {
+	pod := &corev1.Pod{}
+	if err := s.VRec.Client.Get(ctx, podName, pod); err != nil {
+		if errors.IsNotFound(err) {
+			return anns, nil
+		}
+		return nil, err
+	}
+	if pod.Spec.NodeName == "" {
+		return anns, nil
+	}
+	// Unlike the other annotations, this requires a cluster scoped rbac rule
+	// to read the node. That is why it is only done when the zone topology
+	// mode is enabled. The rule is in the node-reader ClusterRole in
+	// config/rbac, as the manager role is namespace scoped.
+	node := &corev1.Node{}
+	if err := s.VRec.Client.Get(ctx, types.NamespacedName{Name: pod.Spec.NodeName}, node); err != nil {
+		return nil, err
+	}
+	zone, ok := node.Labels[s.Vdb.GetTopologyKey()]
+	if !ok || zone == "" {
+		return anns, nil
+	}
+	newAnns := make(map[string]string, len(anns)+1)
+	for k, v := range anns {
+		newAnns[k] = v
+	}
+	newAnns[vmeta.ZoneAnnotation] = zone
+	return newAnns, nil
+}
+
 // generateAnnotations will generate static annotations that will be applied to each running pod
 func (s *AnnotateAndLabelPodReconciler) generateAnnotations() (map[string]string, error) {
 	// We get the k8s server information from the client.  It would be better to
@@ -87,6 +87,14 @@ func findATBasePod(vdb *vapi.VerticaDB, pf *PodFacts) (types.NamespacedName, err
 			return pn, nil
 		}
 	}
+	// Pod -0 may not be installed if it is being rebuilt with new PVCs. Fall
+	// back to the first installed pod, sorted by name so that the choice is
+	// stable across iterations.
+	if pod, ok := pf.findFirstPodSorted(func(v *PodFact) bool {
+		return v.isInstalled && v.isPodRunning
+	}); ok {
+		return pod.name, nil
+	}
 	return types.NamespacedName{}, fmt.Errorf("couldn't find a suitable pod to install from")
 }
 
@@ -37,6 +37,7 @@ const (
 	AddNodeApplyMethod       ApplyMethodType = "Add"           // Called after a db_add_node
 	PodRescheduleApplyMethod ApplyMethodType = "PodReschedule" // Called after pod was rescheduled and vertica restarted
 	DelNodeApplyMethod       ApplyMethodType = "RemoveNode"    // Called before a db_remove_node
+	ReshardApplyMethod       ApplyMethodType = "Reshard"       // Called after the shard count changed
 )
 
 type ClientRoutingLabelReconciler struct {
@@ -108,7 +109,8 @@ func (c *ClientRoutingLabelReconciler) reconcilePod(ctx context.Context, pn type
 			return err
 		}
 
-		if c.ApplyMethod == AddNodeApplyMethod && c.Vdb.IsEON() && pf.upNode && pf.shardSubscriptions == 0 && !pf.pendingDelete {
+		if c.ApplyMethod == AddNodeApplyMethod && c.Vdb.IsEON() && pf.upNode && pf.shardSubscriptions == 0 &&
+			!pf.pendingDelete && !pf.shutdown {
 			c.VRec.Log.Info("Will requeue reconciliation because pod does not have any shard subscriptions yet", "name", pf.name)
 			res.Requeue = true
 		}
@@ -125,6 +127,7 @@ func (c *ClientRoutingLabelReconciler) manipulateRoutingLabelInPod(pod *corev1.P
 	// 2) Called after pod reschedule + restart
 	// 3) Called before remove node
 	// 4) Called before removal of a subcluster
+	// 5) Called after a reshard
 	//
 	// For 1) and 2), we are going to add labels to qualify pods.  For 2),
 	// we will reschedule as this reconciler is usually paired with a
@@ -132,19 +135,34 @@ func (c *ClientRoutingLabelReconciler) manipulateRoutingLabelInPod(pod *corev1.P
 	//
 	// For 3), we are going to remove labels so that client connections
 	// stopped getting routed there.  This only applies to pods that are
-	// pending delete.
+	// pending delete or in a subcluster that is being shutdown.
 	//
 	// For 4), like 3) we are going to remove labels.  This applies to the
 	// entire subcluster, so pending delete isn't checked.
+	//
+	// For 5), the shard subscriptions of every node may have changed. So we
+	// add the label to pods that now own a shard and remove it from pods that
+	// no longer do.
 	switch c.ApplyMethod {
 	case AddNodeApplyMethod, PodRescheduleApplyMethod:
-		if !labelExists && pf.upNode && (pf.shardSubscriptions > 0 || !c.Vdb.IsEON()) && !pf.pendingDelete {
+		if !labelExists && pf.upNode && (pf.shardSubscriptions > 0 || !c.Vdb.IsEON()) && !pf.pendingDelete && !pf.shutdown {
 			pod.Labels[vmeta.ClientRoutingLabel] = vmeta.ClientRoutingVal
 			c.VRec.Log.Info("Adding client routing label", "pod",
 				pod.Name, "label", fmt.Sprintf("%s=%s", vmeta.ClientRoutingLabel, vmeta.ClientRoutingVal))
 		}
 	case DelNodeApplyMethod:
-		if labelExists && pf.pendingDelete {
+		if labelExists && (pf.pendingDelete || pf.shutdown) {
+			delete(pod.Labels, vmeta.ClientRoutingLabel)
+			c.VRec.Log.Info("Removing client routing label", "pod",
+				pod.Name, "label", fmt.Sprintf("%s=%s", vmeta.ClientRoutingLabel, vmeta.ClientRoutingVal))
+		}
+	case ReshardApplyMethod:
+		canRoute := pf.upNode && pf.shardSubscriptions > 0 && !pf.pendingDelete && !pf.shutdown
+		if !labelExists && canRoute {
+			pod.Labels[vmeta.ClientRoutingLabel] = vmeta.ClientRoutingVal
+			c.VRec.Log.Info("Adding client routing label", "pod",
+				pod.Name, "label", fmt.Sprintf("%s=%s", vmeta.ClientRoutingLabel, vmeta.ClientRoutingVal))
+		} else if labelExists && !canRoute {
 			delete(pod.Labels, vmeta.ClientRoutingLabel)
 			c.VRec.Log.Info("Removing client routing label", "pod",
 				pod.Name, "label", fmt.Sprintf("%s=%s", vmeta.ClientRoutingLabel, vmeta.ClientRoutingVal))
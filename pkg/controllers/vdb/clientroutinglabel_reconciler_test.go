@@ -26,6 +26,7 @@ import (
 	"github.com/vertica/vertica-kubernetes/pkg/names"
 	"github.com/vertica/vertica-kubernetes/pkg/test"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -160,4 +161,36 @@ var _ = Describe("clientroutinglabel_reconcile", func() {
 		_, ok = pod.Labels[vmeta.ClientRoutingLabel]
 		Expect(ok).Should(BeFalse())
 	})
+
+	It("should add and remove labels based on the new shard subscriptions after a reshard", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters = []vapi.Subcluster{
+			{Name: "sc1", Size: 2},
+		}
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := MakePodFacts(vdbRec, fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		pfn1 := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+		pfn2 := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 1)
+		for _, pn := range []types.NamespacedName{pfn1, pfn2} {
+			pfacts.Detail[pn].upNode = true
+			pfacts.Detail[pn].shardSubscriptions = 1
+		}
+		act := MakeClientRoutingLabelReconciler(vdbRec, vdb, &pfacts, ReshardApplyMethod, "")
+		Expect(act.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+
+		// After a reshard, the second pod no longer owns a shard
+		pfacts.Detail[pfn2].shardSubscriptions = 0
+		Expect(act.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, pfn1, pod)).Should(Succeed())
+		Expect(pod.Labels[vmeta.ClientRoutingLabel]).Should(Equal(vmeta.ClientRoutingVal))
+		Expect(k8sClient.Get(ctx, pfn2, pod)).Should(Succeed())
+		_, ok := pod.Labels[vmeta.ClientRoutingLabel]
+		Expect(ok).Should(BeFalse())
+	})
 })
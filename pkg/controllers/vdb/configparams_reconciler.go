@@ -0,0 +1,380 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// The node name that configuration_parameters uses for values that are set at
+// the database level.
+const dbLevelParmNodeName = "ALL"
+
+// configParm is a single config parameter that we want set for a node, or for
+// the entire database.
+type configParm struct {
+	nodeName string // Name of the node or dbLevelParmNodeName
+	name     string
+	value    string
+}
+
+// configParmState is the state of a config parameter as read from the
+// configuration_parameters table.
+type configParmState struct {
+	currentValue string
+	restartValue string // Value that will take effect after a restart
+}
+
+// ConfigParamsReconciler will apply the config parameters in the spec to the
+// running database and report on any drift.
+type ConfigParamsReconciler struct {
+	VRec    *VerticaDBReconciler
+	Log     logr.Logger
+	Vdb     *vapi.VerticaDB // Vdb is the CRD we are acting on.
+	PRunner cmds.PodRunner
+	PFacts  *PodFacts
+}
+
+// MakeConfigParamsReconciler will build a ConfigParamsReconciler object
+func MakeConfigParamsReconciler(vdbrecon *VerticaDBReconciler, log logr.Logger,
+	vdb *vapi.VerticaDB, prunner cmds.PodRunner, pfacts *PodFacts) controllers.ReconcileActor {
+	return &ConfigParamsReconciler{
+		VRec:    vdbrecon,
+		Log:     log.WithName("ConfigParamsReconciler"),
+		Vdb:     vdb,
+		PRunner: prunner,
+		PFacts:  pfacts,
+	}
+}
+
+// Reconcile will set any config parameters that differ from the spec
+func (c *ConfigParamsReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ctrl.Result, error) {
+	if c.Vdb.Spec.InitPolicy == vapi.CommunalInitPolicyScheduleOnly {
+		return ctrl.Result{}, nil
+	}
+
+	if err := c.PFacts.Collect(ctx, c.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	desired := c.getDesiredParms()
+	if len(desired) == 0 {
+		// Clear out anything left over from when parameters were in the spec
+		if len(c.Vdb.Status.ConfigParametersPendingRestart) == 0 && len(c.Vdb.Status.ConfigParametersUnknown) == 0 {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, c.updateStatus(ctx, nil, nil, nil)
+	}
+
+	// The parameters can only be checked while the database is up. There is
+	// no need to requeue; we get reconciled again when the pods come up.
+	pf, ok := c.PFacts.findPodToRunVsql(false, "")
+	if !ok {
+		c.Log.Info("No pod found to run vsql from. Skipping config parameters until the database is up.")
+		return ctrl.Result{}, nil
+	}
+
+	states, err := c.fetchParmStates(ctx, pf, desired)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	desired, unknown := findUnknownParms(desired, states)
+	drifted := c.findDriftedParms(desired, states)
+	if len(drifted) > 0 {
+		c.VRec.Eventf(c.Vdb, corev1.EventTypeNormal, events.ConfigParameterDrift,
+			"Setting %d configuration parameters that differ from the spec: %s", len(drifted), genParmList(drifted))
+		if err := c.setParms(ctx, pf, drifted); err != nil {
+			c.VRec.Eventf(c.Vdb, corev1.EventTypeWarning, events.ConfigParameterSetFailed,
+				"Failed to set configuration parameters: %s", err.Error())
+			if err2 := c.updateStatus(ctx, drifted, unknown, nil); err2 != nil {
+				c.Log.Error(err2, "failed to update status after setting config parameters failed")
+			}
+			return ctrl.Result{}, err
+		}
+		// Read the parameters back to verify they were all set
+		states, err = c.fetchParmStates(ctx, pf, desired)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		drifted = c.findDriftedParms(desired, states)
+		if len(drifted) > 0 {
+			c.VRec.Eventf(c.Vdb, corev1.EventTypeWarning, events.ConfigParameterDrift,
+				"Configuration parameters still differ from the spec after setting them: %s", genParmList(drifted))
+		}
+	}
+	return ctrl.Result{}, c.updateStatus(ctx, drifted, unknown, c.findParmsPendingRestart(desired, states))
+}
+
+// getDesiredParms returns all of the config parameters that are set in the
+// spec. Parameters for a subcluster are expanded to each node in it.
+func (c *ConfigParamsReconciler) getDesiredParms() []configParm {
+	parms := []configParm{}
+	for _, k := range sortedKeys(c.Vdb.Spec.ConfigParameters) {
+		parms = append(parms, configParm{nodeName: dbLevelParmNodeName, name: k, value: c.Vdb.Spec.ConfigParameters[k]})
+	}
+	scMap := c.Vdb.GenSubclusterMap()
+	pods := []*PodFact{}
+	for _, pf := range c.PFacts.Detail {
+		if pf.dbExists && pf.vnodeName != "" {
+			pods = append(pods, pf)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].vnodeName < pods[j].vnodeName })
+	for _, pf := range pods {
+		sc, ok := scMap[pf.subclusterName]
+		if !ok {
+			continue
+		}
+		for _, k := range sortedKeys(sc.ConfigParameters) {
+			parms = append(parms, configParm{nodeName: pf.vnodeName, name: k, value: sc.ConfigParameters[k]})
+		}
+	}
+	return parms
+}
+
+// fetchParmStates reads the current state of the given parameters from the
+// configuration_parameters table. The returned map is keyed by the node and
+// parameter name.
+func (c *ConfigParamsReconciler) fetchParmStates(ctx context.Context, pf *PodFact,
+	parms []configParm) (map[string]configParmState, error) {
+	seen := map[string]bool{}
+	quotedNames := []string{}
+	for i := range parms {
+		nm := strings.ToLower(parms[i].name)
+		if !seen[nm] {
+			seen[nm] = true
+			quotedNames = append(quotedNames, fmt.Sprintf("'%s'", nm))
+		}
+	}
+	sql := fmt.Sprintf("select node_name, parameter_name, current_value, restart_value "+
+		"from configuration_parameters where lower(parameter_name) in (%s)", strings.Join(quotedNames, ", "))
+	stdout, _, err := c.PRunner.ExecVSQL(ctx, pf.name, names.ServerContainer, "-tAc", sql)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigParmStates(stdout), nil
+}
+
+// parseConfigParmStates will parse the output of the configuration_parameters
+// query.
+func parseConfigParmStates(stdout string) map[string]configParmState {
+	states := map[string]configParmState{}
+	const ExpectedCols = 4
+	for _, line := range strings.Split(stdout, "\n") {
+		cols := strings.Split(line, "|")
+		if len(cols) < ExpectedCols {
+			continue
+		}
+		states[genParmKey(cols[0], cols[1])] = configParmState{
+			currentValue: cols[2],
+			restartValue: cols[3],
+		}
+	}
+	return states
+}
+
+// findUnknownParms splits out the parameters that the database doesn't have.
+// Any parameter vertica knows about has at least one row in
+// configuration_parameters. The first return value has the known parameters
+// and the second the sorted names of the unknown ones.
+func findUnknownParms(desired []configParm, states map[string]configParmState) (known []configParm, unknown []string) {
+	knownNames := map[string]bool{}
+	for k := range states {
+		knownNames[k[strings.LastIndex(k, "/")+1:]] = true
+	}
+	unknownNames := map[string]bool{}
+	for i := range desired {
+		if knownNames[strings.ToLower(desired[i].name)] {
+			known = append(known, desired[i])
+		} else {
+			unknownNames[desired[i].name] = true
+		}
+	}
+	return known, sortedKeys(unknownNames)
+}
+
+// findDriftedParms returns the parameters whose value in the database, once
+// restarted, won't match the spec.
+func (c *ConfigParamsReconciler) findDriftedParms(desired []configParm, states map[string]configParmState) []configParm {
+	drifted := []configParm{}
+	for i := range desired {
+		st, ok := states[genParmKey(desired[i].nodeName, desired[i].name)]
+		if !ok || normalizeParmValue(st.getValueAfterRestart()) != normalizeParmValue(desired[i].value) {
+			drifted = append(drifted, desired[i])
+		}
+	}
+	return drifted
+}
+
+// findParmsPendingRestart returns the names of the parameters whose value
+// was set but won't take effect until the database is restarted.
+func (c *ConfigParamsReconciler) findParmsPendingRestart(desired []configParm, states map[string]configParmState) []string {
+	pending := map[string]bool{}
+	for i := range desired {
+		st, ok := states[genParmKey(desired[i].nodeName, desired[i].name)]
+		if ok && st.currentValue != st.getValueAfterRestart() {
+			pending[desired[i].name] = true
+		}
+	}
+	return sortedKeys(pending)
+}
+
+// setParms will set the given parameters in the database
+func (c *ConfigParamsReconciler) setParms(ctx context.Context, pf *PodFact, parms []configParm) error {
+	var sb strings.Builder
+	for i := range parms {
+		val := strings.ReplaceAll(parms[i].value, "'", "''")
+		if parms[i].nodeName == dbLevelParmNodeName {
+			sb.WriteString(fmt.Sprintf("alter database default set parameter %s = '%s';\n", parms[i].name, val))
+		} else {
+			sb.WriteString(fmt.Sprintf("alter node %s set parameter %s = '%s';\n", parms[i].nodeName, parms[i].name, val))
+		}
+	}
+	_, _, err := c.PRunner.ExecVSQL(ctx, pf.name, names.ServerContainer, "-tAc", sb.String())
+	return err
+}
+
+// updateStatus will update the status condition and the lists of parameters
+// that need a restart or are unknown. An event is written when either list
+// gets new parameters.
+func (c *ConfigParamsReconciler) updateStatus(ctx context.Context, drifted []configParm, unknown, pendingRestart []string) error {
+	if len(pendingRestart) > 0 && !isSameStringSlice(pendingRestart, c.Vdb.Status.ConfigParametersPendingRestart) {
+		c.VRec.Eventf(c.Vdb, corev1.EventTypeNormal, events.ConfigParameterRestartNeeded,
+			"The database must be restarted for these configuration parameters to take effect: %s",
+			strings.Join(pendingRestart, ", "))
+	}
+	if len(unknown) > 0 && !isSameStringSlice(unknown, c.Vdb.Status.ConfigParametersUnknown) {
+		c.VRec.Eventf(c.Vdb, corev1.EventTypeWarning, events.ConfigParameterUnknown,
+			"These configuration parameters are not known to the database and will be skipped: %s",
+			strings.Join(unknown, ", "))
+	}
+	err := vdbstatus.Update(ctx, c.VRec.Client, c.Vdb, func(vdb *vapi.VerticaDB) error {
+		vdb.Status.ConfigParametersPendingRestart = pendingRestart
+		vdb.Status.ConfigParametersUnknown = unknown
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	status := corev1.ConditionTrue
+	if len(drifted) > 0 || len(unknown) > 0 {
+		status = corev1.ConditionFalse
+	}
+	return vdbstatus.UpdateCondition(ctx, c.VRec.Client, c.Vdb,
+		vapi.VerticaDBCondition{Type: vapi.ConfigParametersInSync, Status: status})
+}
+
+// getValueAfterRestart returns the value the parameter will have once the
+// database is restarted.
+func (c *configParmState) getValueAfterRestart() string {
+	if c.restartValue == "" {
+		return c.currentValue
+	}
+	return c.restartValue
+}
+
+// The values vertica accepts for a boolean parameter
+var (
+	parmTrueValues  = map[string]bool{"1": true, "t": true, "true": true, "y": true, "yes": true, "on": true}
+	parmFalseValues = map[string]bool{"0": true, "f": true, "false": true, "n": true, "no": true, "off": true}
+)
+
+// parmDurationPattern matches a duration with a unit, like '1h' or '30 min'
+var parmDurationPattern = regexp.MustCompile(`^([0-9]+)\s*(s|secs?|seconds?|m|mins?|minutes?|h|hrs?|hours?|d|days?)$`)
+
+// normalizeParmValue returns a canonical form of a parameter value so that
+// equivalent values compare equal. The configuration_parameters table reports
+// booleans as 0/1 and durations in seconds, whereas the spec may use forms
+// like 'true' or '1h'.
+func normalizeParmValue(val string) string {
+	v := strings.ToLower(strings.TrimSpace(val))
+	if len(v) >= 2 && strings.HasPrefix(v, "'") && strings.HasSuffix(v, "'") {
+		v = strings.TrimSpace(v[1 : len(v)-1])
+	}
+	switch {
+	case parmTrueValues[v]:
+		return "1"
+	case parmFalseValues[v]:
+		return "0"
+	}
+	m := parmDurationPattern.FindStringSubmatch(v)
+	if m == nil {
+		return v
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return v
+	}
+	secs := map[byte]int{'s': 1, 'm': 60, 'h': 60 * 60, 'd': 24 * 60 * 60}[m[2][0]]
+	return strconv.Itoa(n * secs)
+}
+
+// genParmKey generates the key for the map of config parameter states. Vertica
+// treats the parameter names as case insensitive.
+func genParmKey(nodeName, parmName string) string {
+	return fmt.Sprintf("%s/%s", nodeName, strings.ToLower(parmName))
+}
+
+// genParmList returns a human readable list of parameters for events
+func genParmList(parms []configParm) string {
+	parmStrs := make([]string, len(parms))
+	for i := range parms {
+		if parms[i].nodeName == dbLevelParmNodeName {
+			parmStrs[i] = parms[i].name
+		} else {
+			parmStrs[i] = fmt.Sprintf("%s (%s)", parms[i].name, parms[i].nodeName)
+		}
+	}
+	return strings.Join(parmStrs, ", ")
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isSameStringSlice returns true if the two slices have the same contents
+func isSameStringSlice(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
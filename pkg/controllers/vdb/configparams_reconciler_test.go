@@ -0,0 +1,168 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/test"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("configparams_reconcile", func() {
+	ctx := context.Background()
+
+	It("should set parameters that drifted and report ones that need a restart", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters[0].Size = 1
+		vdb.Spec.ConfigParameters = map[string]string{
+			"MaxClientSessions":         "100",
+			"DatabaseHeartbeatInterval": "60",
+		}
+		vdb.Spec.Subclusters[0].ConfigParameters = map[string]string{"MaxDepotSizePercent": "80"}
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		fpr.Results = cmds.CmdResults{
+			pn: []cmds.CmdResult{
+				{Stdout: "ALL|MaxClientSessions|50|50\nALL|DatabaseHeartbeatInterval|60|60\n" +
+					"ALL|MaxDepotSizePercent|60|60\n"},
+				{}, // alter database
+				{Stdout: "ALL|MaxClientSessions|50|100\nALL|DatabaseHeartbeatInterval|60|60\n" +
+					"v_db_node0001|MaxDepotSizePercent|80|80\n"},
+			},
+		}
+		pfacts.Detail[pn].upNode = true
+		pfacts.Detail[pn].dbExists = true
+		pfacts.Detail[pn].vnodeName = "v_db_node0001"
+
+		r := MakeConfigParamsReconciler(vdbRec, logger, vdb, fpr, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		cmd := fpr.FindCommands("alter database default set parameter")
+		Expect(cmd).Should(HaveLen(1))
+		sql := cmd[0].Command[len(cmd[0].Command)-1]
+		Expect(sql).Should(ContainSubstring("alter database default set parameter MaxClientSessions = '100';"))
+		Expect(sql).Should(ContainSubstring("alter node v_db_node0001 set parameter MaxDepotSizePercent = '80';"))
+		Expect(sql).ShouldNot(ContainSubstring("DatabaseHeartbeatInterval"))
+
+		fetchVdb := &vapi.VerticaDB{}
+		Expect(k8sClient.Get(ctx, vdb.ExtractNamespacedName(), fetchVdb)).Should(Succeed())
+		Expect(fetchVdb.Status.ConfigParametersPendingRestart).Should(Equal([]string{"MaxClientSessions"}))
+		Expect(fetchVdb.Status.Conditions[vapi.ConfigParametersInSyncIndex].Status).Should(Equal(corev1.ConditionTrue))
+	})
+
+	It("should mark the parameters out of sync if they can't be set", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters[0].Size = 1
+		vdb.Spec.ConfigParameters = map[string]string{"MaxClientSessions": "100"}
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		fpr.Results = cmds.CmdResults{
+			pn: []cmds.CmdResult{
+				{Stdout: "ALL|MaxClientSessions|50|50\n"},
+				{}, // alter database
+				{Stdout: "ALL|MaxClientSessions|50|50\n"},
+			},
+		}
+		pfacts.Detail[pn].upNode = true
+
+		r := MakeConfigParamsReconciler(vdbRec, logger, vdb, fpr, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		fetchVdb := &vapi.VerticaDB{}
+		Expect(k8sClient.Get(ctx, vdb.ExtractNamespacedName(), fetchVdb)).Should(Succeed())
+		Expect(fetchVdb.Status.Conditions[vapi.ConfigParametersInSyncIndex].Status).Should(Equal(corev1.ConditionFalse))
+		Expect(fetchVdb.Status.ConfigParametersPendingRestart).Should(BeEmpty())
+	})
+
+	It("should report unknown parameters without failing", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters[0].Size = 1
+		vdb.Spec.ConfigParameters = map[string]string{"MaxClientSessions": "100", "NoSuchParm": "1"}
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		fpr.Results = cmds.CmdResults{
+			pn: []cmds.CmdResult{
+				{Stdout: "ALL|MaxClientSessions|100|100\n"},
+				{Stdout: "ALL|MaxClientSessions|100|100\n"},
+			},
+		}
+		pfacts.Detail[pn].upNode = true
+
+		r := MakeConfigParamsReconciler(vdbRec, logger, vdb, fpr, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(fpr.FindCommands("NoSuchParm =")).Should(BeEmpty())
+		fetchVdb := &vapi.VerticaDB{}
+		Expect(k8sClient.Get(ctx, vdb.ExtractNamespacedName(), fetchVdb)).Should(Succeed())
+		Expect(fetchVdb.Status.ConfigParametersUnknown).Should(Equal([]string{"NoSuchParm"}))
+		Expect(fetchVdb.Status.Conditions[vapi.ConfigParametersInSyncIndex].Status).Should(Equal(corev1.ConditionFalse))
+	})
+
+	It("should skip without a requeue if no pod is up", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.ConfigParameters = map[string]string{"MaxClientSessions": "100"}
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		for _, pf := range pfacts.Detail {
+			pf.upNode = false
+		}
+		fpr.Histories = nil
+
+		r := MakeConfigParamsReconciler(vdbRec, logger, vdb, fpr, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(fpr.Histories).Should(BeEmpty())
+	})
+
+	It("should treat equivalent values as in sync", func() {
+		Expect(normalizeParmValue("true")).Should(Equal(normalizeParmValue("1")))
+		Expect(normalizeParmValue("'1h'")).Should(Equal(normalizeParmValue("3600")))
+		Expect(normalizeParmValue("30 min")).Should(Equal("1800"))
+		Expect(normalizeParmValue("Off")).Should(Equal("0"))
+		Expect(normalizeParmValue("80")).Should(Equal("80"))
+		Expect(normalizeParmValue("'abc'")).Should(Equal("abc"))
+	})
+})
@@ -47,8 +47,9 @@ func MakeDrainNodeReconciler(vdbrecon *VerticaDBReconciler,
 }
 
 // Reconcile will wait for active connections to leave in any pod that is marked
-// as pending delete.  This will drain those pods that we are going to scale
-// down before we actually remove them from the cluster.
+// as pending delete or that are in a subcluster being shutdown.  This will
+// drain those pods that we are going to scale down before we actually remove
+// them from the cluster or stop them.
 func (s *DrainNodeReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ctrl.Result, error) {
 	if err := s.PFacts.Collect(ctx, s.Vdb); err != nil {
 		return ctrl.Result{}, err
@@ -57,7 +58,7 @@ func (s *DrainNodeReconciler) Reconcile(ctx context.Context, req *ctrl.Request)
 	// Note: this reconciler depends on the clien routing reconciler to have run
 	// and directed traffic away from pending delete pods.
 	for _, pf := range s.PFacts.Detail {
-		if pf.pendingDelete && pf.upNode {
+		if (pf.pendingDelete || pf.shutdown) && pf.upNode {
 			if res, err := s.reconcilePod(ctx, pf); verrors.IsReconcileAborted(res, err) {
 				return res, err
 			}
@@ -0,0 +1,195 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// ZoneFaultGroupPrefix is the prefix of the name of each fault group that the
+// operator creates. Only fault groups with this prefix are dropped by the
+// operator, which leaves any that were created by hand alone.
+const ZoneFaultGroupPrefix = "zone_"
+
+// FaultGroupReconciler will put each Vertica node in a fault group that
+// matches the zone of the Kubernetes node its pod runs on.
+type FaultGroupReconciler struct {
+	VRec    *VerticaDBReconciler
+	Log     logr.Logger
+	Vdb     *vapi.VerticaDB // Vdb is the CRD we are acting on.
+	PRunner cmds.PodRunner
+	PFacts  *PodFacts
+}
+
+// faultGroupState is the current fault group layout in the database
+type faultGroupState struct {
+	// All of the fault groups, including empty ones
+	groups map[string]bool
+	// The fault group of each node, keyed by the vnode name
+	nodeGroup map[string]string
+}
+
+// MakeFaultGroupReconciler will build a FaultGroupReconciler object
+func MakeFaultGroupReconciler(vdbrecon *VerticaDBReconciler, log logr.Logger,
+	vdb *vapi.VerticaDB, prunner cmds.PodRunner, pfacts *PodFacts) controllers.ReconcileActor {
+	return &FaultGroupReconciler{
+		VRec:    vdbrecon,
+		Log:     log.WithName("FaultGroupReconciler"),
+		Vdb:     vdb,
+		PRunner: prunner,
+		PFacts:  pfacts,
+	}
+}
+
+// Reconcile will create, alter and drop fault groups so that they match the
+// zones the pods are running in.
+func (f *FaultGroupReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ctrl.Result, error) {
+	// Fault groups are only used in Enterprise Mode. We skip ScheduleOnly as
+	// the operator doesn't manage the database.
+	if !f.Vdb.IsZoneTopologyEnabled() || f.Vdb.IsEON() ||
+		f.Vdb.Spec.InitPolicy == vapi.CommunalInitPolicyScheduleOnly {
+		return ctrl.Result{}, nil
+	}
+	if isSet, err := f.Vdb.IsConditionSet(vapi.DBInitialized); !isSet || err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := f.PFacts.Collect(ctx, f.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+	pf, ok := f.PFacts.findPodToRunVsql(false, "")
+	if !ok {
+		f.Log.Info("No pod found to run vsql from. Requeue reconciliation.")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	state, err := f.fetchFaultGroups(ctx, pf)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	stmts := f.genFaultGroupChanges(state)
+	if len(stmts) == 0 {
+		return ctrl.Result{}, nil
+	}
+	f.Log.Info("Updating fault groups", "statements", stmts)
+	_, stderr, err := f.PRunner.ExecVSQL(ctx, pf.name, names.ServerContainer, "-tAc", strings.Join(stmts, " "))
+	if err != nil {
+		f.VRec.Eventf(f.Vdb, corev1.EventTypeWarning, events.FaultGroupsUpdateFailed,
+			"Failed to update the fault groups to match the zones of the pods: %s", stderr)
+		return ctrl.Result{}, err
+	}
+	f.VRec.Event(f.Vdb, corev1.EventTypeNormal, events.FaultGroupsUpdated,
+		"Updated the fault groups to match the zones of the pods")
+	return ctrl.Result{}, nil
+}
+
+// fetchFaultGroups will query the database for its fault groups and the nodes
+// that are in them.
+func (f *FaultGroupReconciler) fetchFaultGroups(ctx context.Context, pf *PodFact) (*faultGroupState, error) {
+	sql := "select member_type, member_name, parent_name from fault_groups"
+	stdout, _, err := f.PRunner.ExecVSQL(ctx, pf.name, names.ServerContainer, "-tAc", sql)
+	if err != nil {
+		return nil, err
+	}
+	return parseFaultGroups(stdout), nil
+}
+
+// parseFaultGroups will parse the output of the fault_groups query. Each line
+// has the member type, member name and parent name separated by '|'.
+func parseFaultGroups(stdout string) *faultGroupState {
+	state := &faultGroupState{
+		groups:    map[string]bool{},
+		nodeGroup: map[string]string{},
+	}
+	for _, line := range strings.Split(stdout, "\n") {
+		cols := strings.Split(strings.TrimSpace(line), "|")
+		const ExpectedCols = 3
+		if len(cols) != ExpectedCols {
+			continue
+		}
+		switch cols[0] {
+		case "FAULT GROUP":
+			state.groups[cols[1]] = true
+		case "NODE":
+			state.nodeGroup[cols[1]] = cols[2]
+			state.groups[cols[2]] = true
+		}
+	}
+	return state
+}
+
+// genFaultGroupChanges returns the SQL statements that will move each node to
+// the fault group for its zone. Fault groups created by the operator that end
+// up empty are dropped.
+func (f *FaultGroupReconciler) genFaultGroupChanges(state *faultGroupState) []string {
+	stmts := []string{}
+	// Iterate over the pods in a fixed order so the statements are stable
+	pods := f.PFacts.filterPods(func(v *PodFact) bool {
+		return v.dbExists && v.vnodeName != "" && v.zone != ""
+	})
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].vnodeName < pods[j].vnodeName
+	})
+	for _, pf := range pods {
+		want := genZoneFaultGroupName(pf.zone)
+		cur, inGroup := state.nodeGroup[pf.vnodeName]
+		if inGroup && cur == want {
+			continue
+		}
+		if !state.groups[want] {
+			stmts = append(stmts, fmt.Sprintf(`create fault group "%s";`, want))
+			state.groups[want] = true
+		}
+		if inGroup {
+			stmts = append(stmts, fmt.Sprintf(`alter fault group "%s" drop node %s;`, cur, pf.vnodeName))
+		}
+		stmts = append(stmts, fmt.Sprintf(`alter fault group "%s" add node %s;`, want, pf.vnodeName))
+		state.nodeGroup[pf.vnodeName] = want
+	}
+
+	inUse := map[string]bool{}
+	for _, g := range state.nodeGroup {
+		inUse[g] = true
+	}
+	emptyGroups := []string{}
+	for g := range state.groups {
+		if strings.HasPrefix(g, ZoneFaultGroupPrefix) && !inUse[g] {
+			emptyGroups = append(emptyGroups, g)
+		}
+	}
+	sort.Strings(emptyGroups)
+	for _, g := range emptyGroups {
+		stmts = append(stmts, fmt.Sprintf(`drop fault group "%s";`, g))
+	}
+	return stmts
+}
+
+// genZoneFaultGroupName returns the name of the fault group for a zone
+func genZoneFaultGroupName(zone string) string {
+	return ZoneFaultGroupPrefix + zone
+}
@@ -0,0 +1,88 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("faultgroup_reconcile", func() {
+	ctx := context.Background()
+
+	It("should parse the fault groups from the database", func() {
+		state := parseFaultGroups("FAULT GROUP|zone_a|\nNODE|v_db_node0001|zone_a\nFAULT GROUP|manual|\n\n")
+		Expect(state.groups).Should(Equal(map[string]bool{"zone_a": true, "manual": true}))
+		Expect(state.nodeGroup).Should(Equal(map[string]string{"v_db_node0001": "zone_a"}))
+	})
+
+	It("should move each node to the fault group of its zone", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.ShardCount = 0 // Enterprise Mode
+		vdb.Spec.Topology.Mode = vapi.TopologyModeZone
+		vdb.Spec.Subclusters[0].Size = 3
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		sc := &vdb.Spec.Subclusters[0]
+		zones := []string{"a", "b", "b"}
+		vnodes := []string{"v_db_node0001", "v_db_node0002", "v_db_node0003"}
+		for i := range zones {
+			pf := pfacts.Detail[names.GenPodName(vdb, sc, int32(i))]
+			pf.dbExists = true
+			pf.upNode = true
+			pf.vnodeName = vnodes[i]
+			pf.zone = zones[i]
+		}
+		fpr.Results = cmds.CmdResults{}
+		for pn := range pfacts.Detail {
+			fpr.Results[pn] = []cmds.CmdResult{
+				{Stdout: "FAULT GROUP|zone_a|\nFAULT GROUP|zone_c|\nFAULT GROUP|manual|\n" +
+					"NODE|v_db_node0001|zone_a\nNODE|v_db_node0002|zone_a\n"},
+			}
+		}
+
+		r := MakeFaultGroupReconciler(vdbRec, logger, vdb, fpr, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(fpr.FindCommands("from fault_groups")).Should(HaveLen(1))
+		hist := fpr.FindCommands("alter fault group")
+		Expect(hist).Should(HaveLen(1))
+		Expect(hist[0].Command).Should(ContainElement(
+			`create fault group "zone_b"; ` +
+				`alter fault group "zone_a" drop node v_db_node0002; ` +
+				`alter fault group "zone_b" add node v_db_node0002; ` +
+				`alter fault group "zone_b" add node v_db_node0003; ` +
+				`drop fault group "zone_c";`))
+	})
+
+	It("should skip Eon Mode databases", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Topology.Mode = vapi.TopologyModeZone
+		fpr := &cmds.FakePodRunner{}
+		r := MakeFaultGroupReconciler(vdbRec, logger, vdb, fpr, createPodFactsDefault(fpr))
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(fpr.Histories).Should(BeEmpty())
+	})
+})
@@ -17,16 +17,31 @@ package vdb
 
 import (
 	"context"
+	"sort"
+	"time"
 
 	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
 	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
 	"github.com/vertica/vertica-kubernetes/pkg/events"
+	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
+// We report a warning for any pod that has less then this amount of free
+// space in their local PV.
+const FreeSpaceThreshold = 10 * 1024 * 1024 // 10mb
+
+// The interval we poll the disk usage at when autoGrow is set, but doesn't
+// have a minimum interval between expansions.
+const DefaultAutoGrowPollSeconds = 60
+
 // LocalDataCheckReconciler will check the free space available in the PV and
-// log events if they it is too low.
+// log events if they it is too low. If spec.local.autoGrow is set, it will
+// also expand any PVC whose disk usage crosses the threshold.
 type LocalDataCheckReconciler struct {
 	VRec      *VerticaDBReconciler
 	Vdb       *vapi.VerticaDB
@@ -45,16 +60,133 @@ func (l *LocalDataCheckReconciler) Reconcile(ctx context.Context, req *ctrl.Requ
 		return ctrl.Result{}, err
 	}
 
-	// We report a warning for any pod that has less then this amount of free
-	// space in their local PV.
-	const FreeSpaceThreshold = 10 * 1024 * 1024 // 10mb
 	pods := l.PFacts.findPodsLowOnDiskSpace(FreeSpaceThreshold)
 	l.NumEvents = 0
 	for i := range pods {
-		l.VRec.Eventf(l.Vdb, corev1.EventTypeWarning, events.LowLocalDataAvailSpace,
-			"Low disk space in persistent volume attached to %s", pods[i].name.Name)
-		l.NumEvents++
+		for _, vol := range pods[i].findVolumesLowOnDiskSpace(FreeSpaceThreshold) {
+			l.VRec.Eventf(l.Vdb, corev1.EventTypeWarning, events.LowLocalDataAvailSpace,
+				"Low disk space in persistent volume %s attached to %s", vol, pods[i].name.Name)
+			l.NumEvents++
+		}
+	}
+
+	if l.Vdb.Spec.Local.AutoGrow == nil {
+		return ctrl.Result{}, nil
 	}
+	return l.autoGrowPVCs(ctx)
+}
 
+// autoGrowPVCs will expand the PVCs whose disk usage has crossed the
+// threshold in the autoGrow policy. The PVC is only updated here. The
+// ResizePVReconciler, which runs later, waits for the volume to be expanded
+// and resizes the depot. Unlike a change to the requestSize, this doesn't wait
+// for a maintenance window as the pod is about to run out of disk space.
+func (l *LocalDataCheckReconciler) autoGrowPVCs(ctx context.Context) (ctrl.Result, error) {
+	resizer := &ResizePVReconcile{VRec: l.VRec, Vdb: l.Vdb, PFacts: l.PFacts}
+	localPVCs := l.Vdb.GetLocalPVCs()
+	pods := l.PFacts.filterPods(func(v *PodFact) bool { return v.isPodRunning })
+	sort.Slice(pods, func(i, j int) bool { return pods[i].name.Name < pods[j].name.Name })
+	for _, pf := range pods {
+		for i := range localPVCs {
+			usedPercent, ok := pf.getVolumeUsedPercent(localPVCs[i].Name)
+			if !ok || usedPercent < l.Vdb.Spec.Local.AutoGrow.ThresholdPercent {
+				continue
+			}
+			if res, err := l.autoGrowPVC(ctx, resizer, pf, &localPVCs[i], usedPercent); verrors.IsReconcileAborted(res, err) {
+				return res, err
+			}
+		}
+	}
 	return ctrl.Result{}, nil
 }
+
+// autoGrowPVC will expand a single PVC by the growth step, as long as it
+// hasn't been expanded recently and isn't already at the max size.
+func (l *LocalDataCheckReconciler) autoGrowPVC(ctx context.Context, resizer *ResizePVReconcile, pf *PodFact,
+	localPVC *vapi.LocalPVC, usedPercent int) (ctrl.Result, error) {
+	ag := l.Vdb.Spec.Local.AutoGrow
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := l.VRec.Client.Get(ctx, genLocalPVCName(localPVC, pf), pvc); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	curSize := pvc.Spec.Resources.Requests.Storage()
+	// Don't grow it again until the last expansion has finished
+	if curSize.Cmp(*pvc.Status.Capacity.Storage()) > 0 {
+		return ctrl.Result{}, nil
+	}
+	agStatus, found := l.Vdb.FindPVCAutoGrowStatus(pvc.Name)
+	minInterval := time.Duration(ag.MinIntervalSeconds) * time.Second
+	if found && time.Since(agStatus.LastExpansionTime.Time) < minInterval {
+		l.VRec.Log.Info("Skipping PVC autogrow because it was expanded recently", "pvc", pvc.Name,
+			"lastExpansionTime", agStatus.LastExpansionTime)
+		return ctrl.Result{}, nil
+	}
+
+	if curSize.Cmp(ag.MaxSize) >= 0 {
+		if found && agStatus.MaxSizeReached {
+			return ctrl.Result{}, nil
+		}
+		l.VRec.Eventf(l.Vdb, corev1.EventTypeWarning, events.PVCAutoGrowMaxSizeReached,
+			"PVC '%s' is %d%% full but cannot be expanded beyond the autoGrow max size of %s",
+			pvc.Name, usedPercent, ag.MaxSize.String())
+		return ctrl.Result{}, l.updateAutoGrowStatus(ctx, pvc.Name, func(st *vapi.PVCAutoGrowStatus) {
+			st.MaxSizeReached = true
+		})
+	}
+
+	newSize := curSize.DeepCopy()
+	newSize.Add(ag.GrowthStep)
+	if newSize.Cmp(ag.MaxSize) > 0 {
+		newSize = ag.MaxSize.DeepCopy()
+	}
+	res, err := resizer.updatePVC(ctx, pvc, newSize)
+	// A requeue is returned only when the PVC was updated. Otherwise, the
+	// expansion was skipped because the storage class forbids it.
+	if err != nil || !res.Requeue {
+		return ctrl.Result{}, err
+	}
+	l.VRec.Eventf(l.Vdb, corev1.EventTypeNormal, events.PVCAutoGrown,
+		"PVC '%s' was %d%% full, so it was expanded from %s to %s",
+		pvc.Name, usedPercent, curSize.String(), newSize.String())
+	return ctrl.Result{}, l.updateAutoGrowStatus(ctx, pvc.Name, func(st *vapi.PVCAutoGrowStatus) {
+		st.RequestSize = newSize
+		st.ExpansionCount++
+		st.LastExpansionTime = metav1.Now()
+		st.MaxSizeReached = false
+	})
+}
+
+// updateAutoGrowStatus will update the autogrow status of a single PVC. An
+// entry for the PVC is added if it doesn't exist yet.
+func (l *LocalDataCheckReconciler) updateAutoGrowStatus(ctx context.Context, pvcName string,
+	updateFunc func(st *vapi.PVCAutoGrowStatus)) error {
+	return vdbstatus.Update(ctx, l.VRec.Client, l.Vdb, func(vdbChg *vapi.VerticaDB) error {
+		for i := range vdbChg.Status.PVCAutoGrow {
+			if vdbChg.Status.PVCAutoGrow[i].Name == pvcName {
+				updateFunc(&vdbChg.Status.PVCAutoGrow[i])
+				return nil
+			}
+		}
+		st := vapi.PVCAutoGrowStatus{Name: pvcName}
+		updateFunc(&st)
+		vdbChg.Status.PVCAutoGrow = append(vdbChg.Status.PVCAutoGrow, st)
+		return nil
+	})
+}
+
+// getAutoGrowPollTime returns how long to wait before reconciling again so
+// that we notice when disk usage crosses the autoGrow threshold. Nothing in
+// Kubernetes changes as a disk fills up, so we need to poll. Zero is returned
+// if autoGrow isn't set.
+func getAutoGrowPollTime(vdb *vapi.VerticaDB) time.Duration {
+	if vdb.Spec.Local.AutoGrow == nil {
+		return 0
+	}
+	if vdb.Spec.Local.AutoGrow.MinIntervalSeconds > 0 {
+		return time.Duration(vdb.Spec.Local.AutoGrow.MinIntervalSeconds) * time.Second
+	}
+	return DefaultAutoGrowPollSeconds * time.Second
+}
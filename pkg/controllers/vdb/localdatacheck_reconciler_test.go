@@ -24,6 +24,8 @@ import (
 	"github.com/vertica/vertica-kubernetes/pkg/cmds"
 	"github.com/vertica/vertica-kubernetes/pkg/names"
 	"github.com/vertica/vertica-kubernetes/pkg/test"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -55,4 +57,62 @@ var _ = Describe("localdatacheck_reconcile", func() {
 		Expect(l.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
 		Expect(l.NumEvents).Should(Equal(1))
 	})
+
+	It("should expand a PVC that crosses the autoGrow threshold up to the max size", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters[0].Size = 2
+		vdb.Spec.Local.RequestSize = resource.MustParse("10Gi")
+		vdb.Spec.Local.AutoGrow = &vapi.LocalStorageAutoGrow{
+			ThresholdPercent:   80,
+			GrowthStep:         resource.MustParse("5Gi"),
+			MaxSize:            resource.MustParse("12Gi"),
+			MinIntervalSeconds: 600,
+		}
+		test.CreateStorageClass(ctx, k8sClient, true)
+		defer test.DeleteStorageClass(ctx, k8sClient)
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		prunner := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(prunner)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		sc := &vdb.Spec.Subclusters[0]
+		pn := names.GenPodName(vdb, sc, 0)
+		pfacts.Detail[pn].localDataSize = 100 * 1024 * 1024
+		pfacts.Detail[pn].localDataAvail = 10 * 1024 * 1024
+		pn = names.GenPodName(vdb, sc, 1)
+		pfacts.Detail[pn].localDataSize = 100 * 1024 * 1024
+		pfacts.Detail[pn].localDataAvail = 50 * 1024 * 1024
+
+		r := MakeLocalDataCheckReconciler(vdbRec, vdb, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		pvc := &corev1.PersistentVolumeClaim{}
+		Expect(k8sClient.Get(ctx, names.GenPVCName(vdb, sc, 1), pvc)).Should(Succeed())
+		Expect(pvc.Spec.Resources.Requests.Storage().String()).Should(Equal("10Gi"))
+		pvcName := names.GenPVCName(vdb, sc, 0)
+		Expect(k8sClient.Get(ctx, pvcName, pvc)).Should(Succeed())
+		Expect(pvc.Spec.Resources.Requests.Storage().String()).Should(Equal("12Gi"))
+		agStatus, ok := vdb.FindPVCAutoGrowStatus(pvcName.Name)
+		Expect(ok).Should(BeTrue())
+		Expect(agStatus.RequestSize.String()).Should(Equal("12Gi"))
+		Expect(agStatus.ExpansionCount).Should(Equal(1))
+		Expect(agStatus.MaxSizeReached).Should(BeFalse())
+
+		// The volume has expanded, but we are still within the min interval
+		pvc.Status.Capacity[corev1.ResourceStorage] = resource.MustParse("12Gi")
+		Expect(k8sClient.Status().Update(ctx, pvc)).Should(Succeed())
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		agStatus, _ = vdb.FindPVCAutoGrowStatus(pvcName.Name)
+		Expect(agStatus.MaxSizeReached).Should(BeFalse())
+
+		vdb.Spec.Local.AutoGrow.MinIntervalSeconds = 0
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(k8sClient.Get(ctx, pvcName, pvc)).Should(Succeed())
+		Expect(pvc.Spec.Resources.Requests.Storage().String()).Should(Equal("12Gi"))
+		agStatus, _ = vdb.FindPVCAutoGrowStatus(pvcName.Name)
+		Expect(agStatus.ExpansionCount).Should(Equal(1))
+		Expect(agStatus.MaxSizeReached).Should(BeTrue())
+	})
 })
@@ -0,0 +1,210 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// Names of the disruptive operations that wait for a maintenance window. These
+// are the values reported in status.deferredOperations.
+const (
+	MaintenanceOpUpgrade         = "Upgrade"
+	MaintenanceOpRebalanceShards = "RebalanceShards"
+	MaintenanceOpResizePVC       = "ResizePVC"
+	MaintenanceOpReshard         = "Reshard"
+	MaintenanceOpRestart         = "Restart"
+)
+
+// isMaintenanceWindowOpen returns true if disruptive operations are allowed at
+// the given time.  When no window is open, it also returns the time the next
+// one opens.  If no maintenance windows are defined, we are always open.
+func isMaintenanceWindowOpen(vdb *vapi.VerticaDB, now time.Time) (bool, time.Time, error) {
+	if len(vdb.Spec.MaintenanceWindows) == 0 {
+		return true, time.Time{}, nil
+	}
+	var nextOpen time.Time
+	for i := range vdb.Spec.MaintenanceWindows {
+		mw := &vdb.Spec.MaintenanceWindows[i]
+		sched, err := cron.ParseStandard(mw.Schedule)
+		if err != nil {
+			return false, time.Time{}, err
+		}
+		loc := time.UTC
+		if mw.TimeZone != "" {
+			if loc, err = time.LoadLocation(mw.TimeZone); err != nil {
+				return false, time.Time{}, err
+			}
+		}
+		localNow := now.In(loc)
+		// The window is open if it was last opened within its duration.  We
+		// find that by looking for the first time it opens after the start
+		// of the lookback period.
+		if start := sched.Next(localNow.Add(-mw.Duration.Duration)); !start.After(localNow) {
+			return true, time.Time{}, nil
+		}
+		if next := sched.Next(localNow); nextOpen.IsZero() || next.Before(nextOpen) {
+			nextOpen = next
+		}
+	}
+	return false, nextOpen, nil
+}
+
+// waitForMaintenanceWindow is like deferToMaintenanceWindow, except that it
+// returns a result to requeue when the next window opens if the operation is
+// deferred.  This should only be used where nothing else is waiting behind the
+// caller; actors of the VerticaDB reconcile must use deferToMaintenanceWindow
+// so that they don't hold up the rest of the reconcile.
+func waitForMaintenanceWindow(ctx context.Context, vrec *VerticaDBReconciler, vdb *vapi.VerticaDB,
+	op string) (ctrl.Result, error) {
+	deferred, err := deferToMaintenanceWindow(ctx, vrec, vdb, op)
+	if !deferred || err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: getMaintenanceWindowRequeueTime(vdb)}, nil
+}
+
+// deferToMaintenanceWindow should be called by an actor before it starts a
+// disruptive operation.  If no maintenance window is open, the operation is
+// recorded as deferred in the status and true is returned.  The caller must
+// then skip the operation, but it can carry on with everything else.  The
+// VerticaDB is requeued when the next window opens.
+func deferToMaintenanceWindow(ctx context.Context, vrec *VerticaDBReconciler, vdb *vapi.VerticaDB,
+	op string) (bool, error) {
+	open, nextOpen, err := isMaintenanceWindowOpen(vdb, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if open {
+		return false, clearDeferredOperations(ctx, vrec, vdb)
+	}
+
+	alreadyDeferred := false
+	for _, o := range vdb.Status.DeferredOperations {
+		if o == op {
+			alreadyDeferred = true
+			break
+		}
+	}
+	if !alreadyDeferred {
+		vrec.Eventf(vdb, corev1.EventTypeNormal, events.WaitingForMaintenanceWindow,
+			"Waiting for maintenance window to do %s.  The next window opens at %s",
+			op, nextOpen.Format(time.RFC3339))
+	}
+	nextOpenTime := metav1.NewTime(nextOpen)
+	if !alreadyDeferred || vdb.Status.NextMaintenanceWindow == nil || !vdb.Status.NextMaintenanceWindow.Equal(&nextOpenTime) {
+		err = vdbstatus.Update(ctx, vrec.Client, vdb, func(vdbChg *vapi.VerticaDB) error {
+			found := false
+			for _, o := range vdbChg.Status.DeferredOperations {
+				found = found || o == op
+			}
+			if !found {
+				vdbChg.Status.DeferredOperations = append(vdbChg.Status.DeferredOperations, op)
+			}
+			vdbChg.Status.NextMaintenanceWindow = &nextOpenTime
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	vrec.Log.Info("Waiting for maintenance window", "operation", op, "nextOpen", nextOpen)
+	return true, nil
+}
+
+// releaseDeferredOperations will clear the deferred operations from the status
+// if a maintenance window is open.  The actors that deferred them will pick
+// them up again in the same reconcile.  When no window is open, a deferred
+// rebalance is dropped because it can only come from a VerticaDBOperation, and
+// we only reconcile the VerticaDB when none of those are running.
+func releaseDeferredOperations(ctx context.Context, vrec *VerticaDBReconciler, vdb *vapi.VerticaDB) error {
+	if len(vdb.Status.DeferredOperations) == 0 {
+		return nil
+	}
+	open, _, err := isMaintenanceWindowOpen(vdb, time.Now())
+	if err != nil {
+		return err
+	}
+	if !open {
+		return clearDeferredOperation(ctx, vrec, vdb, MaintenanceOpRebalanceShards)
+	}
+	return clearDeferredOperations(ctx, vrec, vdb)
+}
+
+// clearDeferredOperation will remove a single operation from the deferred
+// operations in the status.  Actors call this when they find that the
+// operation they deferred is no longer needed, such as when the change that
+// triggered it was reverted.
+func clearDeferredOperation(ctx context.Context, vrec *VerticaDBReconciler, vdb *vapi.VerticaDB, op string) error {
+	found := false
+	for _, o := range vdb.Status.DeferredOperations {
+		found = found || o == op
+	}
+	if !found {
+		return nil
+	}
+	vrec.Log.Info("Dropping deferred operation that is no longer needed", "operation", op)
+	return vdbstatus.Update(ctx, vrec.Client, vdb, func(vdbChg *vapi.VerticaDB) error {
+		ops := []string{}
+		for _, o := range vdbChg.Status.DeferredOperations {
+			if o != op {
+				ops = append(ops, o)
+			}
+		}
+		if len(ops) == 0 {
+			vdbChg.Status.DeferredOperations = nil
+			vdbChg.Status.NextMaintenanceWindow = nil
+		} else {
+			vdbChg.Status.DeferredOperations = ops
+		}
+		return nil
+	})
+}
+
+// clearDeferredOperations will remove all of the deferred operations from the
+// status.  Every deferred operation is free to proceed once a window is open.
+func clearDeferredOperations(ctx context.Context, vrec *VerticaDBReconciler, vdb *vapi.VerticaDB) error {
+	if len(vdb.Status.DeferredOperations) == 0 && vdb.Status.NextMaintenanceWindow == nil {
+		return nil
+	}
+	return vdbstatus.Update(ctx, vrec.Client, vdb, func(vdbChg *vapi.VerticaDB) error {
+		vdbChg.Status.DeferredOperations = nil
+		vdbChg.Status.NextMaintenanceWindow = nil
+		return nil
+	})
+}
+
+// getMaintenanceWindowRequeueTime returns how long to wait before we need to
+// reconcile again for the operations deferred to the next maintenance window.
+// Zero is returned if nothing is deferred.
+func getMaintenanceWindowRequeueTime(vdb *vapi.VerticaDB) time.Duration {
+	if len(vdb.Status.DeferredOperations) == 0 || vdb.Status.NextMaintenanceWindow == nil {
+		return 0
+	}
+	if wait := time.Until(vdb.Status.NextMaintenanceWindow.Time); wait > time.Second {
+		return wait
+	}
+	return time.Second
+}
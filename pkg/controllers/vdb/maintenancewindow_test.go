@@ -0,0 +1,207 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/test"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("maintenancewindow", func() {
+	ctx := context.Background()
+
+	It("should always be open if no maintenance windows are defined", func() {
+		vdb := vapi.MakeVDB()
+		open, _, err := isMaintenanceWindowOpen(vdb, time.Now())
+		Expect(err).Should(Succeed())
+		Expect(open).Should(BeTrue())
+	})
+
+	It("should find when a maintenance window is open", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.MaintenanceWindows = []vapi.MaintenanceWindow{
+			{Schedule: "0 2 * * *", Duration: metav1.Duration{Duration: 2 * time.Hour}, TimeZone: "America/Toronto"},
+		}
+		loc, err := time.LoadLocation("America/Toronto")
+		Expect(err).Should(Succeed())
+
+		open, _, err := isMaintenanceWindowOpen(vdb, time.Date(2023, 6, 1, 3, 30, 0, 0, loc))
+		Expect(err).Should(Succeed())
+		Expect(open).Should(BeTrue())
+
+		open, nextOpen, err := isMaintenanceWindowOpen(vdb, time.Date(2023, 6, 1, 4, 30, 0, 0, loc))
+		Expect(err).Should(Succeed())
+		Expect(open).Should(BeFalse())
+		Expect(nextOpen.Equal(time.Date(2023, 6, 2, 2, 0, 0, 0, loc))).Should(BeTrue())
+
+		// The time zone of the window is honoured.  This is 3:30am in Toronto.
+		open, _, err = isMaintenanceWindowOpen(vdb, time.Date(2023, 6, 1, 7, 30, 0, 0, time.UTC))
+		Expect(err).Should(Succeed())
+		Expect(open).Should(BeTrue())
+	})
+
+	It("should defer a disruptive operation until the maintenance window opens", func() {
+		vdb := vapi.MakeVDB()
+		now := time.Now().UTC()
+		// Pick a window that only opens for a minute once a year so that it is
+		// closed while the test runs.
+		vdb.Spec.MaintenanceWindows = []vapi.MaintenanceWindow{
+			{Schedule: "0 0 1 1 *", Duration: metav1.Duration{Duration: time.Minute}},
+		}
+		if now.Month() == time.January && now.Day() == 1 && now.Hour() == 0 {
+			Skip("test cannot run while the maintenance window is open")
+		}
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+
+		res, err := waitForMaintenanceWindow(ctx, vdbRec, vdb, MaintenanceOpUpgrade)
+		Expect(err).Should(Succeed())
+		Expect(res.RequeueAfter).Should(BeNumerically(">", 0))
+		Expect(vdb.Status.DeferredOperations).Should(ConsistOf(MaintenanceOpUpgrade))
+		Expect(vdb.Status.NextMaintenanceWindow).ShouldNot(BeNil())
+
+		// Remove the window so that the operation can proceed
+		vdb.Spec.MaintenanceWindows = nil
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+		Expect(waitForMaintenanceWindow(ctx, vdbRec, vdb, MaintenanceOpUpgrade)).Should(Equal(ctrl.Result{}))
+		Expect(vdb.Status.DeferredOperations).Should(BeEmpty())
+		Expect(vdb.Status.NextMaintenanceWindow).Should(BeNil())
+	})
+
+	It("should only defer a requested rebalance outside of a maintenance window", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.MaintenanceWindows = []vapi.MaintenanceWindow{
+			{Schedule: "0 0 1 1 *", Duration: metav1.Duration{Duration: time.Minute}},
+		}
+		now := time.Now().UTC()
+		if now.Month() == time.January && now.Day() == 1 && now.Hour() == 0 {
+			Skip("test cannot run while the maintenance window is open")
+		}
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		for _, pf := range pfacts.Detail {
+			pf.shardSubscriptions = 1
+		}
+		r := &RebalanceShardsReconciler{VRec: vdbRec, Log: logger, Vdb: vdb, PRunner: fpr, PFacts: pfacts,
+			Force: true, Voluntary: true}
+		res, err := r.Reconcile(ctx, &ctrl.Request{})
+		Expect(err).Should(Succeed())
+		Expect(res.RequeueAfter).Should(BeNumerically(">", 0))
+		Expect(fpr.FindCommands("select rebalance_shards")).Should(BeEmpty())
+		Expect(vdb.Status.DeferredOperations).Should(ConsistOf(MaintenanceOpRebalanceShards))
+
+		// Nodes without a shard subscription are rebalanced right away
+		pfacts.Detail[names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)].shardSubscriptions = 0
+		r = &RebalanceShardsReconciler{VRec: vdbRec, Log: logger, Vdb: vdb, PRunner: fpr, PFacts: pfacts}
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(fpr.FindCommands("select rebalance_shards")).ShouldNot(BeEmpty())
+	})
+
+	It("should defer a PVC resize without holding up the reconcile", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.MaintenanceWindows = []vapi.MaintenanceWindow{
+			{Schedule: "0 0 1 1 *", Duration: metav1.Duration{Duration: time.Minute}},
+		}
+		now := time.Now().UTC()
+		if now.Month() == time.January && now.Day() == 1 && now.Hour() == 0 {
+			Skip("test cannot run while the maintenance window is open")
+		}
+		test.CreateStorageClass(ctx, k8sClient, true)
+		defer test.DeleteStorageClass(ctx, k8sClient)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+
+		resizeLocalStorage(ctx, vdb, "55Gi")
+		runResizePVReconciler(ctx, vdb, false, false)
+		checkPVCSize(ctx, vdb, false)
+		Expect(vdb.Status.DeferredOperations).Should(ConsistOf(MaintenanceOpResizePVC))
+		Expect(getMaintenanceWindowRequeueTime(vdb)).Should(BeNumerically(">", 0))
+
+		// The deferral is released once a window is open
+		vdb.Spec.MaintenanceWindows = nil
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+		Expect(releaseDeferredOperations(ctx, vdbRec, vdb)).Should(Succeed())
+		Expect(vdb.Status.DeferredOperations).Should(BeEmpty())
+		Expect(getMaintenanceWindowRequeueTime(vdb)).Should(BeZero())
+	})
+
+	It("should drop a deferred PVC resize if the size change is reverted", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.MaintenanceWindows = []vapi.MaintenanceWindow{
+			{Schedule: "0 0 1 1 *", Duration: metav1.Duration{Duration: time.Minute}},
+		}
+		now := time.Now().UTC()
+		if now.Month() == time.January && now.Day() == 1 && now.Hour() == 0 {
+			Skip("test cannot run while the maintenance window is open")
+		}
+		test.CreateStorageClass(ctx, k8sClient, true)
+		defer test.DeleteStorageClass(ctx, k8sClient)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		origSize := vdb.Spec.Local.RequestSize.String()
+		mockResizeStatusUpdate(ctx, vdb, origSize)
+
+		resizeLocalStorage(ctx, vdb, "55Gi")
+		runResizePVReconciler(ctx, vdb, false, false)
+		Expect(vdb.Status.DeferredOperations).Should(ConsistOf(MaintenanceOpResizePVC))
+
+		// Going back to the original size leaves nothing to wait for, even
+		// though the window is still closed.
+		resizeLocalStorage(ctx, vdb, origSize)
+		runResizePVReconciler(ctx, vdb, false, true)
+		Expect(vdb.Status.DeferredOperations).Should(BeEmpty())
+		Expect(vdb.Status.NextMaintenanceWindow).Should(BeNil())
+		Expect(getMaintenanceWindowRequeueTime(vdb)).Should(BeZero())
+	})
+
+	It("should drop a deferred rebalance once no operation is running", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.MaintenanceWindows = []vapi.MaintenanceWindow{
+			{Schedule: "0 0 1 1 *", Duration: metav1.Duration{Duration: time.Minute}},
+		}
+		now := time.Now().UTC()
+		if now.Month() == time.January && now.Day() == 1 && now.Hour() == 0 {
+			Skip("test cannot run while the maintenance window is open")
+		}
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+
+		Expect(deferToMaintenanceWindow(ctx, vdbRec, vdb, MaintenanceOpRebalanceShards)).Should(BeTrue())
+		Expect(deferToMaintenanceWindow(ctx, vdbRec, vdb, MaintenanceOpUpgrade)).Should(BeTrue())
+		Expect(releaseDeferredOperations(ctx, vdbRec, vdb)).Should(Succeed())
+		Expect(vdb.Status.DeferredOperations).Should(ConsistOf(MaintenanceOpUpgrade))
+		Expect(vdb.Status.NextMaintenanceWindow).ShouldNot(BeNil())
+	})
+})
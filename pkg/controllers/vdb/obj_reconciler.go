@@ -29,6 +29,7 @@ import (
 	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
 	"github.com/vertica/vertica-kubernetes/pkg/events"
 	"github.com/vertica/vertica-kubernetes/pkg/iter"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
 	"github.com/vertica/vertica-kubernetes/pkg/names"
 	"github.com/vertica/vertica-kubernetes/pkg/paths"
 	appsv1 "k8s.io/api/apps/v1"
@@ -437,6 +438,17 @@ func (o *ObjReconciler) reconcileSts(ctx context.Context, sc *vapi.Subcluster) (
 	i := names.ServerContainerIndex
 	expSts.Spec.Template.Spec.Containers[i].Image = curSts.Spec.Template.Spec.Containers[i].Image
 
+	// The subcluster type label is owned by the SubclusterTypeReconciler. It
+	// only changes the label once the subcluster has been promoted or demoted
+	// in the database. We never change it in the pod template, as that would
+	// cause a rolling restart of the pods.
+	if scType, ok := curSts.Labels[vmeta.SubclusterTypeLabel]; ok {
+		expSts.Labels[vmeta.SubclusterTypeLabel] = scType
+	}
+	if scType, ok := curSts.Spec.Template.Labels[vmeta.SubclusterTypeLabel]; ok {
+		expSts.Spec.Template.Labels[vmeta.SubclusterTypeLabel] = scType
+	}
+
 	// Preserve scaling if told to do so. This is used when doing early
 	// reconciliation so that we have any necessary pods started.
 	if o.Mode&ObjReconcileModePreserveScaling != 0 {
@@ -448,6 +460,16 @@ func (o *ObjReconciler) reconcileSts(ctx context.Context, sc *vapi.Subcluster) (
 		expSts.Spec.UpdateStrategy.Type = curSts.Spec.UpdateStrategy.Type
 	}
 
+	// A statefulset that was recreated to rename its subcluster adopted pods
+	// that have the revision of the old statefulset. We keep the OnDelete
+	// strategy until every pod is on the current revision, which happens the
+	// next time the pods are restarted for another reason, so that the
+	// adopted pods aren't restarted.
+	_, hasAdoptedPods := curSts.Annotations[vmeta.AdoptedPodsAnnotation]
+	if hasAdoptedPods && !isStsFullyUpdated(curSts) {
+		expSts.Spec.UpdateStrategy = curSts.Spec.UpdateStrategy
+	}
+
 	// We allow the requestSize to change in the VerticaDB.  But we cannot
 	// propagate that in the sts spec.  We handle that by modifying the PVC in a
 	// separate reconciler.  Reset the volume claim spec so that we don't try to
@@ -463,6 +485,9 @@ func (o *ObjReconciler) reconcileSts(ctx context.Context, sc *vapi.Subcluster) (
 	curSts.DeepCopyInto(origSts)
 	expSts.Spec.DeepCopyInto(&curSts.Spec)
 	curSts.Labels = expSts.Labels
+	if hasAdoptedPods && isStsFullyUpdated(curSts) {
+		delete(curSts.Annotations, vmeta.AdoptedPodsAnnotation)
+	}
 	if err := o.VRec.Client.Patch(ctx, curSts, patch); err != nil {
 		return ctrl.Result{}, err
 	}
@@ -475,6 +500,14 @@ func (o *ObjReconciler) reconcileSts(ctx context.Context, sc *vapi.Subcluster) (
 	return ctrl.Result{}, nil
 }
 
+// isStsFullyUpdated returns true if the statefulset controller has reported
+// that every pod is on the current revision of the statefulset.
+func isStsFullyUpdated(sts *appsv1.StatefulSet) bool {
+	return sts.Status.ObservedGeneration >= sts.Generation &&
+		sts.Status.Replicas > 0 &&
+		sts.Status.UpdatedReplicas == sts.Status.Replicas
+}
+
 // checkForOrphanAdmintoolsConfEntries will check whether it is okay to proceed
 // with the statefulset update.  This checks if we are deleting pods/sts and if
 // what we are deleting has had proper cleanup in admintools.conf.  Failure to
@@ -60,6 +60,13 @@ var OfflineUpgradeStatusMsgs = []string{
 	"Restarting cluster with new image",
 }
 
+// OfflineUpgradePhases is the order of the phases in an offline upgrade
+var OfflineUpgradePhases = []vapi.UpgradePhase{
+	vapi.UpgradePhaseStoppingCluster,
+	vapi.UpgradePhaseReschedulingPods,
+	vapi.UpgradePhaseRestartingCluster,
+}
+
 // MakeOfflineUpgradeReconciler will build an OfflineUpgradeReconciler object
 func MakeOfflineUpgradeReconciler(vdbrecon *VerticaDBReconciler, log logr.Logger,
 	vdb *vapi.VerticaDB, prunner cmds.PodRunner, pfacts *PodFacts, dispatcher vadmin.Dispatcher) controllers.ReconcileActor {
@@ -81,16 +88,43 @@ func (o *OfflineUpgradeReconciler) Reconcile(ctx context.Context, req *ctrl.Requ
 		return ctrl.Result{}, err
 	}
 
+	if o.Manager.isRollingBack() {
+		return o.runUpgradeFuncs(ctx, []func(context.Context) (ctrl.Result, error){
+			// Put the old image back in the vdb and statefulsets
+			o.revertToSourceImage,
+			// Start up vertica with the old image
+			o.checkForNewPods,
+			o.addPodAnnotations,
+			o.runInstaller,
+			o.restartCluster,
+			o.addClientRoutingLabel,
+			// Cleanup up the condition and event recording for the rollback
+			o.Manager.finishRollback,
+		})
+	}
+
+	// Defer the upgrade until a maintenance window is open.  We let the rest
+	// of the reconcile carry on in the meantime.
+	if deferred, err := o.deferToMaintenanceWindow(ctx); deferred || err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// Functions to perform when the image changes.  Order matters.
 	funcs := []func(context.Context) (ctrl.Result, error){
+		// Check that the upgrade can proceed before any pod is touched
+		o.runPreflightChecks,
 		// Initiate an upgrade by setting condition and event recording
 		o.Manager.startUpgrade,
 		o.logEventIfOnlineUpgradeRequested,
 		// Do a clean shutdown of the cluster
 		o.postStoppingClusterMsg,
+		o.postStoppingClusterPhase,
 		o.stopCluster,
+		// Make sure we can get the cluster lease back before rescheduling
+		o.checkClusterLeaseAfterStop,
 		// Set the new image in the statefulset objects.
 		o.postReschedulePodsMsg,
+		o.postReschedulePodsPhase,
 		o.updateImageInStatefulSets,
 		// Delete pods that have the old image.
 		o.deletePods,
@@ -100,6 +134,7 @@ func (o *OfflineUpgradeReconciler) Reconcile(ctx context.Context, req *ctrl.Requ
 		o.checkVersion,
 		// Start up vertica in each pod.
 		o.postRestartingClusterMsg,
+		o.postRestartingClusterPhase,
 		o.addPodAnnotations,
 		o.runInstaller,
 		o.restartCluster,
@@ -108,12 +143,59 @@ func (o *OfflineUpgradeReconciler) Reconcile(ctx context.Context, req *ctrl.Requ
 		// Cleanup up the condition and event recording for a completed upgrade
 		o.Manager.finishUpgrade,
 	}
+	return o.runUpgradeFuncs(ctx, funcs)
+}
+
+// deferToMaintenanceWindow returns true if the upgrade must wait for a
+// maintenance window.  Besides the start of the upgrade, this covers an
+// upgrade in progress that hasn't shut down the cluster yet, so we never
+// delete pods running vertica outside of a window.  Once the cluster is down,
+// or is restarting with the new image, the upgrade carries on regardless so
+// that the database isn't left down.
+func (o *OfflineUpgradeReconciler) deferToMaintenanceWindow(ctx context.Context) (bool, error) {
+	if o.Manager.ContinuingUpgrade {
+		state := o.Vdb.Status.UpgradeState
+		if o.PFacts.getUpNodeCount() == 0 || (state != nil && indexOfUpgradePhase(OfflineUpgradePhases, state.Phase) >=
+			indexOfUpgradePhase(OfflineUpgradePhases, vapi.UpgradePhaseRestartingCluster)) {
+			return false, nil
+		}
+	}
+	return deferToMaintenanceWindow(ctx, o.VRec, o.Vdb, MaintenanceOpUpgrade)
+}
+
+// runPreflightChecks will run the checks that must pass before the upgrade
+// starts.  They are skipped once the upgrade is in progress.
+func (o *OfflineUpgradeReconciler) runPreflightChecks(ctx context.Context) (ctrl.Result, error) {
+	if o.Manager.ContinuingUpgrade {
+		return ctrl.Result{}, nil
+	}
+	return MakeUpgradePreflight(o.VRec, o.Log, o.Vdb, o.PRunner, o.PFacts, o.Dispatcher).Run(ctx)
+}
+
+// checkClusterLeaseAfterStop will check that no other cluster holds the
+// lease on communal storage now that the cluster is stopped.  This is skipped
+// once the pods have been rescheduled.
+func (o *OfflineUpgradeReconciler) checkClusterLeaseAfterStop(ctx context.Context) (ctrl.Result, error) {
+	state := o.Vdb.Status.UpgradeState
+	if state != nil && indexOfUpgradePhase(OfflineUpgradePhases, state.Phase) >=
+		indexOfUpgradePhase(OfflineUpgradePhases, vapi.UpgradePhaseReschedulingPods) {
+		return ctrl.Result{}, nil
+	}
+	return MakeUpgradePreflight(o.VRec, o.Log, o.Vdb, o.PRunner, o.PFacts, o.Dispatcher).CheckClusterLeaseAfterStop(ctx)
+}
+
+// runUpgradeFuncs will call each of the funcs in order.  It stops at the first
+// one that aborts the reconcile.
+func (o *OfflineUpgradeReconciler) runUpgradeFuncs(ctx context.Context,
+	funcs []func(context.Context) (ctrl.Result, error)) (ctrl.Result, error) {
 	for _, fn := range funcs {
 		if res, err := fn(ctx); verrors.IsReconcileAborted(res, err) {
 			// If Reconcile was aborted with a requeue, set the RequeueAfter interval to prevent exponential backoff
 			if err == nil {
 				res.Requeue = false
 				res.RequeueAfter = o.Vdb.GetUpgradeRequeueTime()
+			} else {
+				o.Manager.recordUpgradeError(ctx, err)
 			}
 			return res, err
 		}
@@ -139,6 +221,13 @@ func (o *OfflineUpgradeReconciler) postStoppingClusterMsg(ctx context.Context) (
 	return o.postNextStatusMsg(ctx, ClusterShutdownOfflineMsgIndex)
 }
 
+// postStoppingClusterPhase will update the upgrade state to indicate a
+// cluster shutdown has commenced.  The subclusters stay pending as none of
+// them have been recreated yet.
+func (o *OfflineUpgradeReconciler) postStoppingClusterPhase(ctx context.Context) (ctrl.Result, error) {
+	return ctrl.Result{}, o.Manager.advanceUpgradePhase(ctx, OfflineUpgradePhases, vapi.UpgradePhaseStoppingCluster)
+}
+
 // stopCluster will shutdown the entire cluster
 func (o *OfflineUpgradeReconciler) stopCluster(ctx context.Context) (ctrl.Result, error) {
 	pf, found := o.PFacts.findRunningPod()
@@ -186,6 +275,12 @@ func (o *OfflineUpgradeReconciler) postReschedulePodsMsg(ctx context.Context) (c
 	return o.postNextStatusMsg(ctx, ReschedulePodsOfflineMsgIndex)
 }
 
+// postReschedulePodsPhase will update the upgrade state to indicate the pods
+// are being recreated with the new image.
+func (o *OfflineUpgradeReconciler) postReschedulePodsPhase(ctx context.Context) (ctrl.Result, error) {
+	return o.postNextPhase(ctx, vapi.UpgradePhaseReschedulingPods, vapi.SubclusterUpgradeRecreating)
+}
+
 // updateImageInStatefulSets will update the statefulsets to have the new image.
 // This depends on the statefulsets having the UpdateStrategy of OnDelete.
 // Since there will be processing after to delete the pods so that they come up
@@ -223,7 +318,7 @@ func (o *OfflineUpgradeReconciler) checkForNewPods(ctx context.Context) (ctrl.Re
 	}
 	for i := range pods.Items {
 		pod := &pods.Items[i]
-		if pod.Spec.Containers[names.ServerContainerIndex].Image == o.Vdb.Spec.Image {
+		if pod.Spec.Containers[names.ServerContainerIndex].Image == o.Vdb.GetDesiredImage() {
 			foundPodWithNewImage = true
 			break
 		}
@@ -254,6 +349,12 @@ func (o *OfflineUpgradeReconciler) postRestartingClusterMsg(ctx context.Context)
 	return o.postNextStatusMsg(ctx, ClusterRestartOfflineMsgIndex)
 }
 
+// postRestartingClusterPhase will update the upgrade state to indicate the
+// cluster is being restarted
+func (o *OfflineUpgradeReconciler) postRestartingClusterPhase(ctx context.Context) (ctrl.Result, error) {
+	return o.postNextPhase(ctx, vapi.UpgradePhaseRestartingCluster, vapi.SubclusterUpgradeRestarting)
+}
+
 // addPodAnnotations will call the PodAnnotationReconciler so that we have the
 // necessary annotations on the pod prior to restart.
 func (o *OfflineUpgradeReconciler) addPodAnnotations(ctx context.Context) (ctrl.Result, error) {
@@ -277,7 +378,24 @@ func (o *OfflineUpgradeReconciler) restartCluster(ctx context.Context) (ctrl.Res
 	// The restart reconciler is called after this reconciler.  But we call the
 	// restart reconciler here so that we restart while the status condition is set.
 	r := MakeRestartReconciler(o.VRec, o.Log, o.Vdb, o.PRunner, o.PFacts, true, o.Dispatcher)
-	return r.Reconcile(ctx, &ctrl.Request{})
+	res, err := r.Reconcile(ctx, &ctrl.Request{})
+	if verrors.IsReconcileAborted(res, err) {
+		if rbErr := o.Manager.recordFailedRestart(ctx, o.PFacts); rbErr != nil {
+			o.Log.Info("Failed to record the failed restart", "err", rbErr)
+		}
+		return res, err
+	}
+	return ctrl.Result{}, o.Manager.recordCatalogUpgraded(ctx, o.PFacts)
+}
+
+// revertToSourceImage will put back the image that we had before the upgrade
+// was started.  This is only called when rolling back an upgrade.
+func (o *OfflineUpgradeReconciler) revertToSourceImage(ctx context.Context) (ctrl.Result, error) {
+	changed, err := o.Manager.revertToSourceImage(ctx)
+	if changed {
+		o.PFacts.Invalidate()
+	}
+	return ctrl.Result{}, err
 }
 
 // addClientRoutingLabel will add the special label we use so that Service
@@ -317,3 +435,14 @@ func (o *OfflineUpgradeReconciler) anyPodsRunningWithOldImage(ctx context.Contex
 func (o *OfflineUpgradeReconciler) postNextStatusMsg(ctx context.Context, msgIndex int) (ctrl.Result, error) {
 	return ctrl.Result{}, o.Manager.postNextStatusMsg(ctx, OfflineUpgradeStatusMsgs, msgIndex)
 }
+
+// postNextPhase will advance the upgrade state to the given phase.  All
+// subclusters are upgraded together in an offline upgrade, so each of them is
+// moved to scPhase too.
+func (o *OfflineUpgradeReconciler) postNextPhase(ctx context.Context, phase vapi.UpgradePhase,
+	scPhase vapi.SubclusterUpgradePhase) (ctrl.Result, error) {
+	if err := o.Manager.advanceUpgradePhase(ctx, OfflineUpgradePhases, phase); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, o.Manager.advanceSubclusterUpgradePhase(ctx, "" /* all subclusters */, scPhase)
+}
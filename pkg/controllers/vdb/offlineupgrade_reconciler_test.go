@@ -24,9 +24,12 @@ import (
 	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
 	"github.com/vertica/vertica-kubernetes/pkg/cmds"
 	"github.com/vertica/vertica-kubernetes/pkg/iter"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
 	"github.com/vertica/vertica-kubernetes/pkg/names"
 	"github.com/vertica/vertica-kubernetes/pkg/test"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -69,6 +72,10 @@ var _ = Describe("offlineupgrade_reconcile", func() {
 		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{Requeue: false, RequeueAfter: vdb.GetUpgradeRequeueTime()}))
 		h := fpr.FindCommands("admintools -t stop_db")
 		Expect(len(h)).Should(Equal(1))
+		Expect(vdb.Status.UpgradeState).ShouldNot(BeNil())
+		Expect(vdb.Status.UpgradeState.Policy).Should(Equal(vapi.OfflineUpgrade))
+		Expect(vdb.Status.UpgradeState.TargetImage).Should(Equal("container1:newimage"))
+		Expect(vdb.Status.UpgradeState.Phase).Should(Equal(vapi.UpgradePhaseReschedulingPods))
 	})
 
 	It("should requeue upgrade if pods aren't running", func() {
@@ -145,6 +152,8 @@ var _ = Describe("offlineupgrade_reconcile", func() {
 		_, err := r.Reconcile(ctx, &ctrl.Request{})
 		Expect(err).ShouldNot(Succeed())
 		Expect(r.Manager.ContinuingUpgrade).Should(Equal(false))
+		Expect(vdb.Status.UpgradeState.Phase).Should(Equal(vapi.UpgradePhaseStoppingCluster))
+		Expect(vdb.Status.UpgradeState.LastError).ShouldNot(Equal(""))
 
 		// Read the latest vdb to get status conditions, etc.
 		Expect(k8sClient.Get(ctx, vapi.MakeVDBName(), vdb)).Should(Succeed())
@@ -152,6 +161,107 @@ var _ = Describe("offlineupgrade_reconcile", func() {
 		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{Requeue: false, RequeueAfter: vdb.GetUpgradeRequeueTime()}))
 		Expect(r.Manager.ContinuingUpgrade).Should(Equal(true))
 	})
+
+	It("should rollback the upgrade if vertica cannot be restarted with the new image", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters[0].Size = 1
+		vdb.Spec.UpgradeRollbackPolicy = vapi.UpgradeRollbackPolicy{Enabled: true, MaxRestartAttempts: 1}
+		vdb.Spec.IgnoreUpgradePath = true // Skip the version check as no pod will be running
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		oldImage := vdb.Spec.Image
+		const NewImage = "container4:newimage"
+		updateVdbToCauseUpgrade(ctx, vdb, NewImage)
+		r, _, _ := createOfflineUpgradeReconciler(vdb)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{Requeue: false, RequeueAfter: vdb.GetUpgradeRequeueTime()}))
+
+		// The pods come back with the new image but vertica never starts
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsNotRunning)
+		r, _, _ = createOfflineUpgradeReconciler(vdb)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{Requeue: false, RequeueAfter: vdb.GetUpgradeRequeueTime()}))
+		Expect(vdb.Status.UpgradeState.RestartAttempts).Should(Equal(int32(1)))
+		Expect(vdb.Status.UpgradeState.Phase).Should(Equal(vapi.UpgradePhaseRollingBack))
+
+		// The rollback puts the old image back and deletes the pods with the new image
+		r, _, _ = createOfflineUpgradeReconciler(vdb)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{Requeue: false, RequeueAfter: vdb.GetUpgradeRequeueTime()}))
+		// The spec is left alone; the rollback is reported in the status
+		Expect(vdb.Spec.Image).Should(Equal(NewImage))
+		Expect(vdb.GetDesiredImage()).Should(Equal(oldImage))
+		sts := &appsv1.StatefulSet{}
+		Expect(k8sClient.Get(ctx, names.GenStsName(vdb, &vdb.Spec.Subclusters[0]), sts)).Should(Succeed())
+		Expect(sts.Spec.Template.Spec.Containers[names.ServerContainerIndex].Image).Should(Equal(oldImage))
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0), pod)).ShouldNot(Succeed())
+
+		// Once the pods are back with the old image, the rollback finishes
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		r, _, _ = createOfflineUpgradeReconciler(vdb)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(vdb.Status.UpgradeState.Phase).Should(Equal(vapi.UpgradePhaseRolledBack))
+		Expect(vdb.Status.Conditions[vapi.UpgradeRolledBackIndex].Status).Should(Equal(corev1.ConditionTrue))
+		Expect(vdb.Status.Conditions[vapi.ImageChangeInProgressIndex].Status).Should(Equal(corev1.ConditionFalse))
+		Expect(vdb.Spec.Image).Should(Equal(NewImage))
+
+		// The failed upgrade isn't retried until spec.image changes
+		r, _, _ = createOfflineUpgradeReconciler(vdb)
+		Expect(r.Manager.IsUpgradeNeeded(ctx)).Should(BeFalse())
+	})
+
+	It("should remember the catalog was upgraded after the node goes down again", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters[0].Size = 1
+		vdb.Spec.UpgradeRollbackPolicy = vapi.UpgradeRollbackPolicy{Enabled: true, MaxRestartAttempts: 1}
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		updateVdbToCauseUpgrade(ctx, vdb, "container6:newimage")
+		r, _, pfacts := createOfflineUpgradeReconciler(vdb)
+		Expect(r.Manager.startUpgrade(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		for _, pf := range pfacts.Detail {
+			pf.image = vdb.Spec.Image
+			pf.upNode = true
+		}
+		Expect(r.Manager.recordCatalogUpgraded(ctx, pfacts)).Should(Succeed())
+		Expect(vdb.Status.UpgradeState.CatalogUpgraded).Should(BeTrue())
+
+		// The node crashes afterwards, which must not allow a rollback
+		for _, pf := range pfacts.Detail {
+			pf.upNode = false
+		}
+		Expect(r.Manager.recordFailedRestart(ctx, pfacts)).Should(Succeed())
+		Expect(vdb.Status.UpgradeState.CatalogUpgraded).Should(BeTrue())
+		Expect(vdb.Status.UpgradeState.Phase).ShouldNot(Equal(vapi.UpgradePhaseRollingBack))
+	})
+
+	It("should not rollback the upgrade once the catalog has been upgraded", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters[0].Size = 2
+		vdb.Spec.UpgradeRollbackPolicy = vapi.UpgradeRollbackPolicy{Enabled: true, MaxRestartAttempts: 1}
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		updateVdbToCauseUpgrade(ctx, vdb, "container5:newimage")
+		r, _, pfacts := createOfflineUpgradeReconciler(vdb)
+		Expect(r.Manager.startUpgrade(ctx)).Should(Equal(ctrl.Result{}))
+		// One node came up with the new image, the other didn't.
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		for _, pf := range pfacts.Detail {
+			pf.image = vdb.Spec.Image
+			pf.upNode = pf.name.Name == names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0).Name
+		}
+		Expect(r.Manager.recordFailedRestart(ctx, pfacts)).Should(Succeed())
+		Expect(vdb.Status.UpgradeState.CatalogUpgraded).Should(BeTrue())
+		Expect(vdb.Status.UpgradeState.Phase).ShouldNot(Equal(vapi.UpgradePhaseRollingBack))
+	})
 })
 
 // updateVdbToCauseUpgrade is a helper to force the upgrade reconciler to do work
@@ -161,8 +271,34 @@ func updateVdbToCauseUpgrade(ctx context.Context, vdb *vapi.VerticaDB, newImage
 	ExpectWithOffset(1, k8sClient.Update(ctx, vdb)).Should(Succeed())
 }
 
+// skipUpgradePreflight will set the annotation to skip the upgrade pre-flight
+// checks.  The upgrade tests have no way to pull an image, so they would be
+// blocked by the checks.  Only the annotation is changed in the server, so
+// any unsaved changes to the vdb are kept.
+func skipUpgradePreflight(ctx context.Context, vdb *vapi.VerticaDB) {
+	fetchedVdb := &vapi.VerticaDB{}
+	err := k8sClient.Get(ctx, vdb.ExtractNamespacedName(), fetchedVdb)
+	if errors.IsNotFound(err) {
+		// Some tests never create the vdb, so we only need the annotation in memory.
+		if vdb.Annotations == nil {
+			vdb.Annotations = map[string]string{}
+		}
+		vdb.Annotations[vmeta.SkipUpgradePreflightAnnotation] = "true"
+		return
+	}
+	ExpectWithOffset(2, err).Should(Succeed())
+	if fetchedVdb.Annotations == nil {
+		fetchedVdb.Annotations = map[string]string{}
+	}
+	fetchedVdb.Annotations[vmeta.SkipUpgradePreflightAnnotation] = "true"
+	ExpectWithOffset(2, k8sClient.Update(ctx, fetchedVdb)).Should(Succeed())
+	vdb.Annotations = fetchedVdb.Annotations
+	vdb.ResourceVersion = fetchedVdb.ResourceVersion
+}
+
 // createOfflineUpgradeReconciler is a helper to run the OfflineUpgradeReconciler.
 func createOfflineUpgradeReconciler(vdb *vapi.VerticaDB) (*OfflineUpgradeReconciler, *cmds.FakePodRunner, *PodFacts) {
+	skipUpgradePreflight(context.Background(), vdb)
 	fpr := &cmds.FakePodRunner{Results: cmds.CmdResults{}}
 	pfacts := createPodFactsDefault(fpr)
 	dispatcher := vdbRec.makeDispatcher(logger, vdb, fpr, TestPassword)
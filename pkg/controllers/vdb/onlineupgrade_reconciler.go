@@ -18,6 +18,7 @@ package vdb
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -56,6 +57,14 @@ type OnlineUpgradeReconciler struct {
 	MsgIndex      int      // Current index in StatusMsgs
 }
 
+// OnlineUpgradePhases is the order of the phases in an online upgrade
+var OnlineUpgradePhases = []vapi.UpgradePhase{
+	vapi.UpgradePhaseCreatingTransient,
+	vapi.UpgradePhaseUpgradingPrimaries,
+	vapi.UpgradePhaseUpgradingSecondaries,
+	vapi.UpgradePhaseRemovingTransient,
+}
+
 // MakeOnlineUpgradeReconciler will build an OnlineUpgradeReconciler object
 func MakeOnlineUpgradeReconciler(vdbrecon *VerticaDBReconciler, log logr.Logger,
 	vdb *vapi.VerticaDB, prunner cmds.PodRunner, pfacts *PodFacts, dispatcher vadmin.Dispatcher) controllers.ReconcileActor {
@@ -73,8 +82,34 @@ func (o *OnlineUpgradeReconciler) Reconcile(ctx context.Context, req *ctrl.Reque
 		return ctrl.Result{}, err
 	}
 
+	if o.Manager.isRollingBack() {
+		return o.runUpgradeFuncs(ctx, []func(context.Context) (ctrl.Result, error){
+			o.loadSubclusterState,
+			// Put the old image back in the vdb and statefulsets, then start
+			// up vertica with it.
+			o.revertToSourceImage,
+			o.restartAfterRollback,
+			// Will cleanup the transient subcluster now that the cluster is back up.
+			o.removeTransientFromVdb,
+			o.removeClientRoutingLabelFromTransientNodes,
+			o.removeTransientSubclusters,
+			o.uninstallTransientNodes,
+			o.deleteTransientSts,
+			// Cleanup up the condition and event recording for the rollback
+			o.Manager.finishRollback,
+		})
+	}
+
+	// Defer the upgrade until a maintenance window is open.  We let the rest
+	// of the reconcile carry on in the meantime.
+	if deferred, err := o.Manager.deferToMaintenanceWindow(ctx); deferred || err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// Functions to perform when the image changes.  Order matters.
 	funcs := []func(context.Context) (ctrl.Result, error){
+		// Check that the upgrade can proceed before any pod is touched
+		o.runPreflightChecks,
 		// Initiate an upgrade by setting condition and event recording
 		o.Manager.startUpgrade,
 		// Load up state that is used for the subsequent steps
@@ -84,6 +119,7 @@ func (o *OnlineUpgradeReconciler) Reconcile(ctx context.Context, req *ctrl.Reque
 		// Setup a transient subcluster to accept traffic when other subclusters
 		// are down
 		o.postNextStatusMsg,
+		o.postCreatingTransientPhase,
 		o.addTransientToVdb,
 		o.createTransientSts,
 		o.installTransientNodes,
@@ -97,6 +133,7 @@ func (o *OnlineUpgradeReconciler) Reconcile(ctx context.Context, req *ctrl.Reque
 		o.restartSecondaries,
 		// Will cleanup the transient subcluster now that the primaries are back up.
 		o.postNextStatusMsg,
+		o.postRemovingTransientPhase,
 		o.removeTransientFromVdb,
 		o.removeClientRoutingLabelFromTransientNodes,
 		o.removeTransientSubclusters,
@@ -105,12 +142,30 @@ func (o *OnlineUpgradeReconciler) Reconcile(ctx context.Context, req *ctrl.Reque
 		// Cleanup up the condition and event recording for a completed upgrade
 		o.Manager.finishUpgrade,
 	}
+	return o.runUpgradeFuncs(ctx, funcs)
+}
+
+// runPreflightChecks will run the checks that must pass before the upgrade
+// starts.  They are skipped once the upgrade is in progress.
+func (o *OnlineUpgradeReconciler) runPreflightChecks(ctx context.Context) (ctrl.Result, error) {
+	if o.Manager.ContinuingUpgrade {
+		return ctrl.Result{}, nil
+	}
+	return MakeUpgradePreflight(o.VRec, o.Log, o.Vdb, o.PRunner, o.PFacts, o.Dispatcher).Run(ctx)
+}
+
+// runUpgradeFuncs will call each of the funcs in order.  It stops at the first
+// one that aborts the reconcile.
+func (o *OnlineUpgradeReconciler) runUpgradeFuncs(ctx context.Context,
+	funcs []func(context.Context) (ctrl.Result, error)) (ctrl.Result, error) {
 	for _, fn := range funcs {
 		if res, err := fn(ctx); verrors.IsReconcileAborted(res, err) {
 			// If Reconcile was aborted with a requeue, set the RequeueAfter interval to prevent exponential backoff
 			if err == nil {
 				res.Requeue = false
 				res.RequeueAfter = o.Vdb.GetUpgradeRequeueTime()
+			} else {
+				o.Manager.recordUpgradeError(ctx, err)
 			}
 			return res, err
 		}
@@ -156,6 +211,10 @@ func (o *OnlineUpgradeReconciler) precomputeStatusMsgs(ctx context.Context) (ctr
 			fmt.Sprintf("Recreating pods for secondary subcluster '%s'", scName),
 			fmt.Sprintf("Restarting vertica in secondary subcluster '%s'", scName),
 		)
+		if o.isCanary(sts) {
+			o.StatusMsgs = append(o.StatusMsgs,
+				fmt.Sprintf("Waiting for approval of canary subcluster '%s'", scName))
+		}
 		return ctrl.Result{}, nil
 	}
 	if res, err := o.iterateSubclusterType(ctx, vapi.SecondarySubclusterType, procFunc); verrors.IsReconcileAborted(res, err) {
@@ -180,6 +239,24 @@ func (o *OnlineUpgradeReconciler) postNextStatusMsgForSts(ctx context.Context, s
 	return o.postNextStatusMsg(ctx)
 }
 
+// postCreatingTransientPhase will update the upgrade state to indicate we are
+// setting up the transient subcluster.
+func (o *OnlineUpgradeReconciler) postCreatingTransientPhase(ctx context.Context) (ctrl.Result, error) {
+	return ctrl.Result{}, o.Manager.advanceUpgradePhase(ctx, OnlineUpgradePhases, vapi.UpgradePhaseCreatingTransient)
+}
+
+// postRemovingTransientPhase will update the upgrade state to indicate we are
+// cleaning up the transient subcluster.
+func (o *OnlineUpgradeReconciler) postRemovingTransientPhase(ctx context.Context) (ctrl.Result, error) {
+	return ctrl.Result{}, o.Manager.advanceUpgradePhase(ctx, OnlineUpgradePhases, vapi.UpgradePhaseRemovingTransient)
+}
+
+// postSubclusterPhase will update the upgrade state for a single subcluster.
+func (o *OnlineUpgradeReconciler) postSubclusterPhase(ctx context.Context, sts *appsv1.StatefulSet,
+	phase vapi.SubclusterUpgradePhase) error {
+	return o.Manager.advanceSubclusterUpgradePhase(ctx, sts.Labels[vmeta.SubclusterNameLabel], phase)
+}
+
 // addTransientToVdb will add the transient subcluster to the VerticaDB.  This
 // is stored in the api server.  It will get removed at the end of the
 // upgrade.
@@ -322,6 +399,14 @@ func (o *OnlineUpgradeReconciler) iterateSubclusterType(ctx context.Context, scT
 		return ctrl.Result{}, err
 	}
 
+	// The canary subcluster, if there is one, is always handled first among
+	// the secondaries so that the remaining ones wait on its approval.
+	if scType == vapi.SecondarySubclusterType {
+		sort.SliceStable(stss.Items, func(i, j int) bool {
+			return o.isCanary(&stss.Items[i]) && !o.isCanary(&stss.Items[j])
+		})
+	}
+
 	for i := range stss.Items {
 		sts := &stss.Items[i]
 		if matches, err := o.isMatchingSubclusterType(sts, scType); err != nil {
@@ -341,6 +426,9 @@ func (o *OnlineUpgradeReconciler) iterateSubclusterType(ctx context.Context, scT
 // restartPrimaries will handle the upgrade on all of the primaries.
 func (o *OnlineUpgradeReconciler) restartPrimaries(ctx context.Context) (ctrl.Result, error) {
 	o.Log.Info("Starting the handling of primaries")
+	if err := o.Manager.advanceUpgradePhase(ctx, OnlineUpgradePhases, vapi.UpgradePhaseUpgradingPrimaries); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	funcs := []func(context.Context, *appsv1.StatefulSet) (ctrl.Result, error){
 		o.drainSubcluster,
@@ -367,6 +455,9 @@ func (o *OnlineUpgradeReconciler) restartPrimaries(ctx context.Context) (ctrl.Re
 // rerouting traffic to the transient while it does the restart.
 func (o *OnlineUpgradeReconciler) restartSecondaries(ctx context.Context) (ctrl.Result, error) {
 	o.Log.Info("Starting the handling of secondaries")
+	if err := o.Manager.advanceUpgradePhase(ctx, OnlineUpgradePhases, vapi.UpgradePhaseUpgradingSecondaries); err != nil {
+		return ctrl.Result{}, err
+	}
 	res, err := o.iterateSubclusterType(ctx, vapi.SecondarySubclusterType, o.processSecondary)
 	return res, err
 }
@@ -374,6 +465,7 @@ func (o *OnlineUpgradeReconciler) restartSecondaries(ctx context.Context) (ctrl.
 // processSecondary will handle restart of a single secondary subcluster
 func (o *OnlineUpgradeReconciler) processSecondary(ctx context.Context, sts *appsv1.StatefulSet) (ctrl.Result, error) {
 	funcs := []func(context.Context, *appsv1.StatefulSet) (ctrl.Result, error){
+		o.postCanaryUpgradingPhase,
 		o.postNextStatusMsgForSts,
 		o.drainSubcluster,
 		o.postNextStatusMsgForSts,
@@ -382,6 +474,7 @@ func (o *OnlineUpgradeReconciler) processSecondary(ctx context.Context, sts *app
 		o.addPodAnnotations,
 		o.runInstaller,
 		o.bringSubclusterOnline,
+		o.waitForCanaryApproval,
 	}
 	for _, fn := range funcs {
 		if res, err := fn(ctx, sts); verrors.IsReconcileAborted(res, err) {
@@ -391,6 +484,117 @@ func (o *OnlineUpgradeReconciler) processSecondary(ctx context.Context, sts *app
 	return ctrl.Result{}, nil
 }
 
+// isCanary returns true if the statefulset is for the canary subcluster
+func (o *OnlineUpgradeReconciler) isCanary(sts *appsv1.StatefulSet) bool {
+	canary := o.Vdb.Spec.UpgradeCanary.Subcluster
+	return canary != "" && sts.Labels[vmeta.SubclusterNameLabel] == canary
+}
+
+// postCanaryUpgradingPhase will record in the upgrade state that we have
+// started to upgrade the canary subcluster.  This is a no-op for any other
+// subcluster.
+func (o *OnlineUpgradeReconciler) postCanaryUpgradingPhase(ctx context.Context, sts *appsv1.StatefulSet) (ctrl.Result, error) {
+	if !o.isCanary(sts) || (o.Vdb.Status.UpgradeState != nil && o.Vdb.Status.UpgradeState.Canary != nil) {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, o.postCanaryPhase(ctx, sts, vapi.UpgradeCanaryPhaseUpgrading)
+}
+
+// waitForCanaryApproval will pause the upgrade after the canary subcluster is
+// up with the new image.  We only continue on to the remaining secondaries
+// once the canary is approved.  If it is denied, the upgrade stays halted.
+func (o *OnlineUpgradeReconciler) waitForCanaryApproval(ctx context.Context, sts *appsv1.StatefulSet) (ctrl.Result, error) {
+	if !o.isCanary(sts) {
+		return ctrl.Result{}, nil
+	}
+	if res, err := o.postNextStatusMsg(ctx); verrors.IsReconcileAborted(res, err) {
+		return res, err
+	}
+	state := o.Vdb.Status.UpgradeState
+	if state != nil && state.Canary != nil && state.Canary.Phase == vapi.UpgradeCanaryPhaseApproved {
+		return ctrl.Result{}, nil
+	}
+
+	scName := sts.Labels[vmeta.SubclusterNameLabel]
+	approval, err := o.getCanaryApproval(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	switch approval {
+	case vapi.UpgradeCanaryApproved:
+		if err := o.postCanaryPhase(ctx, sts, vapi.UpgradeCanaryPhaseApproved); err != nil {
+			return ctrl.Result{}, err
+		}
+		o.VRec.Eventf(o.Vdb, corev1.EventTypeNormal, events.UpgradeCanaryApproved,
+			"Canary subcluster '%s' was approved.  Continuing the upgrade of the remaining subclusters.", scName)
+		return ctrl.Result{}, nil
+	case vapi.UpgradeCanaryDenied:
+		return o.denyCanary(ctx, sts)
+	}
+
+	if state == nil || state.Canary == nil || state.Canary.Phase != vapi.UpgradeCanaryPhaseAwaitingApproval {
+		if err := o.postCanaryPhase(ctx, sts, vapi.UpgradeCanaryPhaseAwaitingApproval); err != nil {
+			return ctrl.Result{}, err
+		}
+		o.VRec.Eventf(o.Vdb, corev1.EventTypeNormal, events.UpgradeCanaryAwaitingApproval,
+			"Canary subcluster '%s' is up with the new image.  Set spec.upgradeCanary.approval to continue.", scName)
+	}
+	o.Log.Info("Requeue to wait for approval of the canary subcluster", "name", scName)
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// getCanaryApproval returns the decision made about the canary of the current
+// upgrade.  An approval that was already in the spec when the upgrade started
+// is ignored.  Once it is cleared from the spec, we forget about it so that
+// setting it again counts.
+func (o *OnlineUpgradeReconciler) getCanaryApproval(ctx context.Context) (vapi.UpgradeCanaryApproval, error) {
+	approval := o.Vdb.Spec.UpgradeCanary.Approval
+	var consumed vapi.UpgradeCanaryApproval
+	if o.Vdb.Status.UpgradeState != nil {
+		consumed = o.Vdb.Status.UpgradeState.ConsumedCanaryApproval
+	}
+	if approval == "" && consumed != "" {
+		return "", o.Manager.updateUpgradeState(ctx, func(state *vapi.UpgradeState) {
+			state.ConsumedCanaryApproval = ""
+		})
+	}
+	if approval == consumed {
+		return "", nil
+	}
+	return approval, nil
+}
+
+// denyCanary handles a canary subcluster that was denied.  The primaries are
+// upgraded before any secondary, so the catalog is already upgraded and the
+// old image can't start with it.  The upgrade is halted instead, with the
+// canary left on the new image.
+func (o *OnlineUpgradeReconciler) denyCanary(ctx context.Context, sts *appsv1.StatefulSet) (ctrl.Result, error) {
+	scName := sts.Labels[vmeta.SubclusterNameLabel]
+	state := o.Vdb.Status.UpgradeState
+	if state != nil && state.Canary != nil && state.Canary.Phase == vapi.UpgradeCanaryPhaseDenied {
+		o.Log.Info("Upgrade is halted because the canary subcluster was denied", "name", scName)
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if err := o.postCanaryPhase(ctx, sts, vapi.UpgradeCanaryPhaseDenied); err != nil {
+		return ctrl.Result{}, err
+	}
+	o.VRec.Eventf(o.Vdb, corev1.EventTypeWarning, events.UpgradeCanaryDenied,
+		"Canary subcluster '%s' was denied.  The upgrade is halted until spec.upgradeCanary.approval is set to Approved.",
+		scName)
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// postCanaryPhase will update the state of the canary subcluster
+func (o *OnlineUpgradeReconciler) postCanaryPhase(ctx context.Context, sts *appsv1.StatefulSet,
+	phase vapi.UpgradeCanaryPhase) error {
+	return o.Manager.updateUpgradeState(ctx, func(state *vapi.UpgradeState) {
+		state.Canary = &vapi.UpgradeCanaryState{
+			Subcluster: sts.Labels[vmeta.SubclusterNameLabel],
+			Phase:      phase,
+		}
+	})
+}
+
 // isMatchingSubclusterType will return true if the subcluster type matches the
 // input string.  Always returns false for the transient subcluster.
 func (o *OnlineUpgradeReconciler) isMatchingSubclusterType(sts *appsv1.StatefulSet, scType string) (bool, error) {
@@ -408,6 +612,9 @@ func (o *OnlineUpgradeReconciler) drainSubcluster(ctx context.Context, sts *apps
 
 	if img != o.Vdb.Spec.Image {
 		scName := sts.Labels[vmeta.SubclusterNameLabel]
+		if err := o.postSubclusterPhase(ctx, sts, vapi.SubclusterUpgradeDraining); err != nil {
+			return ctrl.Result{}, err
+		}
 		o.Log.Info("rerouting client traffic from subcluster", "name", scName)
 		if err := o.routeClientTraffic(ctx, scName, true); err != nil {
 			return ctrl.Result{}, err
@@ -424,6 +631,10 @@ func (o *OnlineUpgradeReconciler) drainSubcluster(ctx context.Context, sts *apps
 func (o *OnlineUpgradeReconciler) recreateSubclusterWithNewImage(ctx context.Context, sts *appsv1.StatefulSet) (ctrl.Result, error) {
 	var err error
 
+	if err = o.postSubclusterPhase(ctx, sts, vapi.SubclusterUpgradeRecreating); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	stsChanged, err := o.Manager.updateImageInStatefulSet(ctx, sts)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -504,13 +715,23 @@ func (o *OnlineUpgradeReconciler) waitForReadOnly(ctx context.Context, sts *apps
 
 // bringSubclusterOnline will bring up a subcluster and reroute traffic back to the subcluster.
 func (o *OnlineUpgradeReconciler) bringSubclusterOnline(ctx context.Context, sts *appsv1.StatefulSet) (ctrl.Result, error) {
+	if err := o.postSubclusterPhase(ctx, sts, vapi.SubclusterUpgradeRestarting); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	const DoNotRestartReadOnly = false
 	actor := MakeRestartReconciler(o.VRec, o.Log, o.Vdb, o.PRunner, o.PFacts, DoNotRestartReadOnly, o.Dispatcher)
 	o.traceActorReconcile(actor)
 	res, err := actor.Reconcile(ctx, &ctrl.Request{})
 	if verrors.IsReconcileAborted(res, err) {
+		if rbErr := o.Manager.recordFailedRestart(ctx, o.PFacts); rbErr != nil {
+			o.Log.Info("Failed to record the failed restart", "err", rbErr)
+		}
 		return res, err
 	}
+	if err := o.Manager.recordCatalogUpgraded(ctx, o.PFacts); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	scName := sts.Labels[vmeta.SubclusterNameLabel]
 
@@ -521,10 +742,53 @@ func (o *OnlineUpgradeReconciler) bringSubclusterOnline(ctx context.Context, sts
 	}
 
 	o.Log.Info("starting client traffic routing back to subcluster", "name", scName)
-	err = o.routeClientTraffic(ctx, scName, false)
+	if err = o.routeClientTraffic(ctx, scName, false); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, o.postSubclusterPhase(ctx, sts, vapi.SubclusterUpgradeUpgraded)
+}
+
+// revertToSourceImage will put back the image that we had before the upgrade
+// was started.  This is only called when rolling back an upgrade.
+func (o *OnlineUpgradeReconciler) revertToSourceImage(ctx context.Context) (ctrl.Result, error) {
+	changed, err := o.Manager.revertToSourceImage(ctx)
+	if changed {
+		o.PFacts.Invalidate()
+	}
 	return ctrl.Result{}, err
 }
 
+// restartAfterRollback will restart vertica in all of the subclusters with the
+// source image and route client traffic back to them.  This includes any nodes
+// that are in read-only state.
+func (o *OnlineUpgradeReconciler) restartAfterRollback(ctx context.Context) (ctrl.Result, error) {
+	const RestartReadOnly = true
+	actors := []controllers.ReconcileActor{
+		MakeAnnotateAndLabelPodReconciler(o.VRec, o.Vdb, o.PFacts),
+		MakeInstallReconciler(o.VRec, o.Log, o.Vdb, o.PRunner, o.PFacts),
+		MakeRestartReconciler(o.VRec, o.Log, o.Vdb, o.PRunner, o.PFacts, RestartReadOnly, o.Dispatcher),
+		MakeClientRoutingLabelReconciler(o.VRec, o.Vdb, o.PFacts, PodRescheduleApplyMethod, "" /* all subclusters */),
+	}
+	for _, actor := range actors {
+		o.traceActorReconcile(actor)
+		if res, err := actor.Reconcile(ctx, &ctrl.Request{}); verrors.IsReconcileAborted(res, err) {
+			return res, err
+		}
+	}
+
+	for i := range o.Vdb.Spec.Subclusters {
+		sc := &o.Vdb.Spec.Subclusters[i]
+		if sc.IsTransient {
+			continue
+		}
+		o.Log.Info("starting client traffic routing back to subcluster", "name", sc.Name)
+		if err := o.routeClientTraffic(ctx, sc.Name, false); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
 // removeTransientFromVdb will remove the transient subcluster that is in the VerticaDB stored in the apiserver
 func (o *OnlineUpgradeReconciler) removeTransientFromVdb(ctx context.Context) (ctrl.Result, error) {
 	if !o.Vdb.RequiresTransientSubcluster() {
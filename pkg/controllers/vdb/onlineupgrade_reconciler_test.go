@@ -344,6 +344,12 @@ var _ = Describe("onlineupgrade_reconcile", func() {
 		r := createOnlineUpgradeReconciler(ctx, vdb)
 		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{Requeue: false, RequeueAfter: vdb.GetUpgradeRequeueTime()}))
 		Expect(vdb.Status.UpgradeStatus).Should(Equal("Checking if new version is compatible"))
+		Expect(vdb.Status.UpgradeState.Policy).Should(Equal(vapi.OnlineUpgrade))
+		Expect(vdb.Status.UpgradeState.SourceImage).Should(Equal(OldImage))
+		Expect(vdb.Status.UpgradeState.Phase).Should(Equal(vapi.UpgradePhaseUpgradingPrimaries))
+		Expect(vdb.Status.UpgradeState.Subclusters).Should(Equal([]vapi.SubclusterUpgradeState{
+			{Name: "sc1", Phase: vapi.SubclusterUpgradeRecreating},
+		}))
 	})
 
 	It("should requeue if there are active connections in the subcluster", func() {
@@ -378,6 +384,110 @@ var _ = Describe("onlineupgrade_reconcile", func() {
 		Expect(r.isSubclusterIdle(ctx, vdb.Spec.Subclusters[0].Name)).Should(Equal(ctrl.Result{Requeue: false}))
 	})
 
+	It("should upgrade the canary subcluster first among the secondaries and wait for its approval", func() {
+		vdb := vapi.MakeVDB()
+		const CanaryScName = "sc3"
+		vdb.Spec.Subclusters = []vapi.Subcluster{
+			{Name: "sc1", IsPrimary: true, Size: 1},
+			{Name: "sc2", IsPrimary: false, Size: 1},
+			{Name: CanaryScName, IsPrimary: false, Size: 1},
+		}
+		vdb.Spec.Image = OldImage
+		vdb.Spec.UpgradePolicy = vapi.OnlineUpgrade
+		vdb.Spec.UpgradeCanary.Subcluster = CanaryScName
+		vdb.ObjectMeta.Annotations[vapi.VersionAnnotation] = vapi.OnlineUpgradeVersion
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		vdb.Spec.Image = NewImageName // Trigger an upgrade
+		vdb.Spec.UpgradeCanary.Approval = vapi.UpgradeCanaryApproved
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+
+		r := createOnlineUpgradeReconciler(ctx, vdb)
+		// An approval left over from a prior upgrade is kept in the spec, but
+		// recorded as consumed
+		Expect(r.Manager.startUpgrade(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(vdb.Spec.UpgradeCanary.Approval).Should(Equal(vapi.UpgradeCanaryApproved))
+		Expect(vdb.Status.UpgradeState.ConsumedCanaryApproval).Should(Equal(vapi.UpgradeCanaryApproved))
+		Expect(r.precomputeStatusMsgs(ctx)).Should(Equal(ctrl.Result{}))
+
+		scNames := []string{}
+		Expect(r.iterateSubclusterType(ctx, vapi.SecondarySubclusterType,
+			func(ctx context.Context, sts *appsv1.StatefulSet) (ctrl.Result, error) {
+				scNames = append(scNames, sts.Labels[vmeta.SubclusterNameLabel])
+				return ctrl.Result{}, nil
+			})).Should(Equal(ctrl.Result{}))
+		Expect(scNames).Should(Equal([]string{CanaryScName, "sc2"}))
+
+		canarySts := &appsv1.StatefulSet{}
+		Expect(k8sClient.Get(ctx, names.GenStsName(vdb, &vdb.Spec.Subclusters[2]), canarySts)).Should(Succeed())
+		otherSts := &appsv1.StatefulSet{}
+		Expect(k8sClient.Get(ctx, names.GenStsName(vdb, &vdb.Spec.Subclusters[1]), otherSts)).Should(Succeed())
+
+		// Only the canary subcluster waits for approval. The consumed approval
+		// doesn't count.
+		Expect(r.waitForCanaryApproval(ctx, otherSts)).Should(Equal(ctrl.Result{}))
+		Expect(r.waitForCanaryApproval(ctx, canarySts)).Should(Equal(ctrl.Result{Requeue: true}))
+		Expect(vdb.Status.UpgradeState.Canary).ShouldNot(BeNil())
+		Expect(vdb.Status.UpgradeState.Canary.Subcluster).Should(Equal(CanaryScName))
+		Expect(vdb.Status.UpgradeState.Canary.Phase).Should(Equal(vapi.UpgradeCanaryPhaseAwaitingApproval))
+
+		// Clearing the approval forgets about the consumed one
+		vdb.Spec.UpgradeCanary.Approval = ""
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+		r.MsgIndex = -1
+		Expect(r.waitForCanaryApproval(ctx, canarySts)).Should(Equal(ctrl.Result{Requeue: true}))
+		Expect(vdb.Status.UpgradeState.ConsumedCanaryApproval).Should(BeEmpty())
+
+		vdb.Spec.UpgradeCanary.Approval = vapi.UpgradeCanaryApproved
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+		r.MsgIndex = -1
+		Expect(r.waitForCanaryApproval(ctx, canarySts)).Should(Equal(ctrl.Result{}))
+		Expect(vdb.Status.UpgradeState.Canary.Phase).Should(Equal(vapi.UpgradeCanaryPhaseApproved))
+	})
+
+	It("should halt the upgrade if the canary subcluster is denied", func() {
+		vdb := vapi.MakeVDB()
+		const CanaryScName = "sc2"
+		vdb.Spec.Subclusters = []vapi.Subcluster{
+			{Name: "sc1", IsPrimary: true, Size: 1},
+			{Name: CanaryScName, IsPrimary: false, Size: 1},
+		}
+		vdb.Spec.Image = OldImage
+		vdb.Spec.UpgradePolicy = vapi.OnlineUpgrade
+		vdb.Spec.UpgradeCanary.Subcluster = CanaryScName
+		vdb.ObjectMeta.Annotations[vapi.VersionAnnotation] = vapi.OnlineUpgradeVersion
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		vdb.Spec.Image = NewImageName // Trigger an upgrade
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+
+		r := createOnlineUpgradeReconciler(ctx, vdb)
+		Expect(r.Manager.startUpgrade(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(r.precomputeStatusMsgs(ctx)).Should(Equal(ctrl.Result{}))
+
+		vdb.Spec.UpgradeCanary.Approval = vapi.UpgradeCanaryDenied
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+		canarySts := &appsv1.StatefulSet{}
+		Expect(k8sClient.Get(ctx, names.GenStsName(vdb, &vdb.Spec.Subclusters[1]), canarySts)).Should(Succeed())
+		Expect(r.waitForCanaryApproval(ctx, canarySts)).Should(Equal(ctrl.Result{Requeue: true}))
+		Expect(vdb.Status.UpgradeState.Canary.Phase).Should(Equal(vapi.UpgradeCanaryPhaseDenied))
+		Expect(r.Manager.isRollingBack()).Should(BeFalse())
+
+		// It stays halted until the canary is approved
+		Expect(r.waitForCanaryApproval(ctx, canarySts)).Should(Equal(ctrl.Result{Requeue: true}))
+		Expect(r.Manager.isRollingBack()).Should(BeFalse())
+		vdb.Spec.UpgradeCanary.Approval = vapi.UpgradeCanaryApproved
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+		Expect(r.waitForCanaryApproval(ctx, canarySts)).Should(Equal(ctrl.Result{}))
+		Expect(vdb.Status.UpgradeState.Canary.Phase).Should(Equal(vapi.UpgradeCanaryPhaseApproved))
+	})
+
 	It("should requeue after a specified UpgradeRequeueAfter time", func() {
 		vdb := vapi.MakeVDB()
 		vdb.Spec.Subclusters = []vapi.Subcluster{
@@ -469,6 +579,7 @@ var _ = Describe("onlineupgrade_reconcile", func() {
 
 // createOnlineUpgradeReconciler is a helper to run the OnlineUpgradeReconciler.
 func createOnlineUpgradeReconciler(ctx context.Context, vdb *vapi.VerticaDB) *OnlineUpgradeReconciler {
+	skipUpgradePreflight(ctx, vdb)
 	fpr := &cmds.FakePodRunner{Results: cmds.CmdResults{}}
 	pfacts := MakePodFacts(vdbRec, fpr)
 	dispatcher := vdbRec.makeDispatcher(logger, vdb, fpr, TestPassword)
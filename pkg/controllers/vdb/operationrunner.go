@@ -0,0 +1,531 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/atconf"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/paths"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// OperationPendingRequeueTime is how long we wait before checking again if a
+// pending VerticaDBOperation can start.
+const OperationPendingRequeueTime = 10 * time.Second
+
+// OperationRunner will carry out a single VerticaDBOperation. An operation is
+// made up of one or more steps that are run in order. Each step that finishes
+// is recorded in the status so that it isn't repeated if we have to requeue.
+type OperationRunner struct {
+	VRec       *VerticaDBReconciler
+	Log        logr.Logger
+	Vop        *vapi.VerticaDBOperation
+	Vdb        *vapi.VerticaDB // Vdb is the CRD the operation is done against.
+	PRunner    cmds.PodRunner
+	PFacts     *PodFacts
+	Dispatcher vadmin.Dispatcher
+	ATWriter   atconf.Writer
+}
+
+// operationStep is one step of an operation. Run can return a result to requeue
+// when it needs to wait for something.
+type operationStep struct {
+	Name string
+	Run  func(ctx context.Context) (ctrl.Result, error)
+}
+
+// MakeOperationRunner will build an OperationRunner object
+func MakeOperationRunner(vdbrecon *VerticaDBReconciler, log logr.Logger, vop *vapi.VerticaDBOperation,
+	vdb *vapi.VerticaDB, prunner cmds.PodRunner, pfacts *PodFacts, dispatcher vadmin.Dispatcher) *OperationRunner {
+	return &OperationRunner{
+		VRec:       vdbrecon,
+		Log:        log,
+		Vop:        vop,
+		Vdb:        vdb,
+		PRunner:    prunner,
+		PFacts:     pfacts,
+		Dispatcher: dispatcher,
+		ATWriter:   atconf.MakeFileWriter(log, vdb, prunner),
+	}
+}
+
+// Run will drive the operation forward. It returns once the operation has
+// finished or when it has to requeue.
+func (o *OperationRunner) Run(ctx context.Context) (ctrl.Result, error) {
+	if o.Vop.IsFinished() {
+		return ctrl.Result{}, nil
+	}
+
+	if msg, ok := o.validate(); !ok {
+		return ctrl.Result{}, o.finish(ctx, vapi.OperationFailed, msg)
+	}
+
+	if o.Vop.Status.Phase != vapi.OperationRunning {
+		if res, err := o.start(ctx); verrors.IsReconcileAborted(res, err) {
+			return res, err
+		}
+	}
+
+	for _, step := range o.getSteps() {
+		if o.isStepCompleted(step.Name) {
+			continue
+		}
+		o.Log.Info("Running operation step", "step", step.Name)
+		res, err := step.Run(ctx)
+		if err != nil {
+			return ctrl.Result{}, o.finish(ctx, vapi.OperationFailed,
+				fmt.Sprintf("Step '%s' failed: %s", step.Name, err.Error()))
+		}
+		if verrors.IsReconcileAborted(res, nil) {
+			return res, nil
+		}
+		if err := o.updateStatus(ctx, func(status *vapi.VerticaDBOperationStatus) {
+			status.CompletedSteps = append(status.CompletedSteps, step.Name)
+		}); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, o.finish(ctx, vapi.OperationSucceeded,
+		fmt.Sprintf("Operation %s finished successfully", o.Vop.Spec.Type))
+}
+
+// validate will check the spec of the operation against the VerticaDB. If it
+// can't be done, a message describing why is returned.
+func (o *OperationRunner) validate() (string, bool) {
+	for _, scName := range o.Vop.Spec.Subclusters {
+		if _, ok := o.Vdb.GenSubclusterMap()[scName]; !ok {
+			return fmt.Sprintf("Subcluster '%s' does not exist in VerticaDB '%s'", scName, o.Vdb.Name), false
+		}
+	}
+	if len(o.Vop.Spec.Pods) > 0 && o.Vop.Spec.Type != vapi.OperationKillSessions {
+		return fmt.Sprintf("Pods can only be given for the %s operation", vapi.OperationKillSessions), false
+	}
+	switch o.Vop.Spec.Type {
+	case vapi.OperationRestartSubcluster:
+		if len(o.Vop.Spec.Subclusters) == 0 {
+			return fmt.Sprintf("At least one subcluster must be given for the %s operation", o.Vop.Spec.Type), false
+		}
+		if !o.Vdb.Spec.AutoRestartVertica {
+			return fmt.Sprintf("autoRestartVertica must be true in VerticaDB '%s' to restart a subcluster", o.Vdb.Name), false
+		}
+	case vapi.OperationRebalanceShards:
+		if !o.Vdb.IsEON() {
+			return fmt.Sprintf("VerticaDB '%s' must be an Eon Mode database to rebalance shards", o.Vdb.Name), false
+		}
+	case vapi.OperationReinstall:
+		if o.Vdb.Spec.InitPolicy == vapi.CommunalInitPolicyScheduleOnly {
+			return fmt.Sprintf("VerticaDB '%s' cannot be reinstalled because the operator doesn't manage its install",
+				o.Vdb.Name), false
+		}
+	case vapi.OperationAnalyzeStatistics, vapi.OperationKillSessions:
+	default:
+		return fmt.Sprintf("Unknown operation type '%s'", o.Vop.Spec.Type), false
+	}
+	return "", true
+}
+
+// start will move the operation to the running phase. It will requeue if the
+// operation has to wait for the database or for another operation.
+func (o *OperationRunner) start(ctx context.Context) (ctrl.Result, error) {
+	if o.Vop.Spec.Type != vapi.OperationReinstall {
+		isSet, err := o.Vdb.IsConditionSet(vapi.DBInitialized)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !isSet {
+			return o.waitToStart(ctx, fmt.Sprintf("Waiting for the database of VerticaDB '%s' to be initialized", o.Vdb.Name))
+		}
+	}
+
+	if o.Vop.IsMutating() {
+		running, err := o.findRunningMutatingOperation(ctx)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if running != "" {
+			return o.waitToStart(ctx, fmt.Sprintf("Waiting for operation '%s' to finish", running))
+		}
+	}
+
+	o.VRec.Eventf(o.Vop, corev1.EventTypeNormal, events.OperationStarted,
+		"Starting operation %s against VerticaDB '%s'", o.Vop.Spec.Type, o.Vdb.Name)
+	return ctrl.Result{}, o.updateStatus(ctx, func(status *vapi.VerticaDBOperationStatus) {
+		now := metav1.Now()
+		status.Phase = vapi.OperationRunning
+		status.Message = fmt.Sprintf("Running operation %s", o.Vop.Spec.Type)
+		status.StartTime = &now
+	})
+}
+
+// waitToStart will leave the operation in the pending phase and requeue
+func (o *OperationRunner) waitToStart(ctx context.Context, msg string) (ctrl.Result, error) {
+	if o.Vop.Status.Message != msg {
+		o.VRec.Event(o.Vop, corev1.EventTypeNormal, events.OperationWaiting, msg)
+	}
+	err := o.updateStatus(ctx, func(status *vapi.VerticaDBOperationStatus) {
+		status.Phase = vapi.OperationPending
+		status.Message = msg
+	})
+	return ctrl.Result{RequeueAfter: OperationPendingRequeueTime}, err
+}
+
+// findRunningMutatingOperation will return the name of another mutating
+// operation that is running against the same VerticaDB. An empty string is
+// returned if there isn't one.
+func (o *OperationRunner) findRunningMutatingOperation(ctx context.Context) (string, error) {
+	return findRunningMutatingOperation(ctx, o.VRec, o.Vop.Namespace, o.Vop.Spec.VerticaDBName, o.Vop.Name)
+}
+
+// findRunningMutatingOperation will return the name of a mutating operation
+// that is running against the given VerticaDB. The operation named by
+// skipName is ignored. An empty string is returned if there isn't one.
+func findRunningMutatingOperation(ctx context.Context, vrec *VerticaDBReconciler, namespace, vdbName,
+	skipName string) (string, error) {
+	vops := &vapi.VerticaDBOperationList{}
+	if err := vrec.List(ctx, vops, client.InNamespace(namespace)); err != nil {
+		return "", err
+	}
+	for i := range vops.Items {
+		v := &vops.Items[i]
+		if v.Name == skipName || v.Spec.VerticaDBName != vdbName {
+			continue
+		}
+		if v.IsMutating() && v.Status.Phase == vapi.OperationRunning {
+			return v.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// getSteps returns the steps for the operation type, in the order they are run
+func (o *OperationRunner) getSteps() []operationStep {
+	switch o.Vop.Spec.Type {
+	case vapi.OperationRestartSubcluster:
+		return []operationStep{
+			{Name: "Drain", Run: o.drainSubclusters},
+			{Name: "Stop", Run: o.stopSubclusters},
+			{Name: "Restart", Run: o.restartSubclusters},
+		}
+	case vapi.OperationRebalanceShards:
+		return []operationStep{{Name: "Rebalance", Run: o.rebalanceShards}}
+	case vapi.OperationAnalyzeStatistics:
+		return []operationStep{{Name: "AnalyzeStatistics", Run: o.analyzeStatistics}}
+	case vapi.OperationKillSessions:
+		return []operationStep{{Name: "KillSessions", Run: o.killSessions}}
+	case vapi.OperationReinstall:
+		return []operationStep{{Name: "Install", Run: o.reinstall}}
+	}
+	return nil
+}
+
+// isStepCompleted returns true if the given step was recorded as done
+func (o *OperationRunner) isStepCompleted(stepName string) bool {
+	for _, s := range o.Vop.Status.CompletedSteps {
+		if s == stepName {
+			return true
+		}
+	}
+	return false
+}
+
+// makeShutdownView returns a copy of the VerticaDB, and pod facts for it,
+// where the target subclusters are marked as shutdown. This lets us reuse the
+// drain and shutdown actors for subclusters that are shutdown in the spec.
+func (o *OperationRunner) makeShutdownView() (*vapi.VerticaDB, *PodFacts) {
+	vdbCopy := o.Vdb.DeepCopy()
+	for _, scName := range o.Vop.Spec.Subclusters {
+		for i := range vdbCopy.Spec.Subclusters {
+			if vdbCopy.Spec.Subclusters[i].Name == scName {
+				vdbCopy.Spec.Subclusters[i].Shutdown = true
+			}
+		}
+	}
+	pfacts := MakePodFacts(o.VRec, o.PRunner)
+	pfacts.OverrideFunc = o.PFacts.OverrideFunc
+	return vdbCopy, &pfacts
+}
+
+// drainSubclusters will wait for client connections to leave the nodes in the
+// target subclusters
+func (o *OperationRunner) drainSubclusters(ctx context.Context) (ctrl.Result, error) {
+	vdbCopy, pfacts := o.makeShutdownView()
+	return MakeDrainNodeReconciler(o.VRec, vdbCopy, o.PRunner, pfacts).Reconcile(ctx, &ctrl.Request{})
+}
+
+// stopSubclusters will stop the vertica nodes in the target subclusters
+func (o *OperationRunner) stopSubclusters(ctx context.Context) (ctrl.Result, error) {
+	vdbCopy, pfacts := o.makeShutdownView()
+	return MakeSubclusterShutdownReconciler(o.VRec, o.Log, vdbCopy, o.PRunner, pfacts).Reconcile(ctx, &ctrl.Request{})
+}
+
+// restartSubclusters will restart the vertica nodes in the target subclusters.
+// It requeues until all of those nodes are up.
+func (o *OperationRunner) restartSubclusters(ctx context.Context) (ctrl.Result, error) {
+	o.PFacts.Invalidate()
+	actor := MakeRestartReconciler(o.VRec, o.Log, o.Vdb, o.PRunner, o.PFacts, false, o.Dispatcher)
+	if res, err := actor.Reconcile(ctx, &ctrl.Request{}); verrors.IsReconcileAborted(res, err) {
+		return res, err
+	}
+	o.PFacts.Invalidate()
+	if err := o.PFacts.Collect(ctx, o.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+	downPods := o.PFacts.filterPods(func(v *PodFact) bool {
+		return o.isTargetSubcluster(v.subclusterName) && !v.upNode
+	})
+	if len(downPods) > 0 {
+		o.Log.Info("Waiting for nodes in the target subclusters to be up", "downPodCount", len(downPods))
+		return ctrl.Result{Requeue: true}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// rebalanceShards will call rebalance_shards for each target subcluster, or
+// for all subclusters if none were given.
+func (o *OperationRunner) rebalanceShards(ctx context.Context) (ctrl.Result, error) {
+	scNames := o.Vop.Spec.Subclusters
+	if len(scNames) == 0 {
+		scNames = []string{""}
+	}
+	for _, scName := range scNames {
+		actor := &RebalanceShardsReconciler{
+			VRec:      o.VRec,
+			Log:       o.Log,
+			Vdb:       o.Vdb,
+			PRunner:   o.PRunner,
+			PFacts:    o.PFacts,
+			ScName:    scName,
+			Force:     true,
+			Voluntary: true,
+		}
+		if res, err := actor.Reconcile(ctx, &ctrl.Request{}); verrors.IsReconcileAborted(res, err) {
+			return res, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// analyzeStatistics will collect statistics for all tables in the database
+func (o *OperationRunner) analyzeStatistics(ctx context.Context) (ctrl.Result, error) {
+	return o.runSQL(ctx, "select analyze_statistics('');")
+}
+
+// killSessions will close the client sessions connected to the target nodes
+func (o *OperationRunner) killSessions(ctx context.Context) (ctrl.Result, error) {
+	if err := o.PFacts.Collect(ctx, o.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+	sql := "select close_session(session_id) from sessions" +
+		" where session_id not in (select session_id from current_session)"
+	if len(o.Vop.Spec.Subclusters) > 0 || len(o.Vop.Spec.Pods) > 0 {
+		nodeNames, err := o.findTargetNodeNames()
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if len(nodeNames) == 0 {
+			return ctrl.Result{}, o.setOutput(ctx, "No nodes are up in the targets. There are no sessions to close.")
+		}
+		sql += fmt.Sprintf(" and node_name in ('%s')", strings.Join(nodeNames, "', '"))
+	}
+	return o.runSQL(ctx, sql+";")
+}
+
+// findTargetNodeNames returns the vertica node names of the up nodes that are
+// in the target subclusters or pods.
+func (o *OperationRunner) findTargetNodeNames() ([]string, error) {
+	podMap := map[string]bool{}
+	for _, podName := range o.Vop.Spec.Pods {
+		podMap[podName] = true
+	}
+	nodeNames := []string{}
+	for _, pf := range o.PFacts.Detail {
+		if !o.isTargetSubcluster(pf.subclusterName) && !podMap[pf.name.Name] {
+			continue
+		}
+		delete(podMap, pf.name.Name)
+		if pf.upNode {
+			nodeNames = append(nodeNames, pf.vnodeName)
+		}
+	}
+	for podName := range podMap {
+		return nil, fmt.Errorf("pod '%s' is not part of VerticaDB '%s'", podName, o.Vdb.Name)
+	}
+	sort.Strings(nodeNames)
+	return nodeNames, nil
+}
+
+// reinstall will redo the install for the pods in the target subclusters, or
+// all pods if none were given. The install indicator and the http server
+// config are removed so that the install doesn't skip the pods, and the
+// admintools.conf is copied again from the base pod.
+func (o *OperationRunner) reinstall(ctx context.Context) (ctrl.Result, error) {
+	if err := o.PFacts.Collect(ctx, o.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+	targets := o.PFacts.filterPods(func(v *PodFact) bool {
+		return len(o.Vop.Spec.Subclusters) == 0 || o.isTargetSubcluster(v.subclusterName)
+	})
+	for _, pf := range targets {
+		if !pf.isPodRunning {
+			o.Log.Info("Waiting for the target pods to be running", "pod", pf.name)
+			return ctrl.Result{Requeue: true}, nil
+		}
+	}
+
+	actor := MakeInstallReconciler(o.VRec, o.Log, o.Vdb, o.PRunner, o.PFacts).(*InstallReconciler)
+	actor.ATWriter = o.ATWriter
+	// We fetch the admintools.conf before removing any install indicator as
+	// the base pod must have one.  With vclusterOps there is no
+	// admintools.conf, so only the http server config is redone.
+	useAT := !vmeta.UseVClusterOps(o.Vdb.Annotations)
+	atConfTempFile := ""
+	if useAT && len(o.PFacts.findInstalledPods()) > 0 {
+		basePod, err := findATBasePod(o.Vdb, o.PFacts)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if atConfTempFile, err = actor.ATWriter.AddHosts(ctx, basePod, []string{}); err != nil {
+			return ctrl.Result{}, err
+		}
+		defer os.Remove(atConfTempFile)
+	}
+
+	for _, pf := range targets {
+		cmd := []string{"rm", "-f", paths.HTTPTLSConfFile}
+		if useAT {
+			cmd = append(cmd, o.Vdb.GenInstallerIndicatorFileName())
+		}
+		if _, _, err := o.PRunner.ExecInPod(ctx, pf.name, names.ServerContainer, cmd...); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to clear the install of pod %s: %w", pf.name.Name, err)
+		}
+	}
+
+	if atConfTempFile != "" {
+		if err := distributeAdmintoolsConf(ctx, o.Vdb, o.VRec, o.PFacts, o.PRunner, atConfTempFile); err != nil {
+			return ctrl.Result{}, err
+		}
+		// The install only adds pods that aren't in admintools.conf, so we
+		// recreate the install indicator for the ones that already were.
+		installed := []*PodFact{}
+		for _, pf := range targets {
+			if pf.isInstalled {
+				installed = append(installed, pf)
+			}
+		}
+		if err := actor.createInstallIndicators(ctx, installed); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// The install regenerates the http server config that we removed
+	o.PFacts.Invalidate()
+	return actor.Reconcile(ctx, &ctrl.Request{})
+}
+
+// runSQL will run the given SQL from any up node and save its output in the
+// status of the operation.
+func (o *OperationRunner) runSQL(ctx context.Context, sql string) (ctrl.Result, error) {
+	if err := o.PFacts.Collect(ctx, o.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+	pf, ok := o.PFacts.findPodToRunVsql(false, "")
+	if !ok {
+		o.Log.Info("No pod found to run vsql from. Requeue reconciliation.")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	stdout, stderr, err := o.PRunner.ExecVSQL(ctx, pf.name, names.ServerContainer, "-tAc", sql)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("%w: %s", err, stderr)
+	}
+	return ctrl.Result{}, o.setOutput(ctx, strings.TrimSpace(stdout))
+}
+
+// isTargetSubcluster returns true if the given subcluster is one of the targets
+func (o *OperationRunner) isTargetSubcluster(scName string) bool {
+	for _, s := range o.Vop.Spec.Subclusters {
+		if s == scName {
+			return true
+		}
+	}
+	return false
+}
+
+// setOutput will save the output of the operation in its status
+func (o *OperationRunner) setOutput(ctx context.Context, output string) error {
+	return o.updateStatus(ctx, func(status *vapi.VerticaDBOperationStatus) {
+		status.Output = output
+	})
+}
+
+// finish will move the operation to a terminal phase and write an event
+func (o *OperationRunner) finish(ctx context.Context, phase, msg string) error {
+	if phase == vapi.OperationSucceeded {
+		o.VRec.Event(o.Vop, corev1.EventTypeNormal, events.OperationSucceeded, msg)
+	} else {
+		o.VRec.Event(o.Vop, corev1.EventTypeWarning, events.OperationFailed, msg)
+	}
+	return setOperationFinished(ctx, o.VRec, o.Vop, phase, msg)
+}
+
+// updateStatus will apply the given function to the status of the operation
+// and write it out
+func (o *OperationRunner) updateStatus(ctx context.Context, updateFunc func(*vapi.VerticaDBOperationStatus)) error {
+	return updateOperationStatus(ctx, o.VRec, o.Vop, updateFunc)
+}
+
+// setOperationFinished will set the phase, message and completion time of an
+// operation that has finished
+func setOperationFinished(ctx context.Context, vrec *VerticaDBReconciler, vop *vapi.VerticaDBOperation,
+	phase, msg string) error {
+	return updateOperationStatus(ctx, vrec, vop, func(status *vapi.VerticaDBOperationStatus) {
+		now := metav1.Now()
+		status.Phase = phase
+		status.Message = msg
+		status.CompletionTime = &now
+	})
+}
+
+// updateOperationStatus will fetch the latest copy of the operation, apply the
+// given function to its status and write it out.
+func updateOperationStatus(ctx context.Context, vrec *VerticaDBReconciler, vop *vapi.VerticaDBOperation,
+	updateFunc func(*vapi.VerticaDBOperationStatus)) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		// Always fetch the latest to minimize the chance of getting a conflict error.
+		if err := vrec.Get(ctx, vop.ExtractNamespacedName(), vop); err != nil {
+			return err
+		}
+		updateFunc(&vop.Status)
+		return vrec.Status().Update(ctx, vop)
+	})
+}
@@ -0,0 +1,248 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/atconf"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/paths"
+	"github.com/vertica/vertica-kubernetes/pkg/test"
+	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// createInitializedVDB will create the vdb, along with its pods, and mark the
+// database as initialized.
+func createInitializedVDB(ctx context.Context, vdb *vapi.VerticaDB) {
+	test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+	test.CreateVDB(ctx, k8sClient, vdb)
+	ExpectWithOffset(1, vdbstatus.UpdateCondition(ctx, k8sClient, vdb,
+		vapi.VerticaDBCondition{Type: vapi.DBInitialized, Status: corev1.ConditionTrue})).Should(Succeed())
+}
+
+func deleteInitializedVDB(ctx context.Context, vdb *vapi.VerticaDB) {
+	test.DeletePods(ctx, k8sClient, vdb)
+	test.DeleteVDB(ctx, k8sClient, vdb)
+}
+
+func createVOP(ctx context.Context, vop *vapi.VerticaDBOperation) {
+	ExpectWithOffset(1, k8sClient.Create(ctx, vop)).Should(Succeed())
+}
+
+func deleteVOP(ctx context.Context, vop *vapi.VerticaDBOperation) {
+	ExpectWithOffset(1, k8sClient.Delete(ctx, vop)).Should(Succeed())
+}
+
+var _ = Describe("operationrunner", func() {
+	ctx := context.Background()
+
+	It("should run analyze_statistics and save the output", func() {
+		vdb := vapi.MakeVDB()
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+		vop := vapi.MakeVOP()
+		createVOP(ctx, vop)
+		defer deleteVOP(ctx, vop)
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		// Any up pod can be picked to run the query from
+		fpr.Results = cmds.CmdResults{}
+		for pn := range pfacts.Detail {
+			fpr.Results[pn] = []cmds.CmdResult{{Stdout: "0\n"}}
+		}
+		o := MakeOperationRunner(vdbRec, logger, vop, vdb, fpr, pfacts, nil)
+		Expect(o.Run(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(fpr.FindCommands("select analyze_statistics('');")).Should(HaveLen(1))
+
+		Expect(k8sClient.Get(ctx, vop.ExtractNamespacedName(), vop)).Should(Succeed())
+		Expect(vop.Status.Phase).Should(Equal(vapi.OperationSucceeded))
+		Expect(vop.Status.Output).Should(Equal("0"))
+		Expect(vop.Status.StartTime).ShouldNot(BeNil())
+		Expect(vop.Status.CompletionTime).ShouldNot(BeNil())
+		Expect(vop.Status.CompletedSteps).Should(ConsistOf("AnalyzeStatistics"))
+
+		// Running again does nothing because the operation has finished
+		Expect(o.Run(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(fpr.FindCommands("select analyze_statistics('');")).Should(HaveLen(1))
+	})
+
+	It("should fail the operation if a subcluster doesn't exist", func() {
+		vdb := vapi.MakeVDB()
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+		vop := vapi.MakeVOP()
+		vop.Spec.Type = vapi.OperationRestartSubcluster
+		vop.Spec.Subclusters = []string{"not-there"}
+		createVOP(ctx, vop)
+		defer deleteVOP(ctx, vop)
+
+		fpr := &cmds.FakePodRunner{}
+		o := MakeOperationRunner(vdbRec, logger, vop, vdb, fpr, createPodFactsDefault(fpr), nil)
+		Expect(o.Run(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(vop.Status.Phase).Should(Equal(vapi.OperationFailed))
+		Expect(vop.Status.Message).Should(ContainSubstring("not-there"))
+		Expect(fpr.Histories).Should(BeEmpty())
+	})
+
+	It("should wait for another mutating operation against the same vdb", func() {
+		vdb := vapi.MakeVDB()
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+		running := vapi.MakeVOP()
+		running.Name = "running-op"
+		running.Spec.Type = vapi.OperationReinstall
+		createVOP(ctx, running)
+		defer deleteVOP(ctx, running)
+		running.Status.Phase = vapi.OperationRunning
+		Expect(k8sClient.Status().Update(ctx, running)).Should(Succeed())
+
+		vop := vapi.MakeVOP()
+		vop.Spec.Type = vapi.OperationKillSessions
+		createVOP(ctx, vop)
+		defer deleteVOP(ctx, vop)
+
+		fpr := &cmds.FakePodRunner{}
+		o := MakeOperationRunner(vdbRec, logger, vop, vdb, fpr, createPodFactsDefault(fpr), nil)
+		Expect(o.Run(ctx)).Should(Equal(ctrl.Result{RequeueAfter: OperationPendingRequeueTime}))
+		Expect(vop.Status.Phase).Should(Equal(vapi.OperationPending))
+		Expect(vop.Status.Message).Should(ContainSubstring("running-op"))
+		Expect(fpr.FindCommands("close_session")).Should(BeEmpty())
+
+		// A non-mutating operation isn't blocked
+		vop.Spec.Type = vapi.OperationAnalyzeStatistics
+		Expect(k8sClient.Update(ctx, vop)).Should(Succeed())
+		Expect(o.Run(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(vop.Status.Phase).Should(Equal(vapi.OperationSucceeded))
+	})
+
+	It("should close the sessions on the nodes of the target pods", func() {
+		vdb := vapi.MakeVDB()
+		sc := &vdb.Spec.Subclusters[0]
+		sc.Size = 3
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+		vop := vapi.MakeVOP()
+		vop.Spec.Type = vapi.OperationKillSessions
+		vop.Spec.Pods = []string{names.GenPodName(vdb, sc, 2).Name}
+		createVOP(ctx, vop)
+		defer deleteVOP(ctx, vop)
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		setVerticaNodeNameInPodFacts(vdb, sc, pfacts)
+		o := MakeOperationRunner(vdbRec, logger, vop, vdb, fpr, pfacts, nil)
+		Expect(o.Run(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(vop.Status.Phase).Should(Equal(vapi.OperationSucceeded))
+		Expect(fpr.FindCommands("and node_name in ('v_db_node0003')")).Should(HaveLen(1))
+	})
+
+	It("should stop and restart the nodes of a subcluster", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters = []vapi.Subcluster{
+			{Name: "sc1", Size: 1, IsPrimary: true},
+			{Name: "sc2", Size: 2, IsPrimary: false},
+		}
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+		vop := vapi.MakeVOP()
+		vop.Spec.Type = vapi.OperationRestartSubcluster
+		vop.Spec.Subclusters = []string{"sc2"}
+		createVOP(ctx, vop)
+		defer deleteVOP(ctx, vop)
+
+		fpr := &cmds.FakePodRunner{}
+		o := MakeOperationRunner(vdbRec, logger, vop, vdb, fpr, createPodFactsDefault(fpr), nil)
+		Expect(o.Run(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(vop.Status.Phase).Should(Equal(vapi.OperationSucceeded))
+		Expect(vop.Status.CompletedSteps).Should(Equal([]string{"Drain", "Stop", "Restart"}))
+		stopCmds := fpr.FindCommands("select shutdown_subcluster('sc2')")
+		Expect(stopCmds).Should(HaveLen(1))
+		Expect(stopCmds[0].Pod).Should(Equal(names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)))
+	})
+
+	It("should redo the install of pods that are already installed", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters = []vapi.Subcluster{
+			{Name: "sc1", Size: 2, IsPrimary: true},
+			{Name: "sc2", Size: 1, IsPrimary: false},
+		}
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+		vop := vapi.MakeVOP()
+		vop.Spec.Type = vapi.OperationReinstall
+		vop.Spec.Subclusters = []string{"sc1"}
+		createVOP(ctx, vop)
+		defer deleteVOP(ctx, vop)
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		for _, pf := range pfacts.Detail {
+			pf.isInstalled = true
+		}
+		fpr.Histories = nil
+		o := MakeOperationRunner(vdbRec, logger, vop, vdb, fpr, pfacts, nil)
+		o.ATWriter = &atconf.FakeWriter{}
+		Expect(o.Run(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(vop.Status.Phase).Should(Equal(vapi.OperationSucceeded))
+
+		// Only the pods of the target subcluster have their install cleared
+		// and the install indicator created again.
+		sc1Pods := []types.NamespacedName{
+			names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0),
+			names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 1),
+		}
+		for _, hist := range [][]cmds.CmdHistory{
+			fpr.FindCommands("rm -f", paths.HTTPTLSConfFile, vdb.GenInstallerIndicatorFileName()),
+			fpr.FindCommands("tee", vdb.GenInstallerIndicatorFileName()),
+		} {
+			pods := []types.NamespacedName{}
+			for _, c := range hist {
+				pods = append(pods, c.Pod)
+			}
+			Expect(pods).Should(ConsistOf(sc1Pods))
+		}
+		Expect(fpr.FindCommands(fmt.Sprintf("cat > %s", paths.AdminToolsConf))).ShouldNot(BeEmpty())
+	})
+
+	It("should hold off the VerticaDB reconcile while a mutating operation runs", func() {
+		vdb := vapi.MakeVDB()
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+		vop := vapi.MakeVOP()
+		vop.Spec.Type = vapi.OperationRestartSubcluster
+		vop.Spec.Subclusters = []string{vdb.Spec.Subclusters[0].Name}
+		createVOP(ctx, vop)
+		defer deleteVOP(ctx, vop)
+		vop.Status.Phase = vapi.OperationRunning
+		Expect(k8sClient.Status().Update(ctx, vop)).Should(Succeed())
+
+		Expect(vdbRec.Reconcile(ctx, ctrl.Request{NamespacedName: vdb.ExtractNamespacedName()})).Should(
+			Equal(ctrl.Result{RequeueAfter: OperationPendingRequeueTime}))
+	})
+})
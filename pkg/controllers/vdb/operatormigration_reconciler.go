@@ -0,0 +1,47 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	"github.com/vertica/vertica-kubernetes/pkg/opmigration"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// OperatorMigrationReconciler will apply any migration steps needed for k8s
+// objects created by an older version of the operator.
+type OperatorMigrationReconciler struct {
+	VRec *VerticaDBReconciler
+	Log  logr.Logger
+	Vdb  *vapi.VerticaDB // Vdb is the CRD we are acting on.
+}
+
+// MakeOperatorMigrationReconciler will build an OperatorMigrationReconciler object
+func MakeOperatorMigrationReconciler(vdbrecon *VerticaDBReconciler, log logr.Logger,
+	vdb *vapi.VerticaDB) controllers.ReconcileActor {
+	return &OperatorMigrationReconciler{VRec: vdbrecon, Log: log.WithName("OperatorMigrationReconciler"), Vdb: vdb}
+}
+
+// Reconcile will run the migration steps that haven't been applied yet to the
+// VerticaDB.
+func (o *OperatorMigrationReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ctrl.Result, error) {
+	m := opmigration.MakeMigrator(o.VRec.Client, o.Log, o.VRec, o.Vdb)
+	return ctrl.Result{}, m.Run(ctx)
+}
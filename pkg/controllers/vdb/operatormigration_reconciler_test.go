@@ -22,6 +22,7 @@ import (
 	"github.com/vertica/vertica-kubernetes/pkg/builder"
 	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
 	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/test"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -30,11 +31,13 @@ import (
 	. "github.com/onsi/gomega"
 )
 
-var _ = Describe("k8s/upgradeoperator120_reconciler", func() {
+var _ = Describe("operatormigration_reconciler", func() {
 	ctx := context.Background()
 
 	It("should delete sts that was created prior to current release", func() {
 		vdb := vapi.MakeVDB()
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
 		sc := &vdb.Spec.Subclusters[0]
 		nm := names.GenStsName(vdb, sc)
 		sts := builder.BuildStsSpec(nm, vdb, sc, builder.DefaultDeploymentNames())
@@ -52,11 +55,16 @@ var _ = Describe("k8s/upgradeoperator120_reconciler", func() {
 		fetchedSts := &appsv1.StatefulSet{}
 		Expect(k8sClient.Get(ctx, nm, fetchedSts)).Should(Succeed())
 
-		r := MakeUpgradeOperator120Reconciler(vdbRec, logger, vdb)
+		r := MakeOperatorMigrationReconciler(vdbRec, logger, vdb)
 		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
 
 		// Reconcile should have deleted the sts because it was created by an
 		// old operator version
 		Expect(k8sClient.Get(ctx, nm, fetchedSts)).ShouldNot(Succeed())
+
+		// The applied version is recorded so the steps aren't run again
+		fetchedVdb := &vapi.VerticaDB{}
+		Expect(k8sClient.Get(ctx, vdb.ExtractNamespacedName(), fetchedVdb)).Should(Succeed())
+		Expect(fetchedVdb.Annotations[vmeta.OperatorMigrationVersionAnnotation]).Should(Equal(vmeta.CurOperatorVersion))
 	})
 })
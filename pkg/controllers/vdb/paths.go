@@ -43,8 +43,11 @@ func prepLocalData(ctx context.Context, vdb *vapi.VerticaDB, prunner cmds.PodRun
 	// the ownership of the config, log and data directory.  This function exists to
 	// handle the depot directory. This can be skipped if the depotPath is
 	// shared with one of the data or catalog paths or if the depot volume is not
-	// a PersistentVolume.
-	if vdb.IsDepotVolumePersistentVolume() && vdb.Spec.Local.IsDepotPathUnique() {
+	// a PersistentVolume. If the depot has its own PVC, it is mounted directly
+	// at the depotPath.
+	if vdb.Spec.Local.DepotPVC != nil {
+		rmCmds.WriteString(fmt.Sprintf("sudo chown dbadmin:verticadba -R %s", vdb.Spec.Local.DepotPath))
+	} else if vdb.IsDepotVolumePersistentVolume() && vdb.Spec.Local.IsDepotPathUnique() {
 		rmCmds.WriteString(fmt.Sprintf("sudo chown dbadmin:verticadba -R %s/%s", paths.LocalDataPath, vdb.GetPVSubPath("depot")))
 	}
 
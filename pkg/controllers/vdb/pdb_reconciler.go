@@ -0,0 +1,169 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/builder"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	"github.com/vertica/vertica-kubernetes/pkg/iter"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// PDBReconciler will maintain the PodDisruptionBudgets of the vdb. There is a
+// single one for the primary pods, sized from the k-safety, and one for each
+// secondary subcluster. This limits the number of pods that voluntary
+// disruptions, such as a node drain, can take down at once.
+type PDBReconciler struct {
+	VRec   *VerticaDBReconciler
+	Log    logr.Logger
+	Vdb    *vapi.VerticaDB // Vdb is the CRD we are acting on.
+	PFacts *PodFacts
+}
+
+// MakePDBReconciler will build a PDBReconciler object
+func MakePDBReconciler(vdbrecon *VerticaDBReconciler, log logr.Logger, vdb *vapi.VerticaDB, pfacts *PodFacts) controllers.ReconcileActor {
+	return &PDBReconciler{
+		VRec:   vdbrecon,
+		Log:    log.WithName("PDBReconciler"),
+		Vdb:    vdb,
+		PFacts: pfacts,
+	}
+}
+
+// Reconcile will create, update or delete the PodDisruptionBudgets so that
+// there is one for the primary pods and one for each non-transient secondary
+// subcluster in the vdb.
+func (p *PDBReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ctrl.Result, error) {
+	if err := p.PFacts.Collect(ctx, p.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	nm := names.GenPrimaryPdbName(p.Vdb)
+	if err := p.reconcilePdb(ctx, builder.BuildPrimaryPdb(nm, p.Vdb, p.countPrimaryRestarts())); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	expected := map[string]bool{}
+	for i := range p.Vdb.Spec.Subclusters {
+		sc := &p.Vdb.Spec.Subclusters[i]
+		// Transient subclusters only live for the duration of an online
+		// upgrade, so they never get a budget. The primaries are covered by
+		// the budget above.
+		if sc.IsTransient || sc.IsPrimary {
+			continue
+		}
+		nm := names.GenPdbName(p.Vdb, sc)
+		expected[nm.Name] = true
+		if err := p.reconcilePdb(ctx, builder.BuildPdb(nm, p.Vdb, sc, p.countSubclusterRestarts(sc))); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, p.deleteStalePdbs(ctx, expected)
+}
+
+// isOperatorRestartingPod returns true if the operator is going to restart
+// vertica in the given pod. Those pods are not ready, so they already count
+// against the budget. We allow for them so that they don't block node drains
+// of the other pods until the restart is done.
+func (p *PDBReconciler) isOperatorRestartingPod(pf *PodFact) bool {
+	return p.Vdb.Spec.AutoRestartVertica && pf.isPodRunning && pf.dbExists && !pf.upNode
+}
+
+// countPrimaryRestarts returns the number of primary pods that the operator is
+// restarting.
+func (p *PDBReconciler) countPrimaryRestarts() int {
+	cnt := 0
+	for _, pf := range p.PFacts.Detail {
+		if pf.isPrimary && p.isOperatorRestartingPod(pf) {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// countSubclusterRestarts returns the number of pods in the given subcluster
+// that the operator is restarting.
+func (p *PDBReconciler) countSubclusterRestarts(sc *vapi.Subcluster) int {
+	cnt := 0
+	for _, pf := range p.PFacts.Detail {
+		if pf.subclusterName == sc.Name && p.isOperatorRestartingPod(pf) {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// reconcilePdb will create or update a single PodDisruptionBudget so that it
+// matches the expected one.
+func (p *PDBReconciler) reconcilePdb(ctx context.Context, expPdb *policyv1.PodDisruptionBudget) error {
+	nm := types.NamespacedName{Namespace: expPdb.Namespace, Name: expPdb.Name}
+	curPdb := &policyv1.PodDisruptionBudget{}
+	if err := p.VRec.Client.Get(ctx, nm, curPdb); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		p.Log.Info("Creating PodDisruptionBudget", "Name", nm, "MaxUnavailable", expPdb.Spec.MaxUnavailable)
+		if err := ctrl.SetControllerReference(p.Vdb, expPdb, p.VRec.Scheme); err != nil {
+			return err
+		}
+		return p.VRec.Client.Create(ctx, expPdb)
+	}
+
+	if reflect.DeepEqual(curPdb.Spec.MaxUnavailable, expPdb.Spec.MaxUnavailable) &&
+		reflect.DeepEqual(curPdb.Spec.Selector, expPdb.Spec.Selector) &&
+		!stringMapDiffer(expPdb.Labels, curPdb.Labels) &&
+		!stringMapDiffer(expPdb.Annotations, curPdb.Annotations) {
+		return nil
+	}
+	p.Log.Info("Updating PodDisruptionBudget", "Name", nm, "MaxUnavailable", expPdb.Spec.MaxUnavailable)
+	curPdb.Labels = expPdb.Labels
+	curPdb.Annotations = expPdb.Annotations
+	curPdb.Spec.Selector = expPdb.Spec.Selector
+	curPdb.Spec.MaxUnavailable = expPdb.Spec.MaxUnavailable
+	curPdb.Spec.MinAvailable = nil
+	return p.VRec.Client.Update(ctx, curPdb)
+}
+
+// deleteStalePdbs will delete the PodDisruptionBudget of any subcluster that
+// no longer needs one. This covers subclusters that were removed from the vdb
+// and primary subclusters, which share the budget of the primary pods.
+func (p *PDBReconciler) deleteStalePdbs(ctx context.Context, expected map[string]bool) error {
+	finder := iter.MakeSubclusterFinder(p.VRec.Client, p.Vdb)
+	pdbs, err := finder.FindPodDisruptionBudgets(ctx, iter.FindExisting)
+	if err != nil {
+		return err
+	}
+	for i := range pdbs.Items {
+		if expected[pdbs.Items[i].Name] {
+			continue
+		}
+		p.Log.Info("Deleting PodDisruptionBudget", "Name", pdbs.Items[i].Name)
+		if err := p.VRec.Client.Delete(ctx, &pdbs.Items[i]); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/builder"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/test"
+	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("pdb_reconcile", func() {
+	ctx := context.Background()
+
+	It("should create a pdb for the primaries and one for each secondary subcluster", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.KSafety = vapi.KSafety1
+		vdb.Spec.Subclusters = []vapi.Subcluster{
+			{Name: "primary", IsPrimary: true, Size: 3},
+			{Name: "secondary", IsPrimary: false, Size: 1},
+		}
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+
+		// A budget left behind for a primary subcluster is replaced by the
+		// one covering all of the primaries.
+		oldPrimaryNm := names.GenPdbName(vdb, &vdb.Spec.Subclusters[0])
+		oldPdb := builder.BuildPdb(oldPrimaryNm, vdb, &vdb.Spec.Subclusters[0], 0)
+		Expect(k8sClient.Create(ctx, oldPdb)).Should(Succeed())
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		r := MakePDBReconciler(vdbRec, logger, vdb, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+
+		pdb := &policyv1.PodDisruptionBudget{}
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, oldPrimaryNm, pdb))).Should(BeTrue())
+		primaryNm := names.GenPrimaryPdbName(vdb)
+		Expect(k8sClient.Get(ctx, primaryNm, pdb)).Should(Succeed())
+		Expect(*pdb.Spec.MaxUnavailable).Should(Equal(intstr.FromInt(1)))
+		secondaryNm := names.GenPdbName(vdb, &vdb.Spec.Subclusters[1])
+		Expect(k8sClient.Get(ctx, secondaryNm, pdb)).Should(Succeed())
+		Expect(*pdb.Spec.MaxUnavailable).Should(Equal(intstr.FromInt(1)))
+
+		// An upgrade on its own doesn't relax any budget
+		Expect(vdbstatus.UpdateCondition(ctx, k8sClient, vdb,
+			vapi.VerticaDBCondition{Type: vapi.ImageChangeInProgress, Status: corev1.ConditionTrue})).Should(Succeed())
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(k8sClient.Get(ctx, primaryNm, pdb)).Should(Succeed())
+		Expect(*pdb.Spec.MaxUnavailable).Should(Equal(intstr.FromInt(1)))
+
+		// The override in the spec is used for the secondary
+		override := intstr.FromInt(2)
+		vdb.Spec.Subclusters[1].PdbMaxUnavailable = &override
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(k8sClient.Get(ctx, secondaryNm, pdb)).Should(Succeed())
+		Expect(*pdb.Spec.MaxUnavailable).Should(Equal(override))
+
+		// Removing a subcluster removes its budget
+		vdb.Spec.Subclusters = vdb.Spec.Subclusters[:1]
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, secondaryNm, pdb))).Should(BeTrue())
+		Expect(k8sClient.Get(ctx, primaryNm, pdb)).Should(Succeed())
+		Expect(k8sClient.Delete(ctx, pdb)).Should(Succeed())
+	})
+
+	It("should only allow for the pods that are being restarted", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.KSafety = vapi.KSafety1
+		vdb.Spec.Subclusters = []vapi.Subcluster{
+			{Name: "primary", IsPrimary: true, Size: 3},
+			{Name: "secondary", IsPrimary: false, Size: 3},
+		}
+		vdb.Spec.AutoRestartVertica = true
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		for _, pf := range pfacts.Detail {
+			pf.dbExists = true
+			pf.upNode = true
+		}
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 1)
+		pfacts.Detail[pn].upNode = false
+		r := MakePDBReconciler(vdbRec, logger, vdb, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+
+		pdb := &policyv1.PodDisruptionBudget{}
+		Expect(k8sClient.Get(ctx, names.GenPrimaryPdbName(vdb), pdb)).Should(Succeed())
+		Expect(*pdb.Spec.MaxUnavailable).Should(Equal(intstr.FromInt(2)))
+		Expect(k8sClient.Delete(ctx, pdb)).Should(Succeed())
+		Expect(k8sClient.Get(ctx, names.GenPdbName(vdb, &vdb.Spec.Subclusters[1]), pdb)).Should(Succeed())
+		Expect(*pdb.Spec.MaxUnavailable).Should(Equal(intstr.FromInt(1)))
+		Expect(k8sClient.Delete(ctx, pdb)).Should(Succeed())
+	})
+})
@@ -79,6 +79,11 @@ type PodFact struct {
 	// (b) statefulset exists but it isn't sized to include this pod yet.
 	managedByParent bool
 
+	// true means the pod is in a subcluster that is shutdown. Its node is
+	// stopped and the pod will be deleted when the statefulset is scaled to
+	// zero. Unlike pendingDelete, the node stays in the catalog.
+	shutdown bool
+
 	// true means the pod is scheduled for deletion.  This can happen if the
 	// size of the subcluster has shrunk in the VerticaDB but the pod still
 	// exists and is managed by a statefulset.  The pod is pending delete in
@@ -126,6 +131,10 @@ type PodFact struct {
 	// True if this pod is for a transient subcluster created for online upgrade
 	isTransient bool
 
+	// The topology domain, such as the zone, of the node the pod runs on.
+	// This is only set when spec.topology.mode is Zone.
+	zone string
+
 	// The number of shards this node has subscribed to, not including the
 	// special replica shard that has unsegmented projections.
 	shardSubscriptions int
@@ -148,6 +157,13 @@ type PodFact struct {
 	// The size, in bytes, of the amount of space left on the PV
 	localDataAvail int
 
+	// The size and available space, in bytes, of each PV that was given to
+	// the catalog, data or depot.  The key is the name of the PVC in the
+	// volumeClaimTemplate (e.g. local-depot).  These are empty if everything
+	// is stored in the local data PV.
+	volumeSize  map[string]int
+	volumeAvail map[string]int
+
 	// The in-container path to the catalog. e.g. /catalog/vertdb/v_node0001_catalog
 	catalogPath string
 
@@ -195,6 +211,8 @@ type GatherState struct {
 	VNodeName              string          `json:"vnodeName"`
 	LocalDataSize          int             `json:"localDataSize"`
 	LocalDataAvail         int             `json:"localDataAvail"`
+	VolumeSize             map[string]int  `json:"volumeSize"`
+	VolumeAvail            map[string]int  `json:"volumeAvail"`
 	AgentRunning           bool            `json:"agentRunning"`
 	ImageHasAgentKeys      bool            `json:"imageHasAgentKeys"`
 	IsHTTPServerRunning    bool            `json:"isHTTPServerRunning"`
@@ -242,7 +260,7 @@ func (p *PodFacts) Invalidate() {
 // collectSubcluster will collect facts about each pod in a specific subcluster
 func (p *PodFacts) collectSubcluster(ctx context.Context, vdb *vapi.VerticaDB, sc *vapi.Subcluster) error {
 	sts := &appsv1.StatefulSet{}
-	maxStsSize := sc.Size
+	maxStsSize := sc.GetStsSize()
 	// Attempt to fetch the sts.  We continue even for 'not found' errors
 	// because we want to populate the missing pods into the pod facts.
 	if err := p.VRec.Client.Get(ctx, names.GenStsName(vdb, sc), sts); err != nil && !k8sErrors.IsNotFound(err) {
@@ -267,6 +285,7 @@ func (p *PodFacts) collectPodByStsIndex(ctx context.Context, vdb *vapi.VerticaDB
 		subclusterName: sc.Name,
 		isPrimary:      sc.IsPrimary,
 		podIndex:       podIndex,
+		shutdown:       sc.Shutdown,
 	}
 	// It is possible for a pod to be managed by a parent sts but not yet exist.
 	// So, this has to be checked before we check for pod existence.
@@ -293,6 +312,7 @@ func (p *PodFacts) collectPodByStsIndex(ctx context.Context, vdb *vapi.VerticaDB
 		pf.pendingDelete = podIndex >= sc.Size
 		pf.image = pod.Spec.Containers[ServerContainerIndex].Image
 		pf.hasDCTableAnnotations = p.checkDCTableAnnotations(pod)
+		pf.zone = pod.Annotations[vmeta.ZoneAnnotation]
 		pf.catalogPath = p.getCatalogPathFromPod(vdb, pod)
 		pf.stsRevisionPending = p.isSTSRevisionPending(sts, pod)
 	}
@@ -442,7 +462,31 @@ func (p *PodFacts) genGatherScript(vdb *vapi.VerticaDB, pf *PodFact) string {
 		pf.catalogPath,
 		paths.DBadminAgentPath,
 		fmt.Sprintf("%d", builder.VerticaHTTPPort),
-	))
+	)) + genVolumeGatherScript(vdb)
+}
+
+// genVolumeGatherScript will generate the part of the gather script that
+// finds the size of each PV that was given to the catalog, data or depot.
+func genVolumeGatherScript(vdb *vapi.VerticaDB) string {
+	pvcs := vdb.GetLocalPVCs()
+	// The first PVC is always the local data PVC, which is covered by the
+	// localDataSize and localDataAvail keys.
+	if len(pvcs) == 1 {
+		return ""
+	}
+	var sb strings.Builder
+	outputs := []struct{ key, dfOutput string }{
+		{"volumeSize", "size"},
+		{"volumeAvail", "avail"},
+	}
+	for _, o := range outputs {
+		sb.WriteString(fmt.Sprintf("echo    '%s:'\n", o.key))
+		for i := 1; i < len(pvcs); i++ {
+			sb.WriteString(fmt.Sprintf("echo -n '  %s: '\n", pvcs[i].Name))
+			sb.WriteString(fmt.Sprintf("df --block-size=1 --output=%s %s | tail -1\n", o.dfOutput, pvcs[i].MountPath))
+		}
+	}
+	return sb.String()
 }
 
 // checkIsInstalled will check a single pod to see if the installation has happened.
@@ -500,6 +544,8 @@ func (p *PodFacts) checkForSimpleGatherStateMapping(ctx context.Context, vdb *va
 	pf.fileExists = gs.FileExists
 	pf.localDataSize = gs.LocalDataSize
 	pf.localDataAvail = gs.LocalDataAvail
+	pf.volumeSize = gs.VolumeSize
+	pf.volumeAvail = gs.VolumeAvail
 	pf.agentRunning = gs.AgentRunning
 	pf.imageHasAgentKeys = gs.ImageHasAgentKeys
 	pf.isHTTPServerRunning = gs.IsHTTPServerRunning
@@ -798,12 +844,12 @@ func (p *PodFacts) findPodToRunVsql(allowReadOnly bool, scName string) (*PodFact
 // Will return false for second parameter if no pod could be found.
 func (p *PodFacts) findPodToRunAdmintoolsAny() (*PodFact, bool) {
 	// Our preference for the pod is as follows:
-	// - up, not read-only and not pending delete
+	// - up, not read-only, not pending delete and not being shutdown
 	// - up and not read-only
 	// - up and read-only
 	// - has vertica installation
 	if pod, ok := p.findFirstPodSorted(func(v *PodFact) bool {
-		return v.upNode && !v.readOnly && !v.pendingDelete
+		return v.upNode && !v.readOnly && !v.pendingDelete && !v.shutdown
 	}); ok {
 		return pod, ok
 	}
@@ -855,6 +901,10 @@ func (p *PodFacts) findRestartablePods(restartReadOnly, restartTransient bool) [
 		if !restartTransient && v.isTransient {
 			return false
 		}
+		// Nodes in a subcluster being shutdown stay down
+		if v.shutdown {
+			return false
+		}
 		return (!v.upNode || (restartReadOnly && v.readOnly)) && v.dbExists && v.isPodRunning && v.hasDCTableAnnotations
 	})
 }
@@ -883,13 +933,45 @@ func (p *PodFacts) findReIPPods(onlyPodsWithoutDBs bool) []*PodFact {
 }
 
 // findPodsLowOnDiskSpace returns a list of pods that have low disk space in
-// their local data persistent volume (PV).
+// any of their persistent volumes (PV).
 func (p *PodFacts) findPodsLowOnDiskSpace(availThreshold int) []*PodFact {
 	return p.filterPods((func(v *PodFact) bool {
-		return v.isPodRunning && v.localDataAvail <= availThreshold
+		return v.isPodRunning && len(v.findVolumesLowOnDiskSpace(availThreshold)) > 0
 	}))
 }
 
+// findVolumesLowOnDiskSpace returns the names of the PVCs in the pod that have
+// low disk space. The names are in a stable order with the local data PVC
+// first.
+func (p *PodFact) findVolumesLowOnDiskSpace(availThreshold int) []string {
+	vols := []string{}
+	if p.localDataAvail <= availThreshold {
+		vols = append(vols, vapi.LocalDataPVC)
+	}
+	others := []string{}
+	for name, avail := range p.volumeAvail {
+		if avail <= availThreshold {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	return append(vols, others...)
+}
+
+// getVolumeUsedPercent returns the percentage of the volume, for the given
+// local PVC, that is in use. The bool return value is false if we don't know
+// the size of the volume.
+func (p *PodFact) getVolumeUsedPercent(pvcName string) (int, bool) {
+	size, avail := p.localDataSize, p.localDataAvail
+	if pvcName != vapi.LocalDataPVC {
+		size, avail = p.volumeSize[pvcName], p.volumeAvail[pvcName]
+	}
+	if size <= 0 {
+		return 0, false
+	}
+	return (size - avail) * 100 / size, true
+}
+
 // filterPods return a list of PodFact that match the given filter.
 // The filterFunc determines what pods to include.  If this function returns
 // true, the pod is included.
@@ -0,0 +1,213 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// reconcilePVCRetentionFinalizer will add the finalizer to the VerticaDB if
+// it has a PVC retention policy, and remove it if it doesn't.
+func (r *VerticaDBReconciler) reconcilePVCRetentionFinalizer(ctx context.Context, vdb *vapi.VerticaDB) error {
+	needFinalizer := vdb.Spec.Local.PVCRetentionPolicy != nil
+	if needFinalizer == controllerutil.ContainsFinalizer(vdb, vmeta.PVCRetentionFinalizer) {
+		return nil
+	}
+	patch := client.MergeFrom(vdb.DeepCopy())
+	if needFinalizer {
+		controllerutil.AddFinalizer(vdb, vmeta.PVCRetentionFinalizer)
+	} else {
+		controllerutil.RemoveFinalizer(vdb, vmeta.PVCRetentionFinalizer)
+	}
+	return r.Patch(ctx, vdb, patch)
+}
+
+// finalizeVDB is called when the VerticaDB is being deleted. It applies the
+// whenDeleted part of the PVC retention policy, then removes our finalizer so
+// that the deletion can continue. The PVCs are owned by the VerticaDB, so to
+// retain them we must remove that ownership before they are garbage collected.
+func (r *VerticaDBReconciler) finalizeVDB(ctx context.Context, log logr.Logger, vdb *vapi.VerticaDB) error {
+	if !controllerutil.ContainsFinalizer(vdb, vmeta.PVCRetentionFinalizer) {
+		return nil
+	}
+	pvcs, err := listLocalPVCs(ctx, r.Client, vdb)
+	if err != nil {
+		return err
+	}
+	for i := range pvcs {
+		pvc := &pvcs[i]
+		if vdb.IsPVCRetainedWhenDeleted() {
+			log.Info("Retaining PVC after VerticaDB deletion", "pvc", pvc.Name)
+			patch := client.MergeFrom(pvc.DeepCopy())
+			pvc.OwnerReferences = removeOwnerReference(pvc.OwnerReferences, vdb.UID)
+			if err := r.Patch(ctx, pvc, patch); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			continue
+		}
+		if err := deletePVC(ctx, r, vdb, pvc); err != nil {
+			return err
+		}
+	}
+	patch := client.MergeFrom(vdb.DeepCopy())
+	controllerutil.RemoveFinalizer(vdb, vmeta.PVCRetentionFinalizer)
+	return r.Patch(ctx, vdb, patch)
+}
+
+// deleteScaledDownPVCs will delete the PVCs of any pod that was removed
+// because its subcluster was scaled down or removed. A PVC is only deleted
+// once its pod is gone, which only happens after the node has been removed
+// from the database and uninstalled. This is a no-op unless the whenScaled
+// retention policy is Delete.
+func deleteScaledDownPVCs(ctx context.Context, vrec *VerticaDBReconciler, log logr.Logger, vdb *vapi.VerticaDB) error {
+	if !vdb.IsPVCDeletedWhenScaled() {
+		return nil
+	}
+	// The size of each subcluster, keyed by its statefulset name
+	stsSizes := map[string]int32{}
+	for i := range vdb.Spec.Subclusters {
+		sc := &vdb.Spec.Subclusters[i]
+		stsSizes[names.GenStsName(vdb, sc).Name] = sc.Size
+	}
+	pvcs, err := listLocalPVCs(ctx, vrec.Client, vdb)
+	if err != nil {
+		return err
+	}
+	for i := range pvcs {
+		pvc := &pvcs[i]
+		podName, stsName, podIndex, ok := parseLocalPVCName(vdb, pvc.Name)
+		if !ok {
+			continue
+		}
+		scaledDown, err := isPVCForScaledDownPod(ctx, vrec.Client, vdb.Namespace, podName, stsName, podIndex, stsSizes)
+		if err != nil {
+			return err
+		}
+		if !scaledDown {
+			continue
+		}
+		log.Info("Deleting PVC of a pod that was scaled down", "pvc", pvc.Name)
+		if err := deletePVC(ctx, vrec, vdb, pvc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isPVCForScaledDownPod returns true if the pod that used the PVC is gone and
+// isn't coming back. This is the case if the pod index is beyond the size of
+// its subcluster, or if its subcluster has been removed.
+func isPVCForScaledDownPod(ctx context.Context, cli client.Client, namespace, podName, stsName string, podIndex int32,
+	stsSizes map[string]int32) (bool, error) {
+	pod := &corev1.Pod{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: namespace, Name: podName}, pod); err == nil || !errors.IsNotFound(err) {
+		return false, client.IgnoreNotFound(err)
+	}
+	if size, ok := stsSizes[stsName]; ok {
+		return podIndex >= size, nil
+	}
+	// The subcluster isn't in the spec. We wait for the statefulset to be
+	// removed as it may be a transient subcluster that is still in use.
+	sts := &appsv1.StatefulSet{}
+	if err := cli.Get(ctx, types.NamespacedName{Namespace: namespace, Name: stsName}, sts); err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// listLocalPVCs returns the PVCs that were created from the
+// volumeClaimTemplates of the VerticaDB's statefulsets
+func listLocalPVCs(ctx context.Context, cli client.Client, vdb *vapi.VerticaDB) ([]corev1.PersistentVolumeClaim, error) {
+	pvcList := &corev1.PersistentVolumeClaimList{}
+	if err := cli.List(ctx, pvcList, client.InNamespace(vdb.Namespace)); err != nil {
+		return nil, err
+	}
+	pvcs := []corev1.PersistentVolumeClaim{}
+	for i := range pvcList.Items {
+		if metav1.IsControlledBy(&pvcList.Items[i], vdb) {
+			pvcs = append(pvcs, pvcList.Items[i])
+		}
+	}
+	return pvcs, nil
+}
+
+// parseLocalPVCName will split the name of a local PVC into the name of its
+// pod, the statefulset name and the pod index. The name has the form
+// <template>-<sts>-<index>. The bool return value is false if the name
+// doesn't have that form.
+func parseLocalPVCName(vdb *vapi.VerticaDB, pvcName string) (podName, stsName string, podIndex int32, ok bool) {
+	localPVCs := vdb.GetLocalPVCs()
+	for i := range localPVCs {
+		prefix := localPVCs[i].Name + "-"
+		if !strings.HasPrefix(pvcName, prefix) {
+			continue
+		}
+		podName = strings.TrimPrefix(pvcName, prefix)
+		sepInx := strings.LastIndex(podName, "-")
+		if sepInx == -1 {
+			return "", "", 0, false
+		}
+		inx, err := strconv.ParseInt(podName[sepInx+1:], 10, 32)
+		if err != nil {
+			return "", "", 0, false
+		}
+		return podName, podName[:sepInx], int32(inx), true
+	}
+	return "", "", 0, false
+}
+
+// removeOwnerReference returns the owner references without the one for the
+// given UID
+func removeOwnerReference(refs []metav1.OwnerReference, uid types.UID) []metav1.OwnerReference {
+	newRefs := []metav1.OwnerReference{}
+	for i := range refs {
+		if refs[i].UID != uid {
+			newRefs = append(newRefs, refs[i])
+		}
+	}
+	return newRefs
+}
+
+// deletePVC will delete a single PVC and log an event for it
+func deletePVC(ctx context.Context, vrec *VerticaDBReconciler, vdb *vapi.VerticaDB, pvc *corev1.PersistentVolumeClaim) error {
+	if pvc.DeletionTimestamp != nil {
+		return nil
+	}
+	if err := vrec.Client.Delete(ctx, pvc); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	vrec.Eventf(vdb, corev1.EventTypeNormal, events.PVCDeleted,
+		"Deleted PVC '%s' as per the pvcRetentionPolicy", pvc.Name)
+	return nil
+}
@@ -0,0 +1,117 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/test"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// setPVCOwner makes the vdb the owner of each of the test PVCs. The
+// statefulset controller does this in a real cluster.
+func setPVCOwner(ctx context.Context, vdb *vapi.VerticaDB) {
+	sc := &vdb.Spec.Subclusters[0]
+	for i := int32(0); i < sc.Size; i++ {
+		pvc := &corev1.PersistentVolumeClaim{}
+		ExpectWithOffset(1, k8sClient.Get(ctx, names.GenPVCName(vdb, sc, i), pvc)).Should(Succeed())
+		ExpectWithOffset(1, controllerutil.SetControllerReference(vdb, pvc, k8sClient.Scheme())).Should(Succeed())
+		ExpectWithOffset(1, k8sClient.Update(ctx, pvc)).Should(Succeed())
+	}
+}
+
+// isPVCDeleted returns true if the PVC is gone or is in the process of being
+// deleted. If it is still around, the pvc-protection finalizer is removed so
+// that it doesn't interfere with the test cleanup.
+func isPVCDeleted(ctx context.Context, nm client.ObjectKey) bool {
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := k8sClient.Get(ctx, nm, pvc); err != nil {
+		ExpectWithOffset(1, errors.IsNotFound(err)).Should(BeTrue())
+		return true
+	}
+	if pvc.DeletionTimestamp == nil {
+		return false
+	}
+	patch := client.MergeFrom(pvc.DeepCopy())
+	pvc.Finalizers = nil
+	ExpectWithOffset(1, k8sClient.Patch(ctx, pvc, patch)).Should(Succeed())
+	return true
+}
+
+var _ = Describe("pvcretention", func() {
+	ctx := context.Background()
+
+	It("should delete the PVCs of pods that were scaled down if whenScaled is Delete", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters[0].Size = 3
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+		setPVCOwner(ctx, vdb)
+
+		// Simulate the scale down of the last pod
+		sc := &vdb.Spec.Subclusters[0]
+		sc.Size = 2
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, names.GenPodName(vdb, sc, 2), pod)).Should(Succeed())
+		Expect(k8sClient.Delete(ctx, pod, client.GracePeriodSeconds(0))).Should(Succeed())
+
+		// Nothing is deleted with the default policy
+		Expect(deleteScaledDownPVCs(ctx, vdbRec, logger, vdb)).Should(Succeed())
+		Expect(isPVCDeleted(ctx, names.GenPVCName(vdb, sc, 2))).Should(BeFalse())
+
+		vdb.Spec.Local.PVCRetentionPolicy = &vapi.PVCRetentionPolicy{WhenScaled: vapi.PVCDelete}
+		Expect(deleteScaledDownPVCs(ctx, vdbRec, logger, vdb)).Should(Succeed())
+		Expect(isPVCDeleted(ctx, names.GenPVCName(vdb, sc, 0))).Should(BeFalse())
+		Expect(isPVCDeleted(ctx, names.GenPVCName(vdb, sc, 1))).Should(BeFalse())
+		Expect(isPVCDeleted(ctx, names.GenPVCName(vdb, sc, 2))).Should(BeTrue())
+	})
+
+	It("should keep the PVCs after the VerticaDB is deleted if whenDeleted is Retain", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters[0].Size = 1
+		vdb.Spec.Local.PVCRetentionPolicy = &vapi.PVCRetentionPolicy{WhenDeleted: vapi.PVCRetain}
+		test.CreateVDB(ctx, k8sClient, vdb)
+		sc := &vdb.Spec.Subclusters[0]
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+		setPVCOwner(ctx, vdb)
+
+		Expect(vdbRec.reconcilePVCRetentionFinalizer(ctx, vdb)).Should(Succeed())
+		Expect(vdb.Finalizers).Should(ContainElement(vmeta.PVCRetentionFinalizer))
+
+		Expect(k8sClient.Delete(ctx, vdb)).Should(Succeed())
+		Expect(k8sClient.Get(ctx, vapi.MakeVDBName(), vdb)).Should(Succeed())
+		Expect(vdb.DeletionTimestamp).ShouldNot(BeNil())
+		Expect(vdbRec.finalizeVDB(ctx, logger, vdb)).Should(Succeed())
+		Expect(k8sClient.Get(ctx, vapi.MakeVDBName(), vdb)).ShouldNot(Succeed())
+
+		pvc := &corev1.PersistentVolumeClaim{}
+		Expect(k8sClient.Get(ctx, names.GenPVCName(vdb, sc, 0), pvc)).Should(Succeed())
+		Expect(pvc.DeletionTimestamp).Should(BeNil())
+		Expect(pvc.OwnerReferences).Should(BeEmpty())
+	})
+})
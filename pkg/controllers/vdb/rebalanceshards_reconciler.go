@@ -23,6 +23,7 @@ import (
 	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
 	"github.com/vertica/vertica-kubernetes/pkg/cmds"
 	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
 	"github.com/vertica/vertica-kubernetes/pkg/events"
 	"github.com/vertica/vertica-kubernetes/pkg/names"
 	corev1 "k8s.io/api/core/v1"
@@ -37,6 +38,13 @@ type RebalanceShardsReconciler struct {
 	PRunner cmds.PodRunner
 	PFacts  *PodFacts
 	ScName  string // Name of the subcluster to rebalance.  Leave this blank if you want to handle all subclusters.
+	// If true, the subclusters are rebalanced even if each node already has a
+	// shard subscription.
+	Force bool
+	// If true, the rebalance was explicitly requested rather than needed to
+	// give each node a shard subscription.  Since it moves subscriptions that
+	// running queries may be using, it waits for a maintenance window.
+	Voluntary bool
 }
 
 // MakeRebalanceShardsReconciler will build a RebalanceShardsReconciler object
@@ -68,6 +76,15 @@ func (s *RebalanceShardsReconciler) Reconcile(ctx context.Context, req *ctrl.Req
 		return ctrl.Result{}, nil
 	}
 
+	// Rebalancing moves shard subscriptions around, which is disruptive to
+	// running queries.  A node without a subscription can't serve anything,
+	// so we only wait for a maintenance window if the rebalance was requested.
+	if s.Voluntary {
+		if res, err := waitForMaintenanceWindow(ctx, s.VRec, s.Vdb, MaintenanceOpRebalanceShards); verrors.IsReconcileAborted(res, err) {
+			return res, err
+		}
+	}
+
 	atPod, ok := s.PFacts.findPodToRunVsql(false, "")
 	if !ok {
 		s.Log.Info("No pod found to run vsql from. Requeue reconciliation.")
@@ -91,7 +108,8 @@ func (s *RebalanceShardsReconciler) findShardsToRebalance() []string {
 	scToRebalance := []string{}
 
 	for _, pf := range s.PFacts.Detail {
-		if (s.ScName == "" || s.ScName == pf.subclusterName) && pf.isPodRunning && pf.upNode && pf.shardSubscriptions == 0 {
+		if (s.ScName == "" || s.ScName == pf.subclusterName) && pf.isPodRunning && pf.upNode &&
+			(s.Force || pf.shardSubscriptions == 0) {
 			_, ok := scRebalanceMap[pf.subclusterName]
 			if !ok {
 				scToRebalance = append(scToRebalance, pf.subclusterName)
@@ -0,0 +1,224 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// ReshardReconciler will change the number of shards in the database so that
+// it matches spec.shardCount.  After the reshard, the subclusters are
+// rebalanced and the client routing labels are refreshed since the shard
+// subscriptions of each node will have changed.
+type ReshardReconciler struct {
+	VRec    *VerticaDBReconciler
+	Log     logr.Logger
+	Vdb     *vapi.VerticaDB // Vdb is the CRD we are acting on.
+	PRunner cmds.PodRunner
+	PFacts  *PodFacts
+}
+
+// MakeReshardReconciler will build a ReshardReconciler object
+func MakeReshardReconciler(vdbrecon *VerticaDBReconciler, log logr.Logger,
+	vdb *vapi.VerticaDB, prunner cmds.PodRunner, pfacts *PodFacts) controllers.ReconcileActor {
+	return &ReshardReconciler{
+		VRec:    vdbrecon,
+		Log:     log.WithName("ReshardReconciler"),
+		Vdb:     vdb,
+		PRunner: prunner,
+		PFacts:  pfacts,
+	}
+}
+
+// Reconcile will reshard the database if spec.shardCount has changed
+func (r *ReshardReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ctrl.Result, error) {
+	// Shards only exist in Eon Mode. We skip ScheduleOnly as the operator
+	// doesn't manage the database.
+	if !r.Vdb.IsEON() || r.Vdb.Spec.InitPolicy == vapi.CommunalInitPolicyScheduleOnly {
+		return ctrl.Result{}, nil
+	}
+	if r.Vdb.Status.ShardCount == r.Vdb.Spec.ShardCount && !r.Vdb.IsReshardInProgress() {
+		// The shard count may have been changed back while the reshard was
+		// waiting for a maintenance window.
+		return ctrl.Result{}, clearDeferredOperation(ctx, r.VRec, r.Vdb, MaintenanceOpReshard)
+	}
+	if isSet, err := r.Vdb.IsConditionSet(vapi.DBInitialized); !isSet || err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.PFacts.Collect(ctx, r.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+	pf, ok := r.PFacts.findPodToRunVsql(false, "")
+	if !ok {
+		r.Log.Info("No pod found to run vsql from. Requeue reconciliation.")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	dbShardCount, err := r.fetchShardCount(ctx, pf)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if dbShardCount != r.Vdb.Spec.ShardCount {
+		if res, err2 := r.reshardDatabase(ctx, pf, dbShardCount); verrors.IsReconcileAborted(res, err2) {
+			return res, err2
+		}
+	}
+	// The follow up is only needed if we resharded the database. Otherwise,
+	// the reshard was skipped or the status just hasn't caught up with the
+	// database yet, which is the case the first time we get here.
+	if !r.Vdb.IsReshardInProgress() {
+		if r.Vdb.Status.ShardCount == dbShardCount {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, r.updateStatus(ctx, dbShardCount, "")
+	}
+
+	if res, err := r.followUpReshard(ctx); verrors.IsReconcileAborted(res, err) {
+		return res, err
+	}
+	return ctrl.Result{}, r.finishReshard(ctx)
+}
+
+// fetchShardCount will query the database for the number of segment shards it
+// has.  The replica shard is not included in spec.shardCount.
+func (r *ReshardReconciler) fetchShardCount(ctx context.Context, pf *PodFact) (int, error) {
+	sql := "select count(*) from shards where shard_type != 'Replica'"
+	stdout, _, err := r.PRunner.ExecVSQL(ctx, pf.name, names.ServerContainer, "-tAc", sql)
+	if err != nil {
+		return 0, err
+	}
+	cnt, err := strconv.Atoi(strings.TrimSpace(stdout))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse the shard count from output '%s': %w", stdout, err)
+	}
+	return cnt, nil
+}
+
+// reshardDatabase will call reshard_database to change the number of shards to
+// match the spec.  If the reshard can't be done, the current shard count is
+// saved in the status and an empty result is returned.
+func (r *ReshardReconciler) reshardDatabase(ctx context.Context, pf *PodFact, dbShardCount int) (ctrl.Result, error) {
+	vinf, ok := r.Vdb.MakeVersionInfo()
+	if !ok || !vinf.IsEqualOrNewer(vapi.ReshardMinVersion) {
+		if r.Vdb.Status.ShardCount != dbShardCount {
+			r.VRec.Eventf(r.Vdb, corev1.EventTypeWarning, events.ReshardNotSupported,
+				"Cannot change the shard count from %d to %d. The server version must be %s or newer",
+				dbShardCount, r.Vdb.Spec.ShardCount, vapi.ReshardMinVersion)
+		}
+		return ctrl.Result{}, r.updateStatus(ctx, dbShardCount, "")
+	}
+
+	// Every node must be up for the reshard. We ignore subclusters that
+	// were shut down on purpose.
+	downPods := r.PFacts.filterPods(func(v *PodFact) bool {
+		return !v.upNode && !v.shutdown
+	})
+	if len(downPods) > 0 {
+		r.Log.Info("Requeue reshard because some nodes are down", "downPodCount", len(downPods))
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	// The reshard puts a lock on the catalog and moves every shard
+	// subscription, so it waits for a maintenance window.
+	if deferred, err := deferToMaintenanceWindow(ctx, r.VRec, r.Vdb, MaintenanceOpReshard); deferred || err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := vdbstatus.UpdateCondition(ctx, r.VRec.Client, r.Vdb,
+		vapi.VerticaDBCondition{Type: vapi.ReshardInProgress, Status: corev1.ConditionTrue}); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.updateStatus(ctx, dbShardCount,
+		fmt.Sprintf("Resharding from %d to %d shards", dbShardCount, r.Vdb.Spec.ShardCount)); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.VRec.Eventf(r.Vdb, corev1.EventTypeNormal, events.ReshardStarted,
+		"Starting reshard of the database from %d to %d shards", dbShardCount, r.Vdb.Spec.ShardCount)
+
+	sql := fmt.Sprintf("select reshard_database(%d);", r.Vdb.Spec.ShardCount)
+	_, stderr, err := r.PRunner.ExecVSQL(ctx, pf.name, names.ServerContainer, "-tAc", sql)
+	if err != nil {
+		r.VRec.Eventf(r.Vdb, corev1.EventTypeWarning, events.ReshardFailed,
+			"Failed to reshard the database to %d shards: %s", r.Vdb.Spec.ShardCount, stderr)
+		return ctrl.Result{}, err
+	}
+	r.VRec.Eventf(r.Vdb, corev1.EventTypeNormal, events.ReshardSucceeded,
+		"Successfully resharded the database to %d shards", r.Vdb.Spec.ShardCount)
+	r.PFacts.Invalidate()
+	return ctrl.Result{}, nil
+}
+
+// followUpReshard will do the steps that are needed after the reshard. The
+// shards are rebalanced in each subcluster, then the client routing labels are
+// updated to reflect the new shard subscriptions.
+func (r *ReshardReconciler) followUpReshard(ctx context.Context) (ctrl.Result, error) {
+	if err := r.updateStatus(ctx, r.Vdb.Spec.ShardCount, "Rebalancing shards"); err != nil {
+		return ctrl.Result{}, err
+	}
+	actors := []controllers.ReconcileActor{
+		&RebalanceShardsReconciler{
+			VRec:    r.VRec,
+			Log:     r.Log,
+			Vdb:     r.Vdb,
+			PRunner: r.PRunner,
+			PFacts:  r.PFacts,
+			Force:   true,
+		},
+		MakeClientRoutingLabelReconciler(r.VRec, r.Vdb, r.PFacts, ReshardApplyMethod, ""),
+	}
+	for _, act := range actors {
+		if res, err := act.Reconcile(ctx, &ctrl.Request{}); verrors.IsReconcileAborted(res, err) {
+			return res, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// finishReshard will clear the reshard condition and status message
+func (r *ReshardReconciler) finishReshard(ctx context.Context) error {
+	if err := r.updateStatus(ctx, r.Vdb.Spec.ShardCount, ""); err != nil {
+		return err
+	}
+	if !r.Vdb.IsReshardInProgress() {
+		return nil
+	}
+	return vdbstatus.UpdateCondition(ctx, r.VRec.Client, r.Vdb,
+		vapi.VerticaDBCondition{Type: vapi.ReshardInProgress, Status: corev1.ConditionFalse})
+}
+
+// updateStatus will save the shard count and reshard message in the status
+func (r *ReshardReconciler) updateStatus(ctx context.Context, shardCount int, msg string) error {
+	return vdbstatus.Update(ctx, r.VRec.Client, r.Vdb, func(vdbChg *vapi.VerticaDB) error {
+		vdbChg.Status.ShardCount = shardCount
+		vdbChg.Status.ReshardStatus = msg
+		return nil
+	})
+}
@@ -0,0 +1,114 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("reshard_reconcile", func() {
+	ctx := context.Background()
+
+	// setShardCountResult will have every pod return the given output for the
+	// query of the shard count.
+	setShardCountResult := func(fpr *cmds.FakePodRunner, pfacts *PodFacts, stdout string) {
+		fpr.Results = cmds.CmdResults{}
+		for pn := range pfacts.Detail {
+			fpr.Results[pn] = []cmds.CmdResult{{Stdout: stdout}}
+		}
+	}
+
+	It("should reshard the database and rebalance the subclusters", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Annotations[vapi.VersionAnnotation] = vapi.ReshardMinVersion
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		setShardCountResult(fpr, pfacts, "6\n")
+		r := MakeReshardReconciler(vdbRec, logger, vdb, fpr, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+
+		Expect(fpr.FindCommands("select reshard_database(12);")).Should(HaveLen(1))
+		Expect(fpr.FindCommands("select rebalance_shards('defaultsubcluster')")).Should(HaveLen(1))
+		Expect(vdb.Status.ShardCount).Should(Equal(12))
+		Expect(vdb.Status.ReshardStatus).Should(Equal(""))
+		Expect(vdb.IsReshardInProgress()).Should(BeFalse())
+	})
+
+	It("should not reshard if the server version is too old", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Annotations[vapi.VersionAnnotation] = vapi.MinimumVersion
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		setShardCountResult(fpr, pfacts, "6\n")
+		r := MakeReshardReconciler(vdbRec, logger, vdb, fpr, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+
+		Expect(fpr.FindCommands("reshard_database")).Should(BeEmpty())
+		Expect(vdb.Status.ShardCount).Should(Equal(6))
+		Expect(vdb.IsReshardInProgress()).Should(BeFalse())
+	})
+
+	It("should do nothing if the shard count in the status matches the spec", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Annotations[vapi.VersionAnnotation] = vapi.ReshardMinVersion
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+		Expect(vdbstatus.Update(ctx, k8sClient, vdb, func(vdbChg *vapi.VerticaDB) error {
+			vdbChg.Status.ShardCount = vdb.Spec.ShardCount
+			return nil
+		})).Should(Succeed())
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		r := MakeReshardReconciler(vdbRec, logger, vdb, fpr, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(fpr.Histories).Should(BeEmpty())
+	})
+
+	It("should only record the shard count if the database already matches the spec", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Annotations[vapi.VersionAnnotation] = vapi.ReshardMinVersion
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		setShardCountResult(fpr, pfacts, "12\n")
+		r := MakeReshardReconciler(vdbRec, logger, vdb, fpr, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+
+		Expect(fpr.FindCommands("reshard_database")).Should(BeEmpty())
+		Expect(fpr.FindCommands("rebalance_shards")).Should(BeEmpty())
+		Expect(vdb.Status.ShardCount).Should(Equal(12))
+		Expect(vdb.IsReshardInProgress()).Should(BeFalse())
+	})
+})
@@ -28,6 +28,7 @@ import (
 	"github.com/vertica/vertica-kubernetes/pkg/events"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
@@ -40,6 +41,8 @@ type ResizePVReconcile struct {
 	Vdb     *vapi.VerticaDB
 	PRunner cmds.PodRunner
 	PFacts  *PodFacts
+	// Set to true if a PVC resize was deferred to a maintenance window
+	resizeDeferred bool
 }
 
 // MakeResizePVReconciler will build and return the ResizePVReconcile object.
@@ -71,32 +74,56 @@ func (r *ResizePVReconcile) Reconcile(ctx context.Context, req *ctrl.Request) (c
 		}
 	}
 
+	// A resize that was deferred isn't needed anymore if every PVC already
+	// has the size in the spec.  The size may have been reverted while we
+	// were waiting for a maintenance window.
+	if returnRes == (ctrl.Result{}) && !r.resizeDeferred {
+		return returnRes, clearDeferredOperation(ctx, r.VRec, r.Vdb, MaintenanceOpResizePVC)
+	}
 	return returnRes, nil
 }
 
-// reconcilePod will handle a single pod to see if its PV needs to be resized
+// reconcilePod will handle a single pod to see if any of its PVs need to be
+// resized
 func (r *ResizePVReconcile) reconcilePod(ctx context.Context, pf *PodFact) (ctrl.Result, error) {
-	pvcName := types.NamespacedName{
-		Namespace: pf.name.Namespace,
-		Name:      fmt.Sprintf("%s-%s", vapi.LocalDataPVC, pf.name.Name),
-	}
-	pvc := &corev1.PersistentVolumeClaim{}
-	if err := r.VRec.Client.Get(ctx, pvcName, pvc); err != nil {
-		if errors.IsNotFound(err) {
-			r.VRec.Log.Info("PVC was not found. Requeuing.", "pvc", pvcName)
-			return ctrl.Result{Requeue: true}, nil
+	returnRes := ctrl.Result{}
+	localPVCs := r.Vdb.GetLocalPVCs()
+	for i := range localPVCs {
+		pvcName := genLocalPVCName(&localPVCs[i], pf)
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := r.VRec.Client.Get(ctx, pvcName, pvc); err != nil {
+			if errors.IsNotFound(err) {
+				r.VRec.Log.Info("PVC was not found. Requeuing.", "pvc", pvcName)
+				returnRes = ctrl.Result{Requeue: true}
+				continue
+			}
+			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, err
-	}
 
-	return r.reconcilePvc(ctx, pf, pvc)
+		if res, err := r.reconcilePvc(ctx, pf, &localPVCs[i], pvc); verrors.IsReconcileAborted(res, err) {
+			if err != nil {
+				return res, err
+			}
+			returnRes = res
+		}
+	}
+	return returnRes, nil
 }
 
 // reconcilePvc will handle a single PVC and see if it needs to be resized
-func (r *ResizePVReconcile) reconcilePvc(ctx context.Context, pf *PodFact, pvc *corev1.PersistentVolumeClaim) (ctrl.Result, error) {
+func (r *ResizePVReconcile) reconcilePvc(ctx context.Context, pf *PodFact, localPVC *vapi.LocalPVC,
+	pvc *corev1.PersistentVolumeClaim) (ctrl.Result, error) {
 	// Resize is necessary if the PVC storage is smaller than the size in the vdb
-	if pvc.Spec.Resources.Requests.Storage().Cmp(r.Vdb.Spec.Local.RequestSize) < 0 {
-		return r.updatePVC(ctx, pvc)
+	if pvc.Spec.Resources.Requests.Storage().Cmp(localPVC.RequestSize) < 0 {
+		// Some storage providers need to restart the pod to finish the
+		// expansion, so we only start it in a maintenance window.  The PVC is
+		// left alone until then.
+		deferred, err := deferToMaintenanceWindow(ctx, r.VRec, r.Vdb, MaintenanceOpResizePVC)
+		if deferred || err != nil {
+			r.resizeDeferred = r.resizeDeferred || deferred
+			return ctrl.Result{}, err
+		}
+		return r.updatePVC(ctx, pvc, localPVC.RequestSize)
 	}
 
 	// We are done with the PVC if the spec <= capacity size in the PVC.  It
@@ -104,7 +131,13 @@ func (r *ResizePVReconcile) reconcilePvc(ctx context.Context, pf *PodFact, pvc *
 	// larger than what was requested.  GCP rounds up to the nearest GB for
 	// instance.
 	if pvc.Spec.Resources.Requests.Storage().Cmp(*pvc.Status.Capacity.Storage()) <= 0 {
-		return r.updateDepotSize(ctx, pvc, pf)
+		// Only the PVC that holds the depot needs a follow up in vertica.  The
+		// local data PVC is still passed through when the depot is an
+		// emptyDir so that we report why the depot wasn't resized.
+		if !localPVC.HasDepot && !(localPVC.Name == vapi.LocalDataPVC && r.Vdb.IsDepotVolumeEmptyDir()) {
+			return ctrl.Result{}, nil
+		}
+		return r.updateDepotSize(ctx, pvc, localPVC, pf)
 	}
 
 	// Requeue to wait for the PVC to be expanded.
@@ -113,7 +146,8 @@ func (r *ResizePVReconcile) reconcilePvc(ctx context.Context, pf *PodFact, pvc *
 }
 
 // updatePVC will update the PVCs size with the size in the vdb.
-func (r *ResizePVReconcile) updatePVC(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (ctrl.Result, error) {
+func (r *ResizePVReconcile) updatePVC(ctx context.Context, pvc *corev1.PersistentVolumeClaim,
+	requestSize resource.Quantity) (ctrl.Result, error) {
 	nm := types.NamespacedName{
 		Name:      pvc.Name,
 		Namespace: pvc.Namespace,
@@ -124,7 +158,7 @@ func (r *ResizePVReconcile) updatePVC(ctx context.Context, pvc *corev1.Persisten
 			return err
 		}
 
-		fetchedPVC.Spec.Resources.Requests[corev1.ResourceStorage] = r.Vdb.Spec.Local.RequestSize
+		fetchedPVC.Spec.Resources.Requests[corev1.ResourceStorage] = requestSize
 		return r.VRec.Client.Update(ctx, fetchedPVC)
 	})
 
@@ -146,7 +180,7 @@ func (r *ResizePVReconcile) updatePVC(ctx context.Context, pvc *corev1.Persisten
 
 // updateDepotSize will call alter_location_size in vertica if necessary
 func (r *ResizePVReconcile) updateDepotSize(ctx context.Context, pvc *corev1.PersistentVolumeClaim,
-	pf *PodFact) (ctrl.Result, error) {
+	localPVC *vapi.LocalPVC, pf *PodFact) (ctrl.Result, error) {
 	if r.Vdb.IsDepotVolumeEmptyDir() {
 		r.VRec.Eventf(r.Vdb, corev1.EventTypeWarning, events.SkipDepotResize,
 			"Skipping depot resize for pod '%s' because its volume is an emptyDir.",
@@ -170,7 +204,7 @@ func (r *ResizePVReconcile) updateDepotSize(ctx context.Context, pvc *corev1.Per
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("cannot convert depot disk percent (%s) to an int: %w", pf.depotDiskPercentSize, err)
 	}
-	curLocalDataSize, err := r.getLocalDataSize(pvc, pf)
+	curLocalDataSize, err := r.getLocalDataSize(pvc, localPVC, pf)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -200,17 +234,22 @@ func (r *ResizePVReconcile) updateDepotSize(ctx context.Context, pvc *corev1.Per
 }
 
 // getLocalDataSize returns the size of the mount that contains the depot
-func (r *ResizePVReconcile) getLocalDataSize(pvc *corev1.PersistentVolumeClaim, pf *PodFact) (int64, error) {
+func (r *ResizePVReconcile) getLocalDataSize(pvc *corev1.PersistentVolumeClaim, localPVC *vapi.LocalPVC,
+	pf *PodFact) (int64, error) {
+	diskSize := pf.localDataSize
+	if localPVC.Name != vapi.LocalDataPVC {
+		diskSize = pf.volumeSize[localPVC.Name]
+	}
 	// If the output is empty, we will use the size from the PVC.  These is here
 	// for test purposes.  The PVC capacity was close to 100mb larger than then
 	// disk size that Vertica calculates, which is why it isn't preferred way of
 	// calculating.
-	if pf.localDataSize == 0 {
+	if diskSize == 0 {
 		curCapacity, ok := pvc.Status.Capacity.Storage().AsInt64()
 		if !ok {
 			return 0, fmt.Errorf("cannot get capacity as int64: %s", pvc.Status.Capacity.Storage().String())
 		}
 		return curCapacity, nil
 	}
-	return int64(pf.localDataSize), nil
+	return int64(diskSize), nil
 }
@@ -17,15 +17,19 @@ package vdb
 
 import (
 	"context"
+	"fmt"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/builder"
 	"github.com/vertica/vertica-kubernetes/pkg/cmds"
 	"github.com/vertica/vertica-kubernetes/pkg/names"
 	"github.com/vertica/vertica-kubernetes/pkg/test"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -84,6 +88,59 @@ var _ = Describe("resizepv_reconcile", func() {
 		// Run reconciler to update vertica.  This will requeue because database isn't up
 		runResizePVReconciler(ctx, vdb, true, false)
 	})
+
+	It("should resize the depot PVC separately from the local data PVC", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters[0].Size = 1
+		vdb.Spec.Local.DepotPVC = &vapi.LocalVolumeClaim{
+			StorageClass: builder.TestStorageClassName,
+			RequestSize:  resource.MustParse("10Gi"),
+		}
+		test.CreateStorageClass(ctx, k8sClient, true)
+		defer test.DeleteStorageClass(ctx, k8sClient)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+		depotPVCName := types.NamespacedName{
+			Namespace: pn.Namespace,
+			Name:      fmt.Sprintf("%s-%s", vapi.LocalDepotPVC, pn.Name),
+		}
+		scn := builder.TestStorageClassName
+		depotPVC := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      depotPVCName.Name,
+				Namespace: depotPVCName.Namespace,
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOnce"},
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: vdb.Spec.Local.DepotPVC.RequestSize},
+				},
+				StorageClassName: &scn,
+			},
+		}
+		Expect(k8sClient.Create(ctx, depotPVC)).Should(Succeed())
+		defer func() { Expect(k8sClient.Delete(ctx, depotPVC)).Should(Succeed()) }()
+		depotPVC.Status.Phase = corev1.ClaimBound
+		depotPVC.Status.Capacity = depotPVC.Spec.Resources.Requests
+		Expect(k8sClient.Status().Update(ctx, depotPVC)).Should(Succeed())
+
+		Expect(k8sClient.Get(ctx, vdb.ExtractNamespacedName(), vdb)).Should(Succeed())
+		vdb.Spec.Local.DepotPVC.RequestSize = resource.MustParse(NewPVSize)
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+		// Only the depot PVC should be expanded
+		runResizePVReconciler(ctx, vdb, true, false)
+		Expect(k8sClient.Get(ctx, depotPVCName, depotPVC)).Should(Succeed())
+		Expect(depotPVC.Spec.Resources.Requests.Storage().Equal(resource.MustParse(NewPVSize))).Should(BeTrue())
+		checkPVCSize(ctx, vdb, true)
+
+		depotPVC.Status.Capacity = depotPVC.Spec.Resources.Requests
+		Expect(k8sClient.Status().Update(ctx, depotPVC)).Should(Succeed())
+		runResizePVReconciler(ctx, vdb, false, true)
+	})
 })
 
 func resizeLocalStorage(ctx context.Context, vdb *vapi.VerticaDB, newSize string) {
@@ -211,6 +211,10 @@ func (r *RestartReconciler) reconcileNodes(ctx context.Context) (ctrl.Result, er
 	// Always skip the transient pods since they only run the old image so they
 	// can't be restarted.
 	downPods := r.PFacts.findRestartablePods(r.RestartReadOnly, false)
+	downPods, err := r.deferReadOnlyRestarts(ctx, downPods)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 	// This is too make sure all pods have signed they EULA before running
 	// admintools on any of them.
 	if err := r.acceptEulaIfMissing(ctx); err != nil {
@@ -302,6 +306,42 @@ func (r *RestartReconciler) restartPods(ctx context.Context, pods []*PodFact) (c
 	return ctrl.Result{}, nil
 }
 
+// deferReadOnlyRestarts will remove the read-only pods from the list if they
+// have to wait for a maintenance window.  Restarting them kills the vertica
+// process, which interrupts the queries they are still serving.  This doesn't
+// apply during an upgrade, which has already waited for a window.
+func (r *RestartReconciler) deferReadOnlyRestarts(ctx context.Context, pods []*PodFact) ([]*PodFact, error) {
+	readOnlyCount := 0
+	for _, pod := range pods {
+		if pod.readOnly {
+			readOnlyCount++
+		}
+	}
+	if readOnlyCount == 0 {
+		// A deferred restart isn't needed anymore once none of the nodes
+		// are read-only.
+		if r.RestartReadOnly {
+			return pods, clearDeferredOperation(ctx, r.VRec, r.Vdb, MaintenanceOpRestart)
+		}
+		return pods, nil
+	}
+	if isSet, err := r.Vdb.IsConditionSet(vapi.ImageChangeInProgress); isSet || err != nil {
+		return pods, err
+	}
+	deferred, err := deferToMaintenanceWindow(ctx, r.VRec, r.Vdb, MaintenanceOpRestart)
+	if !deferred || err != nil {
+		return pods, err
+	}
+	r.Log.Info("Deferring restart of read-only nodes", "readOnlyCount", readOnlyCount)
+	downPods := []*PodFact{}
+	for _, pod := range pods {
+		if !pod.readOnly {
+			downPods = append(downPods, pod)
+		}
+	}
+	return downPods, nil
+}
+
 // removePodsWithClusterUpState will see if the pods in the down list are
 // down according to the cluster state. This will return a new pod list with the
 // pods that aren't considered down removed.
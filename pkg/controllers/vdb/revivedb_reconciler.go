@@ -26,6 +26,7 @@ import (
 	"github.com/vertica/vertica-kubernetes/pkg/controllers"
 	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
 	"github.com/vertica/vertica-kubernetes/pkg/events"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
 	"github.com/vertica/vertica-kubernetes/pkg/names"
 	"github.com/vertica/vertica-kubernetes/pkg/paths"
 	"github.com/vertica/vertica-kubernetes/pkg/reviveplanner"
@@ -35,9 +36,11 @@ import (
 	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/revivedb"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // ReviveDBReconciler will revive a database if one doesn't exist in the vdb yet.
@@ -50,6 +53,8 @@ type ReviveDBReconciler struct {
 	Planr               reviveplanner.Planner
 	Dispatcher          vadmin.Dispatcher
 	ConfigurationParams *vtypes.CiMap
+	// Restore, if set, is the VerticaRestore whose restore point we revive from
+	Restore *vapi.VerticaRestore
 }
 
 // MakeReviveDBReconciler will build a ReviveDBReconciler object
@@ -62,12 +67,21 @@ func MakeReviveDBReconciler(vdbrecon *VerticaDBReconciler, log logr.Logger,
 		Vdb:                 vdb,
 		PRunner:             prunner,
 		PFacts:              pfacts,
-		Planr:               reviveplanner.MakeATPlanner(log),
+		Planr:               makeRevivePlanner(log, vdb),
 		Dispatcher:          dispatcher,
 		ConfigurationParams: vtypes.MakeCiMap(),
 	}
 }
 
+// makeRevivePlanner will create a revive planner that can parse the describe
+// output of the dispatcher in use for the vdb.
+func makeRevivePlanner(log logr.Logger, vdb *vapi.VerticaDB) reviveplanner.Planner {
+	if vmeta.UseVClusterOps(vdb.Annotations) {
+		return reviveplanner.MakeVCPlanner(log)
+	}
+	return reviveplanner.MakeATPlanner(log)
+}
+
 // Reconcile will ensure a DB exists and revive one if it doesn't
 func (r *ReviveDBReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ctrl.Result, error) {
 	// Skip this reconciler entirely if the init policy is to create the DB.
@@ -92,17 +106,91 @@ func (r *ReviveDBReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (
 // execCmd will do the actual execution of revive DB.
 // This handles logging of necessary events.
 func (r *ReviveDBReconciler) execCmd(ctx context.Context, initiatorPod types.NamespacedName, hostList []string) (ctrl.Result, error) {
+	if res, err := r.findRestore(ctx); verrors.IsReconcileAborted(res, err) {
+		return res, err
+	}
 	opts := r.genReviveOpts(initiatorPod, hostList)
+	if r.Restore != nil {
+		r.VRec.Eventf(r.Vdb, corev1.EventTypeNormal, events.ReviveFromRestorePoint,
+			"Reviving database from restore point in archive '%s' as requested by VerticaRestore '%s'",
+			r.Restore.Spec.ArchiveName, r.Restore.Name)
+		if err := r.updateRestoreStatus(ctx, vapi.RestoreInProgress, "Reviving database from restore point"); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 	r.VRec.Event(r.Vdb, corev1.EventTypeNormal, events.ReviveDBStart, "Starting revive database")
 	start := time.Now()
 	if res, err := r.Dispatcher.ReviveDB(ctx, opts...); verrors.IsReconcileAborted(res, err) {
+		if r.Restore != nil {
+			// Fail the restore so that it is clear to the user that the revive
+			// from the restore point didn't happen. findRestore will hold off
+			// any further revive until the user deals with it.
+			msg := "Revive from the restore point failed. See the events of the VerticaDB for the reason"
+			if err != nil {
+				msg = fmt.Sprintf("Revive from the restore point failed: %s", err)
+			}
+			if err2 := r.updateRestoreStatus(ctx, vapi.RestoreFailed, msg); err2 != nil {
+				r.Log.Error(err2, "failed to update the VerticaRestore status", "name", r.Restore.Name)
+			}
+		}
 		return res, err
 	}
 	r.VRec.Eventf(r.Vdb, corev1.EventTypeNormal, events.ReviveDBSucceeded,
 		"Successfully revived database. It took %s", time.Since(start))
+	if r.Restore != nil {
+		return ctrl.Result{}, r.updateRestoreStatus(ctx, vapi.RestoreSucceeded, "")
+	}
+	return ctrl.Result{}, nil
+}
+
+// findRestore will look for a VerticaRestore that wants this database revived
+// from a restore point. If there is more than one, the oldest is used. We
+// requeue if a VerticaRestore exists that hasn't been validated yet, or one
+// that has failed, so that we don't revive from the latest state by accident.
+func (r *ReviveDBReconciler) findRestore(ctx context.Context) (ctrl.Result, error) {
+	restores := &vapi.VerticaRestoreList{}
+	if err := r.VRec.Client.List(ctx, restores, client.InNamespace(r.Vdb.Namespace)); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.Restore = nil
+	for i := range restores.Items {
+		vrs := &restores.Items[i]
+		if vrs.Spec.VerticaDBName != r.Vdb.Name || vrs.Status.State == vapi.RestoreSucceeded {
+			continue
+		}
+		if vrs.Status.State == vapi.RestoreFailed {
+			r.VRec.Eventf(r.Vdb, corev1.EventTypeWarning, events.RestorePointReviveBlocked,
+				"Revive is blocked because VerticaRestore '%s' failed. Delete it to revive from the latest state, "+
+					"or replace it to retry the restore", vrs.Name)
+			return ctrl.Result{Requeue: true}, nil
+		}
+		if vrs.Status.State == "" {
+			r.Log.Info("VerticaRestore has not been validated yet. Requeue reconciliation.", "name", vrs.Name)
+			return ctrl.Result{Requeue: true}, nil
+		}
+		if r.Restore == nil || vrs.CreationTimestamp.Before(&r.Restore.CreationTimestamp) {
+			r.Restore = vrs
+		}
+	}
 	return ctrl.Result{}, nil
 }
 
+// updateRestoreStatus will update the state of the VerticaRestore we are
+// reviving from.
+func (r *ReviveDBReconciler) updateRestoreStatus(ctx context.Context, state, msg string) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		if err := r.VRec.Client.Get(ctx, r.Restore.ExtractNamespacedName(), r.Restore); err != nil {
+			return err
+		}
+		r.Restore.Status.State = state
+		r.Restore.Status.Message = msg
+		if state == vapi.RestoreSucceeded {
+			r.Restore.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+		}
+		return r.VRec.Client.Status().Update(ctx, r.Restore)
+	})
+}
+
 // preCmdSetup is going to run revive with --display-only then validate and
 // fix-up any mismatch it finds.
 func (r *ReviveDBReconciler) preCmdSetup(ctx context.Context, initiatorPod types.NamespacedName, podList []*PodFact) (ctrl.Result, error) {
@@ -224,6 +312,10 @@ func (r *ReviveDBReconciler) genReviveOpts(initiatorPod types.NamespacedName, ho
 	if r.Vdb.Spec.IgnoreClusterLease {
 		opts = append(opts, revivedb.WithIgnoreClusterLease())
 	}
+	if r.Restore != nil {
+		opts = append(opts, revivedb.WithRestorePoint(r.Restore.Spec.ArchiveName,
+			r.Restore.Spec.RestorePointIndex, r.Restore.Spec.RestorePointID))
+	}
 	return opts
 }
 
@@ -271,7 +363,7 @@ func (r *ReviveDBReconciler) runRevivePrepass(ctx context.Context, initiatorPod
 }
 
 func (r *ReviveDBReconciler) runRevivePlanner(ctx context.Context, op string) (ctrl.Result, error) {
-	// Parse the JSON output we get from the AT command.
+	// Parse the output we get from the describe command.
 	if err := r.Planr.Parse(op); err != nil {
 		return ctrl.Result{}, err
 	}
@@ -17,11 +17,14 @@ package vdb
 
 import (
 	"context"
+	"errors"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
 	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
 	"github.com/vertica/vertica-kubernetes/pkg/names"
 	"github.com/vertica/vertica-kubernetes/pkg/reviveplanner"
 	"github.com/vertica/vertica-kubernetes/pkg/test"
@@ -110,6 +113,74 @@ var _ = Describe("revivedb_reconcile", func() {
 		Expect(parms.IgnoreClusterLease).Should(BeTrue())
 	})
 
+	It("should revive from the restore point of a pending VerticaRestore", func() {
+		vdb := vapi.MakeVDB()
+		vrs := vapi.MakeVRS()
+		vrs.Spec.RestorePointIndex = 3
+		Expect(k8sClient.Create(ctx, vrs)).Should(Succeed())
+		defer func() { Expect(k8sClient.Delete(ctx, vrs)).Should(Succeed()) }()
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := MakePodFacts(vdbRec, fpr)
+		dispatcher := vdbRec.makeDispatcher(logger, vdb, fpr, TestPassword)
+		act := MakeReviveDBReconciler(vdbRec, logger, vdb, fpr, &pfacts, dispatcher)
+		r := act.(*ReviveDBReconciler)
+
+		// The restore hasn't been validated yet, so we must wait
+		Expect(r.findRestore(ctx)).Should(Equal(ctrl.Result{Requeue: true}))
+
+		vrs.Status.State = vapi.RestorePending
+		Expect(k8sClient.Status().Update(ctx, vrs)).Should(Succeed())
+		Expect(r.findRestore(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(r.Restore).ShouldNot(BeNil())
+		opts := r.genReviveOpts(types.NamespacedName{}, []string{"hostA"})
+		parms := revivedb.Parms{}
+		parms.Make(opts...)
+		Expect(parms.RestorePointArchive).Should(Equal(vrs.Spec.ArchiveName))
+		Expect(parms.RestorePointIndex).Should(Equal(3))
+
+		Expect(r.updateRestoreStatus(ctx, vapi.RestoreSucceeded, "")).Should(Succeed())
+		fetchVrs := &vapi.VerticaRestore{}
+		Expect(k8sClient.Get(ctx, vrs.ExtractNamespacedName(), fetchVrs)).Should(Succeed())
+		Expect(fetchVrs.Status.State).Should(Equal(vapi.RestoreSucceeded))
+		Expect(fetchVrs.Status.CompletionTime).ShouldNot(BeNil())
+
+		// A finished restore is never picked again
+		Expect(r.findRestore(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(r.Restore).Should(BeNil())
+	})
+
+	It("should fail the VerticaRestore if the revive fails and block further revives", func() {
+		vdb := vapi.MakeVDB()
+		vrs := vapi.MakeVRS()
+		vrs.Spec.RestorePointIndex = 1
+		Expect(k8sClient.Create(ctx, vrs)).Should(Succeed())
+		defer func() { Expect(k8sClient.Delete(ctx, vrs)).Should(Succeed()) }()
+		vrs.Status.State = vapi.RestorePending
+		Expect(k8sClient.Status().Update(ctx, vrs)).Should(Succeed())
+
+		initiator := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+		fpr := &cmds.FakePodRunner{Results: cmds.CmdResults{
+			initiator: []cmds.CmdResult{
+				{}, // copy auth parms
+				{Err: errors.New("revive failed"), Stdout: "Error: restore point not found"},
+			},
+		}}
+		pfacts := MakePodFacts(vdbRec, fpr)
+		dispatcher := vdbRec.makeDispatcher(logger, vdb, fpr, TestPassword)
+		act := MakeReviveDBReconciler(vdbRec, logger, vdb, fpr, &pfacts, dispatcher)
+		r := act.(*ReviveDBReconciler)
+		res, err := r.execCmd(ctx, initiator, []string{"hostA"})
+		Expect(verrors.IsReconcileAborted(res, err)).Should(BeTrue())
+
+		fetchVrs := &vapi.VerticaRestore{}
+		Expect(k8sClient.Get(ctx, vrs.ExtractNamespacedName(), fetchVrs)).Should(Succeed())
+		Expect(fetchVrs.Status.State).Should(Equal(vapi.RestoreFailed))
+
+		// We must not fall back to reviving from the latest state
+		Expect(r.findRestore(ctx)).Should(Equal(ctrl.Result{Requeue: true}))
+	})
+
 	It("should use reviveOrder to order the host list", func() {
 		vdb := vapi.MakeVDB()
 		vdb.Spec.Subclusters = []vapi.Subcluster{
@@ -281,4 +352,22 @@ var _ = Describe("revivedb_reconcile", func() {
 		Expect(act.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{Requeue: true}))
 		Expect(k8sClient.Get(ctx, pn, &pod)).ShouldNot(Succeed())
 	})
+
+	It("should pick the revive planner that matches the dispatcher", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.InitPolicy = vapi.CommunalInitPolicyRevive
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := MakePodFacts(vdbRec, fpr)
+		dispatcher := vdbRec.makeDispatcher(logger, vdb, fpr, TestPassword)
+		act := MakeReviveDBReconciler(vdbRec, logger, vdb, fpr, &pfacts, dispatcher)
+		r := act.(*ReviveDBReconciler)
+		Expect(r.Planr).Should(BeAssignableToTypeOf(&reviveplanner.ATPlanner{}))
+
+		vdb.Annotations[vmeta.VClusterOpsAnnotation] = vmeta.VClusterOpsAnnotationTrue
+		dispatcher = vdbRec.makeDispatcher(logger, vdb, fpr, TestPassword)
+		act = MakeReviveDBReconciler(vdbRec, logger, vdb, fpr, &pfacts, dispatcher)
+		r = act.(*ReviveDBReconciler)
+		Expect(r.Planr).Should(BeAssignableToTypeOf(&reviveplanner.VCPlanner{}))
+	})
 })
@@ -63,6 +63,13 @@ func (s *StatusReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ct
 	}
 
 	refreshStatus := func(vdbChg *vapi.VerticaDB) error {
+		// The subcluster type is maintained by the SubclusterTypeReconciler
+		// and the statefulset name by the SubclusterRenameReconciler. We
+		// carry them forward for each subcluster.
+		prevStatus := map[string]vapi.SubclusterStatus{}
+		for i := range vdbChg.Status.Subclusters {
+			prevStatus[vdbChg.Status.Subclusters[i].Name] = vdbChg.Status.Subclusters[i]
+		}
 		vdbChg.Status.Subclusters = []vapi.SubclusterStatus{}
 		for i := range subclusters {
 			if i == len(vdbChg.Status.Subclusters) {
@@ -72,6 +79,7 @@ func (s *StatusReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ct
 			if i < len(s.Vdb.Status.Subclusters) {
 				vdbChg.Status.Subclusters[i].Oid = s.Vdb.Status.Subclusters[i].Oid
 			}
+			vdbChg.Status.Subclusters[i].Type = prevStatus[subclusters[i].Name].Type
 			if err := s.calculateSubclusterStatus(ctx, subclusters[i], &vdbChg.Status.Subclusters[i]); err != nil {
 				return fmt.Errorf("failed to calculate subcluster status %s %w", subclusters[i].Name, err)
 			}
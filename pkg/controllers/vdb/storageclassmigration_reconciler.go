@@ -0,0 +1,514 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/atconf"
+	"github.com/vertica/vertica-kubernetes/pkg/builder"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/removenode"
+	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// StorageClassMigrationReconciler will move the PVCs of each pod to a new
+// storage class when one is changed in spec.local. The volumeClaimTemplates
+// of a statefulset are immutable, so each statefulset is first recreated with
+// its pods orphaned. Then the pods are rebuilt one at a time: the node is
+// drained and removed from the database, its PVCs and pod are deleted, and the
+// statefulset creates them again with the new storage class. The install and
+// add node actors bring the pod back into the database. We wait for it to be
+// up and rebalanced before moving onto the next pod, so that only one node is
+// ever down.
+type StorageClassMigrationReconciler struct {
+	VRec       *VerticaDBReconciler
+	Log        logr.Logger
+	Vdb        *vapi.VerticaDB // Vdb is the CRD we are acting on.
+	PRunner    cmds.PodRunner
+	PFacts     *PodFacts
+	Dispatcher vadmin.Dispatcher
+	ATWriter   atconf.Writer
+}
+
+// MakeStorageClassMigrationReconciler will build a StorageClassMigrationReconciler object
+func MakeStorageClassMigrationReconciler(vdbrecon *VerticaDBReconciler, log logr.Logger,
+	vdb *vapi.VerticaDB, prunner cmds.PodRunner, pfacts *PodFacts, dispatcher vadmin.Dispatcher) controllers.ReconcileActor {
+	return &StorageClassMigrationReconciler{
+		VRec:       vdbrecon,
+		Log:        log.WithName("StorageClassMigrationReconciler"),
+		Vdb:        vdb,
+		PRunner:    prunner,
+		PFacts:     pfacts,
+		Dispatcher: dispatcher,
+		ATWriter:   atconf.MakeFileWriter(log, vdb, prunner),
+	}
+}
+
+// Reconcile will rebuild the next pod whose PVCs don't use the storage class
+// in the spec
+func (s *StorageClassMigrationReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ctrl.Result, error) {
+	// The webhook only allows the storage class to change for an Eon Mode
+	// database that the operator manages.
+	if !s.Vdb.IsEON() || s.Vdb.Spec.InitPolicy == vapi.CommunalInitPolicyScheduleOnly {
+		return ctrl.Result{}, nil
+	}
+	if isSet, err := s.Vdb.IsConditionSet(vapi.DBInitialized); !isSet || err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if res, err := s.recreateStatefulSets(ctx); verrors.IsReconcileAborted(res, err) {
+		return res, err
+	}
+
+	if err := s.PFacts.Collect(ctx, s.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+	pods, totalPods, err := s.findPodsToMigrate(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(pods) == 0 && !s.Vdb.IsStorageClassMigrationInProgress() {
+		return ctrl.Result{}, nil
+	}
+	if err = s.startMigration(ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Every node, other than the one we are about to rebuild, must be up so
+	// that the database stays k-safe. The pod that was last rebuilt is brought
+	// back by actors that run after this one, so we don't requeue while we
+	// wait for it.
+	var nextPod *PodFact
+	if len(pods) > 0 {
+		nextPod = pods[0]
+	}
+	if pf, ok := s.findPodNotUp(nextPod); ok {
+		if err = s.deletePodIfPVCTerminating(ctx, pf); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, s.updateStatus(ctx,
+			fmt.Sprintf("Waiting for pod %s to be up in the database. %d of %d pods migrated",
+				pf.name.Name, totalPods-len(pods), totalPods))
+	}
+	if res, err := s.rebalanceRebuiltPods(ctx); verrors.IsReconcileAborted(res, err) {
+		return res, err
+	}
+
+	if nextPod == nil {
+		return ctrl.Result{}, s.finishMigration(ctx)
+	}
+	if err = s.updateStatus(ctx, fmt.Sprintf("Rebuilding pod %s. %d of %d pods migrated",
+		nextPod.name.Name, totalPods-len(pods), totalPods)); err != nil {
+		return ctrl.Result{}, err
+	}
+	return s.rebuildPod(ctx, nextPod)
+}
+
+// recreateStatefulSets will recreate any statefulset whose
+// volumeClaimTemplates use an old storage class. The statefulset is deleted
+// with the orphan policy so that its pods keep running. They are adopted by
+// the new statefulset, which creates the PVCs with the new storage class for
+// any pod it has to recreate.
+func (s *StorageClassMigrationReconciler) recreateStatefulSets(ctx context.Context) (ctrl.Result, error) {
+	for i := range s.Vdb.Spec.Subclusters {
+		sc := &s.Vdb.Spec.Subclusters[i]
+		nm := names.GenStsName(s.Vdb, sc)
+		expSts := builder.BuildStsSpec(nm, s.Vdb, sc, &s.VRec.DeploymentNames)
+		curSts := &appsv1.StatefulSet{}
+		err := s.VRec.Client.Get(ctx, nm, curSts)
+		if err == nil {
+			if !isStorageClassChanged(curSts.Spec.VolumeClaimTemplates, expSts.Spec.VolumeClaimTemplates) {
+				continue
+			}
+			if curSts.DeletionTimestamp == nil {
+				if err = s.startMigration(ctx); err != nil {
+					return ctrl.Result{}, err
+				}
+				s.Log.Info("Deleting statefulset, but orphaning its pods, so it can be recreated with the new storage class",
+					"name", nm)
+				if err = s.VRec.Client.Delete(ctx, curSts, client.PropagationPolicy(metav1.DeletePropagationOrphan)); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			s.Log.Info("Requeue to wait for the statefulset to be deleted", "name", nm)
+			return ctrl.Result{Requeue: true}, nil
+		}
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		// A missing statefulset is only ours to create if we deleted it. Any
+		// other is created by the ObjReconciler.
+		if _, ok := s.Vdb.FindSubclusterStatus(sc.Name); !ok || !s.Vdb.IsStorageClassMigrationInProgress() {
+			continue
+		}
+		// Keep the OnDelete strategy until all of the pods have been rebuilt
+		// so that the adopted pods aren't restarted.
+		expSts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}
+		if expSts.Annotations == nil {
+			expSts.Annotations = map[string]string{}
+		}
+		expSts.Annotations[vmeta.AdoptedPodsAnnotation] = "true"
+		if err = ctrl.SetControllerReference(s.Vdb, expSts, s.VRec.Scheme); err != nil {
+			return ctrl.Result{}, err
+		}
+		s.Log.Info("Recreating statefulset with the new storage class", "name", nm)
+		if err = s.VRec.Client.Create(ctx, expSts); err != nil {
+			return ctrl.Result{}, err
+		}
+		s.PFacts.Invalidate()
+	}
+	return ctrl.Result{}, nil
+}
+
+// isStorageClassChanged returns true if any of the expected
+// volumeClaimTemplates has a storage class that differs from the current one.
+// A template without a storage class uses the default one in Kubernetes, which
+// we cannot compare against, so it is never considered changed.
+func isStorageClassChanged(curTemplates, expTemplates []corev1.PersistentVolumeClaim) bool {
+	curClasses := map[string]*string{}
+	for i := range curTemplates {
+		curClasses[curTemplates[i].Name] = curTemplates[i].Spec.StorageClassName
+	}
+	for i := range expTemplates {
+		expClass := expTemplates[i].Spec.StorageClassName
+		curClass, ok := curClasses[expTemplates[i].Name]
+		if !ok || expClass == nil {
+			continue
+		}
+		if curClass == nil || *curClass != *expClass {
+			return true
+		}
+	}
+	return false
+}
+
+// findPodsToMigrate will return the pods that have at least one PVC that
+// doesn't use the storage class in the spec. Pods that are down are returned
+// first, followed by the rest in subcluster and pod index order. It also
+// returns the number of pods that take part in the migration.
+func (s *StorageClassMigrationReconciler) findPodsToMigrate(ctx context.Context) ([]*PodFact, int, error) {
+	scIndex := map[string]int{}
+	for i := range s.Vdb.Spec.Subclusters {
+		scIndex[s.Vdb.Spec.Subclusters[i].Name] = i
+	}
+	pods := []*PodFact{}
+	totalPods := 0
+	for _, pf := range s.PFacts.Detail {
+		if !s.isPodPartOfMigration(pf) {
+			continue
+		}
+		totalPods++
+		migrate, err := s.hasOldStorageClass(ctx, pf)
+		if err != nil {
+			return nil, 0, err
+		}
+		if migrate {
+			pods = append(pods, pf)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].upNode != pods[j].upNode {
+			return !pods[i].upNode
+		}
+		if pods[i].subclusterName != pods[j].subclusterName {
+			return scIndex[pods[i].subclusterName] < scIndex[pods[j].subclusterName]
+		}
+		return pods[i].podIndex < pods[j].podIndex
+	})
+	return pods, totalPods, nil
+}
+
+// isPodPartOfMigration returns true if the pod is one that we rebuild. Pods
+// that are being shutdown or scaled down are left alone.
+func (s *StorageClassMigrationReconciler) isPodPartOfMigration(pf *PodFact) bool {
+	return pf.exists && !pf.isTransient && !pf.shutdown && !pf.pendingDelete
+}
+
+// hasOldStorageClass returns true if any of the pod's PVCs don't use the
+// storage class that is in the spec
+func (s *StorageClassMigrationReconciler) hasOldStorageClass(ctx context.Context, pf *PodFact) (bool, error) {
+	localPVCs := s.Vdb.GetLocalPVCs()
+	for i := range localPVCs {
+		if localPVCs[i].StorageClass == "" {
+			continue
+		}
+		pvc := &corev1.PersistentVolumeClaim{}
+		nm := genLocalPVCName(&localPVCs[i], pf)
+		if err := s.VRec.Client.Get(ctx, nm, pvc); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return false, err
+		}
+		if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName != localPVCs[i].StorageClass {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// findPodNotUp will return a pod, other than the one given, whose node isn't
+// up in the database
+func (s *StorageClassMigrationReconciler) findPodNotUp(nextPod *PodFact) (*PodFact, bool) {
+	return s.PFacts.findFirstPodSorted(func(v *PodFact) bool {
+		return s.isPodPartOfMigration(v) && !v.upNode && (nextPod == nil || v.name != nextPod.name)
+	})
+}
+
+// deletePodIfPVCTerminating will delete a pod that was created while its old
+// PVCs were still being deleted. The pod would otherwise be stuck using a PVC
+// that is going away.
+func (s *StorageClassMigrationReconciler) deletePodIfPVCTerminating(ctx context.Context, pf *PodFact) error {
+	if pf.isPodRunning {
+		return nil
+	}
+	localPVCs := s.Vdb.GetLocalPVCs()
+	for i := range localPVCs {
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := s.VRec.Client.Get(ctx, genLocalPVCName(&localPVCs[i], pf), pvc); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if pvc.DeletionTimestamp != nil {
+			s.Log.Info("Deleting pod because its PVC is being deleted", "pod", pf.name, "pvc", pvc.Name)
+			s.PFacts.Invalidate()
+			return s.deleteObject(ctx, pf.name, &corev1.Pod{})
+		}
+	}
+	return nil
+}
+
+// rebalanceRebuiltPods will rebalance the shards of any subcluster that has a
+// rebuilt pod without a shard subscription. This is done right away, rather
+// than waiting for a maintenance window, as the node cannot take over for the
+// next pod we rebuild until it has shards.
+func (s *StorageClassMigrationReconciler) rebalanceRebuiltPods(ctx context.Context) (ctrl.Result, error) {
+	pods := s.PFacts.filterPods(func(v *PodFact) bool {
+		return s.isPodPartOfMigration(v) && v.upNode && v.shardSubscriptions == 0
+	})
+	scNames := map[string]bool{}
+	for _, pf := range pods {
+		if scNames[pf.subclusterName] {
+			continue
+		}
+		scNames[pf.subclusterName] = true
+		actors := []controllers.ReconcileActor{
+			&RebalanceShardsReconciler{
+				VRec:    s.VRec,
+				Log:     s.Log,
+				Vdb:     s.Vdb,
+				PRunner: s.PRunner,
+				PFacts:  s.PFacts,
+				ScName:  pf.subclusterName,
+				Force:   true,
+			},
+			MakeClientRoutingLabelReconciler(s.VRec, s.Vdb, s.PFacts, AddNodeApplyMethod, pf.subclusterName),
+		}
+		for _, act := range actors {
+			if res, err := act.Reconcile(ctx, &ctrl.Request{}); verrors.IsReconcileAborted(res, err) {
+				return res, err
+			}
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// rebuildPod will take a single pod out of the database and delete it, along
+// with its PVCs, so that the statefulset recreates them with the new storage
+// class. Each step is skipped if it was done in a prior iteration.
+func (s *StorageClassMigrationReconciler) rebuildPod(ctx context.Context, pf *PodFact) (ctrl.Result, error) {
+	if err := s.removeClientRoutingLabel(ctx, pf); err != nil {
+		return ctrl.Result{}, err
+	}
+	if pf.upNode {
+		drainer := &DrainNodeReconciler{VRec: s.VRec, Vdb: s.Vdb, PRunner: s.PRunner, PFacts: s.PFacts}
+		if res, err := drainer.reconcilePod(ctx, pf); verrors.IsReconcileAborted(res, err) {
+			return res, err
+		}
+	}
+	s.VRec.Eventf(s.Vdb, corev1.EventTypeNormal, events.StorageClassMigrationPodRebuild,
+		"Rebuilding pod '%s' so that its PVCs use the new storage class", pf.name.Name)
+	if pf.dbExists {
+		if res, err := s.removeNode(ctx, pf); verrors.IsReconcileAborted(res, err) {
+			return res, err
+		}
+	}
+	if pf.isInstalled {
+		if err := s.uninstall(ctx, pf); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Delete the PVCs first. They are protected from deletion until the pod
+	// is gone, at which point the statefulset will create new ones.
+	localPVCs := s.Vdb.GetLocalPVCs()
+	for i := range localPVCs {
+		if err := s.deleteObject(ctx, genLocalPVCName(&localPVCs[i], pf), &corev1.PersistentVolumeClaim{}); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if err := s.deleteObject(ctx, pf.name, &corev1.Pod{}); err != nil {
+		return ctrl.Result{}, err
+	}
+	s.PFacts.Invalidate()
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// removeClientRoutingLabel will remove the label from the pod so that the
+// service objects stop routing new connections to it
+func (s *StorageClassMigrationReconciler) removeClientRoutingLabel(ctx context.Context, pf *PodFact) error {
+	pod := &corev1.Pod{}
+	if err := s.VRec.Client.Get(ctx, pf.name, pod); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if _, ok := pod.Labels[vmeta.ClientRoutingLabel]; !ok {
+		return nil
+	}
+	patch := client.MergeFrom(pod.DeepCopy())
+	delete(pod.Labels, vmeta.ClientRoutingLabel)
+	s.Log.Info("Removing client routing label", "pod", pod.Name)
+	return s.VRec.Client.Patch(ctx, pod, patch)
+}
+
+// removeNode will remove the pod's node from the database
+func (s *StorageClassMigrationReconciler) removeNode(ctx context.Context, pf *PodFact) (ctrl.Result, error) {
+	initiatorPod, ok := s.PFacts.findFirstPodSorted(func(v *PodFact) bool {
+		return v.upNode && !v.readOnly && v.name != pf.name
+	})
+	if !ok {
+		s.Log.Info("No pod found to run remove node from. Requeue reconciliation.")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	s.VRec.Eventf(s.Vdb, corev1.EventTypeNormal, events.RemoveNodesStart,
+		"Starting database remove node for pods '%s'", pf.name.Name)
+	err := s.Dispatcher.RemoveNode(ctx,
+		removenode.WithInitiator(initiatorPod.name, initiatorPod.podIP),
+		removenode.WithHost(pf.dnsName),
+	)
+	if err != nil {
+		s.VRec.Event(s.Vdb, corev1.EventTypeWarning, events.RemoveNodesFailed,
+			"Failed when calling database remove node")
+		return ctrl.Result{}, fmt.Errorf("failed to call remove node: %w", err)
+	}
+	s.VRec.Eventf(s.Vdb, corev1.EventTypeNormal, events.RemoveNodesSucceeded,
+		"Successfully removed nodes from database")
+	return ctrl.Result{}, nil
+}
+
+// uninstall will remove the pod's host from admintools.conf. The new pod will
+// have a different IP, which is added back when the pod is installed again.
+func (s *StorageClassMigrationReconciler) uninstall(ctx context.Context, pf *PodFact) error {
+	basePod, err := findATBasePod(s.Vdb, s.PFacts)
+	if err != nil {
+		return err
+	}
+	atConfTempFile, err := s.ATWriter.RemoveHosts(ctx, basePod, []string{pf.podIP})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(atConfTempFile)
+	return distributeAdmintoolsConf(ctx, s.Vdb, s.VRec, s.PFacts, s.PRunner, atConfTempFile)
+}
+
+// deleteObject will delete the object with the given name. It isn't an error
+// if the object is already gone.
+func (s *StorageClassMigrationReconciler) deleteObject(ctx context.Context, nm types.NamespacedName, obj client.Object) error {
+	if err := s.VRec.Client.Get(ctx, nm, obj); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if obj.GetDeletionTimestamp() != nil {
+		return nil
+	}
+	s.Log.Info("Deleting object", "name", nm, "kind", fmt.Sprintf("%T", obj))
+	if err := s.VRec.Client.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// startMigration will set the status condition to indicate a migration is in
+// progress. It is a no-op if the condition is already set.
+func (s *StorageClassMigrationReconciler) startMigration(ctx context.Context) error {
+	if s.Vdb.IsStorageClassMigrationInProgress() {
+		return nil
+	}
+	s.VRec.Event(s.Vdb, corev1.EventTypeNormal, events.StorageClassMigrationStarted,
+		"Starting the migration of the PVCs to the new storage class")
+	return vdbstatus.UpdateCondition(ctx, s.VRec.Client, s.Vdb,
+		vapi.VerticaDBCondition{Type: vapi.StorageClassMigrationInProgress, Status: corev1.ConditionTrue})
+}
+
+// finishMigration will clear the status condition and message once every pod
+// has been rebuilt
+func (s *StorageClassMigrationReconciler) finishMigration(ctx context.Context) error {
+	if err := s.updateStatus(ctx, ""); err != nil {
+		return err
+	}
+	if !s.Vdb.IsStorageClassMigrationInProgress() {
+		return nil
+	}
+	s.VRec.Event(s.Vdb, corev1.EventTypeNormal, events.StorageClassMigrationSucceeded,
+		"Successfully migrated the PVCs of all pods to the new storage class")
+	return vdbstatus.UpdateCondition(ctx, s.VRec.Client, s.Vdb,
+		vapi.VerticaDBCondition{Type: vapi.StorageClassMigrationInProgress, Status: corev1.ConditionFalse})
+}
+
+// updateStatus will save the migration message in the status
+func (s *StorageClassMigrationReconciler) updateStatus(ctx context.Context, msg string) error {
+	if s.Vdb.Status.StorageClassMigrationStatus == msg {
+		return nil
+	}
+	return vdbstatus.Update(ctx, s.VRec.Client, s.Vdb, func(vdbChg *vapi.VerticaDB) error {
+		vdbChg.Status.StorageClassMigrationStatus = msg
+		return nil
+	})
+}
+
+// genLocalPVCName returns the name of the PVC that the statefulset created
+// for the given pod and volumeClaimTemplate
+func genLocalPVCName(localPVC *vapi.LocalPVC, pf *PodFact) types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: pf.name.Namespace,
+		Name:      fmt.Sprintf("%s-%s", localPVC.Name, pf.name.Name),
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/atconf"
+	"github.com/vertica/vertica-kubernetes/pkg/builder"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("storageclassmigration_reconcile", func() {
+	ctx := context.Background()
+	const oldStorageClass = "old-storage-class"
+	const newStorageClass = "new-storage-class"
+
+	It("should recreate the statefulset and rebuild the first pod with the new storage class", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Local.StorageClass = oldStorageClass
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+		sc := &vdb.Spec.Subclusters[0]
+		Expect(vdbstatus.Update(ctx, k8sClient, vdb, func(vdbChg *vapi.VerticaDB) error {
+			vdbChg.Status.Subclusters = []vapi.SubclusterStatus{
+				{Name: sc.Name, Detail: []vapi.VerticaDBPodStatus{}},
+			}
+			return nil
+		})).Should(Succeed())
+
+		vdb.Spec.Local.StorageClass = newStorageClass
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		pfacts.OverrideFunc = func(ctx context.Context, vdb *vapi.VerticaDB, pf *PodFact, gs *GatherState) error {
+			pf.shardSubscriptions = 4
+			return defaultPodFactOverrider(ctx, vdb, pf, gs)
+		}
+		dispatcher := vdbRec.makeDispatcher(logger, vdb, fpr, TestPassword)
+		act := MakeStorageClassMigrationReconciler(vdbRec, logger, vdb, fpr, pfacts, dispatcher)
+		r := act.(*StorageClassMigrationReconciler)
+		r.ATWriter = &atconf.FakeWriter{}
+
+		stsName := names.GenStsName(vdb, sc)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{Requeue: true}))
+		Expect(vdb.IsStorageClassMigrationInProgress()).Should(BeTrue())
+
+		// Envtest doesn't run the garbage collector, which would remove the
+		// orphan finalizer, so we do that ourselves.
+		sts := &appsv1.StatefulSet{}
+		Expect(k8sClient.Get(ctx, stsName, sts)).Should(Succeed())
+		Expect(sts.DeletionTimestamp).ShouldNot(BeNil())
+		patch := client.MergeFrom(sts.DeepCopy())
+		sts.Finalizers = nil
+		Expect(k8sClient.Patch(ctx, sts, patch)).Should(Succeed())
+
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{Requeue: true}))
+		Expect(k8sClient.Get(ctx, stsName, sts)).Should(Succeed())
+		Expect(sts.Spec.UpdateStrategy.Type).Should(Equal(appsv1.OnDeleteStatefulSetStrategyType))
+		Expect(sts.Annotations[vmeta.AdoptedPodsAnnotation]).Should(Equal("true"))
+		Expect(sts.Spec.VolumeClaimTemplates).Should(HaveLen(1))
+		Expect(*sts.Spec.VolumeClaimTemplates[0].Spec.StorageClassName).Should(Equal(newStorageClass))
+
+		// Only the first pod is rebuilt
+		Expect(fpr.FindCommands("db_remove_node")).Should(HaveLen(1))
+		Expect(vdb.Status.StorageClassMigrationStatus).Should(ContainSubstring("0 of 3 pods migrated"))
+		for i := int32(0); i < sc.Size; i++ {
+			pod := &corev1.Pod{}
+			err := k8sClient.Get(ctx, names.GenPodName(vdb, sc, i), pod)
+			pvc := &corev1.PersistentVolumeClaim{}
+			Expect(k8sClient.Get(ctx, names.GenPVCName(vdb, sc, i), pvc)).Should(Succeed())
+			if i == 0 {
+				if err == nil {
+					Expect(pod.DeletionTimestamp).ShouldNot(BeNil())
+				} else {
+					Expect(errors.IsNotFound(err)).Should(BeTrue())
+				}
+				Expect(pvc.DeletionTimestamp).ShouldNot(BeNil())
+				// Remove the pvc-protection finalizer so the PVC is gone
+				// before the cleanup runs
+				pvcPatch := client.MergeFrom(pvc.DeepCopy())
+				pvc.Finalizers = nil
+				Expect(k8sClient.Patch(ctx, pvc, pvcPatch)).Should(Succeed())
+			} else {
+				Expect(err).Should(Succeed())
+				Expect(pvc.DeletionTimestamp).Should(BeNil())
+			}
+		}
+	})
+
+	It("should finish the migration once all of the PVCs use the new storage class", func() {
+		vdb := vapi.MakeVDB()
+		// The test PVCs are always created with this storage class
+		vdb.Spec.Local.StorageClass = builder.TestStorageClassName
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+		Expect(vdbstatus.UpdateCondition(ctx, k8sClient, vdb,
+			vapi.VerticaDBCondition{Type: vapi.StorageClassMigrationInProgress, Status: corev1.ConditionTrue})).Should(Succeed())
+		Expect(vdbstatus.Update(ctx, k8sClient, vdb, func(vdbChg *vapi.VerticaDB) error {
+			vdbChg.Status.StorageClassMigrationStatus = "Rebuilding pod"
+			return nil
+		})).Should(Succeed())
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		pfacts.OverrideFunc = func(ctx context.Context, vdb *vapi.VerticaDB, pf *PodFact, gs *GatherState) error {
+			pf.shardSubscriptions = 4
+			return defaultPodFactOverrider(ctx, vdb, pf, gs)
+		}
+		dispatcher := vdbRec.makeDispatcher(logger, vdb, fpr, TestPassword)
+		r := MakeStorageClassMigrationReconciler(vdbRec, logger, vdb, fpr, pfacts, dispatcher)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(vdb.IsStorageClassMigrationInProgress()).Should(BeFalse())
+		Expect(vdb.Status.StorageClassMigrationStatus).Should(Equal(""))
+		Expect(fpr.FindCommands("db_remove_node")).Should(BeEmpty())
+	})
+})
@@ -0,0 +1,332 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/builder"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SubclusterRenameReconciler will rename subclusters as requested by the
+// subcluster renames annotation. The subcluster is renamed in the database and
+// in the status. The statefulset keeps its name, so that the pods and PVCs
+// don't change, but it is recreated so that its selector uses the new
+// subcluster name. The pods are orphaned while this happens, so they keep
+// running. The name of the statefulset is saved in the subcluster statefulset
+// names annotation of the VerticaDB.
+type SubclusterRenameReconciler struct {
+	VRec    *VerticaDBReconciler
+	Log     logr.Logger
+	Vdb     *vapi.VerticaDB // Vdb is the CRD we are acting on.
+	PRunner cmds.PodRunner
+	PFacts  *PodFacts
+}
+
+// MakeSubclusterRenameReconciler will build a SubclusterRenameReconciler object
+func MakeSubclusterRenameReconciler(vdbrecon *VerticaDBReconciler, log logr.Logger,
+	vdb *vapi.VerticaDB, prunner cmds.PodRunner, pfacts *PodFacts) controllers.ReconcileActor {
+	return &SubclusterRenameReconciler{
+		VRec:    vdbrecon,
+		Log:     log.WithName("SubclusterRenameReconciler"),
+		Vdb:     vdb,
+		PRunner: prunner,
+		PFacts:  pfacts,
+	}
+}
+
+// Reconcile will rename any subcluster in the renames annotation
+func (s *SubclusterRenameReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ctrl.Result, error) {
+	renames, err := vmeta.GetSubclusterRenames(s.Vdb.Annotations)
+	if err != nil {
+		// The webhook prevents this, so we only log it.
+		s.Log.Info("Skipping subcluster renames because the annotation is invalid", "err", err.Error())
+		return ctrl.Result{}, nil
+	}
+	oldNames := make([]string, 0, len(renames))
+	for oldName := range renames {
+		oldNames = append(oldNames, oldName)
+	}
+	sort.Strings(oldNames)
+
+	if err := s.pruneStsNames(ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	scMap := s.Vdb.GenSubclusterMap()
+	for _, oldName := range oldNames {
+		sc, ok := scMap[renames[oldName]]
+		// The rename only happens once the name in the spec has changed.
+		if _, oldInSpec := scMap[oldName]; oldInSpec || !ok {
+			continue
+		}
+		if res, err := s.renameSubcluster(ctx, oldName, sc); verrors.IsReconcileAborted(res, err) {
+			return res, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// renameSubcluster will do all of the steps to rename a single subcluster. Each
+// step can be repeated if we requeue part way through.
+func (s *SubclusterRenameReconciler) renameSubcluster(ctx context.Context, oldName string,
+	sc *vapi.Subcluster) (ctrl.Result, error) {
+	if _, ok := s.Vdb.FindSubclusterStatus(oldName); ok {
+		if res, err := s.renameInDatabase(ctx, oldName, sc.Name); verrors.IsReconcileAborted(res, err) {
+			return res, err
+		}
+		if err := s.saveStsName(ctx, oldName, sc.Name); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := s.renameInStatus(ctx, oldName, sc.Name); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return s.recreateStatefulSet(ctx, sc)
+}
+
+// saveStsName will save the name of the statefulset of a renamed subcluster
+// in the VerticaDB. It keeps the name that was derived from the old subcluster
+// name. This is done before the status is changed, so that we never lose
+// track of the statefulset.
+func (s *SubclusterRenameReconciler) saveStsName(ctx context.Context, oldName, newName string) error {
+	nm := s.Vdb.ExtractNamespacedName()
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		// Always fetch the latest in case we are in the retry loop
+		if err := s.VRec.Client.Get(ctx, nm, s.Vdb); err != nil {
+			return err
+		}
+		stsNames, err := vmeta.GetSubclusterStsNames(s.Vdb.Annotations)
+		if err != nil {
+			return err
+		}
+		if _, ok := stsNames[newName]; ok {
+			return nil
+		}
+		stsNames[newName] = names.GenStsName(s.Vdb, &vapi.Subcluster{Name: oldName}).Name
+		delete(stsNames, oldName)
+		if s.Vdb.Annotations == nil {
+			s.Vdb.Annotations = map[string]string{}
+		}
+		s.Vdb.Annotations[vmeta.SubclusterStsNamesAnnotation] = vmeta.GenSubclusterStsNames(stsNames)
+		return s.VRec.Client.Update(ctx, s.Vdb)
+	})
+}
+
+// renameInDatabase will run the alter subcluster statement to rename the
+// subcluster. This is skipped if the subcluster isn't in the database.
+func (s *SubclusterRenameReconciler) renameInDatabase(ctx context.Context, oldName, newName string) (ctrl.Result, error) {
+	// Only Eon Mode databases have subclusters that can be renamed. We skip
+	// ScheduleOnly as the operator doesn't manage the database.
+	if !s.Vdb.IsEON() || s.Vdb.Spec.InitPolicy == vapi.CommunalInitPolicyScheduleOnly {
+		return ctrl.Result{}, nil
+	}
+	if isSet, err := s.Vdb.IsConditionSet(vapi.DBInitialized); !isSet || err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := s.PFacts.Collect(ctx, s.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+	pf, ok := s.PFacts.findPodToRunVsql(false, "")
+	if !ok {
+		s.Log.Info("No pod found to run vsql from. Requeue reconciliation.")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	sql := "select distinct(subcluster_name) from subclusters"
+	stdout, _, err := s.PRunner.ExecVSQL(ctx, pf.name, names.ServerContainer, "-tAc", sql)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	inDB := false
+	for _, line := range strings.Split(stdout, "\n") {
+		inDB = inDB || strings.TrimSpace(line) == oldName
+	}
+	if !inDB {
+		return ctrl.Result{}, nil
+	}
+
+	sql = fmt.Sprintf("alter subcluster \"%s\" rename to \"%s\";", oldName, newName)
+	_, stderr, err := s.PRunner.ExecVSQL(ctx, pf.name, names.ServerContainer, "-tAc", sql)
+	if err != nil {
+		s.VRec.Eventf(s.Vdb, corev1.EventTypeWarning, events.SubclusterRenameFailed,
+			"Failed to rename subcluster '%s' to '%s': %s", oldName, newName, stderr)
+		return ctrl.Result{}, err
+	}
+	s.VRec.Eventf(s.Vdb, corev1.EventTypeNormal, events.SubclusterRenamed,
+		"Successfully renamed subcluster '%s' to '%s'", oldName, newName)
+	return ctrl.Result{}, nil
+}
+
+// pruneStsNames will remove the saved statefulset name of any renamed
+// subcluster that was since removed. We wait for its statefulset to be deleted
+// first, as the name is needed to clean it up.
+func (s *SubclusterRenameReconciler) pruneStsNames(ctx context.Context) error {
+	stsNames, err := vmeta.GetSubclusterStsNames(s.Vdb.Annotations)
+	if err != nil || len(stsNames) == 0 {
+		return err
+	}
+	scMap := s.Vdb.GenSubclusterMap()
+	pruned := false
+	for scName, stsName := range stsNames {
+		if _, ok := scMap[scName]; ok {
+			continue
+		}
+		sts := &appsv1.StatefulSet{}
+		if err = s.VRec.Client.Get(ctx, names.GenNamespacedName(s.Vdb, stsName), sts); err == nil {
+			continue
+		} else if !errors.IsNotFound(err) {
+			return err
+		}
+		delete(stsNames, scName)
+		pruned = true
+	}
+	if !pruned {
+		return nil
+	}
+	s.Log.Info("Removing the statefulset names of subclusters that no longer exist")
+	patch := client.MergeFrom(s.Vdb.DeepCopy())
+	if len(stsNames) == 0 {
+		delete(s.Vdb.Annotations, vmeta.SubclusterStsNamesAnnotation)
+	} else {
+		s.Vdb.Annotations[vmeta.SubclusterStsNamesAnnotation] = vmeta.GenSubclusterStsNames(stsNames)
+	}
+	return s.VRec.Client.Patch(ctx, s.Vdb, patch)
+}
+
+// renameInStatus will change the name of the subcluster in the status.
+func (s *SubclusterRenameReconciler) renameInStatus(ctx context.Context, oldName, newName string) error {
+	err := vdbstatus.Update(ctx, s.VRec.Client, s.Vdb, func(vdbChg *vapi.VerticaDB) error {
+		scs := []vapi.SubclusterStatus{}
+		for i := range vdbChg.Status.Subclusters {
+			switch vdbChg.Status.Subclusters[i].Name {
+			case newName:
+				// Drop any stale status for the new name
+				continue
+			case oldName:
+				vdbChg.Status.Subclusters[i].Name = newName
+			}
+			scs = append(scs, vdbChg.Status.Subclusters[i])
+		}
+		vdbChg.Status.Subclusters = scs
+		return nil
+	})
+	s.PFacts.Invalidate()
+	return err
+}
+
+// recreateStatefulSet will recreate the statefulset of a renamed subcluster so
+// that it has the new subcluster name in its labels and selector. The selector
+// is immutable, which is why we need to recreate it. The old statefulset is
+// deleted with the orphan policy so that the pods keep running. They are then
+// adopted by the new statefulset.
+func (s *SubclusterRenameReconciler) recreateStatefulSet(ctx context.Context, sc *vapi.Subcluster) (ctrl.Result, error) {
+	stsNames, err := vmeta.GetSubclusterStsNames(s.Vdb.Annotations)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if _, ok := stsNames[sc.Name]; !ok {
+		return ctrl.Result{}, nil
+	}
+	nm := names.GenStsName(s.Vdb, sc)
+	sts := &appsv1.StatefulSet{}
+	err = s.VRec.Client.Get(ctx, nm, sts)
+	if err == nil {
+		if sts.Spec.Selector != nil && sts.Spec.Selector.MatchLabels[vmeta.SubclusterNameLabel] == sc.Name {
+			return ctrl.Result{}, nil
+		}
+		if sts.DeletionTimestamp == nil {
+			s.Log.Info("Deleting statefulset, but orphaning its pods, so it can be recreated with the new subcluster name",
+				"name", nm, "subcluster", sc.Name)
+			if err = s.VRec.Client.Delete(ctx, sts, client.PropagationPolicy(metav1.DeletePropagationOrphan)); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		s.Log.Info("Requeue to wait for the statefulset to be deleted", "name", nm)
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	// Update the pods before the statefulset is created, so that they match
+	// its selector and get adopted.
+	if err = s.relabelPods(ctx, sc, nm.Name); err != nil {
+		return ctrl.Result{}, err
+	}
+	expSts := builder.BuildStsSpec(nm, s.Vdb, sc, &s.VRec.DeploymentNames)
+	expSts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}
+	if expSts.Annotations == nil {
+		expSts.Annotations = map[string]string{}
+	}
+	expSts.Annotations[vmeta.AdoptedPodsAnnotation] = "true"
+	if err = ctrl.SetControllerReference(s.Vdb, expSts, s.VRec.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	s.Log.Info("Recreating statefulset for renamed subcluster", "name", nm, "subcluster", sc.Name)
+	s.PFacts.Invalidate()
+	return ctrl.Result{}, s.VRec.Client.Create(ctx, expSts)
+}
+
+// relabelPods will update the subcluster labels in each pod of the statefulset
+func (s *SubclusterRenameReconciler) relabelPods(ctx context.Context, sc *vapi.Subcluster, stsName string) error {
+	pods := &corev1.PodList{}
+	if err := s.VRec.Client.List(ctx, pods, client.InNamespace(s.Vdb.Namespace),
+		client.MatchingLabels(builder.MakeBaseSvcSelectorLabels(s.Vdb))); err != nil {
+		return err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		// Pods of a statefulset are named <sts-name>-<ordinal>
+		ordinal := strings.TrimPrefix(pod.Name, stsName+"-")
+		if _, err := strconv.Atoi(ordinal); ordinal == pod.Name || err != nil {
+			continue
+		}
+		patch := client.MergeFrom(pod.DeepCopy())
+		if pod.Labels == nil {
+			pod.Labels = map[string]string{}
+		}
+		pod.Labels[vmeta.SubclusterNameLabel] = sc.Name
+		if !sc.IsTransient {
+			pod.Labels[vmeta.SubclusterSvcNameLabel] = sc.GetServiceName()
+		}
+		s.Log.Info("Updating subcluster labels in pod", "pod", pod.Name, "subcluster", sc.Name)
+		if err := s.VRec.Client.Patch(ctx, pod, patch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("subclusterrename_reconcile", func() {
+	ctx := context.Background()
+
+	It("should rename the subcluster and recreate its statefulset without deleting the pods", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Subclusters[0].Name = "sc1"
+		vdb.Spec.Subclusters[0].Size = 2
+		createInitializedVDB(ctx, vdb)
+		defer deleteInitializedVDB(ctx, vdb)
+		Expect(vdbstatus.Update(ctx, k8sClient, vdb, func(vdbChg *vapi.VerticaDB) error {
+			vdbChg.Status.Subclusters = []vapi.SubclusterStatus{
+				{Name: "sc1", Oid: "123", Detail: []vapi.VerticaDBPodStatus{}},
+			}
+			return nil
+		})).Should(Succeed())
+		oldStsName := names.GenStsName(vdb, &vdb.Spec.Subclusters[0])
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+
+		vdb.Spec.Subclusters[0].Name = "analytics"
+		vdb.Annotations = map[string]string{vmeta.SubclusterRenamesAnnotation: "sc1=analytics"}
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		fpr.Results = cmds.CmdResults{}
+		for pn := range pfacts.Detail {
+			fpr.Results[pn] = []cmds.CmdResult{{Stdout: "sc1\n"}}
+		}
+		r := MakeSubclusterRenameReconciler(vdbRec, logger, vdb, fpr, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{Requeue: true}))
+		Expect(fpr.FindCommands(`alter subcluster "sc1" rename to "analytics";`)).Should(HaveLen(1))
+		Expect(vdb.Status.Subclusters).Should(HaveLen(1))
+		Expect(vdb.Status.Subclusters[0].Name).Should(Equal("analytics"))
+		Expect(vdb.Status.Subclusters[0].Oid).Should(Equal("123"))
+		Expect(vdb.Annotations[vmeta.SubclusterStsNamesAnnotation]).Should(Equal("analytics=" + oldStsName.Name))
+		Expect(names.GenStsName(vdb, &vdb.Spec.Subclusters[0])).Should(Equal(oldStsName))
+		// The statefulset is still found if the status is lost
+		vdbNoStatus := vdb.DeepCopy()
+		vdbNoStatus.Status = vapi.VerticaDBStatus{}
+		Expect(names.GenStsName(vdbNoStatus, &vdb.Spec.Subclusters[0])).Should(Equal(oldStsName))
+
+		// Envtest doesn't run the garbage collector, which would remove the
+		// orphan finalizer, so we do that ourselves.
+		sts := &appsv1.StatefulSet{}
+		Expect(k8sClient.Get(ctx, oldStsName, sts)).Should(Succeed())
+		Expect(sts.DeletionTimestamp).ShouldNot(BeNil())
+		patch := client.MergeFrom(sts.DeepCopy())
+		sts.Finalizers = nil
+		Expect(k8sClient.Patch(ctx, sts, patch)).Should(Succeed())
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, oldStsName, sts))).Should(BeTrue())
+
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(k8sClient.Get(ctx, oldStsName, sts)).Should(Succeed())
+		Expect(sts.Spec.Selector.MatchLabels[vmeta.SubclusterNameLabel]).Should(Equal("analytics"))
+		Expect(sts.Spec.UpdateStrategy.Type).Should(Equal(appsv1.OnDeleteStatefulSetStrategyType))
+		Expect(sts.Annotations).Should(HaveKey(vmeta.AdoptedPodsAnnotation))
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, pn, pod)).Should(Succeed())
+		Expect(pod.Labels[vmeta.SubclusterNameLabel]).Should(Equal("analytics"))
+		Expect(pod.Labels[vmeta.SubclusterSvcNameLabel]).Should(Equal("analytics"))
+
+		// Nothing more to do once the rename is done
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(fpr.FindCommands("rename to")).Should(HaveLen(1))
+
+		// The saved statefulset name is dropped once the subcluster and its
+		// statefulset are gone.
+		Expect(k8sClient.Delete(ctx, sts)).Should(Succeed())
+		vdb.Spec.Subclusters[0].Name = "other"
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(vdb.Annotations).ShouldNot(HaveKey(vmeta.SubclusterStsNamesAnnotation))
+	})
+})
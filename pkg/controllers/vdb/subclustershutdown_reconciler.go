@@ -0,0 +1,123 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// SubclusterShutdownReconciler will stop the vertica nodes in any subcluster
+// that has shutdown set in the spec.
+type SubclusterShutdownReconciler struct {
+	VRec    *VerticaDBReconciler
+	Log     logr.Logger
+	Vdb     *vapi.VerticaDB // Vdb is the CRD we are acting on.
+	PRunner cmds.PodRunner
+	PFacts  *PodFacts
+}
+
+// MakeSubclusterShutdownReconciler will build a SubclusterShutdownReconciler object
+func MakeSubclusterShutdownReconciler(vdbrecon *VerticaDBReconciler, log logr.Logger,
+	vdb *vapi.VerticaDB, prunner cmds.PodRunner, pfacts *PodFacts) controllers.ReconcileActor {
+	return &SubclusterShutdownReconciler{
+		VRec:    vdbrecon,
+		Log:     log,
+		Vdb:     vdb,
+		PRunner: prunner,
+		PFacts:  pfacts,
+	}
+}
+
+// Reconcile will stop the nodes of each subcluster that is being shutdown.
+// This depends on the DrainNodeReconciler having run first so that client
+// connections have left the nodes. The statefulset is only scaled to zero after
+// this succeeds, so that the nodes are stopped cleanly rather than killed.
+func (s *SubclusterShutdownReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ctrl.Result, error) {
+	// no-op for ScheduleOnly init policy
+	if s.Vdb.Spec.InitPolicy == vapi.CommunalInitPolicyScheduleOnly {
+		return ctrl.Result{}, nil
+	}
+
+	if err := s.PFacts.Collect(ctx, s.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	for _, scName := range s.findSubclustersToShutdown() {
+		if res, err := s.shutdownSubcluster(ctx, scName); verrors.IsReconcileAborted(res, err) {
+			return res, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// findSubclustersToShutdown returns the names of the subclusters that are
+// being shutdown and still have nodes up.
+func (s *SubclusterShutdownReconciler) findSubclustersToShutdown() []string {
+	scMap := map[string]bool{}
+	for _, pf := range s.PFacts.Detail {
+		if pf.shutdown && pf.upNode {
+			scMap[pf.subclusterName] = true
+		}
+	}
+	scNames := make([]string, 0, len(scMap))
+	for scName := range scMap {
+		scNames = append(scNames, scName)
+	}
+	sort.Strings(scNames)
+	return scNames
+}
+
+// shutdownSubcluster will stop all of the nodes in the given subcluster
+func (s *SubclusterShutdownReconciler) shutdownSubcluster(ctx context.Context, scName string) (ctrl.Result, error) {
+	// We run the shutdown from a node outside of the subcluster so that we
+	// aren't connected to a node that is going down.
+	pf, ok := s.PFacts.findFirstPodSorted(func(v *PodFact) bool {
+		return v.upNode && !v.readOnly && !v.shutdown
+	})
+	if !ok {
+		s.Log.Info("No pod found to run vsql from. Requeue reconciliation.")
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	s.VRec.Eventf(s.Vdb, corev1.EventTypeNormal, events.SubclusterShutdownStart,
+		"Starting shutdown of subcluster '%s'", scName)
+	start := time.Now()
+	sql := fmt.Sprintf("select shutdown_subcluster('%s');", scName)
+	_, stderr, err := s.PRunner.ExecVSQL(ctx, pf.name, names.ServerContainer, "-tAc", sql)
+	// Invalidate the pod facts now that some nodes may have gone down
+	s.PFacts.Invalidate()
+	if err != nil {
+		s.VRec.Eventf(s.Vdb, corev1.EventTypeWarning, events.SubclusterShutdownFailed,
+			"Failed to shutdown subcluster '%s': %s", scName, stderr)
+		return ctrl.Result{}, err
+	}
+	s.VRec.Eventf(s.Vdb, corev1.EventTypeNormal, events.SubclusterShutdownSucceeded,
+		"Successfully shutdown subcluster '%s'. It took %s", scName, time.Since(start))
+	return ctrl.Result{}, nil
+}
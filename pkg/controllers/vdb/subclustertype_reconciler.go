@@ -0,0 +1,297 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/builder"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SubclusterTypeReconciler will promote or demote subclusters so that their
+// type in the database matches isPrimary in the spec. The type as known by the
+// database is saved in the status and is used to keep the subcluster type
+// label of the statefulset and pods in sync.
+type SubclusterTypeReconciler struct {
+	VRec    *VerticaDBReconciler
+	Log     logr.Logger
+	Vdb     *vapi.VerticaDB // Vdb is the CRD we are acting on.
+	PRunner cmds.PodRunner
+	PFacts  *PodFacts
+}
+
+// MakeSubclusterTypeReconciler will build a SubclusterTypeReconciler object
+func MakeSubclusterTypeReconciler(vdbrecon *VerticaDBReconciler, log logr.Logger,
+	vdb *vapi.VerticaDB, prunner cmds.PodRunner, pfacts *PodFacts) controllers.ReconcileActor {
+	return &SubclusterTypeReconciler{
+		VRec:    vdbrecon,
+		Log:     log.WithName("SubclusterTypeReconciler"),
+		Vdb:     vdb,
+		PRunner: prunner,
+		PFacts:  pfacts,
+	}
+}
+
+// Reconcile will promote or demote any subcluster whose type has changed
+func (s *SubclusterTypeReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ctrl.Result, error) {
+	// Subcluster types can only change in Eon Mode. We skip ScheduleOnly as
+	// the operator doesn't manage the database.
+	if !s.Vdb.IsEON() || s.Vdb.Spec.InitPolicy == vapi.CommunalInitPolicyScheduleOnly {
+		return ctrl.Result{}, nil
+	}
+
+	if s.isStatusInSync() {
+		return ctrl.Result{}, s.syncLabels(ctx)
+	}
+
+	if err := s.PFacts.Collect(ctx, s.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+	pf, ok := s.PFacts.findPodToRunVsql(false, "")
+	if !ok {
+		s.Log.Info("No pod found to run vsql from. Skipping check of subcluster types.")
+		return ctrl.Result{}, nil
+	}
+	dbTypes, err := s.fetchSubclusterTypes(ctx, pf)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	res, err := s.changeSubclusterTypes(ctx, pf, dbTypes)
+	// Always record what we know about the types, even if the change failed
+	if statusErr := s.updateStatus(ctx, dbTypes); statusErr != nil {
+		return ctrl.Result{}, statusErr
+	}
+	if err != nil || res.Requeue {
+		return res, err
+	}
+	return ctrl.Result{}, s.syncLabels(ctx)
+}
+
+// isStatusInSync returns true if the type in the status of each subcluster
+// matches the spec. If so, there is nothing to promote or demote.
+func (s *SubclusterTypeReconciler) isStatusInSync() bool {
+	for i := range s.Vdb.Spec.Subclusters {
+		sc := &s.Vdb.Spec.Subclusters[i]
+		if sc.IsTransient {
+			continue
+		}
+		scStatus, ok := s.Vdb.FindSubclusterStatus(sc.Name)
+		if ok && scStatus.Type != sc.GetType() {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchSubclusterTypes will query the database for the type of each
+// subcluster. It returns a map of subcluster name to its type.
+func (s *SubclusterTypeReconciler) fetchSubclusterTypes(ctx context.Context, pf *PodFact) (map[string]string, error) {
+	sql := "select distinct subcluster_name, is_primary from subclusters"
+	stdout, _, err := s.PRunner.ExecVSQL(ctx, pf.name, names.ServerContainer, "-tAc", sql)
+	if err != nil {
+		return nil, err
+	}
+	return parseSubclusterTypes(stdout), nil
+}
+
+// parseSubclusterTypes will parse the output of the subclusters query. Each
+// line has the subcluster name and a boolean for primary, separated by '|'.
+func parseSubclusterTypes(stdout string) map[string]string {
+	dbTypes := map[string]string{}
+	for _, line := range strings.Split(stdout, "\n") {
+		cols := strings.Split(strings.TrimSpace(line), "|")
+		const ExpectedCols = 2
+		if len(cols) != ExpectedCols {
+			continue
+		}
+		if cols[1] == "t" {
+			dbTypes[cols[0]] = vapi.PrimarySubclusterType
+		} else {
+			dbTypes[cols[0]] = vapi.SecondarySubclusterType
+		}
+	}
+	return dbTypes
+}
+
+// changeSubclusterTypes will promote and demote the subclusters whose type in
+// the database differs from the spec. The dbTypes map is updated for each
+// subcluster that was changed.
+func (s *SubclusterTypeReconciler) changeSubclusterTypes(ctx context.Context, pf *PodFact,
+	dbTypes map[string]string) (ctrl.Result, error) {
+	toPromote := []string{}
+	toDemote := []string{}
+	primaryNodeCount := 0
+	for i := range s.Vdb.Spec.Subclusters {
+		sc := &s.Vdb.Spec.Subclusters[i]
+		dbType, ok := dbTypes[sc.Name]
+		// Skip subclusters that haven't been added to the database yet
+		if !ok || sc.IsTransient {
+			continue
+		}
+		if sc.IsPrimary {
+			primaryNodeCount += int(sc.Size)
+		}
+		if dbType == sc.GetType() {
+			continue
+		}
+		if sc.IsPrimary {
+			toPromote = append(toPromote, sc.Name)
+		} else {
+			toDemote = append(toDemote, sc.Name)
+		}
+	}
+	if len(toPromote) == 0 && len(toDemote) == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	minPrimaryNodes := vapi.KSafety0MinHosts
+	if s.Vdb.Spec.KSafety == vapi.KSafety1 {
+		minPrimaryNodes = vapi.KSafety1MinHosts
+	}
+	if primaryNodeCount < minPrimaryNodes {
+		s.VRec.Eventf(s.Vdb, corev1.EventTypeWarning, events.SubclusterTypeChangeFailed,
+			"Cannot change the type of subclusters %v because it would leave %d primary nodes. kSafety %s needs at least %d",
+			append(toPromote, toDemote...), primaryNodeCount, s.Vdb.Spec.KSafety, minPrimaryNodes)
+		return ctrl.Result{}, nil
+	}
+
+	// Every node of a subcluster must be up to change its type
+	scsToChange := map[string]bool{}
+	for _, scName := range append(toPromote, toDemote...) {
+		scsToChange[scName] = true
+	}
+	downPods := s.PFacts.filterPods(func(v *PodFact) bool {
+		return !v.upNode && scsToChange[v.subclusterName]
+	})
+	if len(downPods) > 0 {
+		s.Log.Info("Requeue because some nodes are down in a subcluster that needs its type changed",
+			"downPodCount", len(downPods))
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	// Promote before we demote so that we never go below the number of
+	// primary nodes needed for quorum.
+	for _, scName := range toPromote {
+		if err := s.alterSubcluster(ctx, pf, scName, "promote to primary"); err != nil {
+			return ctrl.Result{}, err
+		}
+		dbTypes[scName] = vapi.PrimarySubclusterType
+		s.VRec.Eventf(s.Vdb, corev1.EventTypeNormal, events.SubclusterPromoted,
+			"Successfully promoted subcluster '%s' to primary", scName)
+	}
+	for _, scName := range toDemote {
+		if err := s.alterSubcluster(ctx, pf, scName, "demote to secondary"); err != nil {
+			return ctrl.Result{}, err
+		}
+		dbTypes[scName] = vapi.SecondarySubclusterType
+		s.VRec.Eventf(s.Vdb, corev1.EventTypeNormal, events.SubclusterDemoted,
+			"Successfully demoted subcluster '%s' to secondary", scName)
+	}
+	s.PFacts.Invalidate()
+	return ctrl.Result{}, nil
+}
+
+// alterSubcluster will run the alter subcluster statement to change its type
+func (s *SubclusterTypeReconciler) alterSubcluster(ctx context.Context, pf *PodFact, scName, action string) error {
+	sql := fmt.Sprintf("alter subcluster \"%s\" %s;", scName, action)
+	_, stderr, err := s.PRunner.ExecVSQL(ctx, pf.name, names.ServerContainer, "-tAc", sql)
+	if err != nil {
+		s.VRec.Eventf(s.Vdb, corev1.EventTypeWarning, events.SubclusterTypeChangeFailed,
+			"Failed to %s subcluster '%s': %s", action, scName, stderr)
+		return err
+	}
+	return nil
+}
+
+// updateStatus will save the type of each subcluster in the status
+func (s *SubclusterTypeReconciler) updateStatus(ctx context.Context, dbTypes map[string]string) error {
+	return vdbstatus.Update(ctx, s.VRec.Client, s.Vdb, func(vdbChg *vapi.VerticaDB) error {
+		for i := range vdbChg.Status.Subclusters {
+			if dbType, ok := dbTypes[vdbChg.Status.Subclusters[i].Name]; ok {
+				vdbChg.Status.Subclusters[i].Type = dbType
+			}
+		}
+		return nil
+	})
+}
+
+// syncLabels will set the subcluster type label in the statefulset and pods to
+// match the type in the status. The pod template is left alone so that we
+// don't cause a rolling restart of the pods.
+func (s *SubclusterTypeReconciler) syncLabels(ctx context.Context) error {
+	for i := range s.Vdb.Spec.Subclusters {
+		sc := &s.Vdb.Spec.Subclusters[i]
+		scStatus, ok := s.Vdb.FindSubclusterStatus(sc.Name)
+		if !ok || scStatus.Type == "" {
+			continue
+		}
+		sts := &appsv1.StatefulSet{}
+		if err := s.VRec.Client.Get(ctx, names.GenStsName(s.Vdb, sc), sts); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if err := s.setTypeLabel(ctx, sts, scStatus.Type); err != nil {
+			return err
+		}
+
+		pods := &corev1.PodList{}
+		if err := s.VRec.Client.List(ctx, pods, client.InNamespace(s.Vdb.Namespace),
+			client.MatchingLabels(builder.MakeStsSelectorLabels(s.Vdb, sc))); err != nil {
+			return err
+		}
+		for j := range pods.Items {
+			if err := s.setTypeLabel(ctx, &pods.Items[j], scStatus.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setTypeLabel will patch the subcluster type label in the given object if it
+// differs
+func (s *SubclusterTypeReconciler) setTypeLabel(ctx context.Context, obj client.Object, scType string) error {
+	labels := obj.GetLabels()
+	if labels[vmeta.SubclusterTypeLabel] == scType {
+		return nil
+	}
+	s.Log.Info("Updating subcluster type label", "object", obj.GetName(), "type", scType)
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[vmeta.SubclusterTypeLabel] = scType
+	obj.SetLabels(labels)
+	return s.VRec.Client.Patch(ctx, obj, patch)
+}
@@ -0,0 +1,126 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/test"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("subclustertype_reconcile", func() {
+	ctx := context.Background()
+
+	It("should parse the subcluster types from vsql output", func() {
+		dbTypes := parseSubclusterTypes("sc1|t\nsc2|f\n\n")
+		Expect(dbTypes).Should(Equal(map[string]string{
+			"sc1": vapi.PrimarySubclusterType,
+			"sc2": vapi.SecondarySubclusterType,
+		}))
+	})
+
+	It("should promote before demote and sync the labels and status", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.KSafety = vapi.KSafety0
+		vdb.Spec.Subclusters = []vapi.Subcluster{
+			{Name: "sc1", Size: 1, IsPrimary: true},
+			{Name: "sc2", Size: 1, IsPrimary: false},
+		}
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		vdb.Status.Subclusters = []vapi.SubclusterStatus{
+			{Name: "sc1", Detail: []vapi.VerticaDBPodStatus{}},
+			{Name: "sc2", Detail: []vapi.VerticaDBPodStatus{}},
+		}
+		Expect(k8sClient.Status().Update(ctx, vdb)).Should(Succeed())
+
+		// Swap which subcluster is the primary
+		vdb.Spec.Subclusters[0].IsPrimary = false
+		vdb.Spec.Subclusters[1].IsPrimary = true
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		// Any up pod can be picked to run the query from
+		fpr.Results = cmds.CmdResults{}
+		for pn := range pfacts.Detail {
+			fpr.Results[pn] = []cmds.CmdResult{{Stdout: "sc1|t\nsc2|f\n"}}
+		}
+		r := MakeSubclusterTypeReconciler(vdbRec, logger, vdb, fpr, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+
+		promote := fpr.FindCommands(`alter subcluster "sc2" promote to primary`)
+		demote := fpr.FindCommands(`alter subcluster "sc1" demote to secondary`)
+		Expect(promote).Should(HaveLen(1))
+		Expect(demote).Should(HaveLen(1))
+		Expect(fpr.Histories).Should(ContainElements(promote[0], demote[0]))
+
+		Expect(vdb.Status.Subclusters[0].Type).Should(Equal(vapi.SecondarySubclusterType))
+		Expect(vdb.Status.Subclusters[1].Type).Should(Equal(vapi.PrimarySubclusterType))
+
+		sts := &appsv1.StatefulSet{}
+		Expect(k8sClient.Get(ctx, names.GenStsName(vdb, &vdb.Spec.Subclusters[1]), sts)).Should(Succeed())
+		Expect(sts.Labels[vmeta.SubclusterTypeLabel]).Should(Equal(vapi.PrimarySubclusterType))
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0), pod)).Should(Succeed())
+		Expect(pod.Labels[vmeta.SubclusterTypeLabel]).Should(Equal(vapi.SecondarySubclusterType))
+	})
+
+	It("should not change a type if k-safety can't be kept", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.KSafety = vapi.KSafety1
+		vdb.Spec.Subclusters = []vapi.Subcluster{
+			{Name: "sc1", Size: 3, IsPrimary: true},
+			{Name: "sc2", Size: 2, IsPrimary: false},
+		}
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		vdb.Status.Subclusters = []vapi.SubclusterStatus{
+			{Name: "sc1", Detail: []vapi.VerticaDBPodStatus{}},
+			{Name: "sc2", Detail: []vapi.VerticaDBPodStatus{}},
+		}
+		Expect(k8sClient.Status().Update(ctx, vdb)).Should(Succeed())
+
+		vdb.Spec.Subclusters[0].IsPrimary = false
+		vdb.Spec.Subclusters[1].IsPrimary = true
+
+		fpr := &cmds.FakePodRunner{}
+		pfacts := createPodFactsDefault(fpr)
+		Expect(pfacts.Collect(ctx, vdb)).Should(Succeed())
+		// Any up pod can be picked to run the query from
+		fpr.Results = cmds.CmdResults{}
+		for pn := range pfacts.Detail {
+			fpr.Results[pn] = []cmds.CmdResult{{Stdout: "sc1|t\nsc2|f\n"}}
+		}
+		r := MakeSubclusterTypeReconciler(vdbRec, logger, vdb, fpr, pfacts)
+		Expect(r.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(fpr.FindCommands("alter subcluster")).Should(BeEmpty())
+		Expect(vdb.Status.Subclusters[0].Type).Should(Equal(vapi.PrimarySubclusterType))
+	})
+})
@@ -107,7 +107,8 @@ func (s *UninstallReconciler) Reconcile(ctx context.Context, req *ctrl.Request)
 		}
 	}
 
-	return ctrl.Result{}, nil
+	// Clean up the PVCs of any pod that a prior iteration scaled down
+	return ctrl.Result{}, deleteScaledDownPVCs(ctx, s.VRec, s.Log, s.Vdb)
 }
 
 // reconcileSubcluster Will handle reconcile for a single subcluster
@@ -19,6 +19,7 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/go-logr/logr"
 	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
@@ -30,9 +31,20 @@ import (
 	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
+// subclusterUpgradePhaseOrder is the order that a subcluster moves through
+// during an upgrade.  The phase of a subcluster only ever moves forward.
+var subclusterUpgradePhaseOrder = []vapi.SubclusterUpgradePhase{
+	vapi.SubclusterUpgradePending,
+	vapi.SubclusterUpgradeDraining,
+	vapi.SubclusterUpgradeRecreating,
+	vapi.SubclusterUpgradeRestarting,
+	vapi.SubclusterUpgradeUpgraded,
+}
+
 type UpgradeManager struct {
 	VRec              *VerticaDBReconciler
 	Vdb               *vapi.VerticaDB
@@ -75,7 +87,12 @@ func (i *UpgradeManager) IsUpgradeNeeded(ctx context.Context) (bool, error) {
 		return ok, nil
 	}
 
-	return i.isVDBImageDifferent(ctx)
+	if ok, err := i.isVDBImageDifferent(ctx); ok || err != nil {
+		return ok, err
+	}
+	// The image change may have been reverted while the upgrade was waiting
+	// for a maintenance window.
+	return false, clearDeferredOperation(ctx, i.VRec, i.Vdb, MaintenanceOpUpgrade)
 }
 
 // isUpgradeInProgress returns true if state indicates that an upgrade
@@ -90,7 +107,9 @@ func (i *UpgradeManager) isUpgradeInProgress() (bool, error) {
 }
 
 // isVDBImageDifferent will check if an upgrade is needed based on the
-// image being different between the Vdb and any of the statefulset's.
+// image being different between the Vdb and any of the statefulset's.  After
+// a rollback, the desired image stays at the source image until spec.image is
+// changed again, so we don't retry the failed upgrade.
 func (i *UpgradeManager) isVDBImageDifferent(ctx context.Context) (bool, error) {
 	stss, err := i.Finder.FindStatefulSets(ctx, iter.FindInVdb)
 	if err != nil {
@@ -98,7 +117,7 @@ func (i *UpgradeManager) isVDBImageDifferent(ctx context.Context) (bool, error)
 	}
 	for inx := range stss.Items {
 		sts := stss.Items[inx]
-		if sts.Spec.Template.Spec.Containers[names.ServerContainerIndex].Image != i.Vdb.Spec.Image {
+		if sts.Spec.Template.Spec.Containers[names.ServerContainerIndex].Image != i.Vdb.GetDesiredImage() {
 			return true, nil
 		}
 	}
@@ -106,6 +125,16 @@ func (i *UpgradeManager) isVDBImageDifferent(ctx context.Context) (bool, error)
 	return false, nil
 }
 
+// deferToMaintenanceWindow returns true if the start of the upgrade is
+// deferred until a maintenance window is open.  An upgrade that is already in
+// progress is left to finish.
+func (i *UpgradeManager) deferToMaintenanceWindow(ctx context.Context) (bool, error) {
+	if i.ContinuingUpgrade {
+		return false, nil
+	}
+	return deferToMaintenanceWindow(ctx, i.VRec, i.Vdb, MaintenanceOpUpgrade)
+}
+
 // startUpgrade handles condition status and event recording for start of an upgrade
 func (i *UpgradeManager) startUpgrade(ctx context.Context) (ctrl.Result, error) {
 	i.Log.Info("Starting upgrade for reconciliation iteration", "ContinuingUpgrade", i.ContinuingUpgrade,
@@ -114,8 +143,19 @@ func (i *UpgradeManager) startUpgrade(ctx context.Context) (ctrl.Result, error)
 		return ctrl.Result{}, err
 	}
 
+	if err := i.initUpgradeState(ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// We only log an event message and bump a counter the first time we begin an upgrade.
 	if !i.ContinuingUpgrade {
+		// Clear out the rollback condition from any prior upgrade
+		err := vdbstatus.UpdateCondition(ctx, i.VRec.Client, i.Vdb,
+			vapi.VerticaDBCondition{Type: vapi.UpgradeRolledBack, Status: corev1.ConditionFalse},
+		)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
 		i.VRec.Eventf(i.Vdb, corev1.EventTypeNormal, events.UpgradeStart,
 			"Vertica server upgrade has started.")
 		metrics.UpgradeCount.With(metrics.MakeVDBLabels(i.Vdb)).Inc()
@@ -129,6 +169,19 @@ func (i *UpgradeManager) finishUpgrade(ctx context.Context) (ctrl.Result, error)
 		return ctrl.Result{}, err
 	}
 
+	err := i.updateUpgradeState(ctx, func(state *vapi.UpgradeState) {
+		now := metav1.Now()
+		state.TargetImage = i.Vdb.Spec.Image
+		state.Phase = vapi.UpgradePhaseCompleted
+		state.FinishTime = &now
+		for j := range state.Subclusters {
+			state.Subclusters[j].Phase = vapi.SubclusterUpgradeUpgraded
+		}
+	})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if err := i.toggleImageChangeInProgress(ctx, corev1.ConditionFalse); err != nil {
 		return ctrl.Result{}, err
 	}
@@ -160,6 +213,323 @@ func (i *UpgradeManager) setUpgradeStatus(ctx context.Context, msg string) error
 	return vdbstatus.UpdateUpgradeStatus(ctx, i.VRec.Client, i.Vdb, msg)
 }
 
+// initUpgradeState will setup the upgrade state in the status for a new
+// upgrade.  The existing state is kept if we are continuing an upgrade to the
+// same image.
+func (i *UpgradeManager) initUpgradeState(ctx context.Context) error {
+	state := i.Vdb.Status.UpgradeState
+	if i.ContinuingUpgrade && state != nil && state.TargetImage == i.Vdb.Spec.Image && state.FinishTime == nil {
+		return nil
+	}
+
+	sourceImage, err := i.fetchSourceImage(ctx)
+	if err != nil {
+		return err
+	}
+	now := metav1.Now()
+	newState := vapi.UpgradeState{
+		SourceImage: sourceImage,
+		TargetImage: i.Vdb.Spec.Image,
+		Policy:      i.getChosenUpgradePolicy(),
+		Phase:       vapi.UpgradePhaseStarting,
+		StartTime:   &now,
+		// Any canary approval in the spec was given for a prior upgrade
+		ConsumedCanaryApproval: i.Vdb.Spec.UpgradeCanary.Approval,
+	}
+	for j := range i.Vdb.Spec.Subclusters {
+		sc := &i.Vdb.Spec.Subclusters[j]
+		if sc.IsTransient {
+			continue
+		}
+		newState.Subclusters = append(newState.Subclusters, vapi.SubclusterUpgradeState{
+			Name:  sc.Name,
+			Phase: vapi.SubclusterUpgradePending,
+		})
+	}
+	return i.updateUpgradeState(ctx, func(state *vapi.UpgradeState) {
+		*state = newState
+	})
+}
+
+// fetchSourceImage returns the image we are upgrading from.  This is found by
+// looking for a statefulset that isn't running the new image yet.  An empty
+// string is returned if every statefulset already has the new image.
+func (i *UpgradeManager) fetchSourceImage(ctx context.Context) (string, error) {
+	stss, err := i.Finder.FindStatefulSets(ctx, iter.FindExisting|iter.FindSorted)
+	if err != nil {
+		return "", err
+	}
+	for inx := range stss.Items {
+		sts := &stss.Items[inx]
+		if sts.Labels[vmeta.SubclusterTransientLabel] == strconv.FormatBool(true) {
+			continue
+		}
+		img := sts.Spec.Template.Spec.Containers[names.ServerContainerIndex].Image
+		if img != i.Vdb.Spec.Image {
+			return img, nil
+		}
+	}
+	return "", nil
+}
+
+// getChosenUpgradePolicy returns the upgrade policy that this manager is
+// driving.  This is never Auto, as it reflects the policy that was picked.
+func (i *UpgradeManager) getChosenUpgradePolicy() vapi.UpgradePolicyType {
+	if i.StatusCondition == vapi.OnlineUpgradeInProgress {
+		return vapi.OnlineUpgrade
+	}
+	return vapi.OfflineUpgrade
+}
+
+// updateUpgradeState is a helper to update the structured upgrade state.
+func (i *UpgradeManager) updateUpgradeState(ctx context.Context, updateFunc func(*vapi.UpgradeState)) error {
+	return vdbstatus.UpdateUpgradeState(ctx, i.VRec.Client, i.Vdb, updateFunc)
+}
+
+// advanceUpgradePhase will move the upgrade to the given phase.  The phases
+// slice is the order of the phases for the type of upgrade being done.  We
+// only move forward in that list, so this is a no-op if we are already at, or
+// past, the given phase.
+func (i *UpgradeManager) advanceUpgradePhase(ctx context.Context, phases []vapi.UpgradePhase, phase vapi.UpgradePhase) error {
+	if i.Vdb.Status.UpgradeState != nil &&
+		indexOfUpgradePhase(phases, i.Vdb.Status.UpgradeState.Phase) >= indexOfUpgradePhase(phases, phase) {
+		return nil
+	}
+	return i.updateUpgradeState(ctx, func(state *vapi.UpgradeState) {
+		if indexOfUpgradePhase(phases, state.Phase) < indexOfUpgradePhase(phases, phase) {
+			state.Phase = phase
+		}
+	})
+}
+
+// advanceSubclusterUpgradePhase will move a subcluster to the given phase.
+// Like advanceUpgradePhase, a subcluster never moves backwards.  Passing an
+// empty string for scName will advance all subclusters.
+func (i *UpgradeManager) advanceSubclusterUpgradePhase(ctx context.Context, scName string,
+	phase vapi.SubclusterUpgradePhase) error {
+	needsUpdate := func(state *vapi.UpgradeState) bool {
+		if state == nil {
+			return true
+		}
+		found := false
+		for j := range state.Subclusters {
+			scState := &state.Subclusters[j]
+			if scName != "" && scState.Name != scName {
+				continue
+			}
+			found = true
+			if indexOfSubclusterUpgradePhase(scState.Phase) < indexOfSubclusterUpgradePhase(phase) {
+				return true
+			}
+		}
+		return scName != "" && !found
+	}
+	if !needsUpdate(i.Vdb.Status.UpgradeState) {
+		return nil
+	}
+	return i.updateUpgradeState(ctx, func(state *vapi.UpgradeState) {
+		found := false
+		for j := range state.Subclusters {
+			scState := &state.Subclusters[j]
+			if scName != "" && scState.Name != scName {
+				continue
+			}
+			found = true
+			if indexOfSubclusterUpgradePhase(scState.Phase) < indexOfSubclusterUpgradePhase(phase) {
+				scState.Phase = phase
+			}
+		}
+		if scName != "" && !found {
+			state.Subclusters = append(state.Subclusters, vapi.SubclusterUpgradeState{Name: scName, Phase: phase})
+		}
+	})
+}
+
+// recordUpgradeError will save the error in the upgrade state.  Failure to
+// save it is only logged, so that the original error is the one returned.
+func (i *UpgradeManager) recordUpgradeError(ctx context.Context, upgradeErr error) {
+	err := i.updateUpgradeState(ctx, func(state *vapi.UpgradeState) {
+		state.LastError = upgradeErr.Error()
+	})
+	if err != nil {
+		i.Log.Info("Failed to record the error in the upgrade state", "upgradeErr", upgradeErr, "err", err)
+	}
+}
+
+// indexOfUpgradePhase returns the position of the phase in the given list.
+// -1 is returned for phases not in the list, such as UpgradePhaseStarting.
+func indexOfUpgradePhase(phases []vapi.UpgradePhase, phase vapi.UpgradePhase) int {
+	for i := range phases {
+		if phases[i] == phase {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexOfSubclusterUpgradePhase returns the position of the phase in
+// subclusterUpgradePhaseOrder.
+func indexOfSubclusterUpgradePhase(phase vapi.SubclusterUpgradePhase) int {
+	for i := range subclusterUpgradePhaseOrder {
+		if subclusterUpgradePhaseOrder[i] == phase {
+			return i
+		}
+	}
+	return -1
+}
+
+// isRollingBack returns true if the upgrade failed and we are in the process
+// of rolling back to the source image.
+func (i *UpgradeManager) isRollingBack() bool {
+	return i.Vdb.Status.UpgradeState != nil && i.Vdb.Status.UpgradeState.Phase == vapi.UpgradePhaseRollingBack
+}
+
+// recordFailedRestart is called when vertica couldn't be restarted with the
+// new image.  It counts the failed attempt and will switch the upgrade to
+// rolling back if the rollback policy says so.
+func (i *UpgradeManager) recordFailedRestart(ctx context.Context, pfacts *PodFacts) error {
+	if i.isRollingBack() {
+		return nil
+	}
+	if err := pfacts.Collect(ctx, i.Vdb); err != nil {
+		return err
+	}
+	catalogUpgraded := i.isCatalogUpgraded(pfacts) || i.Vdb.Status.UpgradeState.CatalogUpgraded
+	rollbackNeeded := false
+	err := i.updateUpgradeState(ctx, func(state *vapi.UpgradeState) {
+		state.RestartAttempts++
+		if catalogUpgraded {
+			state.CatalogUpgraded = true
+		}
+		rollbackNeeded = i.isRollbackNeeded(state)
+	})
+	if err != nil || !rollbackNeeded {
+		return err
+	}
+	return i.startRollback(ctx, fmt.Sprintf("Vertica could not be restarted with the new image '%s'", i.Vdb.Spec.Image))
+}
+
+// startRollback will switch the upgrade over to rolling back to the source
+// image.  The reason is included in the event that is logged.
+func (i *UpgradeManager) startRollback(ctx context.Context, reason string) error {
+	err := i.updateUpgradeState(ctx, func(state *vapi.UpgradeState) {
+		state.Phase = vapi.UpgradePhaseRollingBack
+	})
+	if err != nil {
+		return err
+	}
+
+	sourceImage := i.Vdb.Status.UpgradeState.SourceImage
+	i.Log.Info("Rolling back the upgrade", "sourceImage", sourceImage, "reason", reason,
+		"restartAttempts", i.Vdb.Status.UpgradeState.RestartAttempts)
+	i.VRec.Eventf(i.Vdb, corev1.EventTypeWarning, events.UpgradeRollingBack,
+		"%s.  Rolling back to '%s'.", reason, sourceImage)
+	return i.setUpgradeStatus(ctx, fmt.Sprintf("Rolling back to image %s", sourceImage))
+}
+
+// recordCatalogUpgraded will persist in the upgrade state that the catalog
+// was upgraded once we see any node up with the new image.  This must be
+// saved right away, as the node may go down again before the next check.
+func (i *UpgradeManager) recordCatalogUpgraded(ctx context.Context, pfacts *PodFacts) error {
+	state := i.Vdb.Status.UpgradeState
+	if state == nil || state.CatalogUpgraded || i.isRollingBack() {
+		return nil
+	}
+	if err := pfacts.Collect(ctx, i.Vdb); err != nil {
+		return err
+	}
+	if !i.isCatalogUpgraded(pfacts) {
+		return nil
+	}
+	i.Log.Info("A vertica node is up with the new image.  The catalog has been upgraded, so a rollback is no longer possible.")
+	return i.updateUpgradeState(ctx, func(state *vapi.UpgradeState) {
+		state.CatalogUpgraded = true
+	})
+}
+
+// isCatalogUpgraded returns true if any vertica node has come up with the new
+// image.  Vertica upgrades the catalog when it starts with a new version, so a
+// rollback is no longer possible after this.
+func (i *UpgradeManager) isCatalogUpgraded(pfacts *PodFacts) bool {
+	for _, pf := range pfacts.Detail {
+		if pf.upNode && pf.image == i.Vdb.Spec.Image {
+			return true
+		}
+	}
+	return false
+}
+
+// canRollback returns true if the upgrade can still be rolled back to the
+// source image.  This is never the case once the catalog has been upgraded.
+func (i *UpgradeManager) canRollback(state *vapi.UpgradeState) bool {
+	return state != nil && !state.CatalogUpgraded && state.SourceImage != "" && state.SourceImage != i.Vdb.Spec.Image
+}
+
+// isRollbackNeeded returns true if the rollback policy says we should give up
+// on the upgrade.
+func (i *UpgradeManager) isRollbackNeeded(state *vapi.UpgradeState) bool {
+	policy := &i.Vdb.Spec.UpgradeRollbackPolicy
+	if !policy.Enabled || !i.canRollback(state) {
+		return false
+	}
+	if policy.MaxRestartAttempts > 0 && state.RestartAttempts >= policy.MaxRestartAttempts {
+		return true
+	}
+	if policy.DeadlineSeconds > 0 && state.StartTime != nil &&
+		time.Since(state.StartTime.Time) >= time.Duration(policy.DeadlineSeconds)*time.Second {
+		return true
+	}
+	return false
+}
+
+// revertToSourceImage will set the image in the statefulsets back to the image
+// we had prior to the upgrade.  Any pod running a different image is deleted
+// so that it comes back with the source image.  The spec is left alone; the
+// rollback phase in the upgrade state makes the source image the desired one.
+// It returns true if anything was changed.
+func (i *UpgradeManager) revertToSourceImage(ctx context.Context) (bool, error) {
+	numStsChanged, _, err := i.updateImageInStatefulSets(ctx)
+	if err != nil {
+		return numStsChanged > 0, err
+	}
+	numPodsDeleted, err := i.deletePodsRunningOldImage(ctx, "")
+	return numStsChanged > 0 || numPodsDeleted > 0, err
+}
+
+// finishRollback handles condition status and event recording for the end of
+// a rollback.
+func (i *UpgradeManager) finishRollback(ctx context.Context) (ctrl.Result, error) {
+	if err := i.setUpgradeStatus(ctx, ""); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err := i.updateUpgradeState(ctx, func(state *vapi.UpgradeState) {
+		now := metav1.Now()
+		state.Phase = vapi.UpgradePhaseRolledBack
+		state.FinishTime = &now
+	})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = vdbstatus.UpdateCondition(ctx, i.VRec.Client, i.Vdb,
+		vapi.VerticaDBCondition{Type: vapi.UpgradeRolledBack, Status: corev1.ConditionTrue},
+	)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := i.toggleImageChangeInProgress(ctx, corev1.ConditionFalse); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	i.Log.Info("The upgrade was rolled back")
+	i.VRec.Eventf(i.Vdb, corev1.EventTypeWarning, events.UpgradeRolledBack,
+		"Vertica server upgrade to '%s' was rolled back.  Image is '%s'.  Change spec.image to start a new upgrade",
+		i.Vdb.Spec.Image, i.Vdb.GetDesiredImage())
+	return ctrl.Result{}, nil
+}
+
 // updateImageInStatefulSets will change the image in each of the statefulsets.
 // This changes the images in all subclusters except any transient ones.
 func (i *UpgradeManager) updateImageInStatefulSets(ctx context.Context) (int, ctrl.Result, error) {
@@ -198,9 +568,10 @@ func (i *UpgradeManager) updateImageInStatefulSets(ctx context.Context) (int, ct
 func (i *UpgradeManager) updateImageInStatefulSet(ctx context.Context, sts *appsv1.StatefulSet) (bool, error) {
 	stsUpdated := false
 	// Skip the statefulset if it already has the proper image.
-	if sts.Spec.Template.Spec.Containers[names.ServerContainerIndex].Image != i.Vdb.Spec.Image {
+	img := i.Vdb.GetDesiredImage()
+	if sts.Spec.Template.Spec.Containers[names.ServerContainerIndex].Image != img {
 		i.Log.Info("Updating image in old statefulset", "name", sts.ObjectMeta.Name)
-		sts.Spec.Template.Spec.Containers[names.ServerContainerIndex].Image = i.Vdb.Spec.Image
+		sts.Spec.Template.Spec.Containers[names.ServerContainerIndex].Image = img
 		// We change the update strategy to OnDelete.  We don't want the k8s
 		// sts controller to interphere and do a rolling update after the
 		// update has completed.  We don't explicitly change this back.  The
@@ -240,7 +611,7 @@ func (i *UpgradeManager) deletePodsRunningOldImage(ctx context.Context, scName s
 		}
 
 		// Skip the pod if it already has the proper image.
-		if pod.Spec.Containers[names.ServerContainerIndex].Image != i.Vdb.Spec.Image {
+		if pod.Spec.Containers[names.ServerContainerIndex].Image != i.Vdb.GetDesiredImage() {
 			i.Log.Info("Deleting pod that had old image", "name", pod.ObjectMeta.Name)
 			err = i.VRec.Client.Delete(ctx, pod)
 			if err != nil {
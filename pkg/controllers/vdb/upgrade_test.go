@@ -17,6 +17,7 @@ package vdb
 
 import (
 	"context"
+	"fmt"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -189,6 +190,59 @@ var _ = Describe("upgrade", func() {
 		Expect(fetchedVdb.Status.UpgradeStatus).Should(Equal(""))
 	})
 
+	It("should track the structured upgrade state", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.Image = OldImage
+		vdb.Spec.Subclusters = []vapi.Subcluster{
+			{Name: "sc1", IsPrimary: true, Size: 1},
+			{Name: "sc2", IsPrimary: false, Size: 1},
+		}
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+		updateVdbToCauseUpgrade(ctx, vdb, NewImage)
+
+		mgr := MakeUpgradeManager(vdbRec, logger, vdb, vapi.OnlineUpgradeInProgress,
+			func(vdb *vapi.VerticaDB) bool { return true })
+		Expect(mgr.startUpgrade(ctx)).Should(Equal(ctrl.Result{}))
+		state := vdb.Status.UpgradeState
+		Expect(state).ShouldNot(BeNil())
+		Expect(state.SourceImage).Should(Equal(OldImage))
+		Expect(state.TargetImage).Should(Equal(NewImage))
+		Expect(state.Policy).Should(Equal(vapi.OnlineUpgrade))
+		Expect(state.Phase).Should(Equal(vapi.UpgradePhaseStarting))
+		Expect(state.StartTime).ShouldNot(BeNil())
+		Expect(state.FinishTime).Should(BeNil())
+		Expect(state.Subclusters).Should(Equal([]vapi.SubclusterUpgradeState{
+			{Name: "sc1", Phase: vapi.SubclusterUpgradePending},
+			{Name: "sc2", Phase: vapi.SubclusterUpgradePending},
+		}))
+
+		// Phases only move forward
+		Expect(mgr.advanceUpgradePhase(ctx, OnlineUpgradePhases, vapi.UpgradePhaseUpgradingSecondaries)).Should(Succeed())
+		Expect(mgr.advanceUpgradePhase(ctx, OnlineUpgradePhases, vapi.UpgradePhaseUpgradingPrimaries)).Should(Succeed())
+		Expect(mgr.advanceSubclusterUpgradePhase(ctx, "sc1", vapi.SubclusterUpgradeRestarting)).Should(Succeed())
+		Expect(mgr.advanceSubclusterUpgradePhase(ctx, "sc1", vapi.SubclusterUpgradeDraining)).Should(Succeed())
+		mgr.recordUpgradeError(ctx, fmt.Errorf("restart failed"))
+
+		fetchedVdb := &vapi.VerticaDB{}
+		Expect(k8sClient.Get(ctx, vdb.ExtractNamespacedName(), fetchedVdb)).Should(Succeed())
+		state = fetchedVdb.Status.UpgradeState
+		Expect(state.Phase).Should(Equal(vapi.UpgradePhaseUpgradingSecondaries))
+		Expect(state.Subclusters[0].Phase).Should(Equal(vapi.SubclusterUpgradeRestarting))
+		Expect(state.Subclusters[1].Phase).Should(Equal(vapi.SubclusterUpgradePending))
+		Expect(state.LastError).Should(Equal("restart failed"))
+
+		Expect(mgr.finishUpgrade(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(k8sClient.Get(ctx, vdb.ExtractNamespacedName(), fetchedVdb)).Should(Succeed())
+		state = fetchedVdb.Status.UpgradeState
+		Expect(state.Phase).Should(Equal(vapi.UpgradePhaseCompleted))
+		Expect(state.FinishTime).ShouldNot(BeNil())
+		Expect(state.Subclusters[0].Phase).Should(Equal(vapi.SubclusterUpgradeUpgraded))
+		Expect(state.Subclusters[1].Phase).Should(Equal(vapi.SubclusterUpgradeUpgraded))
+	})
+
 	It("should post next status message", func() {
 		vdb := vapi.MakeVDB()
 		test.CreateVDB(ctx, k8sClient, vdb)
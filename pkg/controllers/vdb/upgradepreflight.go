@@ -0,0 +1,396 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/builder"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/paths"
+	vtypes "github.com/vertica/vertica-kubernetes/pkg/types"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/describedb"
+	"github.com/vertica/vertica-kubernetes/pkg/vdbstatus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// The layout of the cluster lease expiration time that is reported when
+// describing the database.
+const clusterLeaseTimeLayout = "2006-01-02 15:04:05.999999999"
+
+// Waiting reasons of a container that indicate its image cannot be pulled
+var imagePullFailureReasons = []string{"ErrImagePull", "ImagePullBackOff", "InvalidImageName"}
+
+// UpgradePreflight will run a set of checks before an upgrade is started.  The
+// checks are done before any pod is touched, so a failure blocks the upgrade
+// while leaving the database as is.  The results are reported in the
+// UpgradePreflight status condition.
+type UpgradePreflight struct {
+	VRec       *VerticaDBReconciler
+	Log        logr.Logger
+	Vdb        *vapi.VerticaDB
+	PRunner    cmds.PodRunner
+	PFacts     *PodFacts
+	Dispatcher vadmin.Dispatcher
+	// Notes about what the checks could not verify.  These don't block the
+	// upgrade, but are included in the event when the checks pass.
+	Notes []string
+}
+
+// MakeUpgradePreflight will build an UpgradePreflight object
+func MakeUpgradePreflight(vdbrecon *VerticaDBReconciler, log logr.Logger, vdb *vapi.VerticaDB,
+	prunner cmds.PodRunner, pfacts *PodFacts, dispatcher vadmin.Dispatcher) *UpgradePreflight {
+	return &UpgradePreflight{VRec: vdbrecon, Log: log.WithName("UpgradePreflight"), Vdb: vdb,
+		PRunner: prunner, PFacts: pfacts, Dispatcher: dispatcher}
+}
+
+// Run will do all of the pre-flight checks.  It will requeue if any of the
+// checks failed or if we are still waiting on the result of a check.  The
+// upgrade can only proceed if an empty result is returned.
+func (u *UpgradePreflight) Run(ctx context.Context) (ctrl.Result, error) {
+	if vmeta.SkipUpgradePreflight(u.Vdb.Annotations) {
+		u.Log.Info("Skipping upgrade pre-flight checks because of annotation",
+			"annotation", vmeta.SkipUpgradePreflightAnnotation)
+		return ctrl.Result{}, nil
+	}
+
+	if err := u.PFacts.Collect(ctx, u.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	failures := []string{}
+	checks := []func(context.Context) ([]string, error){
+		u.checkDiskSpace,
+		u.checkNodesUp,
+		u.checkLicense,
+		u.checkClusterLease,
+	}
+	for _, check := range checks {
+		msgs, err := check(ctx)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		failures = append(failures, msgs...)
+	}
+	if len(failures) > 0 {
+		return u.reportFailures(ctx, failures)
+	}
+
+	// The image pull check is done last as it is the only one that may need
+	// to wait.
+	done, failure, err := u.checkImagePull(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !done {
+		u.Log.Info("Waiting for pod to pull the new image", "image", u.Vdb.Spec.Image)
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if failure != "" {
+		return u.reportFailures(ctx, []string{failure})
+	}
+
+	if err := u.setPreflightCondition(ctx, corev1.ConditionTrue); err != nil {
+		return ctrl.Result{}, err
+	}
+	msg := fmt.Sprintf("Upgrade pre-flight checks passed for image '%s'", u.Vdb.Spec.Image)
+	if len(u.Notes) > 0 {
+		msg = fmt.Sprintf("%s.  Not verified: %s", msg, strings.Join(u.Notes, "; "))
+	}
+	u.VRec.Event(u.Vdb, corev1.EventTypeNormal, events.UpgradePreflightSucceeded, msg)
+	return ctrl.Result{}, nil
+}
+
+// reportFailures will log an event for each failed check and set the status
+// condition so that the upgrade is blocked.
+func (u *UpgradePreflight) reportFailures(ctx context.Context, failures []string) (ctrl.Result, error) {
+	for _, msg := range failures {
+		u.VRec.Eventf(u.Vdb, corev1.EventTypeWarning, events.UpgradePreflightFailed,
+			"Upgrade to image '%s' is blocked: %s", u.Vdb.Spec.Image, msg)
+	}
+	if err := u.setPreflightCondition(ctx, corev1.ConditionFalse); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// setPreflightCondition will set the UpgradePreflight status condition
+func (u *UpgradePreflight) setPreflightCondition(ctx context.Context, newVal corev1.ConditionStatus) error {
+	return vdbstatus.UpdateCondition(ctx, u.VRec.Client, u.Vdb,
+		vapi.VerticaDBCondition{Type: vapi.UpgradePreflight, Status: newVal},
+	)
+}
+
+// checkDiskSpace will make sure each pod has enough free space in the
+// persistent volumes that hold the catalog and depot.  The upgrade will write
+// to the catalog, so we don't want to start it if we are about to run out.
+func (u *UpgradePreflight) checkDiskSpace(_ context.Context) ([]string, error) {
+	failures := []string{}
+	pods := u.PFacts.findPodsLowOnDiskSpace(FreeSpaceThreshold)
+	for i := range pods {
+		failures = append(failures, fmt.Sprintf("low disk space in persistent volume %s attached to %s",
+			strings.Join(pods[i].findVolumesLowOnDiskSpace(FreeSpaceThreshold), ","), pods[i].name.Name))
+	}
+	return failures, nil
+}
+
+// checkNodesUp will make sure that if the database is running, all of its
+// nodes are up.  We don't want to start an upgrade with a degraded cluster.
+// A database that is entirely down is allowed through.
+func (u *UpgradePreflight) checkNodesUp(_ context.Context) ([]string, error) {
+	if _, ok := u.PFacts.findPodToRunVsql(true, ""); !ok {
+		return nil, nil
+	}
+	failures := []string{}
+	pods := u.PFacts.filterPods(func(v *PodFact) bool {
+		return v.dbExists && !v.shutdown && !v.pendingDelete && !v.upNode
+	})
+	for i := range pods {
+		failures = append(failures, fmt.Sprintf("vertica is not up in pod %s", pods[i].name.Name))
+	}
+	return failures, nil
+}
+
+// checkLicense will make sure the license installed in the database hasn't
+// expired.  We can only do this check if the database is up.  Vertica doesn't
+// report which server versions a license covers, so that part can't be
+// checked here.  This is noted in the event when the checks pass.
+func (u *UpgradePreflight) checkLicense(ctx context.Context) ([]string, error) {
+	const VersionNote = "that the license covers the new server version"
+	pf, ok := u.PFacts.findPodToRunVsql(false, "")
+	if !ok {
+		u.Notes = append(u.Notes, "the license, as the database is down", VersionNote)
+		return nil, nil
+	}
+	u.Notes = append(u.Notes, VersionNote)
+	stdout, _, err := u.PRunner.ExecVSQL(ctx, pf.name, names.ServerContainer, "-tAc", "select get_compliance_status();")
+	if err != nil {
+		return nil, err
+	}
+	daysRemaining, ok := parseLicenseDaysRemaining(stdout)
+	if !ok {
+		if !strings.Contains(stdout, "Perpetual") {
+			u.Notes = append(u.Notes, "the license expiration, as get_compliance_status() didn't report it")
+		}
+		return nil, nil
+	}
+	if daysRemaining < 0 {
+		return []string{fmt.Sprintf("the license expired %.0f days ago", -daysRemaining)}, nil
+	}
+	return nil, nil
+}
+
+// parseLicenseDaysRemaining will parse the output of get_compliance_status()
+// to find the number of days remaining in the license.  The second return
+// value is false if this couldn't be found, such as for a perpetual license.
+func parseLicenseDaysRemaining(op string) (float64, bool) {
+	re := regexp.MustCompile(`(?m)^\s*Days Remaining:\s*(-?[0-9.]+)`)
+	m := re.FindStringSubmatch(op)
+	if m == nil {
+		return 0, false
+	}
+	days, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return days, true
+}
+
+// checkClusterLease will make sure no other cluster holds an unexpired lease
+// on the communal storage.  If one does, we won't be able to restart vertica
+// with the new image.  This only applies to an Eon database that is down.  A
+// running database holds the lease itself, so we can't tell a foreign lease
+// apart from our own.  For that case, an offline upgrade repeats this check
+// with CheckClusterLeaseAfterStop once the cluster is stopped.  An online
+// upgrade keeps the database up, so it never has to reacquire the lease.
+func (u *UpgradePreflight) checkClusterLease(ctx context.Context) ([]string, error) {
+	if !u.Vdb.IsEON() || u.Vdb.Spec.IgnoreClusterLease {
+		return nil, nil
+	}
+	if _, ok := u.PFacts.findPodToRunVsql(true, ""); ok {
+		return nil, nil
+	}
+	pf, ok := u.PFacts.findPodToRunAdmintoolsOffline()
+	if !ok {
+		return nil, nil
+	}
+
+	g := GenericDatabaseInitializer{
+		VRec:                u.VRec,
+		Log:                 u.Log,
+		Vdb:                 u.Vdb,
+		PRunner:             u.PRunner,
+		PFacts:              u.PFacts,
+		ConfigurationParams: vtypes.MakeCiMap(),
+	}
+	if res, err := g.ConstructConfigParms(ctx); verrors.IsReconcileAborted(res, err) {
+		if err == nil {
+			return []string{"could not build the communal storage parameters"}, nil
+		}
+		return nil, err
+	}
+	op, res, err := u.Dispatcher.DescribeDB(ctx,
+		describedb.WithInitiator(pf.name),
+		describedb.WithDBName(u.Vdb.Spec.DBName),
+		describedb.WithCommunalPath(u.Vdb.GetCommunalPath()),
+		describedb.WithCommunalStorageParams(paths.AuthParmsFile),
+		describedb.WithConfigurationParams(g.ConfigurationParams.GetMap()),
+	)
+	if verrors.IsReconcileAborted(res, err) {
+		if err == nil {
+			return []string{"could not describe the database in communal storage"}, nil
+		}
+		return nil, err
+	}
+	expiration, ok := parseClusterLeaseExpiration(op)
+	if ok && expiration.After(time.Now().UTC()) {
+		return []string{fmt.Sprintf("another cluster holds a lease on the communal storage until %s", expiration)}, nil
+	}
+	return nil, nil
+}
+
+// CheckClusterLeaseAfterStop will check the cluster lease once an offline
+// upgrade has stopped the database.  The check done before the upgrade is
+// skipped when the database is up.  A clean shutdown releases our lease, so
+// any lease that is still held belongs to another cluster.  We block the
+// upgrade, with the database down, until it expires rather than fail the
+// restart.
+func (u *UpgradePreflight) CheckClusterLeaseAfterStop(ctx context.Context) (ctrl.Result, error) {
+	if vmeta.SkipUpgradePreflight(u.Vdb.Annotations) {
+		return ctrl.Result{}, nil
+	}
+	// The facts were collected before the stop, so they must be refreshed
+	u.PFacts.Invalidate()
+	if err := u.PFacts.Collect(ctx, u.Vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+	failures, err := u.checkClusterLease(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(failures) > 0 {
+		return u.reportFailures(ctx, failures)
+	}
+	return ctrl.Result{}, nil
+}
+
+// parseClusterLeaseExpiration will parse the output of describe db to find
+// the time the cluster lease expires.  The second return value is false if
+// there is no lease or the time couldn't be parsed.
+func parseClusterLeaseExpiration(op string) (time.Time, bool) {
+	re := regexp.MustCompile(`(?m)^\s*Cluster lease expiration:\s*(.*)$`)
+	m := re.FindStringSubmatch(op)
+	if m == nil {
+		return time.Time{}, false
+	}
+	val := strings.TrimSpace(m[1])
+	if val == "" || strings.EqualFold(val, "none") {
+		return time.Time{}, false
+	}
+	expiration, err := time.Parse(clusterLeaseTimeLayout, val)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expiration, true
+}
+
+// checkImagePull will verify that the new image can be pulled.  It does this
+// by scheduling a throwaway pod that uses the image.  The first return value
+// is true once we know the outcome; the second is the failure message if the
+// image could not be pulled.
+func (u *UpgradePreflight) checkImagePull(ctx context.Context) (done bool, failure string, err error) {
+	nm := names.GenUpgradePreflightPodName(u.Vdb)
+	pod := &corev1.Pod{}
+	if err = u.VRec.Client.Get(ctx, nm, pod); err != nil {
+		if !errors.IsNotFound(err) {
+			return false, "", err
+		}
+		pod = builder.BuildUpgradePreflightPod(nm, u.Vdb)
+		if err = ctrl.SetControllerReference(u.Vdb, pod, u.VRec.Scheme); err != nil {
+			return false, "", err
+		}
+		u.Log.Info("Creating pod to check if the new image can be pulled", "name", nm, "image", u.Vdb.Spec.Image)
+		return false, "", u.VRec.Client.Create(ctx, pod)
+	}
+
+	// A pod left over from a prior upgrade attempt may be for a different
+	// image.  We delete it so that it gets recreated with the current one.
+	if pod.Spec.Containers[names.ServerContainerIndex].Image != u.Vdb.Spec.Image {
+		return false, "", u.deleteImagePullPod(ctx, pod)
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodRunning, corev1.PodSucceeded:
+		// The container was able to start, so the image was pulled.
+		return true, "", u.deleteImagePullPod(ctx, pod)
+	case corev1.PodFailed:
+		// The container only runs 'exit 0'.  If the pod failed, either the
+		// image couldn't be pulled or it can't run on the node.
+		failure = fmt.Sprintf("the pod that checks the image failed: %s", getPodFailureReason(pod))
+		return true, failure, u.deleteImagePullPod(ctx, pod)
+	}
+	for i := range pod.Status.ContainerStatuses {
+		waiting := pod.Status.ContainerStatuses[i].State.Waiting
+		if waiting == nil {
+			continue
+		}
+		for _, reason := range imagePullFailureReasons {
+			if waiting.Reason == reason {
+				failure = fmt.Sprintf("the image cannot be pulled (%s): %s", waiting.Reason, waiting.Message)
+				return true, failure, u.deleteImagePullPod(ctx, pod)
+			}
+		}
+	}
+	return false, "", nil
+}
+
+// getPodFailureReason returns a description of why a pod failed.  The state
+// of the terminated container is preferred over the pod's reason.
+func getPodFailureReason(pod *corev1.Pod) string {
+	for i := range pod.Status.ContainerStatuses {
+		term := pod.Status.ContainerStatuses[i].State.Terminated
+		if term != nil {
+			return fmt.Sprintf("container exited with code %d (%s) %s", term.ExitCode, term.Reason, term.Message)
+		}
+	}
+	if pod.Status.Reason != "" || pod.Status.Message != "" {
+		return fmt.Sprintf("%s %s", pod.Status.Reason, pod.Status.Message)
+	}
+	return "unknown reason"
+}
+
+// deleteImagePullPod will delete the pod used to check the image pull
+func (u *UpgradePreflight) deleteImagePullPod(ctx context.Context, pod *corev1.Pod) error {
+	u.Log.Info("Deleting pod used to check the image pull", "name", pod.Name)
+	if err := u.VRec.Client.Delete(ctx, pod); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/test"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("upgradepreflight", func() {
+	ctx := context.Background()
+
+	// createUpgradePreflight is a helper to build an UpgradePreflight whose
+	// pods all have plenty of disk space.
+	createUpgradePreflight := func(vdb *vapi.VerticaDB) (*UpgradePreflight, *PodFacts) {
+		fpr := &cmds.FakePodRunner{Results: cmds.CmdResults{}}
+		pfacts := createPodFactsDefault(fpr)
+		ExpectWithOffset(1, pfacts.Collect(ctx, vdb)).Should(Succeed())
+		for _, pf := range pfacts.Detail {
+			pf.localDataAvail = 1024 * 1024 * 1024
+		}
+		dispatcher := vdbRec.makeDispatcher(logger, vdb, fpr, TestPassword)
+		return MakeUpgradePreflight(vdbRec, logger, vdb, fpr, pfacts, dispatcher), pfacts
+	}
+
+	It("should block the upgrade if a pod is low on disk space", func() {
+		vdb := vapi.MakeVDB()
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		u, pfacts := createUpgradePreflight(vdb)
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+		pfacts.Detail[pn].localDataAvail = FreeSpaceThreshold / 2
+		Expect(u.Run(ctx)).Should(Equal(ctrl.Result{Requeue: true}))
+
+		Expect(k8sClient.Get(ctx, vdb.ExtractNamespacedName(), vdb)).Should(Succeed())
+		Expect(vdb.Status.Conditions[vapi.UpgradePreflightIndex].Status).Should(Equal(corev1.ConditionFalse))
+		// We shouldn't get as far as checking the image
+		pod := &corev1.Pod{}
+		err := k8sClient.Get(ctx, names.GenUpgradePreflightPodName(vdb), pod)
+		Expect(errors.IsNotFound(err)).Should(BeTrue())
+	})
+
+	It("should block the upgrade if a node is down", func() {
+		vdb := vapi.MakeVDB()
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		u, pfacts := createUpgradePreflight(vdb)
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 1)
+		pfacts.Detail[pn].upNode = false
+		failures, err := u.checkNodesUp(ctx)
+		Expect(err).Should(Succeed())
+		Expect(failures).Should(HaveLen(1))
+
+		// No failures are reported if the entire database is down
+		for _, pf := range pfacts.Detail {
+			pf.upNode = false
+		}
+		Expect(u.checkNodesUp(ctx)).Should(BeEmpty())
+	})
+
+	It("should skip the checks if the annotation is set", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Annotations = map[string]string{vmeta.SkipUpgradePreflightAnnotation: "true"}
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		u, pfacts := createUpgradePreflight(vdb)
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+		pfacts.Detail[pn].localDataAvail = 0
+		Expect(u.Run(ctx)).Should(Equal(ctrl.Result{}))
+	})
+
+	It("should use a pod to check if the new image can be pulled", func() {
+		vdb := vapi.MakeVDB()
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		u, _ := createUpgradePreflight(vdb)
+		nm := names.GenUpgradePreflightPodName(vdb)
+		// The first run creates the pod and waits for the image
+		Expect(u.Run(ctx)).Should(Equal(ctrl.Result{Requeue: true}))
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, nm, pod)).Should(Succeed())
+		Expect(pod.Spec.Containers[0].Image).Should(Equal(vdb.Spec.Image))
+
+		// Simulate a failure to pull the image
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{
+				Name:  names.ServerContainer,
+				Image: vdb.Spec.Image,
+				State: corev1.ContainerState{
+					Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"},
+				},
+			},
+		}
+		Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+		Expect(u.Run(ctx)).Should(Equal(ctrl.Result{Requeue: true}))
+		Expect(vdb.Status.Conditions[vapi.UpgradePreflightIndex].Status).Should(Equal(corev1.ConditionFalse))
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, nm, pod))).Should(BeTrue())
+
+		// Simulate the pod running to completion
+		Expect(u.Run(ctx)).Should(Equal(ctrl.Result{Requeue: true}))
+		Expect(k8sClient.Get(ctx, nm, pod)).Should(Succeed())
+		pod.Status.Phase = corev1.PodSucceeded
+		Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+		Expect(u.Run(ctx)).Should(Equal(ctrl.Result{}))
+		Expect(vdb.Status.Conditions[vapi.UpgradePreflightIndex].Status).Should(Equal(corev1.ConditionTrue))
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, nm, pod))).Should(BeTrue())
+	})
+
+	It("should block the upgrade if the pod that checks the image fails", func() {
+		vdb := vapi.MakeVDB()
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		u, _ := createUpgradePreflight(vdb)
+		nm := names.GenUpgradePreflightPodName(vdb)
+		Expect(u.Run(ctx)).Should(Equal(ctrl.Result{Requeue: true}))
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, nm, pod)).Should(Succeed())
+		pod.Status.Phase = corev1.PodFailed
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{
+				Name: names.ServerContainer,
+				State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", Message: "exec format error"},
+				},
+			},
+		}
+		Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+		Expect(u.Run(ctx)).Should(Equal(ctrl.Result{Requeue: true}))
+		Expect(vdb.Status.Conditions[vapi.UpgradePreflightIndex].Status).Should(Equal(corev1.ConditionFalse))
+		Expect(errors.IsNotFound(k8sClient.Get(ctx, nm, pod))).Should(BeTrue())
+	})
+
+	It("should note what the license check couldn't verify", func() {
+		vdb := vapi.MakeVDB()
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		defer test.DeletePods(ctx, k8sClient, vdb)
+
+		u, pfacts := createUpgradePreflight(vdb)
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+		for _, pf := range pfacts.Detail {
+			pf.upNode = pf.name == pn
+		}
+		fpr := u.PRunner.(*cmds.FakePodRunner)
+		fpr.Results[pn] = []cmds.CmdResult{{Stdout: "No expiration date for a Perpetual license\n"}}
+		Expect(u.checkLicense(ctx)).Should(BeEmpty())
+		Expect(u.Notes).Should(ConsistOf("that the license covers the new server version"))
+
+		u.Notes = nil
+		fpr.Results[pn] = []cmds.CmdResult{{Stdout: "Days Remaining: -3.5\n"}}
+		Expect(u.checkLicense(ctx)).Should(ConsistOf(ContainSubstring("expired")))
+
+		u.Notes = nil
+		fpr.Results[pn] = []cmds.CmdResult{{Stdout: "something unexpected\n"}}
+		Expect(u.checkLicense(ctx)).Should(BeEmpty())
+		Expect(u.Notes).Should(ContainElement(ContainSubstring("the license expiration")))
+	})
+
+	It("should parse the license days remaining", func() {
+		op := ` Raw Data Size: 2.00GB +/- 0.003GB
+ License Size : 4.000GB
+ Utilization  : 50%
+ Compliance Status : The database is in compliance with respect to raw data size.
+ License End Date: 04/06/2011
+ Days Remaining: -28.59
+`
+		days, ok := parseLicenseDaysRemaining(op)
+		Expect(ok).Should(BeTrue())
+		Expect(days).Should(BeNumerically("<", 0))
+		_, ok = parseLicenseDaysRemaining("No expiration date for a Perpetual license")
+		Expect(ok).Should(BeFalse())
+	})
+
+	It("should parse the cluster lease expiration", func() {
+		expiration, ok := parseClusterLeaseExpiration("Cluster lease expiration: 2023-02-01 15:07:32.022759\n")
+		Expect(ok).Should(BeTrue())
+		Expect(expiration.Year()).Should(Equal(2023))
+		_, ok = parseClusterLeaseExpiration("Cluster lease expiration: None\n")
+		Expect(ok).Should(BeFalse())
+		_, ok = parseClusterLeaseExpiration("")
+		Expect(ok).Should(BeFalse())
+	})
+})
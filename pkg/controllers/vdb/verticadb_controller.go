@@ -23,6 +23,7 @@ import (
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/rest"
@@ -58,13 +59,16 @@ type VerticaDBReconciler struct {
 //+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticadbs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticadbs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticadbs/finalizers,verbs=update
+//+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticarestores,verbs=get;list;watch
+//+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticarestores/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,namespace=WATCH_NAMESPACE,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,namespace=WATCH_NAMESPACE,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=policy,namespace=WATCH_NAMESPACE,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",namespace=WATCH_NAMESPACE,resources=pods,verbs=get;list;watch;create;update;delete;patch
 // +kubebuilder:rbac:groups="",namespace=WATCH_NAMESPACE,resources=pods/exec,verbs=create
 // +kubebuilder:rbac:groups="",namespace=WATCH_NAMESPACE,resources=pods/status,verbs=update
 // +kubebuilder:rbac:groups="",namespace=WATCH_NAMESPACE,resources=secrets,verbs=get;list;watch;create;update
-// +kubebuilder:rbac:groups="",namespace=WATCH_NAMESPACE,resources=persistentvolumeclaims,verbs=get;list;watch;update
+// +kubebuilder:rbac:groups="",namespace=WATCH_NAMESPACE,resources=persistentvolumeclaims,verbs=get;list;watch;update;patch;delete
 // +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations,verbs=get;list;watch;update;patch
 
@@ -74,6 +78,7 @@ func (r *VerticaDBReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&vapi.VerticaDB{}).
 		Owns(&corev1.Service{}).
 		Owns(&appsv1.StatefulSet{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
 		Complete(r)
 }
 
@@ -100,29 +105,65 @@ func (r *VerticaDBReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
+	// A VerticaDB is only left around after it is deleted if it has our
+	// finalizer. We apply the PVC retention policy and let it go. This is done
+	// even if the operator is paused so that we don't hold up the deletion.
+	if vdb.DeletionTimestamp != nil {
+		return ctrl.Result{}, r.finalizeVDB(ctx, log, vdb)
+	}
+	if err = r.reconcilePVCRetentionFinalizer(ctx, vdb); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if vmeta.IsPauseAnnotationSet(vdb.Annotations) {
 		log.Info(fmt.Sprintf("The pause annotation %s is set. Suspending the iteration", vmeta.PauseOperatorAnnotation),
 			"result", ctrl.Result{}, "err", nil)
 		return ctrl.Result{}, nil
 	}
 
+	// A mutating VerticaDBOperation reuses some of our actors, such as the
+	// restart, against the database. We hold off until it finishes so that the
+	// two don't race each other.
+	opName, err := findRunningMutatingOperation(ctx, r, vdb.Namespace, vdb.Name, "")
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if opName != "" {
+		log.Info("Waiting for VerticaDBOperation to finish", "operation", opName)
+		return ctrl.Result{RequeueAfter: OperationPendingRequeueTime}, nil
+	}
+
 	passwd, err := r.GetSuperuserPassword(ctx, vdb, log)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 	prunner := cmds.MakeClusterPodRunner(log, r.Cfg, passwd)
+	dispatcher := r.makeDispatcher(log, vdb, prunner, passwd)
+	return r.runActors(ctx, &req, log, vdb, prunner, dispatcher)
+}
+
+// runActors will run each of the actors for the vdb in sequence. It stops at
+// the first actor that fails or asks for a requeue.
+func (r *VerticaDBReconciler) runActors(ctx context.Context, req *ctrl.Request, log logr.Logger, vdb *vapi.VerticaDB,
+	prunner cmds.PodRunner, dispatcher vadmin.Dispatcher) (ctrl.Result, error) {
 	// We use the same pod facts for all reconcilers. This allows to reuse as
 	// much as we can. Some reconcilers will purposely invalidate the facts if
 	// it is known they did something to make them stale.
 	pfacts := MakePodFacts(r, prunner)
-	dispatcher := r.makeDispatcher(log, vdb, prunner, passwd)
 	var res ctrl.Result
+	var err error
+
+	// Anything that was deferred to a maintenance window can proceed now if
+	// one is open.
+	if err = releaseDeferredOperations(ctx, r, vdb); err != nil {
+		return res, err
+	}
 
 	// Iterate over each actor
 	actors := r.constructActors(log, vdb, prunner, &pfacts, dispatcher)
 	for _, act := range actors {
 		log.Info("starting actor", "name", fmt.Sprintf("%T", act))
-		res, err = act.Reconcile(ctx, &req)
+		res, err = act.Reconcile(ctx, req)
 		// Error or a request to requeue will stop the reconciliation.
 		if verrors.IsReconcileAborted(res, err) {
 			// Handle requeue time priority.
@@ -138,6 +179,17 @@ func (r *VerticaDBReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		}
 	}
 
+	// With autoGrow, we must come back to check the disk usage again.
+	if pollTime := getAutoGrowPollTime(vdb); pollTime > 0 {
+		res.RequeueAfter = pollTime
+	}
+	// We must also come back when the next maintenance window opens to carry
+	// out any operations that were deferred to it.
+	if waitTime := getMaintenanceWindowRequeueTime(vdb); waitTime > 0 &&
+		(res.RequeueAfter == 0 || waitTime < res.RequeueAfter) {
+		res.RequeueAfter = waitTime
+	}
+
 	log.Info("ending reconcile of VerticaDB", "result", res, "err", err)
 	return res, err
 }
@@ -145,12 +197,19 @@ func (r *VerticaDBReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 // constructActors will a list of actors that should be run for the reconcile.
 // Order matters in that some actors depend on the successeful execution of
 // earlier ones.
-func (r *VerticaDBReconciler) constructActors(log logr.Logger, vdb *vapi.VerticaDB, prunner *cmds.ClusterPodRunner,
+func (r *VerticaDBReconciler) constructActors(log logr.Logger, vdb *vapi.VerticaDB, prunner cmds.PodRunner,
 	pfacts *PodFacts, dispatcher vadmin.Dispatcher) []controllers.ReconcileActor {
 	// The actors that will be applied, in sequence, to reconcile a vdb.
 	// Note, we run the StatusReconciler multiple times. This allows us to
 	// refresh the status of the vdb as we do operations that affect it.
 	return []controllers.ReconcileActor{
+		// Rename any subclusters first. The status is keyed by the subcluster
+		// name, so this must be done before it gets refreshed.
+		MakeSubclusterRenameReconciler(r, log, vdb, prunner, pfacts),
+		// Rebuild, one at a time, any pod whose PVCs use an old storage class.
+		// Like the rename, this can recreate statefulsets, so it must come
+		// before the ObjReconciler.
+		MakeStorageClassMigrationReconciler(r, log, vdb, prunner, pfacts, dispatcher),
 		// Always start with a status reconcile in case the prior reconcile failed.
 		MakeStatusReconciler(r.Client, r.Scheme, log, vdb, pfacts),
 		MakeMetricReconciler(r, vdb, prunner, pfacts),
@@ -158,7 +217,7 @@ func (r *VerticaDBReconciler) constructActors(log logr.Logger, vdb *vapi.Vertica
 		MakeLocalDataCheckReconciler(r, vdb, pfacts),
 		// Handle upgrade actions for any k8s objects created in prior versions
 		// of the operator.
-		MakeUpgradeOperator120Reconciler(r, log, vdb),
+		MakeOperatorMigrationReconciler(r, log, vdb),
 		// Create a TLS secret for the HTTP server
 		MakeHTTPServerCertGenReconciler(r, vdb),
 		// Update any k8s objects with some exceptions. For instance, preserve
@@ -172,6 +231,10 @@ func (r *VerticaDBReconciler) constructActors(log logr.Logger, vdb *vapi.Vertica
 			ObjReconcileModePreserveScaling|ObjReconcileModePreserveUpdateStrategy),
 		// Add annotations/labels to each pod about the host running them
 		MakeAnnotateAndLabelPodReconciler(r, vdb, pfacts),
+		// Maintain the PodDisruptionBudgets for the primaries and each
+		// secondary subcluster. This is done before the restart so that the
+		// budgets allow for the pods the operator is about to restart.
+		MakePDBReconciler(r, log, vdb, pfacts),
 		// Handles vertica server upgrade (i.e., when spec.image changes)
 		MakeOfflineUpgradeReconciler(r, log, vdb, prunner, pfacts, dispatcher),
 		MakeOnlineUpgradeReconciler(r, log, vdb, prunner, pfacts, dispatcher),
@@ -188,6 +251,9 @@ func (r *VerticaDBReconciler) constructActors(log logr.Logger, vdb *vapi.Vertica
 		MakeClientRoutingLabelReconciler(r, vdb, pfacts, DelNodeApplyMethod, ""),
 		// Wait for any nodes that are pending delete with active connections to leave.
 		MakeDrainNodeReconciler(r, vdb, prunner, pfacts),
+		// Stop the nodes of any subcluster that is being shutdown. The
+		// statefulset is scaled to zero later by the ObjReconciler.
+		MakeSubclusterShutdownReconciler(r, log, vdb, prunner, pfacts),
 		// Handles calls to remove subcluster from vertica catalog
 		MakeDBRemoveSubclusterReconciler(r, log, vdb, prunner, pfacts, dispatcher),
 		MakeStatusReconciler(r.Client, r.Scheme, log, vdb, pfacts),
@@ -227,13 +293,24 @@ func (r *VerticaDBReconciler) constructActors(log logr.Logger, vdb *vapi.Vertica
 		// Handle calls to add a new database node to the cluster
 		MakeDBAddNodeReconciler(r, log, vdb, prunner, pfacts, dispatcher),
 		MakeStatusReconciler(r.Client, r.Scheme, log, vdb, pfacts),
+		// Put each node in the fault group for the zone its pod runs in
+		MakeFaultGroupReconciler(r, log, vdb, prunner, pfacts),
+		// Promote or demote any subcluster whose isPrimary has changed
+		MakeSubclusterTypeReconciler(r, log, vdb, prunner, pfacts),
+		// Change the number of shards if spec.shardCount was updated
+		MakeReshardReconciler(r, log, vdb, prunner, pfacts),
 		// Handle calls to rebalance_shards
 		MakeRebalanceShardsReconciler(r, log, vdb, prunner, pfacts, "" /* all subclusters */),
 		// Update the label in pods so that Service routing uses them if they
 		// have finished being rebalanced.
 		MakeClientRoutingLabelReconciler(r, vdb, pfacts, AddNodeApplyMethod, ""),
+		// Set any config parameters in the database that differ from the spec
+		MakeConfigParamsReconciler(r, log, vdb, prunner, pfacts),
 		// Resize any PVs if the local data size changed in the vdb
 		MakeResizePVReconciler(r, vdb, prunner, pfacts),
+		// Tighten the PodDisruptionBudgets again now that any upgrade or
+		// restart is done.
+		MakePDBReconciler(r, log, vdb, pfacts),
 	}
 }
 
@@ -275,7 +352,7 @@ func (r *VerticaDBReconciler) checkShardToNodeRatio(vdb *vapi.VerticaDB, sc *vap
 	const SuboptimalRatio = float32(3.0)
 	if ratio > SuboptimalRatio {
 		r.Eventf(vdb, corev1.EventTypeWarning, events.SuboptimalNodeCount,
-			"Subcluster '%s' has a suboptimal node count.  Consider increasing its size so that the shard to node ratio is %d:1 or less.",
+			"Subcluster '%s' has a suboptimal node count.  Consider increasing its size, or decreasing spec.shardCount, so that the shard to node ratio is %d:1 or less.",
 			sc.Name, int(SuboptimalRatio))
 	}
 }
@@ -283,10 +360,13 @@ func (r *VerticaDBReconciler) checkShardToNodeRatio(vdb *vapi.VerticaDB, sc *vap
 // makeDispatcher will create a Dispatcher object based on the feature flags set.
 func (r *VerticaDBReconciler) makeDispatcher(log logr.Logger, vdb *vapi.VerticaDB, prunner cmds.PodRunner,
 	passwd string) vadmin.Dispatcher {
+	// Both backends are wrapped so that we collect metrics for each admin command
 	if vmeta.UseVClusterOps(vdb.Annotations) {
-		return vadmin.MakeVClusterOps(log, vdb, r.Client, &vops.VClusterCommands{}, passwd)
+		return vadmin.MakeInstrumented(vdb, vadmin.VClusterOpsBackend,
+			vadmin.MakeVClusterOps(log, vdb, r.Client, &vops.VClusterCommands{}, passwd))
 	}
-	return vadmin.MakeAdmintools(log, vdb, prunner, r.EVRec, r.OpCfg.DevMode)
+	return vadmin.MakeInstrumented(vdb, vadmin.AdmintoolsBackend,
+		vadmin.MakeAdmintools(log, vdb, prunner, r.EVRec, r.OpCfg.DevMode))
 }
 
 // Event a wrapper for Event() that also writes a log entry
@@ -0,0 +1,181 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/simulator"
+	"github.com/vertica/vertica-kubernetes/pkg/test"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("verticadb_controller", func() {
+	ctx := context.Background()
+
+	It("should create, scale out and restart a database against the simulator", func() {
+		vdb := vapi.MakeVDB()
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		createS3CredSecret(ctx, vdb)
+		defer deleteCommunalCredSecret(ctx, vdb)
+		sim := simulator.MakeCluster(logger, k8sClient)
+
+		By("creating the database")
+		reconcileWithSimulator(ctx, sim, vdb)
+		defer cleanupSimulatedObjects(ctx, vdb)
+		Expect(sim.GetSubclusters()).Should(HaveLen(1))
+		Expect(sim.GetSubclusters()[0].Name).Should(Equal(vdb.Spec.Subclusters[0].Name))
+		nodes := sim.GetNodes()
+		Expect(nodes).Should(HaveLen(int(vdb.Spec.Subclusters[0].Size)))
+		for i := range nodes {
+			Expect(nodes[i].State).Should(Equal(simulator.StateUp))
+		}
+		Expect(vdb.Status.UpNodeCount).Should(Equal(vdb.Spec.Subclusters[0].Size))
+
+		By("scaling out with a secondary subcluster")
+		vdb.Spec.Subclusters = append(vdb.Spec.Subclusters, vapi.Subcluster{
+			Name: "sc2", Size: 2, ServiceType: corev1.ServiceTypeClusterIP,
+		})
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+		reconcileWithSimulator(ctx, sim, vdb)
+		Expect(sim.GetSubclusters()).Should(HaveLen(2))
+		nodes = sim.GetNodes()
+		Expect(nodes).Should(HaveLen(5))
+		for i := range nodes {
+			Expect(nodes[i].State).Should(Equal(simulator.StateUp))
+			Expect(nodes[i].ShardSubscriptions).ShouldNot(BeZero())
+		}
+
+		By("restarting a pod that was rescheduled")
+		pn := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 1)
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, pn, pod)).Should(Succeed())
+		Expect(k8sClient.Delete(ctx, pod)).Should(Succeed())
+		Expect(sim.SyncPods(ctx, vdb)).Should(Succeed())
+		simPod, ok := sim.GetPod(pn)
+		Expect(ok).Should(BeTrue())
+		node, ok := sim.GetNode(simPod.VNode)
+		Expect(ok).Should(BeTrue())
+		Expect(node.State).Should(Equal(simulator.StateDown))
+		reconcileWithSimulator(ctx, sim, vdb)
+		node, _ = sim.GetNode(simPod.VNode)
+		Expect(node.State).Should(Equal(simulator.StateUp))
+		Expect(vdb.Status.UpNodeCount).Should(Equal(int32(5)))
+
+		By("shutting down the secondary subcluster")
+		vdb.Spec.Subclusters[1].Shutdown = true
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+		reconcileWithSimulator(ctx, sim, vdb)
+		sts := &appsv1.StatefulSet{}
+		Expect(k8sClient.Get(ctx, names.GenStsName(vdb, &vdb.Spec.Subclusters[1]), sts)).Should(Succeed())
+		Expect(*sts.Spec.Replicas).Should(Equal(int32(0)))
+		nodes = sim.GetNodes()
+		Expect(nodes).Should(HaveLen(5))
+		for i := range nodes {
+			if nodes[i].Subcluster == "sc2" {
+				Expect(nodes[i].State).Should(Equal(simulator.StateDown))
+			} else {
+				Expect(nodes[i].State).Should(Equal(simulator.StateUp))
+			}
+		}
+		// Envtest doesn't run the statefulset controller, so remove the pods
+		// ourselves like it would when scaling to zero.
+		for i := int32(0); i < vdb.Spec.Subclusters[1].Size; i++ {
+			pod := &corev1.Pod{}
+			Expect(k8sClient.Get(ctx, names.GenPodName(vdb, &vdb.Spec.Subclusters[1], i), pod)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, pod)).Should(Succeed())
+		}
+
+		By("starting the secondary subcluster again")
+		vdb.Spec.Subclusters[1].Shutdown = false
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+		reconcileWithSimulator(ctx, sim, vdb)
+		Expect(k8sClient.Get(ctx, names.GenStsName(vdb, &vdb.Spec.Subclusters[1]), sts)).Should(Succeed())
+		Expect(*sts.Spec.Replicas).Should(Equal(int32(2)))
+		nodes = sim.GetNodes()
+		Expect(nodes).Should(HaveLen(5))
+		for i := range nodes {
+			Expect(nodes[i].State).Should(Equal(simulator.StateUp))
+		}
+
+		By("resharding the database")
+		Expect(vdb.Status.ShardCount).Should(Equal(vdb.Spec.ShardCount))
+		vdb.Spec.ShardCount = 6
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+		reconcileWithSimulator(ctx, sim, vdb)
+		Expect(sim.FindCommands("select reshard_database(6);")).Should(HaveLen(1))
+		Expect(vdb.Status.ShardCount).Should(Equal(6))
+		Expect(vdb.IsReshardInProgress()).Should(BeFalse())
+		for _, n := range sim.GetNodes() {
+			Expect(n.ShardSubscriptions).ShouldNot(BeZero())
+		}
+
+		By("upgrading to a new image")
+		const NewImage = "vertica-k8s:new"
+		const NewVersion = "v23.3.0-0"
+		sim.ImageVersions[NewImage] = NewVersion
+		vdb.Spec.UpgradePolicy = vapi.OfflineUpgrade
+		vdb.Spec.Image = NewImage
+		// Envtest can't run the pod that checks if the image can be pulled
+		vdb.Annotations[vmeta.SkipUpgradePreflightAnnotation] = "true"
+		Expect(k8sClient.Update(ctx, vdb)).Should(Succeed())
+		reconcileWithSimulator(ctx, sim, vdb)
+		Expect(vdb.Status.Conditions[vapi.ImageChangeInProgressIndex].Status).Should(Equal(corev1.ConditionFalse))
+		Expect(vdb.Status.UpNodeCount).Should(Equal(int32(5)))
+		for _, n := range sim.GetNodes() {
+			Expect(n.State).Should(Equal(simulator.StateUp))
+			Expect(n.Version).Should(Equal(NewVersion))
+		}
+		for i := range vdb.Spec.Subclusters {
+			Expect(k8sClient.Get(ctx, names.GenStsName(vdb, &vdb.Spec.Subclusters[i]), sts)).Should(Succeed())
+			Expect(sts.Spec.Template.Spec.Containers[names.ServerContainerIndex].Image).Should(Equal(NewImage))
+		}
+	})
+})
+
+// reconcileWithSimulator will run full reconcile iterations against the
+// simulator until no more requeues are needed. Since envtest doesn't run the
+// statefulset controller, we create the pods before each iteration.
+func reconcileWithSimulator(ctx context.Context, sim *simulator.Cluster, vdb *vapi.VerticaDB) {
+	req := ctrl.Request{NamespacedName: vdb.ExtractNamespacedName()}
+	const MaxIterations = 25
+	for i := 0; i < MaxIterations; i++ {
+		ExpectWithOffset(1, k8sClient.Get(ctx, req.NamespacedName, vdb)).Should(Succeed())
+		test.CreatePods(ctx, k8sClient, vdb, test.AllPodsRunning)
+		ExpectWithOffset(1, sim.SyncPods(ctx, vdb)).Should(Succeed())
+		res, err := vdbRec.runActors(ctx, &req, logger, vdb, sim, sim)
+		ExpectWithOffset(1, err).Should(Succeed())
+		if res == (ctrl.Result{}) {
+			ExpectWithOffset(1, k8sClient.Get(ctx, req.NamespacedName, vdb)).Should(Succeed())
+			return
+		}
+	}
+	Fail("reconcile did not finish within the maximum number of iterations")
+}
+
+// cleanupSimulatedObjects removes the objects that the reconciler created.
+func cleanupSimulatedObjects(ctx context.Context, vdb *vapi.VerticaDB) {
+	test.DeletePods(ctx, k8sClient, vdb)
+	test.DeleteSvcs(ctx, k8sClient, vdb)
+}
@@ -0,0 +1,106 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vdb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// VerticaDBOperationReconciler reconciles a VerticaDBOperation object. The
+// operation is carried out by reusing the actors of the VerticaDB reconciler,
+// which is why this controller lives in the same package.
+type VerticaDBOperationReconciler struct {
+	VRec *VerticaDBReconciler
+	Log  logr.Logger
+}
+
+//+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticadboperations,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticadboperations/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticadboperations/finalizers,verbs=update
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *VerticaDBOperationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&vapi.VerticaDBOperation{}).
+		Complete(r)
+}
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.5/pkg/reconcile
+func (r *VerticaDBOperationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("verticadboperation", req.NamespacedName)
+	log.Info("starting reconcile of VerticaDBOperation")
+
+	vop := &vapi.VerticaDBOperation{}
+	err := r.VRec.Get(ctx, req.NamespacedName, vop)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("VerticaDBOperation resource not found.  Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "failed to get VerticaDBOperation")
+		return ctrl.Result{}, err
+	}
+
+	if vmeta.IsPauseAnnotationSet(vop.Annotations) {
+		log.Info(fmt.Sprintf("The pause annotation %s is set. Suspending the iteration", vmeta.PauseOperatorAnnotation),
+			"result", ctrl.Result{}, "err", nil)
+		return ctrl.Result{}, nil
+	}
+
+	// Nothing to do once the operation has finished. A new VerticaDBOperation
+	// must be created to do it again.
+	if vop.IsFinished() {
+		return ctrl.Result{}, nil
+	}
+
+	vdb := &vapi.VerticaDB{}
+	nm := types.NamespacedName{Namespace: vop.Namespace, Name: vop.Spec.VerticaDBName}
+	if err = r.VRec.Get(ctx, nm, vdb); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		msg := fmt.Sprintf("VerticaDB '%s' does not exist", vop.Spec.VerticaDBName)
+		r.VRec.Event(vop, corev1.EventTypeWarning, events.OperationFailed, msg)
+		return ctrl.Result{}, setOperationFinished(ctx, r.VRec, vop, vapi.OperationFailed, msg)
+	}
+
+	passwd, err := r.VRec.GetSuperuserPassword(ctx, vdb, log)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	prunner := cmds.MakeClusterPodRunner(log, r.VRec.Cfg, passwd)
+	pfacts := MakePodFacts(r.VRec, prunner)
+	dispatcher := r.VRec.makeDispatcher(log, vdb, prunner, passwd)
+	o := MakeOperationRunner(r.VRec, log, vop, vdb, prunner, &pfacts, dispatcher)
+	res, err := o.Run(ctx)
+	log.Info("ending reconcile of VerticaDBOperation", "result", res, "err", err)
+	return res, err
+}
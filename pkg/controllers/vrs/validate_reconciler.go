@@ -0,0 +1,130 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vrs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// ValidateReconciler will check that a VerticaRestore can be used to revive
+// its VerticaDB. It moves the restore to the Pending state if it can, or to the
+// Failed state if it can't.
+type ValidateReconciler struct {
+	VRec *VerticaRestoreReconciler
+	Log  logr.Logger
+	Vrs  *vapi.VerticaRestore
+}
+
+// MakeValidateReconciler will build a ValidateReconciler object
+func MakeValidateReconciler(vrec *VerticaRestoreReconciler, log logr.Logger,
+	vrs *vapi.VerticaRestore) controllers.ReconcileActor {
+	return &ValidateReconciler{
+		VRec: vrec,
+		Log:  log,
+		Vrs:  vrs,
+	}
+}
+
+// Reconcile will validate the VerticaRestore
+func (v *ValidateReconciler) Reconcile(ctx context.Context, req *ctrl.Request) (ctrl.Result, error) {
+	// Once the VerticaDB reconciler has started the revive, it owns the state
+	if v.Vrs.Status.State != "" && v.Vrs.Status.State != vapi.RestorePending {
+		return ctrl.Result{}, nil
+	}
+
+	if msg, ok := v.validateSpec(); !ok {
+		v.VRec.EVRec.Event(v.Vrs, corev1.EventTypeWarning, events.InvalidRestoreSpec, msg)
+		return ctrl.Result{}, v.setState(ctx, vapi.RestoreFailed, msg)
+	}
+
+	vdb := &vapi.VerticaDB{}
+	nm := types.NamespacedName{Namespace: v.Vrs.Namespace, Name: v.Vrs.Spec.VerticaDBName}
+	if err := v.VRec.Get(ctx, nm, vdb); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		// The VerticaDB can be created after the restore. We are notified
+		// through the watch when that happens.
+		return ctrl.Result{}, v.setState(ctx, vapi.RestorePending,
+			fmt.Sprintf("Waiting for VerticaDB '%s' to be created", v.Vrs.Spec.VerticaDBName))
+	}
+
+	if msg, ok, err := v.validateVDB(vdb); err != nil || !ok {
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		v.VRec.EVRec.Event(v.Vrs, corev1.EventTypeWarning, events.RestoreNotApplicable, msg)
+		return ctrl.Result{}, v.setState(ctx, vapi.RestoreFailed, msg)
+	}
+	return ctrl.Result{}, v.setState(ctx, vapi.RestorePending,
+		fmt.Sprintf("Waiting for VerticaDB '%s' to be revived", vdb.Name))
+}
+
+// validateSpec will check the spec of the VerticaRestore for errors. If there
+// is one, a message describing it is returned.
+func (v *ValidateReconciler) validateSpec() (string, bool) {
+	if !vapi.IsValidArchiveName(v.Vrs.Spec.ArchiveName) {
+		return fmt.Sprintf("Archive name '%s' is not valid. It must start with a letter or underscore and contain "+
+			"only letters, digits and underscores", v.Vrs.Spec.ArchiveName), false
+	}
+	if (v.Vrs.Spec.RestorePointIndex == 0) == (v.Vrs.Spec.RestorePointID == "") {
+		return "Exactly one of restorePointIndex or restorePointID must be set", false
+	}
+	return "", true
+}
+
+// validateVDB will check that the VerticaDB can be revived from a restore
+// point. If it can't, a message describing why is returned.
+func (v *ValidateReconciler) validateVDB(vdb *vapi.VerticaDB) (string, bool, error) {
+	if !vdb.IsEON() || vdb.Spec.InitPolicy != vapi.CommunalInitPolicyRevive {
+		return fmt.Sprintf("VerticaDB '%s' must be an Eon Mode database with an initPolicy of %s",
+			vdb.Name, vapi.CommunalInitPolicyRevive), false, nil
+	}
+	isSet, err := vdb.IsConditionSet(vapi.DBInitialized)
+	if err != nil {
+		return "", false, err
+	}
+	if isSet {
+		return fmt.Sprintf("The database for VerticaDB '%s' has already been initialized", vdb.Name), false, nil
+	}
+	return "", true, nil
+}
+
+// setState will update the state and message in the VerticaRestore status
+func (v *ValidateReconciler) setState(ctx context.Context, state, msg string) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		if err := v.VRec.Get(ctx, v.Vrs.ExtractNamespacedName(), v.Vrs); err != nil {
+			return err
+		}
+		if v.Vrs.Status.State == state && v.Vrs.Status.Message == msg {
+			return nil
+		}
+		v.Vrs.Status.State = state
+		v.Vrs.Status.Message = msg
+		return v.VRec.Status().Update(ctx, v.Vrs)
+	})
+}
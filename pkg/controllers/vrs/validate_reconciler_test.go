@@ -0,0 +1,77 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vrs
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/test"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("validate_reconcile", func() {
+	ctx := context.Background()
+
+	It("should wait in the pending state until the VerticaDB is revived", func() {
+		vrs := vapi.MakeVRS()
+		Expect(k8sClient.Create(ctx, vrs)).Should(Succeed())
+		defer func() { Expect(k8sClient.Delete(ctx, vrs)).Should(Succeed()) }()
+
+		act := MakeValidateReconciler(vrsRec, logger, vrs)
+		Expect(act.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(vrs.Status.State).Should(Equal(vapi.RestorePending))
+		Expect(vrs.Status.Message).Should(ContainSubstring("to be created"))
+
+		vdb := vapi.MakeVDB()
+		vdb.Spec.InitPolicy = vapi.CommunalInitPolicyRevive
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+		Expect(act.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(vrs.Status.State).Should(Equal(vapi.RestorePending))
+		Expect(vrs.Status.Message).Should(ContainSubstring("to be revived"))
+	})
+
+	It("should fail the restore if the spec is invalid", func() {
+		vrs := vapi.MakeVRS()
+		vrs.Spec.RestorePointID = "45006999883346698"
+		Expect(k8sClient.Create(ctx, vrs)).Should(Succeed())
+		defer func() { Expect(k8sClient.Delete(ctx, vrs)).Should(Succeed()) }()
+
+		act := MakeValidateReconciler(vrsRec, logger, vrs)
+		Expect(act.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(vrs.Status.State).Should(Equal(vapi.RestoreFailed))
+		Expect(vrs.Status.Message).Should(ContainSubstring("Exactly one of"))
+	})
+
+	It("should fail the restore if the VerticaDB cannot be revived", func() {
+		vdb := vapi.MakeVDB()
+		vdb.Spec.InitPolicy = vapi.CommunalInitPolicyCreate
+		test.CreateVDB(ctx, k8sClient, vdb)
+		defer test.DeleteVDB(ctx, k8sClient, vdb)
+
+		vrs := vapi.MakeVRS()
+		Expect(k8sClient.Create(ctx, vrs)).Should(Succeed())
+		defer func() { Expect(k8sClient.Delete(ctx, vrs)).Should(Succeed()) }()
+
+		act := MakeValidateReconciler(vrsRec, logger, vrs)
+		Expect(act.Reconcile(ctx, &ctrl.Request{})).Should(Equal(ctrl.Result{}))
+		Expect(vrs.Status.State).Should(Equal(vapi.RestoreFailed))
+		Expect(vrs.Status.Message).Should(ContainSubstring("initPolicy"))
+	})
+})
@@ -0,0 +1,132 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vrs
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/controllers"
+	verrors "github.com/vertica/vertica-kubernetes/pkg/errors"
+	"github.com/vertica/vertica-kubernetes/pkg/meta"
+)
+
+// VerticaRestoreReconciler reconciles a VerticaRestore object. The revive
+// itself is done by the VerticaDB reconciler. This reconciler only validates
+// the VerticaRestore so that the VerticaDB reconciler knows it can be used.
+type VerticaRestoreReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Log    logr.Logger
+	EVRec  record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticarestores,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticarestores/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticarestores/finalizers,verbs=update
+//+kubebuilder:rbac:groups=vertica.com,namespace=WATCH_NAMESPACE,resources=verticadbs,verbs=get;list;watch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.5/pkg/reconcile
+func (r *VerticaRestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("verticarestore", req.NamespacedName)
+	log.Info("starting reconcile of VerticaRestore")
+
+	vrs := &vapi.VerticaRestore{}
+	err := r.Get(ctx, req.NamespacedName, vrs)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("VerticaRestore resource not found.  Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "failed to get VerticaRestore")
+		return ctrl.Result{}, err
+	}
+
+	if meta.IsPauseAnnotationSet(vrs.Annotations) {
+		log.Info(fmt.Sprintf("The pause annotation %s is set. Suspending the iteration", meta.PauseOperatorAnnotation),
+			"result", ctrl.Result{}, "err", nil)
+		return ctrl.Result{}, nil
+	}
+
+	// The actors that will be applied, in sequence, to reconcile a vrs.
+	actors := []controllers.ReconcileActor{
+		// Check the restore can be used and mark it as pending
+		MakeValidateReconciler(r, log, vrs),
+	}
+
+	// Iterate over each actor
+	var res ctrl.Result
+	for _, act := range actors {
+		log.Info("starting actor", "name", fmt.Sprintf("%T", act))
+		res, err = act.Reconcile(ctx, &req)
+		// Error or a request to requeue will stop the reconciliation.
+		if verrors.IsReconcileAborted(res, err) {
+			log.Info("aborting reconcile of VerticaRestore", "result", res, "err", err)
+			return res, err
+		}
+	}
+
+	log.Info("ending reconcile of VerticaRestore", "result", res, "err", err)
+	return res, err
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *VerticaRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&vapi.VerticaRestore{}).
+		Watches(
+			&source.Kind{Type: &vapi.VerticaDB{}},
+			handler.EnqueueRequestsFromMapFunc(r.findObjectsForVerticaDB),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		).
+		Complete(r)
+}
+
+// findObjectsForVerticaDB will generate requests to reconcile VerticaRestores
+// based on watched VerticaDB.
+func (r *VerticaRestoreReconciler) findObjectsForVerticaDB(vdb client.Object) []reconcile.Request {
+	restores := &vapi.VerticaRestoreList{}
+	if err := r.List(context.Background(), restores, client.InNamespace(vdb.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list VerticaRestores", "vdb", vdb.GetName())
+		return []reconcile.Request{}
+	}
+
+	requests := []reconcile.Request{}
+	for i := range restores.Items {
+		if restores.Items[i].Spec.VerticaDBName != vdb.GetName() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: restores.Items[i].ExtractNamespacedName()})
+	}
+	return requests
+}
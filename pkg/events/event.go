@@ -58,6 +58,14 @@ const (
 	UpgradeStart                    = "UpgradeStart"
 	UpgradeSucceeded                = "UpgradeSucceeded"
 	IncompatibleOnlineUpgrade       = "IncompatibleOnlineUpgrade"
+	UpgradeRollingBack              = "UpgradeRollingBack"
+	UpgradeRolledBack               = "UpgradeRolledBack"
+	UpgradePreflightFailed          = "UpgradePreflightFailed"
+	UpgradePreflightSucceeded       = "UpgradePreflightSucceeded"
+	UpgradeCanaryAwaitingApproval   = "UpgradeCanaryAwaitingApproval"
+	UpgradeCanaryApproved           = "UpgradeCanaryApproved"
+	UpgradeCanaryDenied             = "UpgradeCanaryDenied"
+	WaitingForMaintenanceWindow     = "WaitingForMaintenanceWindow"
 	ClusterShutdownStarted          = "ClusterShutdownStarted"
 	ClusterShutdownFailed           = "ClusterShutdownFailed"
 	ClusterShutdownSucceeded        = "ClusterShutdownSucceeded"
@@ -68,6 +76,8 @@ const (
 	HTTPServerStartFailed           = "HTTPServerStartFailed"
 	KerberosAuthError               = "KerberosAuthError"
 	OperatorUpgrade                 = "OperatorUpgrade"
+	OperatorMigrationApplied        = "OperatorMigrationApplied"
+	OperatorMigrationFailed         = "OperatorMigrationFailed"
 	InvalidUpgradePath              = "InvalidUpgradePath"
 	RebalanceShards                 = "RebalanceShards"
 	DrainNodeRetry                  = "DrainNodeRetry"
@@ -82,9 +92,35 @@ const (
 	MgmtFailed                      = "MgmtFailed"
 	MgmtFailedDiskFull              = "MgmtFailedDiskfull"
 	LowLocalDataAvailSpace          = "LowLocalDataAvailSpace"
+	PVCAutoGrown                    = "PVCAutoGrown"
+	PVCAutoGrowMaxSizeReached       = "PVCAutoGrowMaxSizeReached"
+	PVCDeleted                      = "PVCDeleted"
 	RunAgentStart                   = "RunAgentStart"
 	RunAgentSucceeded               = "RunAgentSucceeded"
 	RunAgentFailed                  = "RunAgentFailed"
+	ConfigParameterDrift            = "ConfigParameterDrift"
+	ConfigParameterSetFailed        = "ConfigParameterSetFailed"
+	ConfigParameterRestartNeeded    = "ConfigParameterRestartNeeded"
+	ConfigParameterUnknown          = "ConfigParameterUnknown"
+	ReviveFromRestorePoint          = "ReviveFromRestorePoint"
+	RestorePointReviveBlocked       = "RestorePointReviveBlocked"
+	SubclusterShutdownStart         = "SubclusterShutdownStart"
+	SubclusterShutdownSucceeded     = "SubclusterShutdownSucceeded"
+	SubclusterShutdownFailed        = "SubclusterShutdownFailed"
+	SubclusterPromoted              = "SubclusterPromoted"
+	SubclusterDemoted               = "SubclusterDemoted"
+	SubclusterTypeChangeFailed      = "SubclusterTypeChangeFailed"
+	ReshardStarted                  = "ReshardStarted"
+	ReshardSucceeded                = "ReshardSucceeded"
+	ReshardFailed                   = "ReshardFailed"
+	ReshardNotSupported             = "ReshardNotSupported"
+	SubclusterRenamed               = "SubclusterRenamed"
+	SubclusterRenameFailed          = "SubclusterRenameFailed"
+	FaultGroupsUpdated              = "FaultGroupsUpdated"
+	FaultGroupsUpdateFailed         = "FaultGroupsUpdateFailed"
+	StorageClassMigrationStarted    = "StorageClassMigrationStarted"
+	StorageClassMigrationPodRebuild = "StorageClassMigrationPodRebuild"
+	StorageClassMigrationSucceeded  = "StorageClassMigrationSucceeded"
 )
 
 // Constants for VerticaAutoscaler reconciler
@@ -93,3 +129,21 @@ const (
 	VerticaDBNotFound             = "VerticaDBNotFound"
 	NoSubclusterTemplate          = "NoSubclusterTemplate"
 )
+
+// Constants for VerticaBackup and VerticaRestore reconcilers
+const (
+	InvalidBackupSpec    = "InvalidBackupSpec"
+	RestorePointSaved    = "RestorePointSaved"
+	RestorePointFailed   = "RestorePointFailed"
+	InvalidRestoreSpec   = "InvalidRestoreSpec"
+	RestorePointRestored = "RestorePointRestored"
+	RestoreNotApplicable = "RestoreNotApplicable"
+)
+
+// Constants for VerticaDBOperation reconciler
+const (
+	OperationStarted   = "OperationStarted"
+	OperationSucceeded = "OperationSucceeded"
+	OperationFailed    = "OperationFailed"
+	OperationWaiting   = "OperationWaiting"
+)
@@ -25,6 +25,7 @@ import (
 	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -93,6 +94,21 @@ func (m *SubclusterFinder) FindServices(ctx context.Context, flags FindFlags) (*
 	return svcs, nil
 }
 
+// FindPodDisruptionBudgets returns the PodDisruptionBudgets that were created
+// for subclusters
+func (m *SubclusterFinder) FindPodDisruptionBudgets(ctx context.Context, flags FindFlags) (*policyv1.PodDisruptionBudgetList, error) {
+	pdbs := &policyv1.PodDisruptionBudgetList{}
+	if err := m.buildObjList(ctx, pdbs, flags); err != nil {
+		return nil, err
+	}
+	if flags&FindSorted != 0 {
+		sort.Slice(pdbs.Items, func(i, j int) bool {
+			return pdbs.Items[i].Name < pdbs.Items[j].Name
+		})
+	}
+	return pdbs, nil
+}
+
 // FindPods returns pod objects that are are used to run Vertica.  It limits the
 // pods that were created by the VerticaDB object.
 func (m *SubclusterFinder) FindPods(ctx context.Context, flags FindFlags) (*corev1.PodList, error) {
@@ -229,6 +245,8 @@ func getLabelsFromObject(obj runtime.Object) (map[string]string, bool) {
 		return svc.Labels, true
 	} else if pod, ok := obj.(*corev1.Pod); ok {
 		return pod.Labels, true
+	} else if pdb, ok := obj.(*policyv1.PodDisruptionBudget); ok {
+		return pdb.Labels, true
 	}
 	return nil, false
 }
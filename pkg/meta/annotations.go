@@ -15,7 +15,12 @@
 
 package meta
 
-import "strconv"
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
 
 const (
 	// Annotations that we set in each of the pod.  These are set by the
@@ -25,6 +30,11 @@ const (
 	KubernetesGitCommitAnnotation = "kubernetes.io/gitcommit" // Git commit of the k8s server
 	KubernetesBuildDateAnnotation = "kubernetes.io/buildDate" // Build date of the k8s server
 
+	// The value of the topology key on the node that the pod is running on.
+	// This is set by the AnnotateAndLabelPodReconciler when spec.topology.mode
+	// is Zone, and is used to pick the fault group for the pod's node.
+	ZoneAnnotation = "vertica.com/zone"
+
 	// If this annotation is on any CR, the operator will skip processing. This can
 	// be used to avoid getting in an infinity error-retry loop. Or, if you know
 	// no additional work will ever exist for an object. Just set this to a
@@ -37,6 +47,37 @@ const (
 	// treated as a boolean.
 	VClusterOpsAnnotation     = "vertica.com/vcluster-ops"
 	VClusterOpsAnnotationTrue = "true"
+
+	// If this annotation is set to true, the operator will skip the checks it
+	// does prior to starting an upgrade. This can be used to force an upgrade
+	// when one of the checks is failing for a known reason.
+	SkipUpgradePreflightAnnotation = "vertica.com/skip-upgrade-preflight"
+
+	// The operator records in this annotation the version of the operator
+	// whose migrations have been applied to the objects of the VerticaDB. It
+	// is used to decide which migration steps still need to run after an
+	// operator upgrade.
+	OperatorMigrationVersionAnnotation = "vertica.com/operator-migration-version"
+
+	// Set this annotation in the VerticaDB to rename subclusters rather than
+	// having them removed and added again. The value is a comma separated list
+	// of old=new pairs, such as "sc1=analytics". The name in
+	// spec.subclusters must be changed at the same time. The subcluster keeps
+	// its statefulset, pods and PVCs, so those objects keep the old name.
+	SubclusterRenamesAnnotation = "vertica.com/subcluster-renames"
+
+	// The operator sets this annotation in a statefulset that was recreated
+	// to rename its subcluster. The statefulset adopted the running pods of
+	// the old one, so their revision differs. While this is set, we keep the
+	// OnDelete update strategy so that the pods aren't restarted.
+	AdoptedPodsAnnotation = "vertica.com/adopted-pods"
+
+	// The operator sets this annotation in the VerticaDB to keep track of the
+	// statefulset of each renamed subcluster. The value is a comma separated
+	// list of subcluster=statefulset pairs. A renamed subcluster keeps the
+	// statefulset whose name was derived from its original name, so this is
+	// the only way to find it. Do not change or remove this annotation.
+	SubclusterStsNamesAnnotation = "vertica.com/subcluster-sts-names"
 )
 
 // IsPauseAnnotationSet will check the annotations for a special value that will
@@ -51,6 +92,58 @@ func UseVClusterOps(annotations map[string]string) bool {
 	return lookupBoolAnnotation(annotations, VClusterOpsAnnotation, false)
 }
 
+// SkipUpgradePreflight returns true if the checks done before an upgrade
+// should be skipped.
+func SkipUpgradePreflight(annotations map[string]string) bool {
+	return lookupBoolAnnotation(annotations, SkipUpgradePreflightAnnotation, false)
+}
+
+// GetSubclusterRenames returns the subcluster renames requested with the
+// SubclusterRenamesAnnotation. The map is keyed by the old subcluster name.
+func GetSubclusterRenames(annotations map[string]string) (map[string]string, error) {
+	return parseNamePairs(annotations[SubclusterRenamesAnnotation], "subcluster rename", "old=new")
+}
+
+// GetSubclusterStsNames returns the statefulset names of the renamed
+// subclusters that are saved in the SubclusterStsNamesAnnotation. The map is
+// keyed by the subcluster name.
+func GetSubclusterStsNames(annotations map[string]string) (map[string]string, error) {
+	return parseNamePairs(annotations[SubclusterStsNamesAnnotation], "subcluster statefulset name", "subcluster=statefulset")
+}
+
+// GenSubclusterStsNames returns the value of the SubclusterStsNamesAnnotation
+// for the given map of statefulset names.
+func GenSubclusterStsNames(stsNames map[string]string) string {
+	pairs := make([]string, 0, len(stsNames))
+	for scName, stsName := range stsNames {
+		pairs = append(pairs, scName+"="+stsName)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// parseNamePairs will parse an annotation value that is a comma separated
+// list of name=value pairs. The name of each pair must be unique.
+func parseNamePairs(val, desc, form string) (map[string]string, error) {
+	pairs := map[string]string{}
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return pairs, nil
+	}
+	for _, pair := range strings.Split(val, ",") {
+		names := strings.Split(strings.TrimSpace(pair), "=")
+		const ExpectedNames = 2
+		if len(names) != ExpectedNames || names[0] == "" || names[1] == "" {
+			return nil, fmt.Errorf("%s '%s' must be in the form %s", desc, pair, form)
+		}
+		if _, ok := pairs[names[0]]; ok {
+			return nil, fmt.Errorf("'%s' is given more than once in %ss", names[0], desc)
+		}
+		pairs[names[0]] = names[1]
+	}
+	return pairs, nil
+}
+
 // lookupBoolAnnotation is a helper function to lookup a specific annotation and
 // treat it as if it were a boolean.
 func lookupBoolAnnotation(annotations map[string]string, annotation string, defaultValue bool) bool {
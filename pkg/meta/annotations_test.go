@@ -47,4 +47,32 @@ var _ = Describe("annotations", func() {
 		ann := map[string]string{VClusterOpsAnnotation: VClusterOpsAnnotationTrue}
 		Ω(UseVClusterOps(ann)).Should(BeTrue())
 	})
+
+	It("should parse the subcluster renames annotation", func() {
+		renames, err := GetSubclusterRenames(nil)
+		Ω(err).Should(Succeed())
+		Ω(renames).Should(BeEmpty())
+		ann := map[string]string{SubclusterRenamesAnnotation: "sc1=analytics, sc2=etl"}
+		renames, err = GetSubclusterRenames(ann)
+		Ω(err).Should(Succeed())
+		Ω(renames).Should(Equal(map[string]string{"sc1": "analytics", "sc2": "etl"}))
+		ann[SubclusterRenamesAnnotation] = "sc1"
+		_, err = GetSubclusterRenames(ann)
+		Ω(err).ShouldNot(Succeed())
+		ann[SubclusterRenamesAnnotation] = "sc1=a,sc1=b"
+		_, err = GetSubclusterRenames(ann)
+		Ω(err).ShouldNot(Succeed())
+	})
+
+	It("should parse and generate the subcluster statefulset names annotation", func() {
+		stsNames := map[string]string{"etl": "v-sc2", "analytics": "v-sc1"}
+		ann := map[string]string{SubclusterStsNamesAnnotation: GenSubclusterStsNames(stsNames)}
+		Ω(ann[SubclusterStsNamesAnnotation]).Should(Equal("analytics=v-sc1,etl=v-sc2"))
+		parsed, err := GetSubclusterStsNames(ann)
+		Ω(err).Should(Succeed())
+		Ω(parsed).Should(Equal(stsNames))
+		ann[SubclusterStsNamesAnnotation] = "analytics"
+		_, err = GetSubclusterStsNames(ann)
+		Ω(err).ShouldNot(Succeed())
+	})
 })
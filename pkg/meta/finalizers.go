@@ -0,0 +1,23 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package meta
+
+const (
+	// PVCRetentionFinalizer is added to a VerticaDB that has
+	// spec.local.pvcRetentionPolicy set. It holds up the deletion of the
+	// VerticaDB until the operator has applied the policy to its PVCs.
+	PVCRetentionFinalizer = "vertica.com/pvc-retention"
+)
@@ -33,12 +33,16 @@ const (
 	ClusterRestartSubsystem = "cluster_restart"
 	NodesRestartSubsystem   = "nodes_restart"
 	SubclusterSubsystem     = "subclusters"
+	AdminCommandSubsystem   = "admin_command"
 
 	// Names of the labels that we can apply to metrics.
 	NamespaceLabel        = "namespace"
 	VerticaDBLabel        = "verticadb"
 	SubclusterOidLabel    = "subcluster_oid"
 	ReviveInstanceIDLabel = "revive_instance_id"
+	OperationLabel        = "operation"
+	BackendLabel          = "backend"
+	FailureCategoryLabel  = "failure_category"
 )
 
 var (
@@ -142,6 +146,34 @@ var (
 		},
 		[]string{NamespaceLabel, VerticaDBLabel, ReviveInstanceIDLabel, SubclusterOidLabel},
 	)
+	AdminCommandAttempt = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: AdminCommandSubsystem,
+			Name:      "attempted_total",
+			Help:      "The number of times we called an admin command",
+		},
+		[]string{NamespaceLabel, VerticaDBLabel, ReviveInstanceIDLabel, OperationLabel, BackendLabel},
+	)
+	AdminCommandFailed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: AdminCommandSubsystem,
+			Name:      "failed_total",
+			Help:      "The number of times an admin command failed",
+		},
+		[]string{NamespaceLabel, VerticaDBLabel, ReviveInstanceIDLabel, OperationLabel, BackendLabel, FailureCategoryLabel},
+	)
+	AdminCommandDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: AdminCommandSubsystem,
+			Name:      "seconds",
+			Help:      "The number of seconds it took to run an admin command",
+			Buckets:   AdminToolsBucket,
+		},
+		[]string{NamespaceLabel, VerticaDBLabel, ReviveInstanceIDLabel, OperationLabel, BackendLabel},
+	)
 	// Add new metrics above this comment.
 	//
 	// Once a metric is added a few other things need to be updated:
@@ -169,6 +201,9 @@ func init() {
 		TotalNodeCount,
 		RunningNodeCount,
 		UpNodeCount,
+		AdminCommandAttempt,
+		AdminCommandFailed,
+		AdminCommandDuration,
 	)
 }
 
@@ -205,6 +240,9 @@ func HandleVDBDelete(namespaceName, vdbName string, log logr.Logger) {
 	TotalNodeCount.DeletePartialMatch(labels)
 	RunningNodeCount.DeletePartialMatch(labels)
 	UpNodeCount.DeletePartialMatch(labels)
+	AdminCommandAttempt.DeletePartialMatch(labels)
+	AdminCommandFailed.DeletePartialMatch(labels)
+	AdminCommandDuration.DeletePartialMatch(labels)
 }
 
 // HandleVDBInit will initialized metrics that use verticadb as a
@@ -244,6 +282,15 @@ func MakeSubclusterLabels(vdb *vapi.VerticaDB, scOid string) prometheus.Labels {
 	}
 }
 
+// MakeAdminCommandLabels returns a prometheus.Labels for an admin command
+// that was run through the given backend.
+func MakeAdminCommandLabels(vdb *vapi.VerticaDB, op, backend string) prometheus.Labels {
+	labels := MakeVDBLabels(vdb)
+	labels[OperationLabel] = op
+	labels[BackendLabel] = backend
+	return labels
+}
+
 // getReviveInstanceID returns the revive instance ID stored in the vdb, or an
 // empty string if not present yet.
 func getReviveInstanceID(vdb *vapi.VerticaDB) string {
@@ -19,6 +19,7 @@ import (
 	"fmt"
 
 	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
@@ -49,7 +50,33 @@ func GenHlSvcName(vdb *vapi.VerticaDB) types.NamespacedName {
 
 // GenStsName returns the name of the statefulset object
 func GenStsName(vdb *vapi.VerticaDB, sc *vapi.Subcluster) types.NamespacedName {
-	return GenNamespacedName(vdb, vdb.Name+"-"+sc.GenCompatibleFQDN())
+	return GenNamespacedName(vdb, genStsBaseName(vdb, sc))
+}
+
+// GenPdbName returns the name of the PodDisruptionBudget for a subcluster. It
+// shares the name of the subcluster's statefulset.
+func GenPdbName(vdb *vapi.VerticaDB, sc *vapi.Subcluster) types.NamespacedName {
+	return GenNamespacedName(vdb, genStsBaseName(vdb, sc))
+}
+
+// GenPrimaryPdbName returns the name of the PodDisruptionBudget that covers
+// all of the primary pods. It shares the name of the vdb, which can't collide
+// with the budget of a secondary subcluster.
+func GenPrimaryPdbName(vdb *vapi.VerticaDB) types.NamespacedName {
+	return GenNamespacedName(vdb, vdb.Name)
+}
+
+// genStsBaseName returns the name of the statefulset for a subcluster. This is
+// derived from the subcluster name, except for subclusters that were renamed.
+// Those keep their statefulset, whose name is saved in an annotation of the
+// VerticaDB.
+func genStsBaseName(vdb *vapi.VerticaDB, sc *vapi.Subcluster) string {
+	// The webhook ensures the annotation can be parsed
+	stsNames, _ := vmeta.GetSubclusterStsNames(vdb.Annotations)
+	if stsName, ok := stsNames[sc.Name]; ok {
+		return stsName
+	}
+	return vdb.Name + "-" + sc.GenCompatibleFQDN()
 }
 
 // GenCommunalCredSecretName returns the name of the secret that has the credentials to access s3
@@ -77,7 +104,13 @@ func GenSUPasswdSecretName(vdb *vapi.VerticaDB) types.NamespacedName {
 // The name of the pod is generated, this function is just a helper for when we need
 // to lookup a pod by its generated name.
 func GenPodName(vdb *vapi.VerticaDB, sc *vapi.Subcluster, podIndex int32) types.NamespacedName {
-	return GenNamespacedName(vdb, fmt.Sprintf("%s-%s-%d", vdb.Name, sc.GenCompatibleFQDN(), podIndex))
+	return GenNamespacedName(vdb, fmt.Sprintf("%s-%d", genStsBaseName(vdb, sc), podIndex))
+}
+
+// GenUpgradePreflightPodName returns the name of the pod that is used to check
+// if the new image can be pulled prior to an upgrade.
+func GenUpgradePreflightPodName(vdb *vapi.VerticaDB) types.NamespacedName {
+	return GenNamespacedName(vdb, vdb.Name+"-upgrade-preflight")
 }
 
 // GenPodNameFromSts returns the name of a specific pod in a statefulset
@@ -90,12 +123,12 @@ func GenPodNameFromSts(vdb *vapi.VerticaDB, sts *appsv1.StatefulSet, podIndex in
 
 // GenPVCName returns the name of a specific pod's PVC.  This is for test purposes only.
 func GenPVCName(vdb *vapi.VerticaDB, sc *vapi.Subcluster, podIndex int32) types.NamespacedName {
-	return GenNamespacedName(vdb, fmt.Sprintf("%s-%s-%s-%d", vapi.LocalDataPVC, vdb.Name, sc.GenCompatibleFQDN(), podIndex))
+	return GenNamespacedName(vdb, fmt.Sprintf("%s-%s-%d", vapi.LocalDataPVC, genStsBaseName(vdb, sc), podIndex))
 }
 
 // GenPVName returns the name of a dummy PV for test purposes
 func GenPVName(vdb *vapi.VerticaDB, sc *vapi.Subcluster, podIndex int32) types.NamespacedName {
 	return types.NamespacedName{
-		Name: fmt.Sprintf("pv-%s-%s-%s-%d", vapi.LocalDataPVC, vdb.Name, sc.GenCompatibleFQDN(), podIndex),
+		Name: fmt.Sprintf("pv-%s-%s-%d", vapi.LocalDataPVC, genStsBaseName(vdb, sc), podIndex),
 	}
 }
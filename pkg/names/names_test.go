@@ -23,6 +23,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 
 	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
 )
 
 func TestNames(t *testing.T) {
@@ -54,4 +55,17 @@ var _ = Describe("k8s/names", func() {
 			types.NamespacedName{Namespace: "v-ns", Name: "v-my-sc"},
 		))
 	})
+
+	It("should keep the statefulset name of a renamed subcluster", func() {
+		vdb := vapi.MakeVDB()
+		vdb.ObjectMeta.Name = "v"
+		vdb.ObjectMeta.Namespace = "v-ns"
+		vdb.Spec.Subclusters[0].Name = "analytics"
+		vdb.Annotations[vmeta.SubclusterStsNamesAnnotation] = "analytics=v-sc1"
+		sc := &vdb.Spec.Subclusters[0]
+		Ω(GenStsName(vdb, sc)).Should(Equal(types.NamespacedName{Namespace: "v-ns", Name: "v-sc1"}))
+		Ω(GenPodName(vdb, sc, 1)).Should(Equal(types.NamespacedName{Namespace: "v-ns", Name: "v-sc1-1"}))
+		Ω(GenPVCName(vdb, sc, 1).Name).Should(Equal(vapi.LocalDataPVC + "-v-sc1-1"))
+		Ω(GenExtSvcName(vdb, sc)).Should(Equal(types.NamespacedName{Namespace: "v-ns", Name: "v-analytics"}))
+	})
 })
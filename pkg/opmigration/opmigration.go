@@ -0,0 +1,132 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package opmigration
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/version"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Step is a single migration of the k8s objects of a VerticaDB. A step is
+// needed whenever a new operator version changes objects in a way that can't
+// be handled by the normal reconcile (e.g. an immutable field changes).
+type Step struct {
+	// The operator version that introduced the change. The step is applied to
+	// any VerticaDB that was last migrated by an operator older than this.
+	Version string
+	// A short description of the migration. This is included in the event
+	// written when the step is applied.
+	Description string
+	// Apply does the migration. It must be idempotent because the step can be
+	// run again if the operator restarts before the applied version is
+	// recorded, or when a VerticaDB has no applied version recorded.
+	Apply func(ctx context.Context, m *Migrator) error
+}
+
+// Migrator will apply the migration steps that are pending for a single
+// VerticaDB.
+type Migrator struct {
+	Client   client.Client
+	Log      logr.Logger
+	EVWriter events.EVWriter
+	Vdb      *vapi.VerticaDB
+	Steps    []Step
+}
+
+// MakeMigrator will build a Migrator that uses the default set of steps
+func MakeMigrator(cli client.Client, log logr.Logger, evWriter events.EVWriter, vdb *vapi.VerticaDB) *Migrator {
+	return &Migrator{
+		Client:   cli,
+		Log:      log.WithName("Migrator"),
+		EVWriter: evWriter,
+		Vdb:      vdb,
+		Steps:    DefaultSteps,
+	}
+}
+
+// GetAppliedVersion returns the operator version whose migrations have been
+// applied to the VerticaDB. An empty string is returned if nothing has been
+// recorded yet.
+func GetAppliedVersion(vdb *vapi.VerticaDB) string {
+	return vdb.Annotations[vmeta.OperatorMigrationVersionAnnotation]
+}
+
+// PendingSteps returns the steps that still need to be applied, in the order
+// they must run. A step is pending if it came in an operator version newer
+// than the applied version. All steps are pending if the applied version is
+// empty or can't be parsed.
+func PendingSteps(steps []Step, appliedVersion string) []Step {
+	applied, ok := version.MakeInfoFromStr(toVersionStr(appliedVersion))
+	pending := []Step{}
+	for i := range steps {
+		if ok && applied.IsEqualOrNewer(toVersionStr(steps[i].Version)) {
+			continue
+		}
+		pending = append(pending, steps[i])
+	}
+	return pending
+}
+
+// Run will apply all of the pending steps in order. Once they all succeed, the
+// current operator version is recorded in an annotation of the VerticaDB so
+// that the steps are not run again.
+func (m *Migrator) Run(ctx context.Context) error {
+	appliedVersion := GetAppliedVersion(m.Vdb)
+	if appliedVersion == vmeta.CurOperatorVersion {
+		return nil
+	}
+	for _, step := range PendingSteps(m.Steps, appliedVersion) {
+		m.Log.Info("Applying operator migration step", "version", step.Version, "description", step.Description)
+		if err := step.Apply(ctx, m); err != nil {
+			m.EVWriter.Eventf(m.Vdb, corev1.EventTypeWarning, events.OperatorMigrationFailed,
+				"Failed to apply operator migration for version %s (%s): %s", step.Version, step.Description, err.Error())
+			return fmt.Errorf("failed to apply operator migration for version %s: %w", step.Version, err)
+		}
+		m.EVWriter.Eventf(m.Vdb, corev1.EventTypeNormal, events.OperatorMigrationApplied,
+			"Applied operator migration for version %s: %s", step.Version, step.Description)
+	}
+	return m.recordAppliedVersion(ctx, appliedVersion)
+}
+
+// recordAppliedVersion will set the annotation of the VerticaDB to the current
+// operator version. We never move the annotation backwards, which can happen
+// if an older operator is deployed after a newer one.
+func (m *Migrator) recordAppliedVersion(ctx context.Context, appliedVersion string) error {
+	applied, ok := version.MakeInfoFromStr(toVersionStr(appliedVersion))
+	if ok && applied.IsEqualOrNewer(toVersionStr(vmeta.CurOperatorVersion)) {
+		return nil
+	}
+	patch := client.MergeFrom(m.Vdb.DeepCopy())
+	if m.Vdb.Annotations == nil {
+		m.Vdb.Annotations = map[string]string{}
+	}
+	m.Vdb.Annotations[vmeta.OperatorMigrationVersionAnnotation] = vmeta.CurOperatorVersion
+	return m.Client.Patch(ctx, m.Vdb, patch)
+}
+
+// toVersionStr converts an operator version (e.g. 1.3.0) into the format
+// expected by the version package.
+func toVersionStr(opVer string) string {
+	return "v" + opVer
+}
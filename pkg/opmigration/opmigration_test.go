@@ -0,0 +1,150 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package opmigration
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	appsv1 "k8s.io/api/apps/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestAPIs(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "opmigration Suite")
+}
+
+var stsName = types.NamespacedName{Namespace: "default", Name: "vertica-sample-defaultsubcluster"}
+
+// loadFixture will read a multi-document yaml file from testdata and return a
+// fake client that has all of the objects in it, along with the VerticaDB.
+func loadFixture(fileName string) (client.Client, *vapi.VerticaDB) {
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).Should(Succeed())
+	Expect(vapi.AddToScheme(scheme)).Should(Succeed())
+
+	data, err := os.ReadFile(filepath.Join("testdata", fileName))
+	Expect(err).Should(Succeed())
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	objs := []client.Object{}
+	var vdb *vapi.VerticaDB
+	for _, doc := range strings.Split(string(data), "\n---\n") {
+		obj, _, err := decoder.Decode([]byte(doc), nil, nil)
+		Expect(err).Should(Succeed())
+		if v, ok := obj.(*vapi.VerticaDB); ok {
+			vdb = v
+		}
+		objs = append(objs, obj.(client.Object))
+	}
+	Expect(vdb).ShouldNot(BeNil())
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	// Fetch the vdb so that it has the resource version set by the fake client
+	Expect(cli.Get(context.Background(), vdb.ExtractNamespacedName(), vdb)).Should(Succeed())
+	return cli, vdb
+}
+
+func makeMigrator(cli client.Client, vdb *vapi.VerticaDB) (*Migrator, *record.FakeRecorder) {
+	logger := zap.New(zap.UseDevMode(true), zap.WriteTo(GinkgoWriter))
+	evRec := record.NewFakeRecorder(10)
+	return MakeMigrator(cli, logger, events.Writer{Log: logger, EVRec: evRec}, vdb), evRec
+}
+
+var _ = Describe("opmigration", func() {
+	ctx := context.Background()
+
+	It("should only return steps newer than the applied version", func() {
+		steps := []Step{{Version: "1.3.0"}, {Version: "1.8.0"}, {Version: "1.11.0"}}
+		Expect(PendingSteps(steps, "")).Should(HaveLen(3))
+		Expect(PendingSteps(steps, "1.2.0")).Should(HaveLen(3))
+		Expect(PendingSteps(steps, "1.3.0")).Should(Equal(steps[1:]))
+		Expect(PendingSteps(steps, "1.10.1")).Should(Equal(steps[2:]))
+		Expect(PendingSteps(steps, "1.11.0")).Should(BeEmpty())
+		Expect(PendingSteps(steps, "2.0.0")).Should(BeEmpty())
+	})
+
+	It("should delete old sts and record the applied version", func() {
+		cli, vdb := loadFixture("pre-1.3.0.yaml")
+		m, evRec := makeMigrator(cli, vdb)
+		Expect(m.Run(ctx)).Should(Succeed())
+
+		err := cli.Get(ctx, stsName, &appsv1.StatefulSet{})
+		Expect(kerrors.IsNotFound(err)).Should(BeTrue())
+		Expect(evRec.Events).Should(Receive(ContainSubstring(events.OperatorUpgrade)))
+		Expect(evRec.Events).Should(Receive(ContainSubstring(events.OperatorMigrationApplied)))
+
+		fetchVdb := &vapi.VerticaDB{}
+		Expect(cli.Get(ctx, vdb.ExtractNamespacedName(), fetchVdb)).Should(Succeed())
+		Expect(GetAppliedVersion(fetchVdb)).Should(Equal(vmeta.CurOperatorVersion))
+
+		// Running again is a no-op
+		Expect(m.Run(ctx)).Should(Succeed())
+		Expect(evRec.Events).ShouldNot(Receive())
+	})
+
+	It("should skip steps that were already applied", func() {
+		cli, vdb := loadFixture("migrated-1.11.0.yaml")
+		m, evRec := makeMigrator(cli, vdb)
+		Expect(m.Run(ctx)).Should(Succeed())
+
+		Expect(cli.Get(ctx, stsName, &appsv1.StatefulSet{})).Should(Succeed())
+		Expect(evRec.Events).ShouldNot(Receive())
+		Expect(GetAppliedVersion(vdb)).Should(Equal(vmeta.CurOperatorVersion))
+	})
+
+	It("should not record the version if a step fails", func() {
+		cli, vdb := loadFixture("pre-1.3.0.yaml")
+		m, evRec := makeMigrator(cli, vdb)
+		applied := []string{}
+		m.Steps = []Step{
+			{Version: "1.3.0", Apply: func(ctx context.Context, m *Migrator) error {
+				applied = append(applied, "1.3.0")
+				return nil
+			}},
+			{Version: "1.4.0", Apply: func(ctx context.Context, m *Migrator) error {
+				return errors.New("injected failure")
+			}},
+			{Version: "1.5.0", Apply: func(ctx context.Context, m *Migrator) error {
+				applied = append(applied, "1.5.0")
+				return nil
+			}},
+		}
+		Expect(m.Run(ctx)).ShouldNot(Succeed())
+		Expect(applied).Should(Equal([]string{"1.3.0"}))
+		Expect(evRec.Events).Should(Receive(ContainSubstring(events.OperatorMigrationApplied)))
+		Expect(evRec.Events).Should(Receive(ContainSubstring(events.OperatorMigrationFailed)))
+		Expect(GetAppliedVersion(vdb)).Should(Equal(""))
+	})
+})
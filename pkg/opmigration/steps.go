@@ -0,0 +1,67 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package opmigration
+
+import (
+	"context"
+
+	"github.com/vertica/vertica-kubernetes/pkg/events"
+	"github.com/vertica/vertica-kubernetes/pkg/iter"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultSteps is the registry of all migration steps. It must be kept in
+// operator version order. When a new operator version changes managed objects
+// in a way that needs a migration, add a step to the end of this list.
+var DefaultSteps = []Step{
+	{
+		Version:     vmeta.OperatorVersion130,
+		Description: "recreate statefulsets to pick up new selector labels",
+		Apply:       deletePre130StatefulSets,
+	},
+}
+
+// deletePre130StatefulSets handles the change to the selector labels for
+// statefulsets that was done in 1.3.0. Selector labels are immutable, so any
+// sts created in prior releases is deleted. The normal reconcile will recreate
+// it.
+func deletePre130StatefulSets(ctx context.Context, m *Migrator) error {
+	finder := iter.MakeSubclusterFinder(m.Client, m.Vdb)
+	stss, err := finder.FindStatefulSets(ctx, iter.FindExisting)
+	if err != nil {
+		return err
+	}
+
+	for i := range stss.Items {
+		sts := &stss.Items[i]
+		opVer, ok := sts.ObjectMeta.Labels[vmeta.OperatorVersionLabel]
+		if !ok {
+			continue
+		}
+		switch opVer {
+		case vmeta.OperatorVersion120, vmeta.OperatorVersion110, vmeta.OperatorVersion100:
+			m.EVWriter.Eventf(m.Vdb, corev1.EventTypeNormal, events.OperatorUpgrade,
+				"Deleting statefulset '%s' because it was created by an old operator (pre-%s)",
+				sts.Name, vmeta.OperatorVersion130)
+			if err := m.Client.Delete(ctx, sts); err != nil {
+				m.Log.Info("Error deleting old statefulset", "opVer", opVer)
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -116,10 +116,33 @@ func (a *ATPlanner) ApplyChanges(vdb *vapi.VerticaDB) (updated bool, err error)
 		vdb.Spec.Local.DepotVolume = vapi.PersistentVolume
 		updated = true
 	}
-
+	// The webhook already validated the paths if we didn't change them.
+	if updated {
+		err = checkPathsForLocalPVCs(vdb)
+	}
 	return updated, err
 }
 
+// checkPathsForLocalPVCs will make sure the paths, after they have been
+// updated from the revive output, can still be mounted in their own PV. A path
+// that has its own PVC cannot be shared with any other path.
+func checkPathsForLocalPVCs(vdb *vapi.VerticaDB) error {
+	loc := &vdb.Spec.Local
+	if loc.CatalogPVC != nil && !loc.IsCatalogPathUnique() {
+		return fmt.Errorf("the catalog path from the revive (%s) must differ from the data and depot path because catalogPVC is set",
+			loc.GetCatalogPath())
+	}
+	if loc.DataPVC != nil && !loc.IsDataPathUnique() {
+		return fmt.Errorf("the data path from the revive (%s) must differ from the catalog and depot path because dataPVC is set",
+			loc.DataPath)
+	}
+	if loc.DepotPVC != nil && !loc.IsDepotPathUnique() {
+		return fmt.Errorf("the depot path from the revive (%s) must differ from the catalog and data path because depotPVC is set",
+			loc.DepotPath)
+	}
+	return nil
+}
+
 // logPathChange will add a log entry for a change to one of the vdb path changes
 func (a *ATPlanner) logPathChange(pathType, oldPath, newPath string) {
 	a.Log.Info(fmt.Sprintf("%s path has to change to match revive output", pathType),
@@ -22,6 +22,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 var _ = Describe("analyze", func() {
@@ -168,6 +169,22 @@ var _ = Describe("analyze", func() {
 		Expect(vdb.Spec.Local.DepotVolume).Should(Equal(vapi.PersistentVolume))
 	})
 
+	It("should fail if a path from the revive cannot be mounted in its own PVC", func() {
+		vdb := vapi.MakeVDB()
+		// The revive output will have the catalog path match the data path
+		vdb.Spec.Local.CatalogPath = vdb.Spec.Local.DataPath
+		p := MakeATPlannerFromVDB(vdb, logger)
+
+		vdb.Spec.Local.CatalogPath = "/catalog"
+		vdb.Spec.Local.CatalogPVC = &vapi.LocalVolumeClaim{RequestSize: resource.MustParse("1Gi")}
+		_, err := p.ApplyChanges(vdb)
+		Expect(err).ShouldNot(Succeed())
+
+		vdb.Spec.Local.CatalogPath = "/catalog"
+		vdb.Spec.Local.CatalogPVC = nil
+		Expect(p.ApplyChanges(vdb)).Should(BeTrue())
+	})
+
 	It("should say revive isn't compatible if paths differ among nodes", func() {
 		p := ATPlanner{
 			Database: Database{
@@ -0,0 +1,107 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package reviveplanner
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	vops "github.com/vertica/vcluster/vclusterops"
+)
+
+// VCPlanner is the revive planner for databases that are managed through the
+// vclusterops library. vclusterops describes the database in communal storage
+// as a JSON document, so there is no need to scrape it out of stdout like we do
+// for admintools. Once parsed, the analysis is the same as the one we do for
+// admintools.
+type VCPlanner struct {
+	ATPlanner
+}
+
+// MakeVCPlanner is a factory function for the Planner interface. This makes one
+// specific to the vclusterops describe output.
+func MakeVCPlanner(log logr.Logger) Planner {
+	return &VCPlanner{
+		ATPlanner: ATPlanner{
+			Log: log,
+		},
+	}
+}
+
+// Parse will take the JSON output of the vclusterops describe and convert it
+// into the Database and CommunalLocation structs that the analysis uses.
+func (v *VCPlanner) Parse(op string) error {
+	// We only parse once. No-op if parse already done.
+	if v.ParseComplete {
+		return nil
+	}
+	vdb := vops.MakeVCoordinationDatabase()
+	if err := json.Unmarshal([]byte(op), &vdb); err != nil {
+		return err
+	}
+
+	v.CommunalLocation = CommunalLocation{
+		CommunalStorageURL: vdb.CommunalStorageLocation,
+		DepotPath:          vdb.DepotPrefix,
+		DepotSize:          vdb.DepotSize,
+	}
+	// A shard count of zero means it wasn't included in the output. Leave it
+	// blank so that we don't try to update the vdb with it.
+	if vdb.NumShards > 0 {
+		v.CommunalLocation.NumShards = strconv.Itoa(vdb.NumShards)
+	}
+
+	v.Database = Database{
+		Name: vdb.Name,
+	}
+	for h := range vdb.HostNodeMap {
+		vnode := vdb.HostNodeMap[h]
+		v.Database.Nodes = append(v.Database.Nodes, v.makeNode(&vnode))
+	}
+	// The host map has no order. Sort by the node name so that the node list
+	// is the same each time we parse.
+	sort.Slice(v.Database.Nodes, func(i, j int) bool {
+		return v.Database.Nodes[i].Name < v.Database.Nodes[j].Name
+	})
+	return nil
+}
+
+// makeNode converts a vclusterops node into the Node struct used by the
+// analysis.
+func (v *VCPlanner) makeNode(vnode *vops.VCoordinationNode) Node {
+	node := Node{
+		Name:        vnode.Name,
+		Host:        vnode.Address,
+		Port:        vnode.Port,
+		CatalogPath: vnode.CatalogPath,
+		StorageLocs: vnode.StorageLocations,
+	}
+	for _, loc := range vnode.StorageLocations {
+		node.VStorageLocations = append(node.VStorageLocations, StorageLocation{
+			Path:  loc,
+			Usage: UsageIsDataTemp,
+		})
+	}
+	if vnode.DepotPath != "" {
+		node.VStorageLocations = append(node.VStorageLocations, StorageLocation{
+			Path:  vnode.DepotPath,
+			Usage: UsageIsDepot,
+		})
+	}
+	return node
+}
@@ -0,0 +1,102 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package reviveplanner
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+)
+
+const sampleVCDescribeOutput = `{
+	"Name": "vertdb",
+	"CatalogPrefix": "/catalog",
+	"DataPrefix": "/data",
+	"HostNodeMap": {
+		"10.244.0.48": {
+			"Name": "v_vertdb_node0002",
+			"Address": "10.244.0.48",
+			"CatalogPath": "/catalog/vertdb/v_vertdb_node0002_catalog",
+			"StorageLocations": ["/data/vertdb/v_vertdb_node0002_data"],
+			"DepotPath": "/depot/vertdb/v_vertdb_node0002_depot",
+			"Port": 5433,
+			"ControlAddressFamily": "ipv4"
+		},
+		"10.244.0.47": {
+			"Name": "v_vertdb_node0001",
+			"Address": "10.244.0.47",
+			"CatalogPath": "/catalog/vertdb/v_vertdb_node0001_catalog",
+			"StorageLocations": ["/data/vertdb/v_vertdb_node0001_data"],
+			"DepotPath": "/depot/vertdb/v_vertdb_node0001_depot",
+			"Port": 5433,
+			"ControlAddressFamily": "ipv4"
+		}
+	},
+	"HostList": ["10.244.0.47", "10.244.0.48"],
+	"IsEon": true,
+	"CommunalStorageLocation": "s3://nimbusdb/db",
+	"UseDepot": true,
+	"DepotPrefix": "/depot",
+	"DepotSize": "287447467K",
+	"NumShards": 6,
+	"Ipv6": false
+}`
+
+var _ = Describe("vc", func() {
+	It("should parse the describe output from vclusterops", func() {
+		p := MakeVCPlanner(logger).(*VCPlanner)
+		Expect(p.Parse(sampleVCDescribeOutput)).Should(Succeed())
+		Expect(p.CommunalLocation.CommunalStorageURL).Should(Equal("s3://nimbusdb/db"))
+		Expect(p.CommunalLocation.NumShards).Should(Equal("6"))
+		Expect(p.CommunalLocation.DepotPath).Should(Equal("/depot"))
+		Expect(p.Database.Name).Should(Equal("vertdb"))
+		Expect(len(p.Database.Nodes)).Should(Equal(2))
+		Expect(p.Database.Nodes[0].Name).Should(Equal("v_vertdb_node0001"))
+		Expect(p.Database.Nodes[0].Host).Should(Equal("10.244.0.47"))
+		Expect(p.Database.Nodes[0].CatalogPath).Should(Equal("/catalog/vertdb/v_vertdb_node0001_catalog"))
+		Expect(p.Database.Nodes[0].GetDataPaths()).Should(ContainElement("/data/vertdb/v_vertdb_node0001_data"))
+		Expect(p.Database.Nodes[0].GetDepotPath()).Should(ContainElement("/depot/vertdb/v_vertdb_node0001_depot"))
+		Expect(p.Database.Nodes[1].Name).Should(Equal("v_vertdb_node0002"))
+	})
+
+	It("should fail to parse output that isn't JSON", func() {
+		p := MakeVCPlanner(logger)
+		Expect(p.Parse("== Database and node details: ==")).ShouldNot(Succeed())
+	})
+
+	It("should update vdb paths based on the describe output", func() {
+		p := MakeVCPlanner(logger)
+		Expect(p.Parse(sampleVCDescribeOutput)).Should(Succeed())
+		_, ok := p.IsCompatible()
+		Expect(ok).Should(BeTrue())
+
+		vdb := vapi.MakeVDB()
+		vdb.Spec.DBName = "vertdb"
+		vdb.Spec.ShardCount = 12
+		Expect(p.ApplyChanges(vdb)).Should(BeTrue())
+		Expect(vdb.Spec.ShardCount).Should(Equal(6))
+		Expect(vdb.Spec.Local.GetCatalogPath()).Should(Equal("/catalog"))
+		Expect(vdb.Spec.Local.DataPath).Should(Equal("/data"))
+		Expect(vdb.Spec.Local.DepotPath).Should(Equal("/depot"))
+	})
+
+	It("should leave the shard count alone if it isn't in the describe output", func() {
+		p := MakeVCPlanner(logger).(*VCPlanner)
+		Expect(p.Parse(`{"Name": "vertdb", "HostNodeMap": {}}`)).Should(Succeed())
+		Expect(p.CommunalLocation.NumShards).Should(Equal(""))
+	})
+})
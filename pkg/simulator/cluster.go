@@ -0,0 +1,554 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package simulator provides an in-memory model of a Vertica cluster. It
+// implements both vadmin.Dispatcher and cmds.PodRunner so that whole
+// reconcile loops can be driven in envtest without a real Vertica server.
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	vmeta "github.com/vertica/vertica-kubernetes/pkg/meta"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// StateUp and StateDown are the node states reported by the simulator.
+	// These match the values found in the NODE_STATE column of NODES.
+	StateUp   = vadmin.StateUp
+	StateDown = "DOWN"
+
+	// DefaultVersion is the version reported for images that have no entry in
+	// Cluster.ImageVersions.
+	DefaultVersion = "v12.0.4-0"
+
+	// DefaultLeaseDuration is how long the communal lease is held after a
+	// cluster goes down without a clean shutdown.
+	DefaultLeaseDuration = 5 * time.Minute
+
+	// DefaultLocalDataSize is the size, in bytes, of the local data PV for a
+	// simulated pod.
+	DefaultLocalDataSize = 10 * 1024 * 1024 * 1024
+
+	// DefaultDepotSize is the size vertica gives the depot if one isn't
+	// specified.
+	DefaultDepotSize = "60%"
+
+	// The first oid handed out for a subcluster. This is just to make the oids
+	// look like they came from a real catalog.
+	firstSubclusterOid = 45035996273704980
+)
+
+// Cluster is an in-memory model of a Vertica cluster running in Kubernetes.
+// It tracks the pods the operator talks to, the database catalog (nodes,
+// subclusters and their state) and the communal lease.
+//
+// All methods are safe for concurrent use.
+type Cluster struct {
+	Log logr.Logger
+	// Client, if set, is used by SyncPods to discover the pods that exist in
+	// Kubernetes.
+	Client client.Client
+	// ImageVersions maps a container image to the version that 'vertica
+	// --version' reports for it. Images not in the map report DefaultVersion.
+	ImageVersions map[string]string
+	// LeaseDuration is how long the communal lease is held after all nodes
+	// go down without calling stop_db.
+	LeaseDuration time.Duration
+	// Histories has every command that was issued through the PodRunner
+	// interface, in the order they were received.
+	Histories []cmds.CmdHistory
+
+	mu       sync.Mutex
+	pods     map[types.NamespacedName]*Pod
+	db       *Database
+	failures map[string]error
+	// When the communal lease expires. The lease is also held whenever at
+	// least one node is UP.
+	leaseExpiry time.Time
+	// now returns the current time. It is overridden in tests.
+	now func() time.Time
+}
+
+// Pod is the simulated state of a single Vertica pod. Some of this state,
+// like the files, would normally live in a PV so it survives pod restarts.
+type Pod struct {
+	Name       types.NamespacedName
+	UID        types.UID
+	IP         string
+	DNSName    string
+	Image      string
+	Subcluster string
+	// Running is true if the pod exists in Kubernetes and is running
+	Running bool
+	// Files maps a file path in the pod to its contents
+	Files map[string]string
+	// Dirs is the set of directories that were created in the pod
+	Dirs map[string]bool
+	// VNode is the name of the Vertica node whose catalog is stored in this
+	// pod. It is empty if the pod has no catalog.
+	VNode             string
+	AgentRunning      bool
+	HTTPServerRunning bool
+	LocalDataSize     int
+	LocalDataAvail    int
+}
+
+// Database is the catalog of the simulated database
+type Database struct {
+	Name         string
+	CommunalPath string
+	CatalogPath  string
+	DataPath     string
+	DepotPath    string
+	ShardCount   int
+	// ReviveInstanceID changes each time the database is created or revived
+	ReviveInstanceID string
+	Nodes            map[string]*Node
+	Subclusters      map[string]*Subcluster
+	nextNodeNum      int
+	nextOid          int64
+	reviveCount      int
+}
+
+// Node is a single node in the simulated database catalog
+type Node struct {
+	Name       string
+	Subcluster string
+	// CatalogIP is the IP address the catalog has for this node. It is only
+	// updated through re_ip or restart_node.
+	CatalogIP string
+	// Pod is the pod whose PV has the catalog for this node
+	Pod      types.NamespacedName
+	State    string
+	ReadOnly bool
+	// ShardSubscriptions is the number of non-replica shards the node is
+	// subscribed to. New nodes have none until the subcluster is rebalanced.
+	ShardSubscriptions int
+	// Sessions is the number of active client sessions on the node
+	Sessions int
+	// DepotMaxSize is the size of the depot in bytes. DepotSize is how the
+	// size was specified, which is usually a percentage of the disk.
+	DepotMaxSize int
+	DepotSize    string
+	// Version is the vertica version the node was last started with
+	Version string
+}
+
+// Subcluster is a single subcluster in the simulated database catalog
+type Subcluster struct {
+	Name      string
+	Oid       int64
+	IsPrimary bool
+	IsDefault bool
+}
+
+// MakeCluster will create a simulated cluster with no pods and no database
+func MakeCluster(log logr.Logger, cli client.Client) *Cluster {
+	return &Cluster{
+		Log:           log,
+		Client:        cli,
+		ImageVersions: map[string]string{},
+		LeaseDuration: DefaultLeaseDuration,
+		pods:          map[types.NamespacedName]*Pod{},
+		failures:      map[string]error{},
+		now:           time.Now,
+	}
+}
+
+// SyncPods will refresh the simulated pods from the pods that exist in
+// Kubernetes for the given vdb. Pods that were deleted or recreated have their
+// vertica process stopped; any state kept in the PV is kept.
+func (c *Cluster) SyncPods(ctx context.Context, vdb *vapi.VerticaDB) error {
+	if c.Client == nil {
+		return fmt.Errorf("simulator has no client to sync pods with")
+	}
+	podList := &corev1.PodList{}
+	if err := c.Client.List(ctx, podList, client.InNamespace(vdb.Namespace),
+		client.MatchingLabels{vmeta.VDBInstanceLabel: vdb.Name}); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found := map[types.NamespacedName]bool{}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		nm := types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
+		found[nm] = true
+		image := ""
+		if len(pod.Spec.Containers) > 0 {
+			image = pod.Spec.Containers[names.ServerContainerIndex].Image
+		}
+		c.syncPod(nm, pod.UID, pod.Status.PodIP, pod.Spec.Hostname+"."+pod.Spec.Subdomain,
+			image, pod.Labels[vmeta.SubclusterNameLabel], pod.Status.Phase == corev1.PodRunning)
+	}
+	for nm, p := range c.pods {
+		if !found[nm] && p.Running {
+			c.stopPod(p)
+		}
+	}
+	return nil
+}
+
+// AddPod will register a running pod with the simulator. This is an
+// alternative to SyncPods for tests that don't use a k8s client. If the pod
+// already exists, its details are updated as though the pod was restarted.
+func (c *Cluster) AddPod(nm types.NamespacedName, ip, dnsName, image, subcluster string) *Pod {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// A new UID causes us to treat this as a restart of the pod
+	uid := types.UID(fmt.Sprintf("%s-%d", nm.Name, c.now().UnixNano()))
+	return c.syncPod(nm, uid, ip, dnsName, image, subcluster, true)
+}
+
+// KillPod will simulate the deletion of a pod. Any vertica process running in
+// it goes down, but the state stored in the PV is kept.
+func (c *Cluster) KillPod(nm types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.pods[nm]; ok {
+		c.stopPod(p)
+	}
+}
+
+// RemovePod will drop all state for a pod, including anything stored in its
+// PV. Use this to mimic the deletion of the pod's PVC.
+func (c *Cluster) RemovePod(nm types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.pods[nm]; ok {
+		c.stopPod(p)
+		delete(c.pods, nm)
+	}
+}
+
+// GetPod returns a copy of the simulated state for a pod
+func (c *Cluster) GetPod(nm types.NamespacedName) (Pod, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.pods[nm]
+	if !ok {
+		return Pod{}, false
+	}
+	return *p, true
+}
+
+// GetNode returns a copy of a node in the catalog
+func (c *Cluster) GetNode(vnode string) (Node, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		return Node{}, false
+	}
+	n, ok := c.db.Nodes[vnode]
+	if !ok {
+		return Node{}, false
+	}
+	return *n, true
+}
+
+// GetNodes returns a copy of all of the nodes in the catalog, sorted by name
+func (c *Cluster) GetNodes() []Node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		return nil
+	}
+	nodes := make([]Node, 0, len(c.db.Nodes))
+	for _, n := range c.db.sortedNodes() {
+		nodes = append(nodes, *n)
+	}
+	return nodes
+}
+
+// GetSubclusters returns a copy of the subclusters in the catalog, sorted by name
+func (c *Cluster) GetSubclusters() []Subcluster {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		return nil
+	}
+	scs := make([]Subcluster, 0, len(c.db.Subclusters))
+	for _, sc := range c.db.Subclusters {
+		scs = append(scs, *sc)
+	}
+	sort.Slice(scs, func(i, j int) bool { return scs[i].Name < scs[j].Name })
+	return scs
+}
+
+// DBExists returns true if a database was created or revived
+func (c *Cluster) DBExists() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.db != nil
+}
+
+// SetNodeState will force the state of a node. This can be used to mimic a
+// node going down, or becoming read-only, without the pod being deleted.
+func (c *Cluster) SetNodeState(vnode, state string, readOnly bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, err := c.findNode(vnode)
+	if err != nil {
+		return err
+	}
+	wasUp := c.db.anyNodeUp()
+	n.State = state
+	n.ReadOnly = readOnly
+	c.updateLeaseAfterNodesDown(wasUp)
+	return nil
+}
+
+// SetSessions sets the number of active client sessions on a node
+func (c *Cluster) SetSessions(vnode string, sessions int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, err := c.findNode(vnode)
+	if err != nil {
+		return err
+	}
+	n.Sessions = sessions
+	return nil
+}
+
+// IsLeaseActive returns true if the communal lease is currently held
+func (c *Cluster) IsLeaseActive() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.isLeaseActive()
+}
+
+// ExpireLease will release the communal lease, as though its timeout had
+// elapsed. It has no effect if any node is still UP.
+func (c *Cluster) ExpireLease() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.leaseExpiry = time.Time{}
+}
+
+// FailNext will cause the next call of the given Dispatcher operation (i.e.
+// "RestartNode") to fail with the given error.
+func (c *Cluster) FailNext(op string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures[op] = err
+}
+
+// FindCommands will search through the command history for any command that
+// contains the given partial command.
+func (c *Cluster) FindCommands(partialCmd ...string) []cmds.CmdHistory {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	partialCmdStr := strings.Join(partialCmd, " ")
+	found := []cmds.CmdHistory{}
+	for _, h := range c.Histories {
+		if strings.Contains(strings.Join(h.Command, " "), partialCmdStr) {
+			found = append(found, h)
+		}
+	}
+	return found
+}
+
+// syncPod will add or update a pod. The caller must hold the lock.
+func (c *Cluster) syncPod(nm types.NamespacedName, uid types.UID, ip, dnsName, image, subcluster string,
+	running bool) *Pod {
+	p, ok := c.pods[nm]
+	if !ok {
+		p = &Pod{
+			Name:           nm,
+			Files:          map[string]string{},
+			Dirs:           map[string]bool{},
+			LocalDataSize:  DefaultLocalDataSize,
+			LocalDataAvail: DefaultLocalDataSize,
+		}
+		c.pods[nm] = p
+	}
+	// A different UID means the pod was deleted and recreated. Anything that
+	// was running in the old pod is gone.
+	if p.UID != uid || !running {
+		c.stopPod(p)
+	}
+	p.UID = uid
+	p.IP = ip
+	p.DNSName = dnsName
+	p.Image = image
+	p.Subcluster = subcluster
+	p.Running = running
+	return p
+}
+
+// stopPod will stop all processes running in the pod. The caller must hold
+// the lock.
+func (c *Cluster) stopPod(p *Pod) {
+	p.Running = false
+	p.AgentRunning = false
+	p.HTTPServerRunning = false
+	if c.db == nil || p.VNode == "" {
+		return
+	}
+	if n, ok := c.db.Nodes[p.VNode]; ok {
+		wasUp := c.db.anyNodeUp()
+		n.State = StateDown
+		n.ReadOnly = false
+		c.updateLeaseAfterNodesDown(wasUp)
+	}
+}
+
+// updateLeaseAfterNodesDown will start the lease timeout if the last node
+// went down without a clean shutdown. The caller must hold the lock.
+func (c *Cluster) updateLeaseAfterNodesDown(wasUp bool) {
+	if wasUp && !c.db.anyNodeUp() {
+		c.leaseExpiry = c.now().Add(c.LeaseDuration)
+	}
+}
+
+// isLeaseActive returns true if the communal lease is held. The caller must
+// hold the lock.
+func (c *Cluster) isLeaseActive() bool {
+	if c.db != nil && c.db.anyNodeUp() {
+		return true
+	}
+	return c.now().Before(c.leaseExpiry)
+}
+
+// findNode returns the node from the catalog. The caller must hold the lock.
+func (c *Cluster) findNode(vnode string) (*Node, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("database does not exist")
+	}
+	n, ok := c.db.Nodes[vnode]
+	if !ok {
+		return nil, fmt.Errorf("node %s does not exist in the catalog", vnode)
+	}
+	return n, nil
+}
+
+// findPodByHost returns the pod that has the given IP or DNS name. The caller
+// must hold the lock.
+func (c *Cluster) findPodByHost(host string) (*Pod, error) {
+	for _, p := range c.pods {
+		if p.IP == host || p.DNSName == host {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("no pod found for host %s", host)
+}
+
+// popFailure returns the error injected for the given op, if any. The caller
+// must hold the lock.
+func (c *Cluster) popFailure(op string) error {
+	err, ok := c.failures[op]
+	if !ok {
+		return nil
+	}
+	delete(c.failures, op)
+	return err
+}
+
+// genNodeName generates the name of the next node to add to the database
+func (d *Database) genNodeName() string {
+	d.nextNodeNum++
+	return fmt.Sprintf("v_%s_node%04d", strings.ToLower(d.Name), d.nextNodeNum)
+}
+
+// makeNode creates a new node whose catalog is in the given pod. It isn't
+// added to the database.
+func (d *Database) makeNode(scName string, p *Pod, catalogIP, state string) *Node {
+	n := &Node{
+		Name:       d.genNodeName(),
+		Subcluster: scName,
+		CatalogIP:  catalogIP,
+		Pod:        p.Name,
+		State:      state,
+	}
+	if d.DepotPath != "" {
+		n.setDepotSize(DefaultDepotSize, p.LocalDataSize)
+	}
+	return n
+}
+
+// setDepotSize will set the depot size as a percentage of the given disk size
+func (n *Node) setDepotSize(pct string, diskSize int) {
+	n.DepotSize = pct
+	const FullPercent = 100
+	if v, err := strconv.Atoi(strings.TrimSuffix(pct, "%")); err == nil {
+		n.DepotMaxSize = diskSize * v / FullPercent
+	}
+}
+
+// addSubcluster adds a new subcluster to the catalog
+func (d *Database) addSubcluster(name string, isPrimary bool) *Subcluster {
+	sc := &Subcluster{
+		Name:      name,
+		Oid:       firstSubclusterOid + d.nextOid,
+		IsPrimary: isPrimary,
+		IsDefault: len(d.Subclusters) == 0,
+	}
+	d.nextOid++
+	d.Subclusters[name] = sc
+	return sc
+}
+
+// anyNodeUp returns true if at least one node in the database is UP
+func (d *Database) anyNodeUp() bool {
+	for _, n := range d.Nodes {
+		if n.State == StateUp {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPrimaryQuorum returns true if more than half of the primary nodes would
+// be UP. The given set of nodes are treated as UP even if they aren't yet.
+func (d *Database) hasPrimaryQuorum(extraUp map[string]bool) bool {
+	total, up := 0, 0
+	for _, n := range d.Nodes {
+		sc, ok := d.Subclusters[n.Subcluster]
+		if !ok || !sc.IsPrimary {
+			continue
+		}
+		total++
+		if n.State == StateUp || extraUp[n.Name] {
+			up++
+		}
+	}
+	return up*2 > total
+}
+
+// sortedNodes returns the nodes sorted by their name
+func (d *Database) sortedNodes() []*Node {
+	nodes := make([]*Node, 0, len(d.Nodes))
+	for _, n := range d.Nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes
+}
@@ -0,0 +1,548 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/vertica/vertica-kubernetes/pkg/reviveplanner"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/addnode"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/addsc"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/createdb"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/describedb"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/fetchnodestate"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/reip"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/removenode"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/removesc"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/restartnode"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/revivedb"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/startdb"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/stopdb"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// The name create_db gives to the first subcluster. The operator renames
+	// it in the post create SQL file.
+	defaultSubclusterName = "default_subcluster"
+	defaultClientPort     = 5433
+)
+
+var _ vadmin.Dispatcher = &Cluster{}
+
+// CreateDB will create a brand new database. It assumes the communal
+// storage location is empty.
+func (c *Cluster) CreateDB(ctx context.Context, opts ...createdb.Option) (ctrl.Result, error) {
+	s := createdb.Parms{}
+	s.Make(opts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.popFailure("CreateDB"); err != nil {
+		return ctrl.Result{}, err
+	}
+	if c.db != nil && c.db.CommunalPath == s.CommunalPath {
+		return ctrl.Result{}, fmt.Errorf("communal location %s is not empty", s.CommunalPath)
+	}
+	if len(s.Hosts) == 0 {
+		return ctrl.Result{}, fmt.Errorf("no hosts given to create_db")
+	}
+	pods := make([]*Pod, 0, len(s.Hosts))
+	for _, h := range s.Hosts {
+		p, err := c.findPodByHost(h)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !p.Running {
+			return ctrl.Result{}, fmt.Errorf("pod %s is not running", p.Name)
+		}
+		pods = append(pods, p)
+	}
+
+	db := &Database{
+		Name:         s.DBName,
+		CommunalPath: s.CommunalPath,
+		CatalogPath:  s.CatalogPath,
+		DataPath:     s.DataPath,
+		DepotPath:    s.DepotPath,
+		ShardCount:   s.ShardCount,
+		Nodes:        map[string]*Node{},
+		Subclusters:  map[string]*Subcluster{},
+	}
+	scName := c.getSubclusterNameFromPostCreateSQL(&s)
+	db.addSubcluster(scName, true)
+	for i, p := range pods {
+		n := db.makeNode(scName, p, s.Hosts[i], StateUp)
+		n.Version = c.imageVersion(p)
+		// New databases have all of their shards evenly distributed
+		n.ShardSubscriptions = (s.ShardCount + len(pods) - 1) / len(pods)
+		db.Nodes[n.Name] = n
+		p.VNode = n.Name
+	}
+	c.dropStaleCatalogs(db)
+	c.db = db
+	c.newReviveInstanceID()
+	c.leaseExpiry = c.now()
+	return ctrl.Result{}, nil
+}
+
+// ReviveDB will initialize a database using a pre-populated communal path.
+func (c *Cluster) ReviveDB(ctx context.Context, opts ...revivedb.Option) (ctrl.Result, error) {
+	s := revivedb.Parms{}
+	s.Make(opts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.popFailure("ReviveDB"); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := c.checkDBInCommunal(s.DBName, s.CommunalPath); err != nil {
+		return ctrl.Result{}, err
+	}
+	if !s.IgnoreClusterLease && c.isLeaseActive() {
+		return ctrl.Result{}, fmt.Errorf("cluster lease for communal location %s has not expired", s.CommunalPath)
+	}
+	nodes := c.db.sortedNodes()
+	if len(s.Hosts) != len(nodes) {
+		return ctrl.Result{}, fmt.Errorf("database has %d nodes but %d hosts were given", len(nodes), len(s.Hosts))
+	}
+	pods := make([]*Pod, 0, len(s.Hosts))
+	for _, h := range s.Hosts {
+		p, err := c.findPodByHost(h)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		pods = append(pods, p)
+	}
+	for i, n := range nodes {
+		// The catalog is rebuilt from communal storage, so it no longer
+		// lives in whatever pod had it before.
+		if old, ok := c.pods[n.Pod]; ok && old.VNode == n.Name {
+			old.VNode = ""
+		}
+		n.Pod = pods[i].Name
+		n.CatalogIP = s.Hosts[i]
+		n.State = StateDown
+		n.ReadOnly = false
+		pods[i].VNode = n.Name
+	}
+	c.newReviveInstanceID()
+	return ctrl.Result{}, nil
+}
+
+// DescribeDB will read state information about the database in communal
+// storage and return it back to the caller. The output is in the same format
+// as 'admintools -t revive_db --display-only'.
+func (c *Cluster) DescribeDB(ctx context.Context, opts ...describedb.Option) (string, ctrl.Result, error) {
+	s := describedb.Parms{}
+	s.Make(opts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.popFailure("DescribeDB"); err != nil {
+		return "", ctrl.Result{}, err
+	}
+	if err := c.checkDBInCommunal(s.DBName, s.CommunalPath); err != nil {
+		return "", ctrl.Result{}, err
+	}
+	return c.genDescribeOutput()
+}
+
+// FetchNodeState will determine if the given set of nodes are considered UP
+// or DOWN in our consensous state. It returns a map of vnode to its node state.
+func (c *Cluster) FetchNodeState(ctx context.Context, opts ...fetchnodestate.Option) (map[string]string, ctrl.Result, error) {
+	s := fetchnodestate.Parms{}
+	s.Make(opts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.popFailure("FetchNodeState"); err != nil {
+		return nil, ctrl.Result{}, err
+	}
+	if c.db == nil {
+		return nil, ctrl.Result{}, fmt.Errorf("database does not exist")
+	}
+	stateMap := map[string]string{}
+	for _, h := range s.Hosts {
+		if n, ok := c.db.Nodes[h.VNode]; ok {
+			stateMap[n.Name] = n.State
+		}
+	}
+	return stateMap, ctrl.Result{}, nil
+}
+
+// ReIP will update the catalog on disk with new IPs for all of the nodes given.
+func (c *Cluster) ReIP(ctx context.Context, opts ...reip.Option) (ctrl.Result, error) {
+	s := reip.Parms{}
+	s.Make(opts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.popFailure("ReIP"); err != nil {
+		return ctrl.Result{}, err
+	}
+	if c.db == nil {
+		// Nothing to update. Only the admintools.conf would change in this
+		// case, which isn't modeled.
+		return ctrl.Result{}, nil
+	}
+	for _, h := range s.Hosts {
+		n, ok := c.db.Nodes[h.VNode]
+		// Hosts that aren't yet part of the database are skipped
+		if !ok || n.CatalogIP == h.IP {
+			continue
+		}
+		if n.State == StateUp {
+			return ctrl.Result{}, fmt.Errorf("cannot change the IP of node %s while it is UP", n.Name)
+		}
+		n.CatalogIP = h.IP
+	}
+	return ctrl.Result{}, nil
+}
+
+// StopDB will stop all the vertica hosts of a running cluster.
+func (c *Cluster) StopDB(ctx context.Context, opts ...stopdb.Option) error {
+	s := stopdb.Parms{}
+	s.Make(opts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.popFailure("StopDB"); err != nil {
+		return err
+	}
+	if c.db == nil {
+		return fmt.Errorf("database does not exist")
+	}
+	for _, n := range c.db.Nodes {
+		n.State = StateDown
+		n.ReadOnly = false
+	}
+	// A clean shutdown releases the lease right away
+	c.leaseExpiry = c.now()
+	return nil
+}
+
+// AddNode will add a new vertica node to the cluster.
+func (c *Cluster) AddNode(ctx context.Context, opts ...addnode.Option) error {
+	s := addnode.Parms{}
+	s.Make(opts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.popFailure("AddNode"); err != nil {
+		return err
+	}
+	if err := c.checkDBUp(); err != nil {
+		return err
+	}
+	if _, ok := c.db.Subclusters[s.Subcluster]; !ok {
+		return fmt.Errorf("subcluster %s does not exist", s.Subcluster)
+	}
+	for _, h := range s.Hosts {
+		p, err := c.findPodByHost(h)
+		if err != nil {
+			return err
+		}
+		if p.VNode != "" {
+			if _, ok := c.db.Nodes[p.VNode]; ok {
+				return fmt.Errorf("host %s is already part of the database as %s", h, p.VNode)
+			}
+		}
+		n := c.db.makeNode(s.Subcluster, p, p.IP, StateUp)
+		n.Version = c.imageVersion(p)
+		c.db.Nodes[n.Name] = n
+		p.VNode = n.Name
+	}
+	return nil
+}
+
+// AddSubcluster will create a subcluster in the vertica cluster.
+func (c *Cluster) AddSubcluster(ctx context.Context, opts ...addsc.Option) error {
+	s := addsc.Parms{}
+	s.Make(opts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.popFailure("AddSubcluster"); err != nil {
+		return err
+	}
+	if err := c.checkDBUp(); err != nil {
+		return err
+	}
+	if _, ok := c.db.Subclusters[s.Subcluster]; ok {
+		return fmt.Errorf("subcluster %s already exists", s.Subcluster)
+	}
+	c.db.addSubcluster(s.Subcluster, s.IsPrimary)
+	return nil
+}
+
+// RemoveNode will remove an existng vertica node from the cluster.
+func (c *Cluster) RemoveNode(ctx context.Context, opts ...removenode.Option) error {
+	s := removenode.Parms{}
+	s.Make(opts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.popFailure("RemoveNode"); err != nil {
+		return err
+	}
+	if err := c.checkDBUp(); err != nil {
+		return err
+	}
+	for _, h := range s.Hosts {
+		p, err := c.findPodByHost(h)
+		if err != nil {
+			return err
+		}
+		if _, ok := c.db.Nodes[p.VNode]; !ok {
+			return fmt.Errorf("host %s is not part of the database", h)
+		}
+		delete(c.db.Nodes, p.VNode)
+		p.VNode = ""
+	}
+	return nil
+}
+
+// RemoveSubcluster will remove the given subcluster, and all of its nodes,
+// from the vertica cluster.
+func (c *Cluster) RemoveSubcluster(ctx context.Context, opts ...removesc.Option) error {
+	s := removesc.Parms{}
+	s.Make(opts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.popFailure("RemoveSubcluster"); err != nil {
+		return err
+	}
+	if err := c.checkDBUp(); err != nil {
+		return err
+	}
+	sc, ok := c.db.Subclusters[s.Subcluster]
+	if !ok {
+		return fmt.Errorf("subcluster %s does not exist", s.Subcluster)
+	}
+	if sc.IsDefault {
+		return fmt.Errorf("cannot remove the default subcluster %s", s.Subcluster)
+	}
+	for name, n := range c.db.Nodes {
+		if n.Subcluster != s.Subcluster {
+			continue
+		}
+		if p, ok := c.pods[n.Pod]; ok && p.VNode == name {
+			p.VNode = ""
+		}
+		delete(c.db.Nodes, name)
+	}
+	delete(c.db.Subclusters, s.Subcluster)
+	return nil
+}
+
+// RestartNode will restart a subset of nodes. The cluster must have quorum.
+// The IP given for each vnode is saved in the catalog.
+func (c *Cluster) RestartNode(ctx context.Context, opts ...restartnode.Option) (ctrl.Result, error) {
+	s := restartnode.Parms{}
+	s.Make(opts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.popFailure("RestartNode"); err != nil {
+		return ctrl.Result{}, err
+	}
+	if c.db == nil {
+		return ctrl.Result{}, fmt.Errorf("database does not exist")
+	}
+	if !c.db.hasPrimaryQuorum(nil) {
+		return ctrl.Result{}, fmt.Errorf("cluster does not have quorum, restart_node cannot be used")
+	}
+	for i, vnode := range s.HostVNodes {
+		n, err := c.findNode(vnode)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		p, err := c.findPodByHost(s.HostIPs[i])
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := c.startNode(n, p); err != nil {
+			return ctrl.Result{}, err
+		}
+		n.CatalogIP = s.HostIPs[i]
+	}
+	return ctrl.Result{}, nil
+}
+
+// StartDB will start a subset of nodes. The IP given for each host must match
+// what is in the catalog, and enough primary nodes must come up to form
+// quorum.
+func (c *Cluster) StartDB(ctx context.Context, opts ...startdb.Option) (ctrl.Result, error) {
+	s := startdb.Parms{}
+	s.Make(opts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.popFailure("StartDB"); err != nil {
+		return ctrl.Result{}, err
+	}
+	if c.db == nil {
+		return ctrl.Result{}, fmt.Errorf("database does not exist")
+	}
+	toStart := map[*Node]*Pod{}
+	vnodes := map[string]bool{}
+	for _, h := range s.Hosts {
+		p, err := c.findPodByHost(h)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		n, err := c.findNode(p.VNode)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("host %s has no catalog: %w", h, err)
+		}
+		if n.CatalogIP != h {
+			return ctrl.Result{}, fmt.Errorf("node %s has IP %s in the catalog but is being started with %s, re_ip is needed",
+				n.Name, n.CatalogIP, h)
+		}
+		toStart[n] = p
+		vnodes[n.Name] = true
+	}
+	if !c.db.hasPrimaryQuorum(vnodes) {
+		return ctrl.Result{}, fmt.Errorf("not enough primary nodes to start the database")
+	}
+	for n, p := range toStart {
+		if err := c.startNode(n, p); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// startNode will bring a node UP in the given pod. The caller must hold the
+// lock.
+func (c *Cluster) startNode(n *Node, p *Pod) error {
+	if !p.Running {
+		return fmt.Errorf("pod %s is not running", p.Name)
+	}
+	if old, ok := c.pods[n.Pod]; ok && old != p && old.VNode == n.Name {
+		old.VNode = ""
+	}
+	n.Pod = p.Name
+	n.State = StateUp
+	n.ReadOnly = false
+	n.Version = c.imageVersion(p)
+	p.VNode = n.Name
+	return nil
+}
+
+// checkDBUp returns an error if the database isn't running. The caller must
+// hold the lock.
+func (c *Cluster) checkDBUp() error {
+	if c.db == nil {
+		return fmt.Errorf("database does not exist")
+	}
+	if !c.db.anyNodeUp() {
+		return fmt.Errorf("database %s is not running", c.db.Name)
+	}
+	return nil
+}
+
+// checkDBInCommunal returns an error if the database isn't found in the
+// communal location. The caller must hold the lock.
+func (c *Cluster) checkDBInCommunal(dbName, communalPath string) error {
+	if c.db == nil || c.db.CommunalPath != communalPath {
+		return fmt.Errorf("no database found in communal location %s", communalPath)
+	}
+	if !strings.EqualFold(c.db.Name, dbName) {
+		return fmt.Errorf("communal location %s has database %s, not %s", communalPath, c.db.Name, dbName)
+	}
+	return nil
+}
+
+// dropStaleCatalogs will remove the catalog reference from any pod whose node
+// isn't part of the given database. The caller must hold the lock.
+func (c *Cluster) dropStaleCatalogs(db *Database) {
+	for _, p := range c.pods {
+		if n, ok := db.Nodes[p.VNode]; !ok || n.Pod != p.Name {
+			p.VNode = ""
+		}
+	}
+}
+
+// newReviveInstanceID generates a new instance ID for the database. The
+// caller must hold the lock.
+func (c *Cluster) newReviveInstanceID() {
+	c.db.reviveCount++
+	c.db.ReviveInstanceID = fmt.Sprintf("%x%04d", c.now().UnixNano(), c.db.reviveCount)
+}
+
+// getSubclusterNameFromPostCreateSQL returns the name of the first subcluster
+// for create_db. The operator renames the default subcluster in the post
+// create SQL file, which we look for in the initiator pod. The caller must
+// hold the lock.
+func (c *Cluster) getSubclusterNameFromPostCreateSQL(s *createdb.Parms) string {
+	p, ok := c.pods[s.Initiator]
+	if !ok || s.PostDBCreateSQLFile == "" {
+		return defaultSubclusterName
+	}
+	re := regexp.MustCompile(`alter subcluster default_subcluster rename to "([^"]+)"`)
+	m := re.FindStringSubmatch(p.Files[s.PostDBCreateSQLFile])
+	const ExpectedMatches = 2
+	if len(m) < ExpectedMatches {
+		return defaultSubclusterName
+	}
+	return m[1]
+}
+
+// genDescribeOutput generates the output of describe db in the format of
+// admintools. The caller must hold the lock.
+func (c *Cluster) genDescribeOutput() (string, ctrl.Result, error) {
+	commLoc := reviveplanner.CommunalLocation{
+		CommunalStorageURL: c.db.CommunalPath,
+		NumShards:          fmt.Sprintf("%d", c.db.ShardCount),
+		DepotPath:          c.db.DepotPath,
+	}
+	db := reviveplanner.Database{Name: c.db.Name}
+	for _, n := range c.db.sortedNodes() {
+		sc := c.db.Subclusters[n.Subcluster]
+		db.Nodes = append(db.Nodes, reviveplanner.Node{
+			Name:        n.Name,
+			CatalogPath: fmt.Sprintf("%s/%s/%s_catalog", c.db.CatalogPath, c.db.Name, n.Name),
+			Host:        n.CatalogIP,
+			Port:        defaultClientPort,
+			IsPrimary:   sc != nil && sc.IsPrimary,
+			VStorageLocations: []reviveplanner.StorageLocation{
+				{
+					Path:  fmt.Sprintf("%s/%s/%s_data", c.db.DataPath, c.db.Name, n.Name),
+					Usage: reviveplanner.UsageIsDataTemp,
+				}, {
+					Path:  fmt.Sprintf("%s/%s/%s_depot", c.db.DepotPath, c.db.Name, n.Name),
+					Usage: reviveplanner.UsageIsDepot,
+				},
+			},
+		})
+	}
+	commJSON, err := json.Marshal(&commLoc)
+	if err != nil {
+		return "", ctrl.Result{}, err
+	}
+	dbJSON, err := json.Marshal(&db)
+	if err != nil {
+		return "", ctrl.Result{}, err
+	}
+	lease := "None"
+	if c.isLeaseActive() {
+		lease = c.leaseExpiry.String()
+	}
+	var sb strings.Builder
+	sb.WriteString("== Communal location details: ==\n")
+	sb.Write(commJSON)
+	sb.WriteString(fmt.Sprintf("\nCluster lease expiration: %s\n", lease))
+	sb.WriteString("== Database and node details: ==\n")
+	sb.Write(dbJSON)
+	sb.WriteString("\n")
+	return sb.String(), ctrl.Result{}, nil
+}
@@ -0,0 +1,161 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package simulator
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/createdb"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/restartnode"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/revivedb"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/startdb"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/stopdb"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	testDBName       = "vertdb"
+	testCommunalPath = "s3://nimbusdb/db"
+)
+
+var _ = Describe("dispatcher", func() {
+	ctx := context.Background()
+
+	It("should create a database with all nodes up", func() {
+		c, ips := makeClusterWithPods(3)
+		createTestDB(ctx, c, ips)
+		Expect(c.DBExists()).Should(BeTrue())
+		nodes := c.GetNodes()
+		Expect(nodes).Should(HaveLen(3))
+		for i := range nodes {
+			Expect(nodes[i].State).Should(Equal(StateUp))
+			Expect(nodes[i].ShardSubscriptions).Should(Equal(4))
+		}
+		Expect(c.GetSubclusters()).Should(HaveLen(1))
+		Expect(c.GetSubclusters()[0].Name).Should(Equal(defaultSubclusterName))
+
+		_, err := c.CreateDB(ctx, createdb.WithDBName(testDBName), createdb.WithCommunalPath(testCommunalPath),
+			createdb.WithHosts(ips))
+		Expect(err).ShouldNot(Succeed())
+	})
+
+	It("should not revive a database while the cluster lease is active", func() {
+		c, ips := makeClusterWithPods(3)
+		createTestDB(ctx, c, ips)
+		for i := range ips {
+			c.KillPod(testPodName(i))
+		}
+		Expect(c.IsLeaseActive()).Should(BeTrue())
+		_, err := c.ReviveDB(ctx, revivedb.WithDBName(testDBName), revivedb.WithCommunalPath(testCommunalPath),
+			revivedb.WithHosts(ips))
+		Expect(err).ShouldNot(Succeed())
+
+		c.ExpireLease()
+		_, err = c.ReviveDB(ctx, revivedb.WithDBName(testDBName), revivedb.WithCommunalPath(testCommunalPath),
+			revivedb.WithHosts(ips))
+		Expect(err).Should(Succeed())
+		for _, n := range c.GetNodes() {
+			Expect(n.State).Should(Equal(StateDown))
+		}
+	})
+
+	It("should require a re_ip before start_db when IPs change", func() {
+		c, ips := makeClusterWithPods(3)
+		createTestDB(ctx, c, ips)
+		Expect(c.StopDB(ctx, stopdb.WithInitiator(testPodName(0), ips[0]))).Should(Succeed())
+		Expect(c.IsLeaseActive()).Should(BeFalse())
+
+		newIPs := []string{"10.10.2.1", ips[1], ips[2]}
+		for i := range newIPs {
+			c.AddPod(testPodName(i), newIPs[i], testDNSName(i), "", "")
+		}
+		_, err := c.StartDB(ctx, startDBHosts(newIPs)...)
+		Expect(err).ShouldNot(Succeed())
+		_, err = c.StartDB(ctx, startDBHosts(ips[1:])...)
+		Expect(err).Should(Succeed())
+		nodes := c.GetNodes()
+		Expect(nodes[0].State).Should(Equal(StateDown))
+		Expect(nodes[1].State).Should(Equal(StateUp))
+	})
+
+	It("should only restart nodes when the cluster has quorum", func() {
+		c, ips := makeClusterWithPods(3)
+		createTestDB(ctx, c, ips)
+		nodes := c.GetNodes()
+		c.KillPod(testPodName(0))
+		c.KillPod(testPodName(1))
+		c.AddPod(testPodName(0), ips[0], testDNSName(0), "", "")
+		_, err := c.RestartNode(ctx, restartnode.WithHost(nodes[0].Name, ips[0]))
+		Expect(err).ShouldNot(Succeed())
+
+		c.KillPod(testPodName(2))
+		c.AddPod(testPodName(1), ips[1], testDNSName(1), "", "")
+		_, err = c.StartDB(ctx, startdb.WithHost(ips[1]))
+		Expect(err).ShouldNot(Succeed())
+		_, err = c.StartDB(ctx, startDBHosts(ips[:2])...)
+		Expect(err).Should(Succeed())
+		Expect(c.GetNodes()[0].State).Should(Equal(StateUp))
+	})
+
+	It("should fail the next call when a failure is injected", func() {
+		c, ips := makeClusterWithPods(1)
+		c.FailNext("CreateDB", fmt.Errorf("injected failure"))
+		_, err := c.CreateDB(ctx, createdb.WithDBName(testDBName), createdb.WithCommunalPath(testCommunalPath),
+			createdb.WithHosts(ips))
+		Expect(err).Should(MatchError("injected failure"))
+		createTestDB(ctx, c, ips)
+	})
+})
+
+// makeClusterWithPods creates a simulated cluster with the given number of
+// running pods. It returns the IPs of each pod.
+func makeClusterWithPods(numPods int) (*Cluster, []string) {
+	c := MakeCluster(logger, nil)
+	ips := make([]string, numPods)
+	for i := 0; i < numPods; i++ {
+		ips[i] = fmt.Sprintf("10.10.1.%d", i+1)
+		c.AddPod(testPodName(i), ips[i], testDNSName(i), "", "")
+	}
+	return c, ips
+}
+
+// createTestDB will create the database in the simulated cluster
+func createTestDB(ctx context.Context, c *Cluster, ips []string) {
+	const ShardCount = 12
+	_, err := c.CreateDB(ctx, createdb.WithDBName(testDBName), createdb.WithCommunalPath(testCommunalPath),
+		createdb.WithHosts(ips), createdb.WithShardCount(ShardCount))
+	ExpectWithOffset(1, err).Should(Succeed())
+}
+
+// startDBHosts returns the start_db options for each of the given hosts
+func startDBHosts(ips []string) []startdb.Option {
+	opts := make([]startdb.Option, len(ips))
+	for i := range ips {
+		opts[i] = startdb.WithHost(ips[i])
+	}
+	return opts
+}
+
+func testPodName(i int) types.NamespacedName {
+	return types.NamespacedName{Namespace: "default", Name: fmt.Sprintf("v-sc1-%d", i)}
+}
+
+func testDNSName(i int) string {
+	return fmt.Sprintf("v-sc1-%d.v", i)
+}
@@ -0,0 +1,370 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/paths"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ cmds.PodRunner = &Cluster{}
+
+var (
+	// cat > <file><<< '<contents>'[; bash <file>]
+	hereStringPattern = regexp.MustCompile(`(?s)^cat > (\S+?)\s*<<< (['"])(.*)(['"])(; bash (\S+))?\s*$`)
+	// The command used by the install reconciler to create the install indicator
+	grepTeePattern = regexp.MustCompile(`^grep -E '(.+)' (\S+) \| head -1 \| cut -d' ' -f1 \| tee (\S+)$`)
+	// [[ -d <dir> ]] && rm -rf <dir> || true
+	rmDirPattern = regexp.MustCompile(`^\[\[ -d (\S+) \]\] && rm -rf \S+ \|\| true$`)
+)
+
+// ExecInPod will run a command in a simulated pod. Only the commands the
+// operator issues are understood. Any other command succeeds with no output.
+func (c *Cluster) ExecInPod(ctx context.Context, podName types.NamespacedName,
+	contName string, command ...string) (stdout, stderr string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Histories = append(c.Histories, cmds.CmdHistory{Pod: podName, Command: command})
+	p, err := c.findRunningPod(podName)
+	if err != nil {
+		return "", err.Error(), err
+	}
+	return c.execCmd(p, command)
+}
+
+// ExecVSQL will run a vsql command in a simulated pod. It fails if vertica
+// isn't running in the pod.
+func (c *Cluster) ExecVSQL(ctx context.Context, podName types.NamespacedName,
+	contName string, command ...string) (stdout, stderr string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Histories = append(c.Histories, cmds.CmdHistory{Pod: podName, Command: cmds.UpdateVsqlCmd("", command...)})
+	p, err := c.findRunningPod(podName)
+	if err != nil {
+		return "", err.Error(), err
+	}
+	return c.execVSQL(p, command)
+}
+
+// ExecAdmintools is not supported. The simulator models the cluster at the
+// level of the Dispatcher interface, so admintools is never called.
+func (c *Cluster) ExecAdmintools(ctx context.Context, podName types.NamespacedName,
+	contName string, command ...string) (stdout, stderr string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Histories = append(c.Histories, cmds.CmdHistory{Pod: podName, Command: cmds.UpdateAdmintoolsCmd("", command...)})
+	err = fmt.Errorf("admintools is not simulated, use the Dispatcher interface instead")
+	return "", err.Error(), err
+}
+
+// CopyToPod will copy a local file into a simulated pod. If a command is
+// given, it is run after the copy.
+func (c *Cluster) CopyToPod(ctx context.Context, podName types.NamespacedName,
+	contName string, sourceFile string, destFile string, executeCmd ...string) (stdout, stderr string, err error) {
+	contents, err := os.ReadFile(sourceFile)
+	if err != nil {
+		return "", "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Histories = append(c.Histories, cmds.CmdHistory{Pod: podName, Command: []string{"sh", "-c", "cat > " + destFile}})
+	p, err := c.findRunningPod(podName)
+	if err != nil {
+		return "", err.Error(), err
+	}
+	p.Files[destFile] = string(contents)
+	if executeCmd == nil {
+		return "", "", nil
+	}
+	c.Histories = append(c.Histories, cmds.CmdHistory{Pod: podName, Command: executeCmd})
+	return c.execCmd(p, executeCmd)
+}
+
+// DumpAdmintoolsConf is a no-op for the simulator
+func (c *Cluster) DumpAdmintoolsConf(ctx context.Context, podName types.NamespacedName) {}
+
+// findRunningPod returns the pod if it exists and is running. The caller must
+// hold the lock.
+func (c *Cluster) findRunningPod(podName types.NamespacedName) (*Pod, error) {
+	p, ok := c.pods[podName]
+	if !ok || !p.Running {
+		return nil, fmt.Errorf("pod %s is not running", podName)
+	}
+	return p, nil
+}
+
+// isVerticaRunning returns true if the vertica process is running in the
+// pod. The caller must hold the lock.
+func (c *Cluster) isVerticaRunning(p *Pod) bool {
+	if !p.Running || c.db == nil {
+		return false
+	}
+	n, ok := c.db.Nodes[p.VNode]
+	return ok && n.State == StateUp && n.Pod == p.Name
+}
+
+// execCmd will simulate a single command. The caller must hold the lock.
+func (c *Cluster) execCmd(p *Pod, command []string) (stdout, stderr string, err error) {
+	if len(command) == 0 {
+		return "", "", nil
+	}
+	switch {
+	case len(command) == 3 && command[0] == "bash" && command[1] == "-c":
+		return c.execScript(p, command[2])
+	case len(command) == 2 && command[0] == "bash" && command[1] == paths.PodFactGatherScript:
+		return c.genGatherOutput(p, p.Files[command[1]])
+	case len(command) == 2 && command[0] == "bash":
+		return c.execScript(p, p.Files[command[1]])
+	case len(command) == 2 && command[1] == paths.EulaAcceptanceScript:
+		p.Files[paths.EulaAcceptanceFile] = ""
+		return "", "", nil
+	case len(command) == 2 && command[0] == "/opt/vertica/bin/vertica" && command[1] == "--version":
+		return c.genVersionOutput(p), "", nil
+	case len(command) == 3 && command[1] == "/opt/vertica/sbin/vertica_agent" && command[2] == "start":
+		p.AgentRunning = true
+		return "", "", nil
+	}
+	return c.execLine(p, strings.Join(command, " "))
+}
+
+// execScript will simulate a bash script, one line at a time. The caller
+// must hold the lock.
+func (c *Cluster) execScript(p *Pod, script string) (stdout, stderr string, err error) {
+	if m := hereStringPattern.FindStringSubmatch(script); m != nil {
+		contents := m[3]
+		if m[2] == `"` {
+			contents = strings.ReplaceAll(contents, `\"`, `"`)
+		}
+		p.Files[m[1]] = contents
+		if m[6] == "" {
+			return "", "", nil
+		}
+		return c.execScript(p, contents)
+	}
+	var sb strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || line == "set -o errexit" {
+			continue
+		}
+		out, serr, err := c.execLine(p, line)
+		sb.WriteString(out)
+		if err != nil {
+			return sb.String(), serr, err
+		}
+	}
+	return sb.String(), "", nil
+}
+
+// execLine will simulate a single line of shell. The caller must hold the lock.
+func (c *Cluster) execLine(p *Pod, line string) (stdout, stderr string, err error) {
+	if m := grepTeePattern.FindStringSubmatch(line); m != nil {
+		return c.execGrepTee(p, m[1], m[2], m[3])
+	}
+	if m := rmDirPattern.FindStringSubmatch(line); m != nil {
+		c.removeDir(p, m[1])
+		return "", "", nil
+	}
+	if strings.Contains(line, "pgrep ^vertica$") && strings.Contains(line, "kill") {
+		return c.killVertica(p), "", nil
+	}
+	// Drop redirection and error suppression. They don't change the outcome
+	// in the simulator.
+	line = strings.TrimSuffix(line, " || true")
+	line = strings.TrimSuffix(line, " 2>/dev/null")
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return "", "", nil
+	}
+	switch args[0] {
+	case "mkdir":
+		p.Dirs[args[len(args)-1]] = true
+	case "cp":
+		p.Files[args[len(args)-1]] = ""
+	case "rm":
+		delete(p.Files, args[len(args)-1])
+	case "mv":
+		const MvArgs = 3
+		if len(args) != MvArgs {
+			break
+		}
+		contents, ok := p.Files[args[1]]
+		if !ok {
+			err = fmt.Errorf("mv: cannot stat '%s': No such file or directory", args[1])
+			return "", err.Error(), err
+		}
+		delete(p.Files, args[1])
+		p.Files[args[2]] = contents
+	case "cat":
+		contents, ok := p.Files[args[len(args)-1]]
+		if !ok {
+			err = fmt.Errorf("cat: %s: No such file or directory", args[len(args)-1])
+			return "", err.Error(), err
+		}
+		return contents, "", nil
+	case "test":
+		if !c.testPath(p, args) {
+			return "", "", fmt.Errorf("test failed: %s", line)
+		}
+	}
+	return "", "", nil
+}
+
+// execGrepTee simulates the grep of a file, saving the first column of the
+// first matching line to another file. The caller must hold the lock.
+func (c *Cluster) execGrepTee(p *Pod, pattern, srcFile, destFile string) (stdout, stderr string, err error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err.Error(), err
+	}
+	out := ""
+	for _, l := range strings.Split(p.Files[srcFile], "\n") {
+		if re.MatchString(l) {
+			out = strings.Fields(l)[0] + "\n"
+			break
+		}
+	}
+	p.Files[destFile] = out
+	return out, "", nil
+}
+
+// removeDir deletes a directory and everything under it. The caller must hold
+// the lock.
+func (c *Cluster) removeDir(p *Pod, dir string) {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	for d := range p.Dirs {
+		if d == dir || strings.HasPrefix(d, prefix) {
+			delete(p.Dirs, d)
+		}
+	}
+	for f := range p.Files {
+		if strings.HasPrefix(f, prefix) {
+			delete(p.Files, f)
+		}
+	}
+}
+
+// killVertica stops the vertica process running in the pod, if any. The
+// caller must hold the lock.
+func (c *Cluster) killVertica(p *Pod) string {
+	if !c.isVerticaRunning(p) {
+		return ""
+	}
+	n := c.db.Nodes[p.VNode]
+	wasUp := c.db.anyNodeUp()
+	n.State = StateDown
+	n.ReadOnly = false
+	c.updateLeaseAfterNodesDown(wasUp)
+	return "Killing process 1\n"
+}
+
+// testPath simulates 'test -f' and 'test -d'. The caller must hold the lock.
+func (c *Cluster) testPath(p *Pod, args []string) bool {
+	const TestArgs = 3
+	if len(args) != TestArgs {
+		return true
+	}
+	switch args[1] {
+	case "-f":
+		_, ok := p.Files[args[2]]
+		return ok
+	case "-d":
+		return p.Dirs[args[2]]
+	}
+	return true
+}
+
+// genVersionOutput returns the output of 'vertica --version' for the pod's
+// image. The caller must hold the lock.
+func (c *Cluster) genVersionOutput(p *Pod) string {
+	ver := c.imageVersion(p)
+	return fmt.Sprintf("Vertica Analytic Database %s\n"+
+		"vertica(%s) built by @re-docker2 from master@da8f0e93f1ee720d8e4f8e1366a26c0d9dd7f9e7 on 'Tue Jun  1 05:04:35 2021' $BuildId$\n",
+		ver, ver)
+}
+
+// imageVersion returns the vertica version of the pod's image. The caller must
+// hold the lock.
+func (c *Cluster) imageVersion(p *Pod) string {
+	if ver, ok := c.ImageVersions[p.Image]; ok {
+		return ver
+	}
+	return DefaultVersion
+}
+
+// genGatherOutput simulates the pod facts gather script. The script echos a
+// YAML key and then runs a command to produce its value. We walk through the
+// script and generate each value from the state of the pod. The caller must
+// hold the lock.
+//
+//nolint:gocyclo
+func (c *Cluster) genGatherOutput(p *Pod, script string) (stdout, stderr string, err error) {
+	var sb strings.Builder
+	echoPattern := regexp.MustCompile(`^echo( -n)?\s+'(.*)'$`)
+	testPattern := regexp.MustCompile(`^test (-[fd]) (\S+) && echo true \|\| echo false$`)
+	catPattern := regexp.MustCompile(`^test -f (\S+) && echo -n '"' && echo -n \$\(cat \S+\)`)
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if m := echoPattern.FindStringSubmatch(line); m != nil {
+			sb.WriteString(m[2])
+			if m[1] == "" {
+				sb.WriteString("\n")
+			}
+			continue
+		}
+		if m := testPattern.FindStringSubmatch(line); m != nil {
+			sb.WriteString(fmt.Sprintf("%t\n", c.testPath(p, []string{"test", m[1], m[2]})))
+			continue
+		}
+		if m := catPattern.FindStringSubmatch(line); m != nil {
+			sb.WriteString(fmt.Sprintf("%q\n", strings.TrimSpace(p.Files[m[1]])))
+			continue
+		}
+		switch {
+		case line == "" || line == "set -o errexit":
+		case strings.HasPrefix(line, "ls ") && strings.Contains(line, "_catalog"):
+			sb.WriteString(fmt.Sprintf("%t\n", p.VNode != ""))
+		case strings.HasPrefix(line, "cd ") && strings.Contains(line, "_catalog"):
+			sb.WriteString(p.VNode + "\n")
+		case strings.Contains(line, "pgrep ^vertica"):
+			sb.WriteString(fmt.Sprintf("%t\n", c.isVerticaRunning(p)))
+		case strings.Contains(line, "Startup Complete"):
+			sb.WriteString(fmt.Sprintf("%t\n", c.isVerticaRunning(p)))
+		case strings.Contains(line, "--output=size"):
+			sb.WriteString(fmt.Sprintf("%d\n", p.LocalDataSize))
+		case strings.Contains(line, "--output=avail"):
+			sb.WriteString(fmt.Sprintf("%d\n", p.LocalDataAvail))
+		case strings.Contains(line, "vertica_agent status"):
+			sb.WriteString(fmt.Sprintf("%t\n", p.AgentRunning))
+		case strings.HasPrefix(line, "ls ") && strings.Contains(line, paths.DBadminAgentPath):
+			// The simulated image never has the agent keys
+			sb.WriteString("false\n")
+		case strings.HasPrefix(line, "ss "):
+			sb.WriteString(fmt.Sprintf("%t\n", p.HTTPServerRunning && c.isVerticaRunning(p)))
+		default:
+			err = fmt.Errorf("simulator does not understand gather script line: %s", line)
+			return "", err.Error(), err
+		}
+	}
+	return sb.String(), "", nil
+}
@@ -0,0 +1,78 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package simulator
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("podrunner", func() {
+	ctx := context.Background()
+
+	It("should only answer vsql queries when vertica is running", func() {
+		c, ips := makeClusterWithPods(3)
+		_, _, err := c.ExecVSQL(ctx, testPodName(0), "server", "vsql", "-c", "select 1")
+		Expect(err).ShouldNot(Succeed())
+
+		createTestDB(ctx, c, ips)
+		pod, ok := c.GetPod(testPodName(0))
+		Expect(ok).Should(BeTrue())
+		stdout, _, err := c.ExecVSQL(ctx, testPodName(0), "server", "vsql", "-tAc",
+			"select n.node_name, node_state from nodes as n where n.node_name = '"+pod.VNode+"'")
+		Expect(err).Should(Succeed())
+		Expect(stdout).Should(Equal(pod.VNode + "|UP|\n"))
+	})
+
+	It("should reject admintools commands", func() {
+		c, _ := makeClusterWithPods(1)
+		_, _, err := c.ExecAdmintools(ctx, testPodName(0), "server", "/opt/vertica/bin/admintools", "-t", "list_allnodes")
+		Expect(err).ShouldNot(Succeed())
+	})
+
+	It("should record each command that was run", func() {
+		c, _ := makeClusterWithPods(1)
+		_, _, err := c.ExecInPod(ctx, testPodName(0), "server", "mkdir", "-p", "/opt/vertica/config")
+		Expect(err).Should(Succeed())
+		Expect(c.FindCommands("mkdir")).Should(HaveLen(1))
+		_, _, err = c.ExecInPod(ctx, testPodName(0), "server", "bash", "-c", "test -d /opt/vertica/config")
+		Expect(err).Should(Succeed())
+
+		c.KillPod(testPodName(0))
+		_, _, err = c.ExecInPod(ctx, testPodName(0), "server", "ls")
+		Expect(err).ShouldNot(Succeed())
+	})
+
+	It("should change the shard count with a reshard", func() {
+		c, ips := makeClusterWithPods(3)
+		createTestDB(ctx, c, ips)
+		const ShardCountSQL = "select count(*) from shards where shard_type != 'Replica'"
+		stdout, _, err := c.ExecVSQL(ctx, testPodName(0), "server", "vsql", "-tAc", ShardCountSQL)
+		Expect(err).Should(Succeed())
+		Expect(stdout).Should(Equal("12\n"))
+
+		_, _, err = c.ExecVSQL(ctx, testPodName(0), "server", "vsql", "-tAc", "select reshard_database(6);")
+		Expect(err).Should(Succeed())
+		stdout, _, err = c.ExecVSQL(ctx, testPodName(0), "server", "vsql", "-tAc", ShardCountSQL)
+		Expect(err).Should(Succeed())
+		Expect(stdout).Should(Equal("6\n"))
+		for _, n := range c.GetNodes() {
+			Expect(n.ShardSubscriptions).Should(Equal(2))
+		}
+	})
+})
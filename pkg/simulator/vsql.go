@@ -0,0 +1,230 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package simulator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	nodeNamePattern       = regexp.MustCompile(`node_name = '([^']+)'`)
+	subclusterNamePattern = regexp.MustCompile(`subcluster_name = '([^']*)'`)
+	setDefaultPattern     = regexp.MustCompile(`alter subcluster "([^"]+)" set default`)
+	rebalancePattern      = regexp.MustCompile(`select rebalance_shards\('([^']*)'\)`)
+	alterDepotPattern     = regexp.MustCompile(`select alter_location_size\('depot', '([^']+)', '([^']+)'\)`)
+	shutdownSCPattern     = regexp.MustCompile(`select shutdown_subcluster\('([^']*)'\)`)
+	reshardPattern        = regexp.MustCompile(`select reshard_database\(([0-9]+)\)`)
+)
+
+// execVSQL will simulate a vsql command. Only the statements the operator
+// issues are understood. Any other statement succeeds with no output. The
+// caller must hold the lock.
+func (c *Cluster) execVSQL(p *Pod, command []string) (stdout, stderr string, err error) {
+	if !c.isVerticaRunning(p) {
+		err = fmt.Errorf("vsql: could not connect to server: Connection refused")
+		return "", err.Error(), err
+	}
+	if len(command) == 0 {
+		return "", "", nil
+	}
+	sql := command[len(command)-1]
+	node := c.db.Nodes[p.VNode]
+	switch {
+	case strings.Contains(sql, "from v_catalog.node_subscriptions"):
+		n, err := c.findNodeInSQL(sql)
+		if err != nil {
+			return "", err.Error(), err
+		}
+		return fmt.Sprintf("%d\n", n.ShardSubscriptions), "", nil
+	case strings.Contains(sql, "from storage_locations") && strings.Contains(sql, "DEPOT"):
+		n, err := c.findNodeInSQL(sql)
+		if err != nil {
+			return "", err.Error(), err
+		}
+		if n.DepotSize == "" {
+			return "", "", nil
+		}
+		return fmt.Sprintf("%d|%s\n", n.DepotMaxSize, n.DepotSize), "", nil
+	case strings.Contains(sql, "from nodes as n"):
+		return c.genNodeStatusOutput(node, sql), "", nil
+	case strings.Contains(sql, "select distinct(subcluster_name) from subclusters"):
+		return c.genSubclusterNamesOutput(), "", nil
+	case strings.Contains(sql, "from subclusters where is_default is true"):
+		for _, sc := range c.db.Subclusters {
+			if sc.IsDefault {
+				return sc.Name + "\n", "", nil
+			}
+		}
+		return "", "", nil
+	case setDefaultPattern.MatchString(sql):
+		return c.setDefaultSubcluster(setDefaultPattern.FindStringSubmatch(sql)[1])
+	case strings.Contains(sql, "from sessions") && strings.Contains(sql, "node_name"):
+		n, err := c.findNodeInSQL(sql)
+		if err != nil {
+			return "", err.Error(), err
+		}
+		return fmt.Sprintf("%d\n", n.Sessions), "", nil
+	case strings.Contains(sql, "from v_monitor.sessions join v_catalog.subclusters"):
+		return c.genSubclusterSessionsOutput(sql), "", nil
+	case rebalancePattern.MatchString(sql):
+		c.rebalanceShards(rebalancePattern.FindStringSubmatch(sql)[1])
+		return "REBALANCED SHARDS\n", "", nil
+	case strings.Contains(sql, "from shards where shard_type != 'Replica'"):
+		return fmt.Sprintf("%d\n", c.db.ShardCount), "", nil
+	case reshardPattern.MatchString(sql):
+		return c.reshardDatabase(reshardPattern.FindStringSubmatch(sql)[1])
+	case alterDepotPattern.MatchString(sql):
+		m := alterDepotPattern.FindStringSubmatch(sql)
+		n, err := c.findNode(m[1])
+		if err != nil {
+			return "", err.Error(), err
+		}
+		n.setDepotSize(m[2], c.pods[n.Pod].LocalDataSize)
+		return "", "", nil
+	case shutdownSCPattern.MatchString(sql):
+		return c.shutdownSubcluster(shutdownSCPattern.FindStringSubmatch(sql)[1])
+	case strings.Contains(sql, "select http_server_ctrl('start'"):
+		p.HTTPServerRunning = true
+		return "", "", nil
+	case strings.Contains(sql, "select revive_instance_id from vs_databases"):
+		return c.db.ReviveInstanceID + "\n", "", nil
+	}
+	return "", "", nil
+}
+
+// findNodeInSQL returns the node named in the where clause of the SQL. The
+// caller must hold the lock.
+func (c *Cluster) findNodeInSQL(sql string) (*Node, error) {
+	m := nodeNamePattern.FindStringSubmatch(sql)
+	if m == nil {
+		return nil, fmt.Errorf("no node name found in sql: %s", sql)
+	}
+	return c.findNode(m[1])
+}
+
+// genNodeStatusOutput generates the output for the node status query that
+// pod facts uses. The caller must hold the lock.
+func (c *Cluster) genNodeStatusOutput(n *Node, sql string) string {
+	scOid := ""
+	if strings.Contains(sql, "subcluster_oid") {
+		if sc, ok := c.db.Subclusters[n.Subcluster]; ok {
+			scOid = fmt.Sprintf("%d", sc.Oid)
+		}
+	}
+	cols := []string{n.Name, n.State, scOid}
+	if strings.Contains(sql, "is_readonly") {
+		readOnly := "f"
+		if n.ReadOnly {
+			readOnly = "t"
+		}
+		cols = append(cols, readOnly)
+	}
+	return strings.Join(cols, "|") + "\n"
+}
+
+// genSubclusterNamesOutput generates the output listing each subcluster. The
+// caller must hold the lock.
+func (c *Cluster) genSubclusterNamesOutput() string {
+	scNames := make([]string, 0, len(c.db.Subclusters))
+	for name := range c.db.Subclusters {
+		scNames = append(scNames, name)
+	}
+	sort.Strings(scNames)
+	var sb strings.Builder
+	for _, name := range scNames {
+		sb.WriteString(name)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// genSubclusterSessionsOutput counts the number of sessions for all nodes in a
+// subcluster. The caller must hold the lock.
+func (c *Cluster) genSubclusterSessionsOutput(sql string) string {
+	m := subclusterNamePattern.FindStringSubmatch(sql)
+	sessions := 0
+	for _, n := range c.db.Nodes {
+		if m != nil && n.Subcluster == m[1] {
+			sessions += n.Sessions
+		}
+	}
+	return fmt.Sprintf("%d\n", sessions)
+}
+
+// setDefaultSubcluster makes the given subcluster the default one. The caller
+// must hold the lock.
+func (c *Cluster) setDefaultSubcluster(scName string) (stdout, stderr string, err error) {
+	if _, ok := c.db.Subclusters[scName]; !ok {
+		err = fmt.Errorf("subcluster %s does not exist", scName)
+		return "", err.Error(), err
+	}
+	for name, sc := range c.db.Subclusters {
+		sc.IsDefault = name == scName
+	}
+	return "ALTER SUBCLUSTER\n", "", nil
+}
+
+// rebalanceShards will evenly distribute the shards to the nodes in the given
+// subcluster. An empty name rebalances every subcluster. The caller must hold
+// the lock.
+func (c *Cluster) rebalanceShards(scName string) {
+	nodesPerSC := map[string][]*Node{}
+	for _, n := range c.db.Nodes {
+		if scName == "" || n.Subcluster == scName {
+			nodesPerSC[n.Subcluster] = append(nodesPerSC[n.Subcluster], n)
+		}
+	}
+	for _, nodes := range nodesPerSC {
+		for _, n := range nodes {
+			n.ShardSubscriptions = (c.db.ShardCount + len(nodes) - 1) / len(nodes)
+		}
+	}
+}
+
+// reshardDatabase will change the number of shards in the database. Like the
+// real reshard, the shards are spread across the nodes of each subcluster. The
+// caller must hold the lock.
+func (c *Cluster) reshardDatabase(shardCountStr string) (stdout, stderr string, err error) {
+	shardCount, err := strconv.Atoi(shardCountStr)
+	if err != nil || shardCount <= 0 {
+		err = fmt.Errorf("invalid shard count: %s", shardCountStr)
+		return "", err.Error(), err
+	}
+	c.db.ShardCount = shardCount
+	c.rebalanceShards("")
+	return "The database has been re-sharded from the old shard count to the new one\n", "", nil
+}
+
+// shutdownSubcluster will bring down all of the nodes in the given subcluster.
+// The pods keep running, like they would in a real cluster. The caller must
+// hold the lock.
+func (c *Cluster) shutdownSubcluster(scName string) (stdout, stderr string, err error) {
+	if _, ok := c.db.Subclusters[scName]; !ok {
+		err = fmt.Errorf("subcluster %s does not exist", scName)
+		return "", err.Error(), err
+	}
+	for _, n := range c.db.Nodes {
+		if n.Subcluster == scName {
+			n.State = StateDown
+			n.ReadOnly = false
+		}
+	}
+	return "Subcluster shutdown\n", "", nil
+}
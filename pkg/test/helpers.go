@@ -62,7 +62,7 @@ func CreateSts(ctx context.Context, c client.Client, vdb *vapi.VerticaDB, sc *va
 		sts = builder.BuildStsSpec(names.GenStsName(vdb, sc), vdb, sc, builder.DefaultDeploymentNames())
 		ExpectWithOffset(offset, c.Create(ctx, sts)).Should(Succeed())
 	}
-	for j := int32(0); j < sc.Size; j++ {
+	for j := int32(0); j < sc.GetStsSize(); j++ {
 		pod := &corev1.Pod{}
 		if err := c.Get(ctx, names.GenPodName(vdb, sc, j), pod); kerrors.IsNotFound(err) {
 			pod = builder.BuildPod(vdb, sc, j)
@@ -79,12 +79,13 @@ func CreateSts(ctx context.Context, c client.Client, vdb *vapi.VerticaDB, sc *va
 			pvc := builder.BuildPVC(vdb, sc, j)
 			ExpectWithOffset(offset, c.Create(ctx, pvc)).Should(Succeed())
 			pvc.Status.Phase = corev1.ClaimBound
+			pvc.Status.Capacity = pvc.Spec.Resources.Requests
 			ExpectWithOffset(offset, c.Status().Update(ctx, pvc)).Should(Succeed())
 		}
 	}
 	// Update the status in the sts to reflect the number of pods we created
-	sts.Status.Replicas = sc.Size
-	sts.Status.ReadyReplicas = sc.Size
+	sts.Status.Replicas = sc.GetStsSize()
+	sts.Status.ReadyReplicas = sc.GetStsSize()
 	ExpectWithOffset(offset, c.Status().Update(ctx, sts))
 }
 
@@ -34,10 +34,20 @@ import (
 
 // logFailure will log and record an event for an admintools failure
 func (a *Admintools) logFailure(cmd, genericFailureReason, op string, err error) (ctrl.Result, error) {
+	a.lastFailureCategory = aterrors.GetFailureCategory(op)
 	evLogr := aterrors.MakeATErrors(a.EVWriter, a.VDB, genericFailureReason)
 	return evLogr.LogFailure(cmd, op, err)
 }
 
+// popFailureCategory returns the failure category of the last admintools
+// command that failed. An empty string is returned if nothing failed since the
+// last call.
+func (a *Admintools) popFailureCategory() string {
+	category := a.lastFailureCategory
+	a.lastFailureCategory = ""
+	return category
+}
+
 // execAdmintools is a wrapper for admintools tools that handles logging of
 // debug information. The stdout and error of the AT call is returned.
 func (a *Admintools) execAdmintools(ctx context.Context, initiatorPod types.NamespacedName, cmd ...string) (string, error) {
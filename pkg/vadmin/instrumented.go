@@ -0,0 +1,181 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vadmin
+
+import (
+	"context"
+	"time"
+
+	vapi "github.com/vertica/vertica-kubernetes/api/v1beta1"
+	"github.com/vertica/vertica-kubernetes/pkg/aterrors"
+	"github.com/vertica/vertica-kubernetes/pkg/metrics"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/addnode"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/addsc"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/createdb"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/describedb"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/fetchnodestate"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/reip"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/removenode"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/removesc"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/restartnode"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/revivedb"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/startdb"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/stopdb"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// The names of the backends that we label the admin command metrics with
+const (
+	AdmintoolsBackend  = "admintools"
+	VClusterOpsBackend = "vclusterops"
+)
+
+// Instrumented is a decorator for a Dispatcher. It forwards each call to the
+// wrapped Dispatcher and records how long it took and whether it failed as
+// prometheus metrics.
+type Instrumented struct {
+	Dispatcher
+	VDB     *vapi.VerticaDB
+	Backend string
+}
+
+// failureCategorizer is implemented by a Dispatcher that can tell us why its
+// last command failed. Some failures are handled by requeueing the reconcile
+// without returning an error, so we can't always get this from the error.
+type failureCategorizer interface {
+	popFailureCategory() string
+}
+
+var _ Dispatcher = &Instrumented{}
+
+// MakeInstrumented will wrap the given dispatcher so that metrics are
+// collected for each admin command.
+func MakeInstrumented(vdb *vapi.VerticaDB, backend string, dispatcher Dispatcher) Dispatcher {
+	return &Instrumented{
+		Dispatcher: dispatcher,
+		VDB:        vdb,
+		Backend:    backend,
+	}
+}
+
+func (i *Instrumented) CreateDB(ctx context.Context, opts ...createdb.Option) (ctrl.Result, error) {
+	start := time.Now()
+	res, err := i.Dispatcher.CreateDB(ctx, opts...)
+	i.observe("CreateDB", start, err)
+	return res, err
+}
+
+func (i *Instrumented) ReviveDB(ctx context.Context, opts ...revivedb.Option) (ctrl.Result, error) {
+	start := time.Now()
+	res, err := i.Dispatcher.ReviveDB(ctx, opts...)
+	i.observe("ReviveDB", start, err)
+	return res, err
+}
+
+func (i *Instrumented) DescribeDB(ctx context.Context, opts ...describedb.Option) (string, ctrl.Result, error) {
+	start := time.Now()
+	op, res, err := i.Dispatcher.DescribeDB(ctx, opts...)
+	i.observe("DescribeDB", start, err)
+	return op, res, err
+}
+
+func (i *Instrumented) FetchNodeState(ctx context.Context, opts ...fetchnodestate.Option) (map[string]string, ctrl.Result, error) {
+	start := time.Now()
+	stateMap, res, err := i.Dispatcher.FetchNodeState(ctx, opts...)
+	i.observe("FetchNodeState", start, err)
+	return stateMap, res, err
+}
+
+func (i *Instrumented) ReIP(ctx context.Context, opts ...reip.Option) (ctrl.Result, error) {
+	start := time.Now()
+	res, err := i.Dispatcher.ReIP(ctx, opts...)
+	i.observe("ReIP", start, err)
+	return res, err
+}
+
+func (i *Instrumented) StopDB(ctx context.Context, opts ...stopdb.Option) error {
+	start := time.Now()
+	err := i.Dispatcher.StopDB(ctx, opts...)
+	i.observe("StopDB", start, err)
+	return err
+}
+
+func (i *Instrumented) AddNode(ctx context.Context, opts ...addnode.Option) error {
+	start := time.Now()
+	err := i.Dispatcher.AddNode(ctx, opts...)
+	i.observe("AddNode", start, err)
+	return err
+}
+
+func (i *Instrumented) AddSubcluster(ctx context.Context, opts ...addsc.Option) error {
+	start := time.Now()
+	err := i.Dispatcher.AddSubcluster(ctx, opts...)
+	i.observe("AddSubcluster", start, err)
+	return err
+}
+
+func (i *Instrumented) RemoveNode(ctx context.Context, opts ...removenode.Option) error {
+	start := time.Now()
+	err := i.Dispatcher.RemoveNode(ctx, opts...)
+	i.observe("RemoveNode", start, err)
+	return err
+}
+
+func (i *Instrumented) RemoveSubcluster(ctx context.Context, opts ...removesc.Option) error {
+	start := time.Now()
+	err := i.Dispatcher.RemoveSubcluster(ctx, opts...)
+	i.observe("RemoveSubcluster", start, err)
+	return err
+}
+
+func (i *Instrumented) RestartNode(ctx context.Context, opts ...restartnode.Option) (ctrl.Result, error) {
+	start := time.Now()
+	res, err := i.Dispatcher.RestartNode(ctx, opts...)
+	i.observe("RestartNode", start, err)
+	return res, err
+}
+
+func (i *Instrumented) StartDB(ctx context.Context, opts ...startdb.Option) (ctrl.Result, error) {
+	start := time.Now()
+	res, err := i.Dispatcher.StartDB(ctx, opts...)
+	i.observe("StartDB", start, err)
+	return res, err
+}
+
+// observe will update the metrics for an admin command that just completed
+func (i *Instrumented) observe(op string, start time.Time, err error) {
+	labels := metrics.MakeAdminCommandLabels(i.VDB, op, i.Backend)
+	metrics.AdminCommandAttempt.With(labels).Inc()
+	metrics.AdminCommandDuration.With(labels).Observe(time.Since(start).Seconds())
+	if category := i.getFailureCategory(err); category != "" {
+		labels[metrics.FailureCategoryLabel] = category
+		metrics.AdminCommandFailed.With(labels).Inc()
+	}
+}
+
+// getFailureCategory returns the category of failure for the command that
+// just ran. An empty string is returned if the command succeeded.
+func (i *Instrumented) getFailureCategory(err error) string {
+	if fc, ok := i.Dispatcher.(failureCategorizer); ok {
+		if category := fc.popFailureCategory(); category != "" {
+			return category
+		}
+	}
+	if err == nil {
+		return ""
+	}
+	return aterrors.GetFailureCategory(err.Error())
+}
@@ -0,0 +1,73 @@
+/*
+ (c) Copyright [2021-2023] Open Text.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ You may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vadmin
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/vertica/vertica-kubernetes/pkg/aterrors"
+	"github.com/vertica/vertica-kubernetes/pkg/cmds"
+	"github.com/vertica/vertica-kubernetes/pkg/metrics"
+	"github.com/vertica/vertica-kubernetes/pkg/names"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/restartnode"
+	"github.com/vertica/vertica-kubernetes/pkg/vadmin/opts/stopdb"
+)
+
+var _ = Describe("instrumented", func() {
+	ctx := context.Background()
+
+	It("should count attempts and categorize failures", func() {
+		at, vdb, fpr := mockAdmintoolsDispatcher()
+		vdb.Name = "instrumented-vdb"
+		dispatcher := MakeInstrumented(vdb, AdmintoolsBackend, at)
+		nm := names.GenPodName(vdb, &vdb.Spec.Subclusters[0], 0)
+		defer metrics.HandleVDBDelete(vdb.Namespace, vdb.Name, logger)
+
+		Ω(dispatcher.StopDB(ctx, stopdb.WithInitiator(nm, "10.8.1.1"))).Should(Succeed())
+		labels := metrics.MakeAdminCommandLabels(vdb, "StopDB", AdmintoolsBackend)
+		Ω(testutil.ToFloat64(metrics.AdminCommandAttempt.With(labels))).Should(Equal(1.0))
+
+		// A disk full error is handled with a requeue, so no error is
+		// returned. It should still be counted as a failure.
+		fpr.Results[nm] = []cmds.CmdResult{
+			{Stdout: "OSError: [Errno 28] No space left on device", Err: fmt.Errorf("restart failed")},
+		}
+		res, err := dispatcher.RestartNode(ctx, restartnode.WithInitiator(nm, "10.8.1.1"),
+			restartnode.WithHost("v_db_node0001", "10.8.1.10"))
+		Ω(err).Should(Succeed())
+		Ω(res.Requeue).Should(BeTrue())
+		labels = metrics.MakeAdminCommandLabels(vdb, "RestartNode", AdmintoolsBackend)
+		Ω(testutil.ToFloat64(metrics.AdminCommandAttempt.With(labels))).Should(Equal(1.0))
+		labels[metrics.FailureCategoryLabel] = aterrors.FailureDiskFull
+		Ω(testutil.ToFloat64(metrics.AdminCommandFailed.With(labels))).Should(Equal(1.0))
+
+		// A successful call after the failure must not be counted as failed
+		_, err = dispatcher.RestartNode(ctx, restartnode.WithInitiator(nm, "10.8.1.1"),
+			restartnode.WithHost("v_db_node0001", "10.8.1.10"))
+		Ω(err).Should(Succeed())
+		Ω(testutil.ToFloat64(metrics.AdminCommandFailed.With(labels))).Should(Equal(1.0))
+
+		fpr.Results[nm] = []cmds.CmdResult{{Err: fmt.Errorf("stop failed")}}
+		Ω(dispatcher.StopDB(ctx, stopdb.WithInitiator(nm, "10.8.1.1"))).ShouldNot(Succeed())
+		labels = metrics.MakeAdminCommandLabels(vdb, "StopDB", AdmintoolsBackend)
+		labels[metrics.FailureCategoryLabel] = aterrors.FailureGeneric
+		Ω(testutil.ToFloat64(metrics.AdminCommandFailed.With(labels))).Should(Equal(1.0))
+	})
+})
@@ -99,6 +99,9 @@ type Admintools struct {
 	EVWriter events.EVWriter
 	VDB      *vapi.VerticaDB
 	DevMode  bool // true to include verbose logging for some operations
+	// The failure category of the last admintools command that failed. This
+	// is reset each time it is read.
+	lastFailureCategory string
 }
 
 // MakeAdmintools will create a dispatcher that uses admintools to call the
@@ -28,6 +28,11 @@ type Parms struct {
 	CommunalStorageParams string
 	ConfigurationParams   map[string]string
 	IgnoreClusterLease    bool
+	// Restore point to revive from. These are only used when
+	// RestorePointArchive is set.
+	RestorePointArchive string
+	RestorePointIndex   int
+	RestorePointID      string
 }
 
 type Option func(*Parms)
@@ -80,3 +85,14 @@ func WithIgnoreClusterLease() Option {
 		s.IgnoreClusterLease = true
 	}
 }
+
+// WithRestorePoint will revive the database from a restore point saved in the
+// given archive. The restore point is identified by either its index or its
+// id. The index is used if it is non-zero.
+func WithRestorePoint(archive string, index int, id string) Option {
+	return func(s *Parms) {
+		s.RestorePointArchive = archive
+		s.RestorePointIndex = index
+		s.RestorePointID = id
+	}
+}
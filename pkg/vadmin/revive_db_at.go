@@ -57,6 +57,14 @@ func (a *Admintools) genReviveCmd(s *revivedb.Parms) []string {
 	if s.IgnoreClusterLease {
 		cmd = append(cmd, "--ignore-cluster-lease")
 	}
+	if s.RestorePointArchive != "" {
+		cmd = append(cmd, "--restore-point-archive="+s.RestorePointArchive)
+		if s.RestorePointIndex != 0 {
+			cmd = append(cmd, fmt.Sprintf("--restore-point-index=%d", s.RestorePointIndex))
+		} else {
+			cmd = append(cmd, "--restore-point-id="+s.RestorePointID)
+		}
+	}
 	return cmd
 }
 
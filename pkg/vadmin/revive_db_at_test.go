@@ -41,6 +41,30 @@ var _ = Describe("revive_db_at", func() {
 		Ω(hist[0].Command).Should(ContainElement("testdb"))
 	})
 
+	It("should pass the restore point to admintools -t revive_db", func() {
+		dispatcher, _, fpr := mockAdmintoolsDispatcher()
+		Ω(dispatcher.ReviveDB(ctx,
+			revivedb.WithCommunalPath("/communal-1"),
+			revivedb.WithDBName("testdb"),
+			revivedb.WithRestorePoint("nightly", 2, ""),
+		)).Should(Equal(ctrl.Result{}))
+		hist := fpr.FindCommands("-t revive_db")
+		Ω(len(hist)).Should(Equal(1))
+		Ω(hist[0].Command).Should(ContainElement("--restore-point-archive=nightly"))
+		Ω(hist[0].Command).Should(ContainElement("--restore-point-index=2"))
+		Ω(hist[0].Command).ShouldNot(ContainElement(ContainSubstring("--restore-point-id")))
+
+		fpr.Histories = nil
+		Ω(dispatcher.ReviveDB(ctx,
+			revivedb.WithCommunalPath("/communal-1"),
+			revivedb.WithDBName("testdb"),
+			revivedb.WithRestorePoint("nightly", 0, "abc-123"),
+		)).Should(Equal(ctrl.Result{}))
+		hist = fpr.FindCommands("-t revive_db")
+		Ω(len(hist)).Should(Equal(1))
+		Ω(hist[0].Command).Should(ContainElement("--restore-point-id=abc-123"))
+	})
+
 	It("should create a non empty auth file", func() {
 		confParms := map[string]string{
 			TestParm: TestValue,
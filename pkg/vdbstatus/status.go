@@ -99,3 +99,17 @@ func UpdateUpgradeStatus(ctx context.Context, clnt client.Client, vdb *vapi.Vert
 		return nil
 	})
 }
+
+// UpdateUpgradeState will update the structured upgrade state.  The state is
+// allocated if it isn't set yet.  The input vdb will be updated with the new
+// state.
+func UpdateUpgradeState(ctx context.Context, clnt client.Client, vdb *vapi.VerticaDB,
+	updateFunc func(*vapi.UpgradeState)) error {
+	return Update(ctx, clnt, vdb, func(vdb *vapi.VerticaDB) error {
+		if vdb.Status.UpgradeState == nil {
+			vdb.Status.UpgradeState = &vapi.UpgradeState{}
+		}
+		updateFunc(vdb.Status.UpgradeState)
+		return nil
+	})
+}
@@ -32,6 +32,9 @@ $KUSTOMIZE build $REPO_DIR/config/default | $KUBERNETES_SPLIT_YAML --outdir $TEM
 mv $TEMPLATE_DIR/verticadbs.vertica.com-crd.yaml $CRD_DIR
 mv $TEMPLATE_DIR/verticaautoscalers.vertica.com-crd.yaml $CRD_DIR
 mv $TEMPLATE_DIR/eventtriggers.vertica.com-crd.yaml $CRD_DIR
+mv $TEMPLATE_DIR/verticabackups.vertica.com-crd.yaml $CRD_DIR
+mv $TEMPLATE_DIR/verticarestores.vertica.com-crd.yaml $CRD_DIR
+mv $TEMPLATE_DIR/verticadboperations.vertica.com-crd.yaml $CRD_DIR
 
 # Delete openshift clusterRole and clusterRoleBinding files
 rm $TEMPLATE_DIR/verticadb-operator-openshift-cluster-role-cr.yaml 
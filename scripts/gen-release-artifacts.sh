@@ -43,7 +43,9 @@ for f in verticadb-operator-metrics-monitor-servicemonitor.yaml \
     verticadb-operator-proxy-rolebinding-crb.yaml \
     verticadb-operator-proxy-role-cr.yaml \
     verticadb-operator-metrics-reader-cr.yaml \
-    verticadb-operator-metrics-reader-crb.yaml
+    verticadb-operator-metrics-reader-crb.yaml \
+    verticadb-operator-node-reader-cr.yaml \
+    verticadb-operator-node-reader-rolebinding-crb.yaml
 do
   cp $MANIFEST_DIR/$f $RELEASE_ARTIFACT_TARGET_DIR
   # Modify the artifact we are copying over by removing any namespace field.
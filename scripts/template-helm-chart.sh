@@ -103,7 +103,9 @@ done
 for f in verticadb-operator-manager-role-role.yaml \
     verticadb-operator-manager-rolebinding-rb.yaml \
     verticadb-operator-leader-election-role-role.yaml \
-    verticadb-operator-leader-election-rolebinding-rb.yaml
+    verticadb-operator-leader-election-rolebinding-rb.yaml \
+    verticadb-operator-node-reader-cr.yaml \
+    verticadb-operator-node-reader-rolebinding-crb.yaml
 do
     perl -i -pe 's/^/{{- if not .Values.skipRoleAndRoleBindingCreation -}}\n/ if 1 .. 1' $TEMPLATE_DIR/$f
     echo "{{- end }}" >> $TEMPLATE_DIR/$f
@@ -112,7 +114,8 @@ for f in verticadb-operator-manager-rolebinding-rb.yaml \
     verticadb-operator-leader-election-rolebinding-rb.yaml \
     verticadb-operator-proxy-rolebinding-crb.yaml \
     verticadb-operator-metrics-reader-crb.yaml \
-    verticadb-operator-manager-clusterrolebinding-crb.yaml
+    verticadb-operator-manager-clusterrolebinding-crb.yaml \
+    verticadb-operator-node-reader-rolebinding-crb.yaml
 do
     perl -i -0777 -pe 's/kind: ServiceAccount\n.*name: .*/kind: ServiceAccount\n  name: {{ include "vdb-op.serviceAccount" . }}/g' $TEMPLATE_DIR/$f
 done
@@ -132,6 +135,10 @@ for f in verticadb-operator-proxy-role-cr.yaml verticadb-operator-proxy-rolebind
 do
     perl -i -0777 -pe 's/-(proxy-role.*)/-{{ .Release.Namespace }}-$1/g' $TEMPLATE_DIR/$f
 done
+for f in verticadb-operator-node-reader-cr.yaml verticadb-operator-node-reader-rolebinding-crb.yaml
+do
+    perl -i -0777 -pe 's/-node-reader/-{{ .Release.Namespace }}-node-reader/g' $TEMPLATE_DIR/$f
+done
 
 # 10.  Template the webhook access enablement
 for f in $TEMPLATE_DIR/verticadb-operator-validating-webhook-configuration-validatingwebhookconfiguration.yaml \